@@ -49,7 +49,7 @@ func TestCommentStore(t *testing.T) {
 
 	go informer.Run(ctx.Done())
 	go store.Run(ctx, informer)
-	go diskStore.Run(ctx, lister, store, false)
+	go diskStore.Run(ctx, store, false)
 
 	klog.Infof("waiting for caches to sync")
 	cache.WaitForCacheSync(ctx.Done(), informer.HasSynced)
@@ -67,12 +67,13 @@ func TestCommentStore(t *testing.T) {
 
 		var missing bool
 		for _, bug := range bugs {
-			comments, ok := store.Get(bug.Info.ID)
-			if !ok || comments.RefreshTime.IsZero() {
+			item, ok := store.Get(bug.Name)
+			if !ok || item.Refreshed().IsZero() {
 				klog.Infof("no comments for %d", bug.Info.ID)
 				missing = true
 				continue
 			}
+			comments := item.(*BugComments)
 			if len(comments.Comments) == 0 {
 				t.Fatalf("bug %d had zero comments: %#v", bug.Info.ID, comments)
 			}
@@ -1,258 +1,102 @@
 package bugzilla
 
 import (
-	"bufio"
-	"bytes"
-	"context"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	"k8s.io/apimachinery/pkg/util/sets"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/util/workqueue"
-	"k8s.io/klog"
-
-	"github.com/openshift/ci-search/walk"
+	"github.com/openshift/ci-search/pkg/tracker"
 )
 
-type CommentDiskStore struct {
-	base   string
-	maxAge time.Duration
-
-	queue workqueue.Interface
+// NewCommentDiskStore saves each bug and its comments to a file named
+// bug-NUMBER under path.
+func NewCommentDiskStore(path string, maxAge time.Duration) *tracker.DiskStore {
+	return tracker.NewDiskStore("comment_disk", diskFormat{}, path, maxAge)
 }
 
-type CommentAccessor interface {
-	Get(id int) (*BugComments, bool)
+// NewCommentDiskStoreReader returns a store that reads the comments saved
+// under path without expiring or removing any files.
+func NewCommentDiskStoreReader(path string) *tracker.DiskStore {
+	return tracker.NewDiskStoreReader(diskFormat{}, path)
 }
 
-func NewCommentDiskStore(path string, maxAge time.Duration) *CommentDiskStore {
-	return &CommentDiskStore{
-		base:   path,
-		maxAge: maxAge,
-		queue:  workqueue.NewNamed("comment_disk"),
-	}
-}
+type diskFormat struct{}
 
-func (s *CommentDiskStore) Run(ctx context.Context, lister *BugLister, store CommentAccessor, disableWrite bool) {
-	defer klog.V(2).Infof("Comment disk worker exited")
-	wait.UntilWithContext(ctx, func(ctx context.Context) {
-		for {
-			obj, done := s.queue.Get()
-			if done {
-				return
-			}
-			if disableWrite {
-				s.queue.Done(obj)
-				return
-			}
-			id, err := strconv.Atoi(obj.(string))
-			if err != nil {
-				s.queue.Done(obj)
-				klog.Errorf("unexpected id in queue: %v", err)
-				continue
-			}
-			comments, ok := store.Get(id)
-			if !ok {
-				s.queue.Done(obj)
-				klog.V(5).Infof("No comments for %d", id)
-				continue
-			}
-			s.queue.Done(obj)
-			bug, err := lister.Get(id)
-			if err != nil {
-				bug = &Bug{ObjectMeta: comments.ObjectMeta, Info: comments.Info}
-			}
-			if err := s.write(bug, comments); err != nil {
-				klog.Errorf("failed to write bug: %v", err)
-			}
-		}
-	}, time.Second)
-}
+func (diskFormat) Prefix() string { return "bug-" }
 
-func (s *CommentDiskStore) NotifyChanged(id int) {
-	s.queue.Add(strconv.Itoa(id))
+func (diskFormat) FileName(item tracker.Item) string {
+	return fmt.Sprintf("bug-%d", item.(*BugComments).Info.ID)
 }
 
-func (s *CommentDiskStore) Sync(keys []string) ([]*BugComments, error) {
-	var known sets.String
-	if keys != nil {
-		known = sets.NewString(keys...)
-	}
-	start := time.Now()
-	mustExpire := s.maxAge != 0
-	expiredAt := start.Add(-s.maxAge)
-	tempExpiredAfter := start.Add(-15 * time.Minute)
-
-	bugs := make([]*BugComments, 0, 2048)
-
-	err := walk.Walk(s.base, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			if os.IsNotExist(err) {
-				return nil
-			}
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-
-		if mustExpire && expiredAt.After(info.ModTime()) {
-			os.Remove(path)
-			klog.V(5).Infof("File expired: %s", path)
-			return nil
-		}
-		relPath, err := filepath.Rel(s.base, path)
-		if err != nil {
-			return err
-		}
-		relPath = filepath.ToSlash(relPath)
-		if strings.HasPrefix(info.Name(), "z-bug-") {
-			if tempExpiredAfter.After(info.ModTime()) {
-				os.Remove(path)
-				klog.V(5).Infof("Temporary file expired: %s", path)
-				return nil
-			}
-			return nil
-		}
-		if !strings.HasPrefix(info.Name(), "bug-") {
-			return nil
-		}
-		idString := info.Name()[4:]
-		id, err := strconv.ParseInt(idString, 10, 64)
-		if err != nil {
-			os.Remove(path)
-			klog.V(5).Infof("File has invalid name: %s", path)
-			return nil
-		}
-
-		if known != nil && !known.Has(idString) {
-			os.Remove(path)
-			klog.V(5).Infof("Bug is not in the known list: %s", path)
-			return nil
-		}
-
-		comments, err := readBugComments(path)
-		if err != nil {
-			return fmt.Errorf("unable to read %q: %v", path, err)
-		}
-		if len(comments.Comments) == 0 {
-			os.Remove(path)
-			klog.V(5).Infof("Bug has no comments: %s", path)
-			return nil
-		}
-		if comments.Name != idString {
-			return fmt.Errorf("file has path %q but ID is %d", path, id)
-		}
-		comments.CreationTimestamp.Time = comments.Comments[0].CreationTime.Time
-		comments.RefreshTime = info.ModTime()
-		bugs = append(bugs, comments)
-		return nil
-	})
-	if err != nil {
-		return nil, err
+func (diskFormat) ItemName(fileName string) (string, error) {
+	idString := strings.TrimPrefix(fileName, "bug-")
+	if _, err := strconv.ParseInt(idString, 10, 64); err != nil {
+		return "", err
 	}
-	return bugs, nil
-}
-
-func (s *CommentDiskStore) DeleteBug(bug *Bug) error {
-	_, path := s.pathForBug(bug)
-	return os.Remove(path)
+	return idString, nil
 }
 
-func (s *CommentDiskStore) CloseBug(bug *BugComments) error {
-
-	clone := bug.DeepCopyObject().(*BugComments)
+func (diskFormat) Closed(item tracker.Item) tracker.Item {
+	clone := item.DeepCopyObject().(*BugComments)
 	clone.Info.Status = "CLOSED"
-	if err := s.write(&Bug{ObjectMeta: clone.ObjectMeta, Info: clone.Info}, clone); err != nil {
-		return fmt.Errorf("could not mark bug %d closed due to write error: %v", clone.Info.ID, err)
-	}
-	return nil
-}
-func (s *CommentDiskStore) pathForBug(bug *Bug) (string, string) {
-	return filepath.Join(s.base, fmt.Sprintf("z-bug-%d", bug.Info.ID)),
-		filepath.Join(s.base, fmt.Sprintf("bug-%d", bug.Info.ID))
+	return clone
 }
 
-func lineSafe(s string) string {
-	return strings.TrimSpace(strings.Replace(s, "\n", " ", -1))
-}
-func arrayLineSafe(arr []string, delim string) string {
-	inputs := make([]string, 0, len(arr))
-	for _, s := range arr {
-		inputs = append(inputs, lineSafe(s))
-	}
-	return strings.Join(inputs, delim)
-}
-
-func (s *CommentDiskStore) write(bug *Bug, comments *BugComments) error {
-	path, finalPath := s.pathForBug(bug)
-
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+func (diskFormat) Read(path string, modTime time.Time) (tracker.Item, error) {
+	comments, err := readBugComments(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	if len(comments.Comments) == 0 {
+		return nil, nil
+	}
+	comments.CreationTimestamp.Time = comments.Comments[0].CreationTime.Time
+	comments.RefreshTime = modTime
+	return comments, nil
+}
 
-	w := bufio.NewWriter(f)
-
+func (diskFormat) Write(w io.Writer, item tracker.Item) error {
+	bug := item.(*BugComments)
 	if _, err := fmt.Fprintf(
 		w,
 		"Bug %d: %s\nStatus: %s %s\nSeverity: %s\nCreator: %s\nAssigned To: %s\nKeywords: %s\nWhiteboard: %s\nInternal Whiteboard: %s\nTarget Release: %s\nVersion: %s\nComponent: %s\nEnvironment:%s\n---\n",
 		bug.Info.ID,
-		lineSafe(bug.Info.Summary),
-		lineSafe(bug.Info.Status),
-		lineSafe(bug.Info.Resolution),
-		lineSafe(bug.Info.Severity),
-		lineSafe(bug.Info.Creator),
-		lineSafe(bug.Info.AssignedTo),
-		arrayLineSafe(bug.Info.Keywords, ", "),
-		lineSafe(bug.Info.Whiteboard),
-		lineSafe(bug.Info.InternalWhiteboard),
-		arrayLineSafe(bug.Info.TargetRelease, ", "),
-		arrayLineSafe(bug.Info.Version, ", "),
-		arrayLineSafe(bug.Info.Component, ", "),
-		lineSafe(strings.ReplaceAll(bug.Info.Environment, "\x0D", "")),
+		tracker.LineSafe(bug.Info.Summary),
+		tracker.LineSafe(bug.Info.Status),
+		tracker.LineSafe(bug.Info.Resolution),
+		tracker.LineSafe(bug.Info.Severity),
+		tracker.LineSafe(bug.Info.Creator),
+		tracker.LineSafe(bug.Info.AssignedTo),
+		tracker.ArrayLineSafe(bug.Info.Keywords, ", "),
+		tracker.LineSafe(bug.Info.Whiteboard),
+		tracker.LineSafe(bug.Info.InternalWhiteboard),
+		tracker.ArrayLineSafe(bug.Info.TargetRelease, ", "),
+		tracker.ArrayLineSafe(bug.Info.Version, ", "),
+		tracker.ArrayLineSafe(bug.Info.Component, ", "),
+		tracker.LineSafe(strings.ReplaceAll(bug.Info.Environment, "\x0D", "")),
 	); err != nil {
-		f.Close()
-		os.Remove(path)
 		return err
 	}
 
-	for _, comment := range comments.Comments {
-		escapedText := strings.ReplaceAll(strings.ReplaceAll(comment.Text, "\x00", " "), "\x1e", " ")
+	for _, comment := range bug.Comments {
+		escapedText := strings.ReplaceAll(strings.ReplaceAll(comment.Text, "\x00", " "), tracker.CommentDelimiter, " ")
 		if _, err := fmt.Fprintf(
 			w,
-			"Comment %d by %s at %s\n%s\n\x1e",
+			"Comment %d by %s at %s\n%s\n%s",
 			comment.ID,
 			strings.TrimSpace(comment.Creator),
-			timeToRV(comment.CreationTime),
+			tracker.TimeToRV(comment.CreationTime),
 			escapedText,
+			tracker.CommentDelimiter,
 		); err != nil {
-			f.Close()
-			os.Remove(path)
 			return err
 		}
 	}
-
-	if err := w.Flush(); err != nil {
-		f.Close()
-		os.Remove(path)
-		return err
-	}
-	if err := f.Close(); err != nil {
-		os.Remove(path)
-		return err
-	}
-	if err := os.Chtimes(path, comments.RefreshTime, comments.RefreshTime); err != nil {
-		os.Remove(path)
-		return err
-	}
-	return os.Rename(path, finalPath)
+	return nil
 }
 
 var (
@@ -260,10 +104,6 @@ var (
 	reDiskCommentsLineCommentHeader = regexp.MustCompile(`^Comment (\d+) by (.+) at (\d\d\d\d-\d\d-\d\dT\d\d:\d\d:\d\dZ)$`)
 )
 
-const (
-	bugCommentDelimiter = "\x1e"
-)
-
 func readBugComments(path string) (*BugComments, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -274,34 +114,7 @@ func readBugComments(path string) (*BugComments, error) {
 	var bug BugComments
 	comments := make([]BugComment, 0, 4)
 
-	// allow lines of up to 4MB
-	delim := []byte(bugCommentDelimiter)
-	br := bufio.NewReader(f)
-	sr := bufio.NewScanner(br)
-	sr.Buffer(make([]byte, 4*1024), 4*1024*1024)
-	phase := 0
-	sr.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		switch phase {
-		case 0, 1:
-			return bufio.ScanLines(data, atEOF)
-		case 2:
-			if atEOF && len(data) == 0 {
-				return 0, nil, nil
-			}
-			if i := bytes.Index(data, delim); i >= 0 {
-				// We have a full comment
-				return i + len(delim), data[0:i], nil
-			}
-			// If we're at EOF, we have a final, non-terminated line. Return it.
-			if atEOF {
-				return len(data), data, nil
-			}
-			// Request more data.
-			return 0, nil, nil
-		default:
-			return 0, nil, fmt.Errorf("unrecognized phase %d", phase)
-		}
-	})
+	sr := tracker.NewScanner(f)
 
 	// PHASE 0: Header
 	if !sr.Scan() {
@@ -403,7 +216,7 @@ ScanHeader:
 		return nil, fmt.Errorf("%s: unable to read stored bug: no body separator", path)
 	}
 
-	phase = 1
+	phase := 1
 	var comment BugComment
 	for sr.Scan() {
 		switch phase {
@@ -426,6 +239,7 @@ ScanHeader:
 			comment.Time = comment.CreationTime
 
 			phase = 2
+			sr.ScanComments()
 
 		case 2:
 			comment.Text = strings.TrimSuffix(sr.Text(), "\n")
@@ -433,6 +247,7 @@ ScanHeader:
 			comment = BugComment{}
 
 			phase = 1
+			sr.ScanLines()
 
 		default:
 			return nil, fmt.Errorf("%s: programmer error, unexpected phase %d", path, phase)
@@ -3,6 +3,7 @@ package bugzilla
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -19,24 +20,7 @@ func TestCommentDiskStore_write(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	s := &CommentDiskStore{
-		base: dir,
-	}
-	bug := &Bug{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: "181",
-		},
-		Info: BugInfo{
-			ID:            181,
-			Status:        "CLOSED",
-			Resolution:    "WORKSFORME",
-			Severity:      "urgent",
-			Summary:       "Test bug",
-			Creator:       "Katherine Johnson",
-			Version:       []string{"4.8"},
-			TargetRelease: []string{"---"},
-		},
-	}
+	s := NewCommentDiskStore(dir, 0)
 	comments := &BugComments{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:              "181",
@@ -99,10 +83,10 @@ func TestCommentDiskStore_write(t *testing.T) {
 		},
 	}
 
-	if err := s.write(bug, comments); err != nil {
+	if err := s.Write(comments); err != nil {
 		t.Fatal(err)
 	}
-	tempPath, path := s.pathForBug(bug)
+	tempPath, path := filepath.Join(dir, "z-bug-181"), s.Path(comments)
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		t.Fatal(err)
@@ -128,7 +112,7 @@ func TestCommentDiskStore_write(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(list) != 1 || len(list[0].Comments) != len(comments.Comments) {
+	if len(list) != 1 || len(list[0].(*BugComments).Comments) != len(comments.Comments) {
 		t.Fatalf("%#v", list)
 	}
 }
@@ -11,6 +11,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/openshift/ci-search/pkg/tracker"
 )
 
 type BugList struct {
@@ -144,7 +146,7 @@ func NewBug(info *BugInfo) *Bug {
 			Name:              strconv.Itoa(info.ID),
 			UID:               types.UID(strconv.Itoa(info.ID)),
 			CreationTimestamp: info.CreationTime,
-			ResourceVersion:   timeToRV(info.LastChangeTime),
+			ResourceVersion:   tracker.TimeToRV(info.LastChangeTime),
 		},
 		Info: *info,
 	}
@@ -171,15 +173,10 @@ func setFieldsFromBugComments(bug *BugComments) *BugComments {
 		}
 	}
 	bug.CreationTimestamp.Time = oldest
-	bug.ResourceVersion = timeToRV(metav1.Time{Time: newest})
+	bug.ResourceVersion = tracker.TimeToRV(metav1.Time{Time: newest})
 	return bug
 }
 
-func timeToRV(t metav1.Time) string {
-	s, _ := t.MarshalQueryParameter()
-	return s
-}
-
 func NewBugList(bugs *BugInfoList, includeFn func(*BugInfo) bool) *BugList {
 	var change time.Time
 	items := make([]Bug, 0, len(bugs.Bugs))
@@ -195,14 +192,14 @@ func NewBugList(bugs *BugInfoList, includeFn func(*BugInfo) bool) *BugList {
 				Name:              strconv.Itoa(info.ID),
 				UID:               types.UID(strconv.Itoa(info.ID)),
 				CreationTimestamp: info.CreationTime,
-				ResourceVersion:   timeToRV(info.LastChangeTime),
+				ResourceVersion:   tracker.TimeToRV(info.LastChangeTime),
 			},
 			Info: info,
 		})
 	}
 	list := &BugList{Items: items}
 	if !change.IsZero() {
-		list.ResourceVersion = timeToRV(metav1.Time{Time: change})
+		list.ResourceVersion = tracker.TimeToRV(metav1.Time{Time: change})
 	}
 	return list
 }
@@ -223,6 +220,11 @@ func (b BugComments) DeepCopyObject() runtime.Object {
 	return &copied
 }
 
+// Refreshed returns when the comments of the bug were last fetched.
+func (b *BugComments) Refreshed() time.Time {
+	return b.RefreshTime
+}
+
 func (b *BugList) DeepCopyObject() runtime.Object {
 	copied := *b
 	if b.Items != nil {
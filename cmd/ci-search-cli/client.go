@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+// searchOptions are the parameters of a search, encoded as the server parses
+// them into an Index.
+type searchOptions struct {
+	Search      []string
+	Query       string
+	SearchType  string
+	IncludeName string
+	ExcludeName string
+	MaxAge      time.Duration
+	From        string
+	To          string
+	MaxMatches  int
+	Context     int
+	GroupByJob  bool
+}
+
+// Values returns the query parameters for the search.
+func (o *searchOptions) Values() url.Values {
+	v := make(url.Values)
+	if len(o.Query) > 0 {
+		v.Set("query", o.Query)
+	} else {
+		v["search"] = o.Search
+	}
+	if len(o.SearchType) > 0 {
+		v.Set("type", o.SearchType)
+	}
+	if len(o.IncludeName) > 0 {
+		v.Set("name", o.IncludeName)
+	}
+	if len(o.ExcludeName) > 0 {
+		v.Set("excludeName", o.ExcludeName)
+	}
+	if o.MaxAge > 0 {
+		v.Set("maxAge", o.MaxAge.String())
+	}
+	if len(o.From) > 0 {
+		v.Set("from", o.From)
+	}
+	if len(o.To) > 0 {
+		v.Set("to", o.To)
+	}
+	if o.MaxMatches > 0 {
+		v.Set("maxMatches", strconv.Itoa(o.MaxMatches))
+	}
+	v.Set("context", strconv.Itoa(o.Context))
+	if o.GroupByJob {
+		v.Set("groupBy", "job")
+	} else {
+		v.Set("groupBy", "none")
+	}
+	return v
+}
+
+// Match is a single match returned by the /v2/search API.
+type Match struct {
+	Name         string    `json:"name,omitempty"`
+	LastModified time.Time `json:"lastModified"`
+	FileType     string    `json:"filename"`
+	Context      []string  `json:"context,omitempty"`
+	MoreLines    int       `json:"moreLines,omitempty"`
+	URL          string    `json:"url,omitempty"`
+}
+
+type searchResponseResult struct {
+	Matches []*Match `json:"matches,omitempty"`
+}
+
+type searchResponse struct {
+	Results       map[string]searchResponseResult `json:"results"`
+	NextPageToken string                          `json:"nextPageToken,omitempty"`
+}
+
+// client calls the search server at base.
+type client struct {
+	base   *url.URL
+	client *http.Client
+}
+
+func newClient(server string, timeout time.Duration) (*client, error) {
+	base, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("--server is not a valid URL: %v", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("--server must be an http or https URL")
+	}
+	return &client{base: base, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// URL returns the URL of path on the server with the given parameters.
+func (c *client) URL(path string, values url.Values) *url.URL {
+	u := *c.base
+	u.Path = strings.TrimSuffix(c.base.Path, "/") + path
+	u.RawQuery = values.Encode()
+	return &u
+}
+
+// get requests path and returns the body of a successful response, which the
+// caller must close.
+func (c *client) get(path string, values url.Values) (io.ReadCloser, error) {
+	u := c.URL(path, values)
+	resp, err := c.client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		if retry := resp.Header.Get("Retry-After"); len(retry) > 0 {
+			return nil, fmt.Errorf("%s: server is busy, retry after %s seconds", u.Path, retry)
+		}
+		return nil, fmt.Errorf("%s: %s: %s", u.Path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return resp.Body, nil
+}
+
+func (c *client) getJSON(path string, values url.Values, into interface{}) error {
+	body, err := c.get(path, values)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(into); err != nil {
+		return fmt.Errorf("%s: unable to decode response: %v", path, err)
+	}
+	return nil
+}
+
+// Search returns the matches for each search, following pages of results if
+// pageSize is set.
+func (c *client) Search(opts *searchOptions, pageSize int) (map[string][]*Match, error) {
+	values := opts.Values()
+	if pageSize > 0 {
+		values.Set("pageSize", strconv.Itoa(pageSize))
+	}
+	results := make(map[string][]*Match)
+	for {
+		var response searchResponse
+		if err := c.getJSON("/v2/search", values, &response); err != nil {
+			return nil, err
+		}
+		for search, result := range response.Results {
+			results[search] = append(results[search], result.Matches...)
+		}
+		if len(response.NextPageToken) == 0 {
+			return results, nil
+		}
+		values.Set("pageToken", response.NextPageToken)
+	}
+}
+
+// Jobs returns the jobs known to the server.
+func (c *client) Jobs() ([]*prow.Job, error) {
+	var list prow.JobList
+	if err := c.getJSON("/jobs", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// Chart writes the chart of the jobs matching opts as a PNG to w.
+func (c *client) Chart(opts *searchOptions, w io.Writer) error {
+	body, err := c.get("/chart.png", opts.Values())
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = io.Copy(w, body)
+	return err
+}
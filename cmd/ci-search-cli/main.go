@@ -0,0 +1,238 @@
+// Command ci-search-cli runs searches against a ci-search server from a
+// terminal or a script.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// exitThreshold is the exit code when a search matches more runs than allowed
+// by --fail-over, to distinguish it from a failed search.
+const exitThreshold = 2
+
+// thresholdError is returned when a search matches too many runs.
+type thresholdError struct {
+	runs, threshold int
+}
+
+func (e *thresholdError) Error() string {
+	return fmt.Sprintf("%d runs matched, more than the allowed %d", e.runs, e.threshold)
+}
+
+type options struct {
+	Server  string
+	Timeout time.Duration
+	Output  string
+
+	search searchOptions
+
+	PageSize int
+	Open     bool
+	FailOver int
+	File     string
+
+	out io.Writer
+}
+
+func main() {
+	opt := &options{
+		Server:   "https://search.ci.openshift.org",
+		Timeout:  5 * time.Minute,
+		Output:   "table",
+		PageSize: 500,
+		FailOver: -1,
+		File:     "chart.png",
+		search: searchOptions{
+			MaxAge: 2 * 24 * time.Hour,
+		},
+		out: os.Stdout,
+	}
+
+	cmd := &cobra.Command{
+		Use:           "ci-search-cli",
+		Short:         "Search OpenShift CI job failures, bugs and issues",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.PersistentFlags().StringVar(&opt.Server, "server", opt.Server, "The URL of the search server.")
+	cmd.PersistentFlags().DurationVar(&opt.Timeout, "timeout", opt.Timeout, "How long to wait for each response from the server.")
+	cmd.PersistentFlags().StringVarP(&opt.Output, "output", "o", opt.Output, "The output format: 'table', 'json' or 'csv'.")
+
+	searchCmd := &cobra.Command{
+		Use:   "search REGEX...",
+		Short: "Print the job runs that match one or more regular expressions",
+		RunE: func(cmd *cobra.Command, arguments []string) error {
+			opt.search.Search = arguments
+			return opt.Search()
+		},
+	}
+	addSearchFlags(searchCmd, opt)
+	searchCmd.Flags().StringVar(&opt.search.Query, "query", opt.search.Query, "A query combining several terms with AND, OR and NOT instead of regular expression arguments.")
+	searchCmd.Flags().IntVar(&opt.search.MaxMatches, "max-matches", opt.search.MaxMatches, "The number of matches to return per file.")
+	searchCmd.Flags().IntVar(&opt.search.Context, "context", opt.search.Context, "The number of lines before and after each match to return.")
+	searchCmd.Flags().BoolVar(&opt.search.GroupByJob, "group-by-job", opt.search.GroupByJob, "Print the number of matched runs of each job instead of each run.")
+	searchCmd.Flags().IntVar(&opt.PageSize, "page-size", opt.PageSize, "The number of files to request at a time. Set to 0 to request all results at once.")
+	searchCmd.Flags().BoolVar(&opt.Open, "open", opt.Open, "Print only the URL of each matched run, one per line.")
+	searchCmd.Flags().IntVar(&opt.FailOver, "fail-over", opt.FailOver, "Exit with code 2 if more than this many runs match. Set to -1 to disable.")
+
+	jobsCmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "Print the jobs known to the server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, arguments []string) error {
+			return opt.Jobs()
+		},
+	}
+	jobsCmd.Flags().StringVar(&opt.search.IncludeName, "name", opt.search.IncludeName, "A regular expression that job names must match.")
+	jobsCmd.Flags().StringVar(&opt.search.ExcludeName, "exclude-name", opt.search.ExcludeName, "A regular expression that job names must not match.")
+
+	chartCmd := &cobra.Command{
+		Use:   "chart REGEX...",
+		Short: "Save a chart of the job runs that match one or more regular expressions",
+		RunE: func(cmd *cobra.Command, arguments []string) error {
+			opt.search.Search = arguments
+			return opt.Chart()
+		},
+	}
+	addSearchFlags(chartCmd, opt)
+	chartCmd.Flags().StringVar(&opt.File, "file", opt.File, "The file to write the PNG chart to.")
+
+	cmd.AddCommand(searchCmd, jobsCmd, chartCmd)
+
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		if _, ok := err.(*thresholdError); ok {
+			os.Exit(exitThreshold)
+		}
+		os.Exit(1)
+	}
+}
+
+func addSearchFlags(cmd *cobra.Command, opt *options) {
+	flag := cmd.Flags()
+	flag.StringVar(&opt.search.SearchType, "type", opt.search.SearchType, "The type of results to search: 'bug', 'issue', 'junit', 'build-log', 'all' or a combination such as 'bug+junit'.")
+	flag.StringVar(&opt.search.IncludeName, "name", opt.search.IncludeName, "A regular expression that job names must match.")
+	flag.StringVar(&opt.search.ExcludeName, "exclude-name", opt.search.ExcludeName, "A regular expression that job names must not match.")
+	flag.DurationVar(&opt.search.MaxAge, "max-age", opt.search.MaxAge, "How far back to search for jobs.")
+	flag.StringVar(&opt.search.From, "from", opt.search.From, "Only include jobs that failed after this RFC3339 time or duration ago, instead of --max-age.")
+	flag.StringVar(&opt.search.To, "to", opt.search.To, "Only include jobs that failed before this RFC3339 time or duration ago.")
+}
+
+func (o *options) validateSearch() error {
+	if len(o.search.Search) == 0 && len(o.search.Query) == 0 {
+		return fmt.Errorf("at least one regular expression or --query is required")
+	}
+	if len(o.search.Search) > 0 && len(o.search.Query) > 0 {
+		return fmt.Errorf("regular expressions may not be combined with --query")
+	}
+	for _, search := range o.search.Search {
+		if _, err := regexp.Compile(search); err != nil {
+			return fmt.Errorf("%q is an invalid regular expression: %v", search, err)
+		}
+	}
+	return nil
+}
+
+// Search prints the runs matching the search and fails if there are more than
+// allowed.
+func (o *options) Search() error {
+	if err := o.validateSearch(); err != nil {
+		return err
+	}
+	c, err := newClient(o.Server, o.Timeout)
+	if err != nil {
+		return err
+	}
+	results, err := c.Search(&o.search, o.PageSize)
+	if err != nil {
+		return err
+	}
+
+	runs := matchedRuns(results)
+	now := time.Now()
+	switch {
+	case o.Open:
+		for _, run := range runs {
+			fmt.Fprintln(o.out, run.URL)
+		}
+	case o.search.GroupByJob:
+		err = printTable(o.out, o.Output, jobsTable(runs, now), results)
+	default:
+		err = printTable(o.out, o.Output, runsTable(runs, now), results)
+	}
+	if err != nil {
+		return err
+	}
+
+	if o.FailOver >= 0 && len(runs) > o.FailOver {
+		return &thresholdError{runs: len(runs), threshold: o.FailOver}
+	}
+	return nil
+}
+
+// Jobs prints the jobs known to the server whose names match the filters.
+func (o *options) Jobs() error {
+	var include, exclude *regexp.Regexp
+	var err error
+	if len(o.search.IncludeName) > 0 {
+		if include, err = regexp.Compile(o.search.IncludeName); err != nil {
+			return fmt.Errorf("--name is an invalid regular expression: %v", err)
+		}
+	}
+	if len(o.search.ExcludeName) > 0 {
+		if exclude, err = regexp.Compile(o.search.ExcludeName); err != nil {
+			return fmt.Errorf("--exclude-name is an invalid regular expression: %v", err)
+		}
+	}
+	c, err := newClient(o.Server, o.Timeout)
+	if err != nil {
+		return err
+	}
+	all, err := c.Jobs()
+	if err != nil {
+		return err
+	}
+	jobs := all[:0]
+	for _, job := range all {
+		if include != nil && !include.MatchString(job.Spec.Job) {
+			continue
+		}
+		if exclude != nil && exclude.MatchString(job.Spec.Job) {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return printTable(o.out, o.Output, prowJobsTable(jobs, time.Now()), jobs)
+}
+
+// Chart saves the chart of the runs matching the search and prints the URL of
+// the interactive chart.
+func (o *options) Chart() error {
+	if err := o.validateSearch(); err != nil {
+		return err
+	}
+	c, err := newClient(o.Server, o.Timeout)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(o.File)
+	if err != nil {
+		return err
+	}
+	if err := c.Chart(&o.search, f); err != nil {
+		f.Close()
+		os.Remove(o.File)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.out, "Wrote %s, view the chart at %s\n", o.File, c.URL("/chart", o.search.Values()))
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_options_Search(t *testing.T) {
+	now := time.Now()
+	pages := map[string]searchResponse{
+		"": {
+			Results: map[string]searchResponseResult{
+				"timeout": {Matches: []*Match{
+					{Name: "job-a", URL: "https://prow/job-a/2", FileType: "junit", LastModified: now.Add(-time.Hour), Context: []string{"timeout waiting"}},
+					{Name: "job-a", URL: "https://prow/job-a/1", FileType: "junit", LastModified: now.Add(-2 * time.Hour), Context: []string{"timeout waiting"}},
+				}},
+			},
+			NextPageToken: "next",
+		},
+		"next": {
+			Results: map[string]searchResponseResult{
+				"timeout": {Matches: []*Match{
+					{Name: "job-b", URL: "https://prow/job-b/1", FileType: "build-log", LastModified: now.Add(-3 * time.Hour), Context: []string{"timeout dialing"}},
+				}},
+			},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/search" || req.FormValue("search") != "timeout" || req.FormValue("name") != "job-" || req.FormValue("pageSize") != "2" {
+			http.Error(w, "unexpected request "+req.URL.String(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(pages[req.FormValue("pageToken")])
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		opt      options
+		want     []string
+		wantRuns int
+	}{
+		{
+			name: "table",
+			opt:  options{Output: "table"},
+			want: []string{"JOB    AGE", "job-a  1h0m0s ago  junit      https://prow/job-a/2  timeout waiting", "job-b  3h0m0s ago  build-log  https://prow/job-b/1  timeout dialing"},
+		},
+		{
+			name: "csv grouped by job",
+			opt:  options{Output: "csv", search: searchOptions{GroupByJob: true}},
+			want: []string{"JOB,RUNS,LAST,URL", "job-a,2,1h0m0s ago,https://prow/job-a/2", "job-b,1,3h0m0s ago,https://prow/job-b/1"},
+		},
+		{
+			name: "open",
+			opt:  options{Open: true},
+			want: []string{"https://prow/job-a/2\nhttps://prow/job-a/1\nhttps://prow/job-b/1\n"},
+		},
+		{
+			name:     "over the threshold",
+			opt:      options{Open: true, FailOver: 2},
+			wantRuns: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			opt := tt.opt
+			opt.Server, opt.Timeout, opt.PageSize, opt.out = server.URL, time.Minute, 2, out
+			if opt.FailOver == 0 {
+				opt.FailOver = -1
+			}
+			opt.search.Search = []string{"timeout"}
+			opt.search.IncludeName = "job-"
+			err := opt.Search()
+			if tt.wantRuns > 0 {
+				if threshold, ok := err.(*thresholdError); !ok || threshold.runs != tt.wantRuns {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output does not contain %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
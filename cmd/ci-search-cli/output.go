@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+// table is the rows of a result with their column headers, so that every
+// result can be printed in each of the output formats.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+// printTable writes t to w in the given format, or value instead if the
+// format is JSON.
+func printTable(w io.Writer, format string, t table, value interface{}) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(value)
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(t.headers); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(t.rows); err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.headers, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("--output must be one of 'table', 'json' or 'csv'")
+	}
+}
+
+// matchedRun is a job run that matched at least one search.
+type matchedRun struct {
+	URL          string
+	Job          string
+	FileType     string
+	LastModified time.Time
+	Searches     []string
+	Line         string
+}
+
+// matchedRuns returns the distinct runs in results, most recent first.
+func matchedRuns(results map[string][]*Match) []*matchedRun {
+	byURL := make(map[string]*matchedRun)
+	searches := make([]string, 0, len(results))
+	for search := range results {
+		searches = append(searches, search)
+	}
+	sort.Strings(searches)
+	for _, search := range searches {
+		for _, match := range results[search] {
+			run, ok := byURL[match.URL]
+			if !ok {
+				run = &matchedRun{URL: match.URL, Job: match.Name, FileType: match.FileType, LastModified: match.LastModified}
+				if len(match.Context) > 0 {
+					run.Line = strings.TrimSpace(match.Context[len(match.Context)/2])
+				}
+				byURL[match.URL] = run
+			}
+			if l := len(run.Searches); l == 0 || run.Searches[l-1] != search {
+				run.Searches = append(run.Searches, search)
+			}
+			if match.LastModified.After(run.LastModified) {
+				run.LastModified = match.LastModified
+			}
+		}
+	}
+	runs := make([]*matchedRun, 0, len(byURL))
+	for _, run := range byURL {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].LastModified.Equal(runs[j].LastModified) {
+			return runs[i].LastModified.After(runs[j].LastModified)
+		}
+		return runs[i].URL < runs[j].URL
+	})
+	return runs
+}
+
+// runsTable lists each matched run.
+func runsTable(runs []*matchedRun, now time.Time) table {
+	t := table{headers: []string{"JOB", "AGE", "TYPE", "URL", "MATCH"}}
+	for _, run := range runs {
+		t.rows = append(t.rows, []string{run.Job, formatAge(run.LastModified, now), run.FileType, run.URL, run.Line})
+	}
+	return t
+}
+
+// jobsTable lists the number of matched runs of each job, most matched first.
+func jobsTable(runs []*matchedRun, now time.Time) table {
+	type job struct {
+		name string
+		runs int
+		last *matchedRun
+	}
+	byName := make(map[string]*job)
+	var jobs []*job
+	for _, run := range runs {
+		j, ok := byName[run.Job]
+		if !ok {
+			j = &job{name: run.Job, last: run}
+			byName[run.Job] = j
+			jobs = append(jobs, j)
+		}
+		j.runs++
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].runs > jobs[j].runs })
+	t := table{headers: []string{"JOB", "RUNS", "LAST", "URL"}}
+	for _, j := range jobs {
+		t.rows = append(t.rows, []string{j.name, strconv.Itoa(j.runs), formatAge(j.last.LastModified, now), j.last.URL})
+	}
+	return t
+}
+
+// prowJobsTable lists the jobs known to the server.
+func prowJobsTable(jobs []*prow.Job, now time.Time) table {
+	t := table{headers: []string{"JOB", "STATE", "STARTED", "DURATION", "URL"}}
+	for _, job := range jobs {
+		var duration string
+		if !job.Status.CompletionTime.IsZero() && !job.Status.StartTime.IsZero() {
+			duration = job.Status.CompletionTime.Sub(job.Status.StartTime.Time).Round(time.Second).String()
+		}
+		t.rows = append(t.rows, []string{job.Spec.Job, job.Status.State, formatAge(job.Status.StartTime.Time, now), duration, job.Status.URL})
+	}
+	return t
+}
+
+func formatAge(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return now.Sub(t).Round(time.Minute).String() + " ago"
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcpoption "google.golang.org/api/option"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+// backfillOptions are the parameters of the backfill command, named after its
+// flags.
+type backfillOptions struct {
+	From     string
+	To       string
+	JobRegex string
+	Workers  int
+}
+
+// backfillProgressInterval is the number of runs between progress reports.
+const backfillProgressInterval = 100
+
+// RunBackfill downloads the runs in the job index of --index-bucket that
+// finished between --from and --to into --path, reporting progress and the
+// runs that failed to w.
+func (o *options) RunBackfill(w io.Writer) error {
+	if err := o.setupPaths(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if len(o.Backfill.From) == 0 {
+		return fmt.Errorf("--from is required")
+	}
+	from, err := parseTime(o.Backfill.From, now)
+	if err != nil {
+		return fmt.Errorf("--from %v", err)
+	}
+	to := now
+	if len(o.Backfill.To) > 0 {
+		if to, err = parseTime(o.Backfill.To, now); err != nil {
+			return fmt.Errorf("--to %v", err)
+		}
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("--from must be before --to")
+	}
+	var jobRegex *regexp.Regexp
+	if len(o.Backfill.JobRegex) > 0 {
+		if jobRegex, err = regexp.Compile(o.Backfill.JobRegex); err != nil {
+			return fmt.Errorf("--job-regex is invalid: %v", err)
+		}
+	}
+	if o.Backfill.Workers < 1 {
+		return fmt.Errorf("--workers must be at least 1")
+	}
+
+	ctx := context.Background()
+	gcsClient, err := storage.NewClient(ctx, gcpoption.WithoutAuthentication())
+	if err != nil {
+		return fmt.Errorf("unable to build gcs client: %v", err)
+	}
+	sources, err := prow.NewArtifactSources(gcsClient, o.artifactSources)
+	if err != nil {
+		return fmt.Errorf("unable to build artifact sources: %v", err)
+	}
+	// runs older than --max-age of the server are expired by it, not here
+	store := prow.NewDiskStore(sources, o.jobsPath, 0, o.artifacts)
+
+	statusURL := *o.jobURIPrefix
+	statusURL.Path, statusURL.RawQuery = "", ""
+
+	start := time.Now()
+	var scanned, matched int
+	var scanErr error
+	jobs := make(chan *prow.Job)
+	go func() {
+		defer close(jobs)
+		scanErr = prow.EachJobInIndex(ctx, gcsClient, o.IndexBucket, "job-state", from, to, statusURL, func(job *prow.Job) error {
+			scanned++
+			if jobRegex != nil && !jobRegex.MatchString(job.Spec.Job) {
+				return nil
+			}
+			matched++
+			jobs <- job
+			return nil
+		})
+	}()
+
+	var done int
+	var failed []string
+	fmt.Fprintf(w, "Backfilling runs that finished from %s to %s\n", from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	store.Backfill(ctx, jobs, o.Backfill.Workers, func(job *prow.Job, err error) {
+		done++
+		if err != nil {
+			klog.Errorf("Unable to backfill %s: %v", job.Status.URL, err)
+			failed = append(failed, job.Status.URL)
+		}
+		if done%backfillProgressInterval == 0 {
+			fmt.Fprintf(w, "%d runs downloaded, %d failed, %s elapsed\n", done, len(failed), time.Since(start).Truncate(time.Second))
+		}
+	})
+	if scanErr != nil {
+		return fmt.Errorf("unable to read the job index: %v", scanErr)
+	}
+
+	fmt.Fprintf(w, "Downloaded %d of %d matching runs (%d scanned) in %s, %d failed\n", done-len(failed), matched, scanned, time.Since(start).Truncate(time.Second), len(failed))
+	for _, url := range failed {
+		fmt.Fprintf(w, "  failed: %s\n", url)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d runs could not be downloaded, run the backfill again to retry them", len(failed))
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// resultCacheTTL bounds how long a result is kept even if the searched files do
+// not change.
+const resultCacheTTL = 30 * time.Minute
+
+// maxCachedPageSize is the largest rendered page of matches that is cached.
+const maxCachedPageSize = 4 * 1024 * 1024
+
+// resultCache holds the results of recent searches so that repeated queries do
+// not search the files again. Callers include the generation of the searched
+// files in the key so that results are not reused after the files change. A
+// nil cache caches nothing.
+type resultCache struct {
+	cache *cache.LRUExpireCache
+
+	lock     sync.Mutex
+	inflight map[string]*inflightResult
+}
+
+type cachedResult struct {
+	value   interface{}
+	created time.Time
+}
+
+type inflightResult struct {
+	done   chan struct{}
+	result cachedResult
+	err    error
+}
+
+// newResultCache returns a cache of up to size results, or nil if size is not
+// positive.
+func newResultCache(size int) *resultCache {
+	if size <= 0 {
+		return nil
+	}
+	return &resultCache{
+		cache:    cache.NewLRUExpireCache(size),
+		inflight: make(map[string]*inflightResult),
+	}
+}
+
+// Lookup returns the value cached for key and the time it was computed.
+func (c *resultCache) Lookup(key string) (interface{}, time.Time, bool) {
+	if c == nil {
+		return nil, time.Time{}, false
+	}
+	obj, ok := c.cache.Get(key)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	result := obj.(cachedResult)
+	return result.value, result.created, true
+}
+
+// Add caches value for key as computed at created.
+func (c *resultCache) Add(key string, value interface{}, created time.Time) {
+	if c == nil {
+		return
+	}
+	c.cache.Add(key, cachedResult{value: value, created: created}, resultCacheTTL)
+}
+
+// Get returns the value cached for key or invokes fn to compute and cache it.
+// Concurrent callers for the same key wait for a single invocation of fn. Hit
+// is true if the value was not computed by fn in this call. Errors are not
+// cached.
+func (c *resultCache) Get(ctx context.Context, key string, fn func() (interface{}, error)) (value interface{}, created time.Time, hit bool, err error) {
+	if c == nil {
+		value, err := fn()
+		return value, time.Now(), false, err
+	}
+
+	c.lock.Lock()
+	if value, created, ok := c.Lookup(key); ok {
+		c.lock.Unlock()
+		return value, created, true, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.lock.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, time.Time{}, false, ctx.Err()
+		}
+		if call.err == nil {
+			return call.result.value, call.result.created, true, nil
+		}
+		// the other caller may have failed for its own reasons, such as a closed
+		// connection, so search again without waiting for anyone else
+		value, err := fn()
+		return value, time.Now(), false, err
+	}
+	call := &inflightResult{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.lock.Unlock()
+
+	start := time.Now()
+	value, err = fn()
+	call.result, call.err = cachedResult{value: value, created: start}, err
+
+	c.lock.Lock()
+	delete(c.inflight, key)
+	if err == nil {
+		c.Add(key, value, start)
+	}
+	c.lock.Unlock()
+	close(call.done)
+
+	return value, start, false, err
+}
+
+// SetHeaders reports on the response whether the result was served from the
+// cache and its age in seconds.
+func (c *resultCache) SetHeaders(w http.ResponseWriter, hit bool, created time.Time) {
+	if c == nil {
+		return
+	}
+	if hit {
+		w.Header().Set("X-Cache", "hit")
+		w.Header().Set("Age", strconv.Itoa(int(time.Since(created).Seconds())))
+		return
+	}
+	w.Header().Set("X-Cache", "miss")
+	w.Header().Set("Age", "0")
+}
+
+// cacheKey returns the key for a result of kind for index. It changes when any
+// of the files the index searches are added, removed or reloaded.
+func (o *options) cacheKey(kind string, index *Index) string {
+	var generations []string
+	var jobs bool
+	for _, source := range o.sources() {
+		if !source.Searched(index.SearchType) {
+			continue
+		}
+		if s, ok := source.(jobSource); ok {
+			// runs are added continuously, so only those the index searches count
+			jobs = true
+			generations = append(generations, strconv.FormatUint(s.GenerationFor(index), 10))
+			continue
+		}
+		generations = append(generations, strconv.FormatUint(source.Generation(), 10))
+	}
+	// job results are annotated with the bugs and issues that reference them
+	var known uint64
+	if jobs {
+		known = o.knownIssues.Generation()
+	}
+	// relative bounds are resolved to a different time by each request, so
+	// the parameters they were given as identify a repeated search
+	query := index.Query()
+	if len(index.relativeFrom) > 0 {
+		query.Set("from", index.relativeFrom)
+	}
+	if len(index.relativeTo) > 0 {
+		query.Set("to", index.relativeTo)
+	}
+	if index.Fields != nil && len(index.Fields.relativeUpdatedSince) > 0 {
+		query.Set("updatedSince", index.Fields.relativeUpdatedSince)
+	}
+	return fmt.Sprintf("%s/%s/%d/%s", kind, strings.Join(generations, "/"), known, query.Encode())
+}
+
+// cachedSearchResult returns the result of searchResult for index from the cache
+// if possible.
+func (o *options) cachedSearchResult(w http.ResponseWriter, req *http.Request, index *Index) (map[string]map[string][]*Match, error) {
+	value, created, hit, err := o.results.Get(req.Context(), o.cacheKey("result", index), func() (interface{}, error) {
+		var result map[string]map[string][]*Match
+		err := o.scheduler.Run(req.Context(), func(ctx context.Context) error {
+			var err error
+			result, err = o.searchResult(ctx, index)
+			return err
+		})
+		return result, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	o.results.SetHeaders(w, hit, created)
+	return value.(map[string]map[string][]*Match), nil
+}
+
+// renderedMatches is the HTML rendered for a page of matches.
+type renderedMatches struct {
+	data  []byte
+	count int
+}
+
+// cappedBuffer keeps everything written to it until more than limit bytes are
+// written, after which it discards its contents and ignores further writes.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflow {
+		return len(p), nil
+	}
+	if b.Len()+len(p) > b.limit {
+		b.overflow = true
+		b.Reset()
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
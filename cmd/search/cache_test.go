@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_resultCache(t *testing.T) {
+	c := newResultCache(2)
+	var calls int
+	fn := func() (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	ctx := context.Background()
+
+	if value, _, hit, err := c.Get(ctx, "a", fn); err != nil || hit || value != 1 {
+		t.Fatalf("unexpected first result: %v %t %v", value, hit, err)
+	}
+	if value, _, hit, err := c.Get(ctx, "a", fn); err != nil || !hit || value != 1 {
+		t.Fatalf("unexpected cached result: %v %t %v", value, hit, err)
+	}
+	if value, _, hit, err := c.Get(ctx, "b", fn); err != nil || hit || value != 2 {
+		t.Fatalf("unexpected result for a new key: %v %t %v", value, hit, err)
+	}
+
+	// errors are not cached
+	failed := fmt.Errorf("failed")
+	if _, _, _, err := c.Get(ctx, "c", func() (interface{}, error) { return nil, failed }); err != failed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, ok := c.Lookup("c"); ok {
+		t.Fatalf("failed results should not be cached")
+	}
+
+	// a nil cache always invokes fn
+	var disabled *resultCache
+	for i := 0; i < 2; i++ {
+		if _, _, hit, _ := disabled.Get(ctx, "a", fn); hit {
+			t.Fatalf("a nil cache should not return cached results")
+		}
+	}
+	if calls != 4 {
+		t.Fatalf("unexpected number of calls: %d", calls)
+	}
+}
+
+func Test_resultCache_concurrent(t *testing.T) {
+	c := newResultCache(1)
+	release := make(chan struct{})
+	var lock sync.Mutex
+	var calls int
+	fn := func() (interface{}, error) {
+		lock.Lock()
+		calls++
+		lock.Unlock()
+		<-release
+		return "result", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, _, _, err := c.Get(context.Background(), "key", fn); err != nil || value != "result" {
+				t.Errorf("unexpected result: %v %v", value, err)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+	if calls < 1 || calls > 5 {
+		t.Fatalf("unexpected number of calls: %d", calls)
+	}
+	if _, _, ok := c.Lookup("key"); !ok {
+		t.Fatalf("expected the result to be cached")
+	}
+}
+
+func Test_options_cacheKey_pathChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	write := func(path string, age time.Duration) string {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("error: timed out\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("bucket/logs/job-a/1/junit.failures", time.Hour)
+
+	index := &pathIndex{base: dir, baseURI: &url.URL{}, maxAge: 24 * time.Hour}
+	if err := index.Load(); err != nil {
+		t.Fatal(err)
+	}
+	o := &options{jobsIndex: index, results: newResultCache(10)}
+	search := &Index{
+		Search:     []string{"timed out"},
+		SearchType: "junit",
+		MaxAge:     6 * time.Hour,
+		JobFilter:  func(name string) bool { return name == "job-a" },
+	}
+	key := o.cacheKey("result", search)
+	o.results.Add(key, "cached", now)
+
+	// runs of other jobs and runs older than the window do not affect the search
+	index.Notify([]string{
+		write("bucket/logs/job-b/2/junit.failures", time.Hour),
+		write("bucket/logs/job-a/3/junit.failures", 12*time.Hour),
+	})
+	index.flush()
+	if _, _, ok := o.results.Lookup(o.cacheKey("result", search)); !ok {
+		t.Fatalf("expected the cached result to be kept after unrelated runs were added")
+	}
+
+	index.Notify([]string{write("bucket/logs/job-a/4/junit.failures", time.Minute)})
+	index.flush()
+	if _, _, ok := o.results.Lookup(o.cacheKey("result", search)); ok {
+		t.Fatalf("expected the cached result to be invalidated by a run the search includes")
+	}
+
+	// a walk may change any path
+	key = o.cacheKey("result", search)
+	if err := index.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if o.cacheKey("result", search) == key {
+		t.Fatalf("expected the key to change after the index was reloaded")
+	}
+}
+
+func Test_options_cacheKey_relativeWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cachekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	index := &pathIndex{base: dir, baseURI: &url.URL{}, maxAge: 24 * time.Hour}
+	if err := index.Load(); err != nil {
+		t.Fatal(err)
+	}
+	o := &options{jobsIndex: index, results: newResultCache(10)}
+	parse := func(query string) *Index {
+		search, err := parseRequest(httptest.NewRequest("GET", "/?"+query, nil), "text", 24*time.Hour, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return search
+	}
+
+	search := parse("search=timeout&type=junit&from=6h&to=1h")
+	o.results.Add(o.cacheKey("result", search), "cached", time.Now())
+
+	// the same search repeated later resolves to a later window
+	later := parse("search=timeout&type=junit&from=6h&to=1h")
+	later.From, later.To = later.From.Add(time.Minute), later.To.Add(time.Minute)
+	if _, _, ok := o.results.Lookup(o.cacheKey("result", later)); !ok {
+		t.Fatalf("expected a repeated search with a relative window to hit the cache")
+	}
+
+	absolute := url.Values{"search": {"timeout"}, "type": {"junit"}, "from": {search.From.UTC().Format(time.RFC3339)}, "to": {search.To.UTC().Format(time.RFC3339)}}
+	if o.cacheKey("result", parse(absolute.Encode())) == o.cacheKey("result", search) {
+		t.Fatalf("expected an absolute window to be cached separately")
+	}
+}
+
+func Test_cappedBuffer(t *testing.T) {
+	b := &cappedBuffer{limit: 4}
+	fmt.Fprint(b, "abc")
+	if b.overflow || b.String() != "abc" {
+		t.Fatalf("unexpected buffer: %q %t", b.String(), b.overflow)
+	}
+	if n, err := b.Write([]byte("de")); n != 2 || err != nil {
+		t.Fatalf("writes past the limit should succeed: %d %v", n, err)
+	}
+	if !b.overflow || b.Len() != 0 {
+		t.Fatalf("expected buffer to overflow: %q %t", b.String(), b.overflow)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/pkg/httpwriter"
+	"github.com/openshift/ci-search/pkg/signature"
+)
+
+// maxClusterExamples is the number of recent runs reported for each cluster.
+const maxClusterExamples = 5
+
+// maxClusterWindows bounds the number of time windows a request may ask for.
+const maxClusterWindows = 400
+
+// defaultClusterSearch selects the build log lines clustered when no search is
+// given.
+const defaultClusterSearch = `\b(error|Error|ERROR|fail|failed|Failed|FAILED)\b`
+
+// ClusterJob is the number of runs of a job a signature was seen in.
+type ClusterJob struct {
+	Name string `json:"name"`
+	Runs int    `json:"runs"`
+}
+
+// ClusterWindow is the number of runs a signature was seen in that finished
+// within the window starting at Start.
+type ClusterWindow struct {
+	Start metav1.Time `json:"start"`
+	Runs  int         `json:"runs"`
+}
+
+// ClusterExample is a run a signature was seen in.
+type ClusterExample struct {
+	URL  string      `json:"url"`
+	Job  string      `json:"job"`
+	Time metav1.Time `json:"time"`
+	// Text is the failing test or the matched line before it was normalized.
+	Text string `json:"text"`
+}
+
+// SignatureCluster groups the failures that normalize to the same signature.
+type SignatureCluster struct {
+	Signature string `json:"signature"`
+	// Runs is the number of runs the signature was seen in.
+	Runs      int              `json:"runs"`
+	Jobs      []ClusterJob     `json:"jobs"`
+	Windows   []ClusterWindow  `json:"windows"`
+	FirstSeen metav1.Time      `json:"firstSeen"`
+	LastSeen  metav1.Time      `json:"lastSeen"`
+	Examples  []ClusterExample `json:"examples"`
+}
+
+// ClustersResponse lists the largest clusters of failures.
+type ClustersResponse struct {
+	// Runs is the number of runs that were considered.
+	Runs int `json:"runs"`
+	// Interval is the width of each window.
+	Interval string             `json:"interval"`
+	Clusters []SignatureCluster `json:"clusters"`
+}
+
+// signatureClusterer groups failures by signature, counting each run at most
+// once per signature.
+type signatureClusterer struct {
+	interval time.Duration
+	runs     map[string]struct{}
+	clusters map[string]*signatureCluster
+}
+
+type signatureCluster struct {
+	runs    map[string]ClusterExample
+	jobs    map[string]int
+	windows map[int64]int
+	first   time.Time
+	last    time.Time
+}
+
+func newSignatureClusterer(interval time.Duration) *signatureClusterer {
+	return &signatureClusterer{
+		interval: interval,
+		runs:     make(map[string]struct{}),
+		clusters: make(map[string]*signatureCluster),
+	}
+}
+
+// AddRun records that a run was considered even if it had no failures.
+func (c *signatureClusterer) AddRun(uri string) {
+	c.runs[uri] = struct{}{}
+}
+
+// Add records that the run at uri of job failed with signature at the given
+// time. Text is kept as an example of the failure.
+func (c *signatureClusterer) Add(sig, job, uri string, at time.Time, text string) {
+	c.AddRun(uri)
+	if len(sig) == 0 {
+		return
+	}
+	cluster, ok := c.clusters[sig]
+	if !ok {
+		cluster = &signatureCluster{
+			runs:    make(map[string]ClusterExample),
+			jobs:    make(map[string]int),
+			windows: make(map[int64]int),
+		}
+		c.clusters[sig] = cluster
+	}
+	if _, ok := cluster.runs[uri]; ok {
+		return
+	}
+	cluster.runs[uri] = ClusterExample{URL: uri, Job: job, Time: metav1.Time{Time: at}, Text: text}
+	cluster.jobs[job]++
+	cluster.windows[at.Truncate(c.interval).Unix()]++
+	if cluster.first.IsZero() || at.Before(cluster.first) {
+		cluster.first = at
+	}
+	if at.After(cluster.last) {
+		cluster.last = at
+	}
+}
+
+// Result returns up to limit clusters seen in the most runs.
+func (c *signatureClusterer) Result(limit int) ClustersResponse {
+	response := ClustersResponse{
+		Runs:     len(c.runs),
+		Interval: c.interval.String(),
+		Clusters: make([]SignatureCluster, 0, len(c.clusters)),
+	}
+	for sig, cluster := range c.clusters {
+		response.Clusters = append(response.Clusters, SignatureCluster{
+			Signature: sig,
+			Runs:      len(cluster.runs),
+			FirstSeen: metav1.Time{Time: cluster.first},
+			LastSeen:  metav1.Time{Time: cluster.last},
+		})
+	}
+	sort.Slice(response.Clusters, func(i, j int) bool {
+		a, b := response.Clusters[i], response.Clusters[j]
+		if a.Runs != b.Runs {
+			return a.Runs > b.Runs
+		}
+		return a.Signature < b.Signature
+	})
+	if limit > 0 && len(response.Clusters) > limit {
+		response.Clusters = response.Clusters[:limit]
+	}
+
+	// only the reported clusters need their details sorted
+	for i := range response.Clusters {
+		result := &response.Clusters[i]
+		cluster := c.clusters[result.Signature]
+
+		result.Jobs = make([]ClusterJob, 0, len(cluster.jobs))
+		for name, runs := range cluster.jobs {
+			result.Jobs = append(result.Jobs, ClusterJob{Name: name, Runs: runs})
+		}
+		sort.Slice(result.Jobs, func(i, j int) bool {
+			a, b := result.Jobs[i], result.Jobs[j]
+			if a.Runs != b.Runs {
+				return a.Runs > b.Runs
+			}
+			return a.Name < b.Name
+		})
+
+		result.Windows = make([]ClusterWindow, 0, len(cluster.windows))
+		for start, runs := range cluster.windows {
+			result.Windows = append(result.Windows, ClusterWindow{Start: metav1.Time{Time: time.Unix(start, 0).UTC()}, Runs: runs})
+		}
+		sort.Slice(result.Windows, func(i, j int) bool { return result.Windows[i].Start.Before(&result.Windows[j].Start) })
+
+		result.Examples = make([]ClusterExample, 0, len(cluster.runs))
+		for _, example := range cluster.runs {
+			result.Examples = append(result.Examples, example)
+		}
+		sort.Slice(result.Examples, func(i, j int) bool {
+			a, b := result.Examples[i], result.Examples[j]
+			if !a.Time.Equal(&b.Time) {
+				return b.Time.Before(&a.Time)
+			}
+			return a.URL < b.URL
+		})
+		if len(result.Examples) > maxClusterExamples {
+			result.Examples = result.Examples[:maxClusterExamples]
+		}
+	}
+	return response
+}
+
+// Clusters groups the failed tests recorded for runs that finished between
+// from and to by the signature of their failure message.
+func (t *testFailureIndex) Clusters(from, to time.Time, jobFilter func(string) bool, interval time.Duration, limit int) ClustersResponse {
+	clusterer := newSignatureClusterer(interval)
+	for _, run := range t.Runs(from, to, jobFilter) {
+		clusterer.AddRun(run.uri)
+		for _, failure := range run.failures {
+			text := failure.Name
+			if len(failure.Suite) > 0 {
+				text = failure.Suite + "." + failure.Name
+			}
+			clusterer.Add(failure.Signature, run.job, run.uri, run.at, text)
+		}
+	}
+	return clusterer.Result(limit)
+}
+
+// searchClusters groups the lines matched by index in job runs by their
+// signature.
+func (o *options) searchClusters(ctx context.Context, index *Index, interval time.Duration, limit int) (ClustersResponse, error) {
+	// every matched line is clustered on its own
+	copied := *index
+	copied.Context = 0
+	if copied.MaxMatches == 0 {
+		copied.MaxMatches = 20
+	}
+	result, err := o.orderedSearchResults(ctx, &copied)
+	if err != nil {
+		return ClustersResponse{}, err
+	}
+	clusterer := newSignatureClusterer(interval)
+	for _, job := range result.Jobs {
+		for _, instance := range job.Instances {
+			uri := instance.URI.String()
+			clusterer.AddRun(uri)
+			for _, match := range instance.Matches {
+				for _, line := range match.Context {
+					clusterer.Add(signature.Normalize(line), job.Name, uri, match.LastModified.Time, line)
+				}
+			}
+		}
+	}
+	return clusterer.Result(limit), nil
+}
+
+// parseClustersRequest returns the index, window width and limit of a request
+// for failure clusters.
+func parseClustersRequest(req *http.Request, maxAge time.Duration, rules artifactRules) (*Index, time.Duration, int, error) {
+	index, err := parseRequest(req, "clusters", maxAge, rules)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	limit, err := parseLimit(req, 25)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	interval := 24 * time.Hour
+	if value := req.FormValue("interval"); len(value) > 0 {
+		interval, err = time.ParseDuration(value)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("interval is an invalid duration: %v", err)
+		}
+		if interval < time.Minute {
+			return nil, 0, 0, fmt.Errorf("interval must be at least one minute")
+		}
+	}
+	if from, to := index.Window(time.Now()); !from.IsZero() && to.Sub(from)/interval > maxClusterWindows {
+		return nil, 0, 0, fmt.Errorf("interval must divide the searched time range into at most %d windows", maxClusterWindows)
+	}
+	if len(index.Search) == 0 && index.SearchType == "build-log" {
+		index.Search = []string{defaultClusterSearch}
+	}
+	return index, interval, limit, nil
+}
+
+func (o *options) handleClusters(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		klog.Infof("Render clusters %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	var err error
+	var interval time.Duration
+	var limit int
+	index, interval, limit, err = parseClustersRequest(req, o.MaxAge, o.artifacts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var result ClustersResponse
+	if len(index.Search) == 0 {
+		// without a search the failed tests recorded for each run are clustered
+		from, to := index.Window(start)
+		result = o.testFailures.Clusters(from, to, index.JobFilter, interval, limit)
+	} else {
+		key := o.cacheKey(fmt.Sprintf("clusters/%s/%d", interval, limit), index)
+		value, created, hit, err := o.results.Get(req.Context(), key, func() (interface{}, error) {
+			var result ClustersResponse
+			err := o.scheduler.Run(req.Context(), func(ctx context.Context) error {
+				var err error
+				result, err = o.searchClusters(ctx, index, interval, limit)
+				return err
+			})
+			return result, err
+		})
+		if err != nil {
+			searchFailed(w, err, http.StatusInternalServerError)
+			return
+		}
+		o.results.SetHeaders(w, hit, created)
+		result = value.(ClustersResponse)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to serialize result: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	if _, err = writer.Write(data); err != nil {
+		klog.Errorf("Failed to write response: %v", err)
+		return
+	}
+
+	success = true
+}
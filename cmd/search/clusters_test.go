@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_signatureClusterer(t *testing.T) {
+	day := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	c := newSignatureClusterer(24 * time.Hour)
+	c.Add("timeout after <duration>", "job-1", "run-1", day.Add(time.Hour), "timeout after 1s")
+	// a signature is counted once per run
+	c.Add("timeout after <duration>", "job-1", "run-1", day.Add(time.Hour), "timeout after 2s")
+	c.Add("timeout after <duration>", "job-1", "run-2", day.Add(25*time.Hour), "timeout after 3s")
+	c.Add("timeout after <duration>", "job-2", "run-3", day.Add(26*time.Hour), "timeout after 4s")
+	c.Add("expected <n>", "job-2", "run-3", day.Add(26*time.Hour), "expected 1")
+	c.Add("", "job-2", "run-4", day.Add(26*time.Hour), "")
+	c.AddRun("run-5")
+
+	result := c.Result(10)
+	if result.Runs != 5 || result.Interval != "24h0m0s" || len(result.Clusters) != 2 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+	top := result.Clusters[0]
+	if top.Signature != "timeout after <duration>" || top.Runs != 3 {
+		t.Fatalf("unexpected top cluster: %#v", top)
+	}
+	if len(top.Jobs) != 2 || top.Jobs[0].Name != "job-1" || top.Jobs[0].Runs != 2 || top.Jobs[1].Runs != 1 {
+		t.Errorf("unexpected jobs: %#v", top.Jobs)
+	}
+	if len(top.Windows) != 2 || !top.Windows[0].Start.Time.Equal(day) || top.Windows[0].Runs != 1 || top.Windows[1].Runs != 2 {
+		t.Errorf("unexpected windows: %#v", top.Windows)
+	}
+	if !top.FirstSeen.Time.Equal(day.Add(time.Hour)) || !top.LastSeen.Time.Equal(day.Add(26*time.Hour)) {
+		t.Errorf("unexpected first and last seen: %v %v", top.FirstSeen, top.LastSeen)
+	}
+	if len(top.Examples) != 3 || top.Examples[0].URL != "run-3" || top.Examples[2].Text != "timeout after 1s" {
+		t.Errorf("unexpected examples: %#v", top.Examples)
+	}
+
+	if result := c.Result(1); len(result.Clusters) != 1 || result.Clusters[0].Runs != 3 {
+		t.Errorf("unexpected limited result: %#v", result)
+	}
+}
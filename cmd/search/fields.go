@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TrackerFields are the fields of a bug or issue that searches may filter on.
+type TrackerFields struct {
+	Status        string
+	Components    []string
+	TargetRelease []string
+	// Assignees identify the assignees by login, email or name.
+	Assignees []string
+	Updated   time.Time
+}
+
+// FieldFilter restricts the bugs and issues a search returns by their fields.
+// Every condition that is set must match, and each condition lists the values
+// it accepts, compared without case. Job results are not filtered.
+type FieldFilter struct {
+	Status        []string
+	Component     []string
+	TargetRelease []string
+	Assignee      []string
+	// UpdatedSince excludes items that were last updated before it.
+	UpdatedSince time.Time
+	// relativeUpdatedSince is the updatedSince parameter if it is relative to
+	// the time of the request.
+	relativeUpdatedSince string
+}
+
+// parseFieldFilter returns the filter described by the parameters of form, or
+// nil if none are set. Each parameter may be repeated or list values separated
+// by commas.
+func parseFieldFilter(form url.Values, now time.Time) (*FieldFilter, error) {
+	values := func(name string) []string {
+		var arr []string
+		for _, value := range form[name] {
+			for _, s := range strings.Split(value, ",") {
+				if s = strings.TrimSpace(s); len(s) > 0 {
+					arr = append(arr, s)
+				}
+			}
+		}
+		return arr
+	}
+	filter := &FieldFilter{
+		Status:        values("bugStatus"),
+		Component:     values("component"),
+		TargetRelease: values("targetRelease"),
+		Assignee:      values("assignee"),
+	}
+	if value := form.Get("updatedSince"); len(value) > 0 {
+		t, err := parseTime(value, now)
+		if err != nil {
+			return nil, fmt.Errorf("updatedSince is invalid: %v", err)
+		}
+		filter.UpdatedSince = t
+		if isRelativeTime(value) {
+			filter.relativeUpdatedSince = value
+		}
+	}
+	if len(filter.Status) == 0 && len(filter.Component) == 0 && len(filter.TargetRelease) == 0 && len(filter.Assignee) == 0 && filter.UpdatedSince.IsZero() {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// Values adds the parameters of the filter to v.
+func (f *FieldFilter) Values(v url.Values) {
+	if f == nil {
+		return
+	}
+	for name, values := range map[string][]string{"bugStatus": f.Status, "component": f.Component, "targetRelease": f.TargetRelease, "assignee": f.Assignee} {
+		if len(values) > 0 {
+			v.Set(name, strings.Join(values, ","))
+		}
+	}
+	if !f.UpdatedSince.IsZero() {
+		v.Set("updatedSince", f.UpdatedSince.UTC().Format(time.RFC3339))
+	}
+}
+
+func (f *FieldFilter) String() string {
+	v := make(url.Values)
+	f.Values(v)
+	return v.Encode()
+}
+
+// Matches returns true if fields satisfy every condition of the filter. Items
+// whose fields are unknown only match an empty filter.
+func (f *FieldFilter) Matches(fields *TrackerFields) bool {
+	if f == nil {
+		return true
+	}
+	if fields == nil {
+		return false
+	}
+	if len(f.Status) > 0 && !containsFold(f.Status, fields.Status) {
+		return false
+	}
+	if len(f.Component) > 0 && !containsAnyFold(f.Component, fields.Components) {
+		return false
+	}
+	if len(f.TargetRelease) > 0 && !containsAnyFold(f.TargetRelease, fields.TargetRelease) {
+		return false
+	}
+	if len(f.Assignee) > 0 {
+		var matched bool
+		for _, assignee := range fields.Assignees {
+			// an email also matches by the name before the domain
+			if containsFold(f.Assignee, assignee) || (strings.Contains(assignee, "@") && containsFold(f.Assignee, assignee[:strings.Index(assignee, "@")])) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if !f.UpdatedSince.IsZero() && fields.Updated.Before(f.UpdatedSince) {
+		return false
+	}
+	return true
+}
+
+func containsFold(arr []string, s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, value := range arr {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnyFold(arr []string, values []string) bool {
+	for _, s := range values {
+		if containsFold(arr, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldPaths returns the paths of the files of the items of tracker whose
+// fields match filter, so that only those are searched.
+func (o *options) fieldPaths(tracker trackerSource, filter *FieldFilter) []string {
+	var paths []string
+	tracker.Fields(func(name string, fields *TrackerFields) {
+		if !filter.Matches(fields) {
+			return
+		}
+		path := filepath.Join(o.Path, tracker.Dir(), name)
+		// items are held in memory before their files are written
+		if _, err := os.Stat(path); err != nil {
+			return
+		}
+		paths = append(paths, path)
+	})
+	return paths
+}
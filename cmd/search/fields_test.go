@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/ci-search/bugzilla"
+)
+
+func Test_FieldFilter_Matches(t *testing.T) {
+	now := time.Now()
+	fields := &TrackerFields{
+		Status:        "ASSIGNED",
+		Components:    []string{"Etcd"},
+		TargetRelease: []string{"4.12.0"},
+		Assignees:     []string{"jdoe@redhat.com"},
+		Updated:       now.Add(-time.Hour),
+	}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: "", want: true},
+		{query: "bugStatus=NEW,assigned", want: true},
+		{query: "bugStatus=NEW", want: false},
+		{query: "bugStatus=ASSIGNED&component=etcd&targetRelease=4.12.0", want: true},
+		{query: "component=Networking", want: false},
+		{query: "assignee=jdoe", want: true},
+		{query: "assignee=jdoe@redhat.com", want: true},
+		{query: "assignee=doe", want: false},
+		{query: "updatedSince=2h", want: true},
+		{query: "updatedSince=30m", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			form, _ := url.ParseQuery(tt.query)
+			filter, err := parseFieldFilter(form, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (filter == nil) != (len(tt.query) == 0) {
+				t.Fatalf("unexpected filter: %#v", filter)
+			}
+			if got := filter.Matches(fields); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+			if filter != nil && filter.Matches(nil) {
+				t.Errorf("unknown fields must not match")
+			}
+		})
+	}
+	if _, err := parseFieldFilter(url.Values{"updatedSince": {"yesterday"}}, now); err == nil {
+		t.Errorf("expected an invalid time to be rejected")
+	}
+}
+
+func Test_options_SearchPaths_fields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "bugs"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	bug := func(id int, status, component string) *bugzilla.BugComments {
+		if err := ioutil.WriteFile(filepath.Join(dir, "bugs", "bug-"+strconv.Itoa(id)), []byte("timed out\n"), 0640); err != nil {
+			t.Fatal(err)
+		}
+		return &bugzilla.BugComments{
+			ObjectMeta: metav1.ObjectMeta{Name: strconv.Itoa(id)},
+			Info:       bugzilla.BugInfo{ID: id, Status: status, Component: []string{component}},
+		}
+	}
+	bugs := bugzilla.NewCommentStore(nil, 0, false, fakeBugStore{
+		bug(1, "NEW", "Etcd"),
+		bug(2, "CLOSED", "Etcd"),
+		bug(3, "NEW", "Networking"),
+	})
+	if err := bugs.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &options{Path: dir, BugzillaURL: "https://bugzilla.redhat.com"}
+	if err := o.setupPaths(); err != nil {
+		t.Fatal(err)
+	}
+	o.trackers[0].(*bugzillaSource).store = bugs
+
+	index := &Index{SearchType: "bug", Fields: &FieldFilter{Status: []string{"new"}, Component: []string{"etcd"}}}
+	paths, err := o.SearchPaths(index, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "bugs", "bug-1")}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+	args, paths, err := o.RipgrepSourceArguments(index, nil)
+	if err != nil || len(args) > 0 || len(paths) != 1 {
+		t.Errorf("unexpected ripgrep arguments %v %v: %v", args, paths, err)
+	}
+
+	// matches are checked again against the fields in memory
+	var matched []string
+	fn := querySearcher{resolver: o}.filterFields(index.Fields, func(name string, search string, lines []bytes.Buffer, moreLines int) error {
+		matched = append(matched, name)
+		return nil
+	})
+	for _, name := range []string{"bugs/bug-1", "bugs/bug-2", "bugs/bug-4"} {
+		if err := fn(name, "timed out", nil, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"bugs/bug-1"}; !reflect.DeepEqual(matched, want) {
+		t.Errorf("got %v, want %v", matched, want)
+	}
+}
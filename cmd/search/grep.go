@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os/exec"
 	"path/filepath"
 	"runtime"
@@ -22,6 +23,9 @@ var ErrMaxBytes = fmt.Errorf("reached maximum search length, more results not sh
 
 type CommandGenerator interface {
 	Command(index *Index, search string, jobNames sets.String) (cmd string, args []string, paths []string, err error)
+	// SearchCommand returns a command that prints every line selected by index that
+	// matches any of searches, along with its context, as ripgrep JSON messages.
+	SearchCommand(index *Index, searches []string, jobNames sets.String) (cmd string, args []string, paths []string, err error)
 	PathPrefix() string
 }
 
@@ -31,13 +35,52 @@ type RipgrepSourceArguments interface {
 	RipgrepSourceArguments(*Index, sets.String) (args []string, paths []string, err error)
 }
 
+// CandidateFilter discards the paths that cannot contain a match for search.
+type CandidateFilter interface {
+	Candidates(search string, paths []string) []string
+}
+
 type ripgrepGenerator struct {
 	execPath   string
 	searchPath string
 	arguments  RipgrepSourceArguments
+	filter     CandidateFilter
 }
 
 func (g ripgrepGenerator) Command(index *Index, search string, jobNames sets.String) (string, []string, []string, error) {
+	args := g.searchArgs(index, search)
+	newArgs, paths, err := g.arguments.RipgrepSourceArguments(index, jobNames)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if g.filter != nil {
+		paths = g.filter.Candidates(search, paths)
+	}
+	return g.execPath, append(args, newArgs...), paths, nil
+}
+
+func (g ripgrepGenerator) SearchCommand(index *Index, searches []string, jobNames sets.String) (string, []string, []string, error) {
+	// case is ignored for all searches and no maximum count is set, since neither
+	// smart case nor the count can be applied to each search separately. The
+	// caller assigns each line to the searches that match it.
+	args := []string{g.execPath, "-a", "-z", "-u", "-i", "--json"}
+	if index.Context > 0 {
+		args = append(args, "--context", strconv.Itoa(index.Context))
+	}
+	for _, search := range searches {
+		args = append(args, "-e", search)
+	}
+	newArgs, paths, err := g.arguments.RipgrepSourceArguments(index, jobNames)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if g.filter != nil {
+		paths = candidatePaths(g.filter, searches, paths)
+	}
+	return g.execPath, append(args, newArgs...), paths, nil
+}
+
+func (g ripgrepGenerator) searchArgs(index *Index, search string) []string {
 	args := []string{g.execPath, "-a", "-z", "-u", "--color", "never", "-S", "--null", "--no-line-number", "--no-heading"}
 	if index.Context >= 0 {
 		args = append(args, "--context", strconv.Itoa(index.Context))
@@ -53,26 +96,89 @@ func (g ripgrepGenerator) Command(index *Index, search string, jobNames sets.Str
 			args = append(args, "--max-count", strconv.Itoa(index.MaxMatches))
 		}
 	}
-	args = append(args, search)
-	newArgs, paths, err := g.arguments.RipgrepSourceArguments(index, jobNames)
-	if err != nil {
-		return "", nil, nil, err
+	return append(args, search)
+}
+
+// candidatePaths returns the paths that filter selects for any of searches, in
+// their original order.
+func candidatePaths(filter CandidateFilter, searches []string, paths []string) []string {
+	if len(searches) == 1 {
+		return filter.Candidates(searches[0], paths)
 	}
-	return g.execPath, append(args, newArgs...), paths, nil
+	selected := make(sets.String, len(paths))
+	for _, search := range searches {
+		selected.Insert(filter.Candidates(search, paths)...)
+	}
+	filtered := make([]string, 0, len(selected))
+	for _, path := range paths {
+		if selected.Has(path) {
+			filtered = append(filtered, path)
+			selected.Delete(path)
+		}
+	}
+	return filtered
 }
 
 func (g ripgrepGenerator) PathPrefix() string {
 	return g.searchPath
 }
 
-func NewCommandGenerator(searchPath string, arguments RipgrepSourceArguments) (CommandGenerator, error) {
+func NewCommandGenerator(searchPath string, arguments RipgrepSourceArguments, filter CandidateFilter) (CommandGenerator, error) {
 	if path, err := exec.LookPath("rg"); err == nil {
 		klog.Infof("Using ripgrep at %s for searches", path)
-		return ripgrepGenerator{execPath: path, searchPath: searchPath, arguments: arguments}, nil
+		return ripgrepGenerator{execPath: path, searchPath: searchPath, arguments: arguments, filter: filter}, nil
 	}
 	return nil, fmt.Errorf("could not find 'rg' on the path")
 }
 
+// Searcher finds the matches for each of searches within the files selected by
+// index in a single pass over the files and invokes fn for each match.
+type Searcher interface {
+	Search(ctx context.Context, index *Index, searches []string, jobNames sets.String, fn GrepFunc) error
+}
+
+// commandSearcher runs the command built by a CommandGenerator and parses its
+// output.
+type commandSearcher struct {
+	CommandGenerator
+}
+
+// Search runs a single command for one search. When there are more, a single
+// command reports the lines that match any search and each line is assigned to
+// the searches it matches.
+func (s commandSearcher) Search(ctx context.Context, index *Index, searches []string, jobNames sets.String, fn GrepFunc) error {
+	switch len(searches) {
+	case 0:
+		return nil
+	case 1:
+		return executeGrepSingle(ctx, s.CommandGenerator, index, searches[0], jobNames, fn)
+	}
+	return executeGrepMulti(ctx, s.CommandGenerator, index, searches, jobNames, fn)
+}
+
+// NewSearcher returns the searcher for backend, which may be "rg" to invoke
+// ripgrep, "go" to search in-process, or empty to prefer ripgrep when it is
+// available on the path. If filter is not nil it is used to exclude files
+// before they are searched.
+func NewSearcher(backend, searchPath string, arguments RipgrepSourceArguments, paths PathSource, filter CandidateFilter, workers int) (Searcher, error) {
+	switch backend {
+	case "", "rg":
+		gen, err := NewCommandGenerator(searchPath, arguments, filter)
+		if err == nil {
+			return commandSearcher{gen}, nil
+		}
+		if backend == "rg" {
+			return nil, err
+		}
+		klog.Infof("Unable to use ripgrep (%v), falling back to in-process search", err)
+		fallthrough
+	case "go":
+		return NewInProcessSearcher(searchPath, paths, filter, workers), nil
+	default:
+		return nil, fmt.Errorf("unrecognized search backend %q, must be 'rg' or 'go'", backend)
+	}
+}
+
 type GrepFunc func(name string, search string, lines []bytes.Buffer, moreLines int) error
 
 // executeGrep search for matches to index and, for each match found,
@@ -84,13 +190,11 @@ type GrepFunc func(name string, search string, lines []bytes.Buffer, moreLines i
 // * lines, the match with its surrounding context.
 // * moreLines, the number of elided lines, when the match and context
 //   is truncated due to excessive length.
-func executeGrep(ctx context.Context, gen CommandGenerator, index *Index, jobNames sets.String, fn GrepFunc) error {
-	for _, search := range index.Search {
-		if err := executeGrepSingle(ctx, gen, index, search, jobNames, fn); err != nil {
-			return err
-		}
-	}
-	return nil
+//
+// All of index.Search are evaluated together, so fn may be invoked for
+// different searches on the same file before moving to the next file.
+func executeGrep(ctx context.Context, searcher Searcher, index *Index, jobNames sets.String, fn GrepFunc) error {
+	return searcher.Search(ctx, index, index.Search, jobNames, fn)
 }
 
 func estimateLength(arr []string) int {
@@ -111,12 +215,9 @@ func splitStringSliceByLength(arr []string, maxLength int) ([]string, []string)
 	return arr, nil
 }
 
-func executeGrepSingle(ctx context.Context, gen CommandGenerator, index *Index, search string, jobNames sets.String, fn GrepFunc) error {
-	commandPath, commandArgs, commandPaths, err := gen.Command(index, search, jobNames)
-	if err != nil {
-		return err
-	}
-
+// maxArgumentLength returns the combined length of the paths that may be
+// passed to a command with commandArgs.
+func maxArgumentLength(commandArgs []string) int {
 	// platforms limit the length of arguments - we have to execute in batches
 	var maxArgs int
 	switch runtime.GOOS {
@@ -128,8 +229,26 @@ func executeGrepSingle(ctx context.Context, gen CommandGenerator, index *Index,
 	for _, arg := range commandArgs {
 		maxArgs -= len(arg) + 1
 	}
+	return maxArgs
+}
+
+func executeGrepSingle(ctx context.Context, gen CommandGenerator, index *Index, search string, jobNames sets.String, fn GrepFunc) error {
+	commandPath, commandArgs, commandPaths, err := gen.Command(index, search, jobNames)
+	if err != nil {
+		return err
+	}
+	return runGrepCommand(ctx, gen.PathPrefix(), commandPath, commandArgs, commandPaths, index, search, fn)
+}
+
+// runGrepCommand executes the command on commandPaths in as many batches as
+// necessary and passes the output for search to fn.
+func runGrepCommand(ctx context.Context, pathPrefix string, commandPath string, commandArgs []string, commandPaths []string, index *Index, search string, fn GrepFunc) error {
+	maxArgs := maxArgumentLength(commandArgs)
 	maxBytes := index.MaxBytes
-	pathPrefix := gen.PathPrefix()
+	if maxBytes <= 0 {
+		// as for the in-process search, no budget means the output is not limited
+		maxBytes = math.MaxInt64
+	}
 
 	for len(commandPaths) > 0 {
 		var args []string
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+// maxLineLength is the longest line the in-process searcher will match against,
+// longer lines are truncated.
+const maxLineLength = 1024 * 1024
+
+type PathSource interface {
+	// SearchPaths returns the filesystem paths of the files that match the index's
+	// SearchType and MaxAge.
+	SearchPaths(*Index, sets.String) ([]string, error)
+}
+
+// inProcessSearcher reads the files selected by a PathSource and matches them
+// line by line with the Go regular expression engine, using the same options
+// as the ripgrep command (smart case, transparent gzip decompression, context
+// and max count).
+type inProcessSearcher struct {
+	searchPath string
+	paths      PathSource
+	filter     CandidateFilter
+	workers    int
+}
+
+func NewInProcessSearcher(searchPath string, paths PathSource, filter CandidateFilter, workers int) Searcher {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	klog.Infof("Using in-process search with %d workers", workers)
+	return &inProcessSearcher{searchPath: searchPath, paths: paths, filter: filter, workers: workers}
+}
+
+// grepMatch is a single block of matching lines and their context.
+type grepMatch struct {
+	lines     []bytes.Buffer
+	moreLines int
+}
+
+type grepFileResult struct {
+	path string
+	// matches and bytes are indexed by the position of the search in the
+	// searches passed to Search
+	matches [][]grepMatch
+	bytes   []int64
+	err     error
+}
+
+// grepFile is a file to search and the positions of the searches that may
+// match it.
+type grepFile struct {
+	path     string
+	searches []int
+}
+
+// Search reads each file once and evaluates every search against it, invoking
+// fn for the matches of each search in turn.
+func (s *inProcessSearcher) Search(ctx context.Context, index *Index, searches []string, jobNames sets.String, fn GrepFunc) error {
+	if len(searches) == 0 {
+		return nil
+	}
+	res := make([]*regexp.Regexp, 0, len(searches))
+	for _, search := range searches {
+		re, err := compileSearch(search)
+		if err != nil {
+			return fmt.Errorf("search is an invalid regular expression: %v", err)
+		}
+		res = append(res, re)
+	}
+	paths, err := s.paths.SearchPaths(index, jobNames)
+	if err != nil {
+		return err
+	}
+	files := s.candidates(searches, paths)
+	if len(files) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// files are searched in parallel but results are delivered in the order of
+	// paths, so that all matches for a file are passed to fn together
+	pending := make(chan chan grepFileResult, s.workers)
+	go func() {
+		defer close(pending)
+		limit := make(chan struct{}, s.workers)
+		for _, file := range files {
+			result := make(chan grepFileResult, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case limit <- struct{}{}:
+			case <-ctx.Done():
+				close(result)
+				return
+			}
+			go func(file grepFile) {
+				defer func() { <-limit }()
+				result <- searchFile(ctx, res, file, index)
+			}(file)
+		}
+	}()
+
+	bytesRead := make([]int64, len(searches))
+	for result := range pending {
+		r, ok := <-result
+		if !ok {
+			break
+		}
+		if r.err != nil {
+			if os.IsNotExist(r.err) {
+				klog.V(5).Infof("File was removed before it could be searched: %s", r.path)
+			} else {
+				klog.Errorf("Unable to search %s: %v", r.path, r.err)
+			}
+			continue
+		}
+		relPath, err := filepath.Rel(s.searchPath, r.path)
+		if err != nil {
+			return err
+		}
+		if err := sendMatches(filepath.ToSlash(relPath), searches, r.matches, r.bytes, bytesRead, index, fn); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// sendMatches passes the matches for each search within the file name to fn
+// and adds the bytes read for each search to bytesRead.
+func sendMatches(name string, searches []string, matches [][]grepMatch, bytes []int64, bytesRead []int64, index *Index, fn GrepFunc) error {
+	for i := range matches {
+		for _, match := range matches[i] {
+			klog.V(7).Infof("Captured %d lines for %s, %d not shown", len(match.lines)+match.moreLines, name, match.moreLines)
+			if err := fn(name, searches[i], match.lines, match.moreLines); err != nil {
+				return err
+			}
+		}
+		// each search may read up to the maximum, as if it had been run alone
+		bytesRead[i] += bytes[i]
+		if index.MaxBytes > 0 && bytesRead[i] > index.MaxBytes {
+			return ErrMaxBytes
+		}
+	}
+	return nil
+}
+
+// candidates returns the paths that may match at least one search, in order,
+// along with the searches that should be evaluated against each.
+func (s *inProcessSearcher) candidates(searches []string, paths []string) []grepFile {
+	all := make([]int, len(searches))
+	for i := range searches {
+		all[i] = i
+	}
+	if s.filter == nil {
+		files := make([]grepFile, 0, len(paths))
+		for _, path := range paths {
+			files = append(files, grepFile{path: path, searches: all})
+		}
+		return files
+	}
+
+	matched := make(map[string][]int, len(paths))
+	for i, search := range searches {
+		for _, path := range s.filter.Candidates(search, paths) {
+			matched[path] = append(matched[path], i)
+		}
+	}
+	files := make([]grepFile, 0, len(matched))
+	for _, path := range paths {
+		if searches, ok := matched[path]; ok {
+			files = append(files, grepFile{path: path, searches: searches})
+			delete(matched, path)
+		}
+	}
+	return files
+}
+
+// compileSearch compiles search using ripgrep's smart case rule: a pattern that
+// contains no uppercase literals is matched case-insensitively.
+func compileSearch(search string) (*regexp.Regexp, error) {
+	if !hasUppercaseLiteral(search) {
+		search = "(?i)" + search
+	}
+	return regexp.Compile(search)
+}
+
+func hasUppercaseLiteral(search string) bool {
+	escaped := false
+	for _, r := range search {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case unicode.IsUpper(r):
+			return true
+		}
+	}
+	return false
+}
+
+// searchFile searches the file for the expressions in res selected by
+// file.searches, decompressing it if it has a .gz suffix.
+func searchFile(ctx context.Context, res []*regexp.Regexp, file grepFile, index *Index) grepFileResult {
+	result := grepFileResult{path: file.path}
+	f, err := os.Open(file.path)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(file.path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	states := make([]*grepState, 0, len(file.searches))
+	for _, i := range file.searches {
+		states = append(states, newGrepState(res[i], index))
+	}
+	if result.err = grepReader(ctx, states, r); result.err != nil {
+		return result
+	}
+	result.matches = make([][]grepMatch, len(res))
+	result.bytes = make([]int64, len(res))
+	for j, i := range file.searches {
+		result.matches[i] = states[j].matches
+		result.bytes[i] = states[j].bytes
+	}
+	return result
+}
+
+// grepState collects the lines that match a single expression along with
+// index.Context lines before and after each match. At most index.MaxMatches
+// matches are found. When context is requested each contiguous block of lines
+// is a separate match, otherwise all matching lines are returned together. No
+// more than index.MaxMatches * (2 * index.Context + 1) lines are kept for any
+// match, the remainder are counted in moreLines. bytes is the length of all
+// kept lines.
+type grepState struct {
+	re *regexp.Regexp
+
+	context  int
+	before   int
+	after    int
+	maxCount int
+	maxLines int
+
+	matches []grepMatch
+	current *grepMatch
+	bytes   int64
+
+	// previous holds the lines immediately preceding the current line that have
+	// not been added to a match, up to the amount of leading context
+	previous       [][]byte
+	lastAdded      int
+	remainingAfter int
+	count          int
+	done           bool
+}
+
+func newGrepState(re *regexp.Regexp, index *Index) *grepState {
+	before := index.Context
+	if before < 0 {
+		before = 0
+	}
+	maxLines := index.MaxMatches
+	if index.Context > 0 {
+		maxLines *= index.Context*2 + 1
+	}
+	return &grepState{
+		re:        re,
+		context:   index.Context,
+		before:    before,
+		after:     before,
+		maxCount:  index.MaxMatches,
+		maxLines:  maxLines,
+		previous:  make([][]byte, 0, before),
+		lastAdded: -1,
+	}
+}
+
+func (s *grepState) add(line []byte) {
+	if s.current == nil {
+		s.matches = append(s.matches, grepMatch{})
+		s.current = &s.matches[len(s.matches)-1]
+	}
+	if s.maxLines > 0 && len(s.current.lines) >= s.maxLines {
+		s.current.moreLines++
+		return
+	}
+	s.current.lines = append(s.current.lines, bytes.Buffer{})
+	s.current.lines[len(s.current.lines)-1].Write(line)
+	s.bytes += int64(len(line)) + 1
+}
+
+// next processes the line at lineNumber and sets done once no more lines are
+// needed.
+func (s *grepState) next(lineNumber int, line []byte) {
+	switch {
+	case (s.maxCount <= 0 || s.count < s.maxCount) && s.re.Match(line):
+		s.count++
+		if s.context > 0 && lineNumber-len(s.previous) > s.lastAdded+1 {
+			// the lines are not contiguous with the previous match
+			s.current = nil
+		}
+		for _, l := range s.previous {
+			s.add(l)
+		}
+		s.previous = s.previous[:0]
+		s.add(line)
+		s.lastAdded = lineNumber
+		s.remainingAfter = s.after
+
+	case s.remainingAfter > 0:
+		s.add(line)
+		s.lastAdded = lineNumber
+		s.remainingAfter--
+
+	case s.maxCount > 0 && s.count >= s.maxCount:
+		s.done = true
+
+	case s.before > 0:
+		var buf []byte
+		if len(s.previous) == s.before {
+			buf = s.previous[0][:0]
+			copy(s.previous, s.previous[1:])
+			s.previous = s.previous[:s.before-1]
+		}
+		s.previous = append(s.previous, append(buf, line...))
+	}
+}
+
+// skip discards the lines held for leading context when the lines before the
+// next line passed to next are not contiguous with the previous one. The
+// skipped lines are known not to match and not to be needed as context.
+func (s *grepState) skip() {
+	s.previous = s.previous[:0]
+	s.remainingAfter = 0
+}
+
+// grepReader reads the lines of r and passes them to each state until r is
+// exhausted or every state is done.
+func grepReader(ctx context.Context, states []*grepState, r io.Reader) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var line []byte
+	for lineNumber := 0; ; lineNumber++ {
+		if lineNumber%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		var err error
+		line, err = readLine(br, line)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		active := false
+		for _, state := range states {
+			if state.done {
+				continue
+			}
+			state.next(lineNumber, line)
+			active = active || !state.done
+		}
+		if !active {
+			return nil
+		}
+	}
+}
+
+// readLine reads the next line from br into buf without the trailing newline.
+// Lines longer than maxLineLength are truncated. io.EOF is returned only when
+// no more lines remain.
+func readLine(br *bufio.Reader, buf []byte) ([]byte, error) {
+	buf = buf[:0]
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		if err != nil {
+			return buf, err
+		}
+		if remaining := maxLineLength - len(buf); remaining > 0 {
+			if len(chunk) > remaining {
+				chunk = chunk[:remaining]
+			}
+			buf = append(buf, chunk...)
+		}
+		if !isPrefix {
+			return buf, nil
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+type staticPaths []string
+
+func (p staticPaths) SearchPaths(*Index, sets.String) ([]string, error) {
+	return p, nil
+}
+
+// onlyFilter selects a single path for the searches it contains and every path
+// for other searches.
+type onlyFilter map[string]string
+
+func (f onlyFilter) Candidates(search string, paths []string) []string {
+	if path, ok := f[search]; ok {
+		return []string{path}
+	}
+	return paths
+}
+
+func matchStrings(matches []grepMatch) [][]string {
+	var out [][]string
+	for _, match := range matches {
+		var lines []string
+		for _, line := range match.lines {
+			lines = append(lines, line.String())
+		}
+		out = append(out, lines)
+	}
+	return out
+}
+
+func Test_grepReader(t *testing.T) {
+	input := "a\nb\nerror 1\nc\nd\ne\nf\nERROR 2\ng\nerror 3\nh\n"
+	tests := []struct {
+		name   string
+		search string
+		index  Index
+		want   [][]string
+	}{
+		{
+			name:   "no context joins matches",
+			search: "error",
+			index:  Index{MaxMatches: 5},
+			want:   [][]string{{"error 1", "ERROR 2", "error 3"}},
+		},
+		{
+			name:   "smart case",
+			search: "ERROR",
+			index:  Index{MaxMatches: 5},
+			want:   [][]string{{"ERROR 2"}},
+		},
+		{
+			name:   "max matches",
+			search: "error",
+			index:  Index{MaxMatches: 2},
+			want:   [][]string{{"error 1", "ERROR 2"}},
+		},
+		{
+			name:   "context splits blocks",
+			search: "error",
+			index:  Index{MaxMatches: 5, Context: 1},
+			want:   [][]string{{"b", "error 1", "c"}, {"f", "ERROR 2", "g", "error 3", "h"}},
+		},
+		{
+			name:   "context after last match",
+			search: "error",
+			index:  Index{MaxMatches: 1, Context: 2},
+			want:   [][]string{{"a", "b", "error 1", "c", "d"}},
+		},
+		{
+			name:   "no matches",
+			search: "missing",
+			index:  Index{MaxMatches: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := compileSearch(tt.search)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := newGrepState(re, &tt.index)
+			if err := grepReader(context.Background(), []*grepState{state}, strings.NewReader(input)); err != nil {
+				t.Fatal(err)
+			}
+			if got := matchStrings(state.matches); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inProcessSearcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jobDir := filepath.Join(dir, "jobs", "origin-ci-test", "logs", "job-a", "1")
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	junitPath := filepath.Join(jobDir, "junit.failures")
+	if err := ioutil.WriteFile(junitPath, []byte("\n\n# test\nfailed: timeout waiting\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(jobDir, "build-log.txt.gz")
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	gw.Write([]byte("starting\nlevel=error msg=\"timeout\"\ndone\n"))
+	gw.Close()
+	if err := ioutil.WriteFile(logPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	searcher := NewInProcessSearcher(dir, staticPaths{junitPath, filepath.Join(jobDir, "missing"), logPath}, nil, 2)
+	index := &Index{Search: []string{"timeout"}, MaxMatches: 1, MaxBytes: 1024}
+	var got []string
+	if err := executeGrep(context.Background(), searcher, index, nil, func(name string, search string, lines []bytes.Buffer, moreLines int) error {
+		got = append(got, name+": "+lines[0].String())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"jobs/origin-ci-test/logs/job-a/1/junit.failures: failed: timeout waiting",
+		"jobs/origin-ci-test/logs/job-a/1/build-log.txt.gz: level=error msg=\"timeout\"",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// all searches are evaluated in one pass and reported together for each file
+	index.Search = []string{"timeout", "level=error", "never"}
+	got = nil
+	if err := executeGrep(context.Background(), searcher, index, nil, func(name string, search string, lines []bytes.Buffer, moreLines int) error {
+		got = append(got, search+" "+name+": "+lines[0].String())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"timeout jobs/origin-ci-test/logs/job-a/1/junit.failures: failed: timeout waiting",
+		"timeout jobs/origin-ci-test/logs/job-a/1/build-log.txt.gz: level=error msg=\"timeout\"",
+		"level=error jobs/origin-ci-test/logs/job-a/1/build-log.txt.gz: level=error msg=\"timeout\"",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// searches are only evaluated against the files the filter selects for them
+	searcher = NewInProcessSearcher(dir, staticPaths{junitPath, logPath}, onlyFilter{"timeout": logPath}, 2)
+	got = nil
+	if err := executeGrep(context.Background(), searcher, index, nil, func(name string, search string, lines []bytes.Buffer, moreLines int) error {
+		got = append(got, search+" "+name)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"timeout jobs/origin-ci-test/logs/job-a/1/build-log.txt.gz",
+		"level=error jobs/origin-ci-test/logs/job-a/1/build-log.txt.gz",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	index.Search = []string{"timeout"}
+	index.MaxBytes = 1
+	if err := executeGrep(context.Background(), searcher, index, nil, func(string, string, []bytes.Buffer, int) error { return nil }); err != ErrMaxBytes {
+		t.Errorf("expected max bytes error, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+// ripgrepMessage is a single line of ripgrep --json output. Only the begin,
+// match, context and end messages are used.
+type ripgrepMessage struct {
+	Type string `json:"type"`
+	Data struct {
+		Path       ripgrepData `json:"path"`
+		Lines      ripgrepData `json:"lines"`
+		LineNumber int         `json:"line_number"`
+	} `json:"data"`
+}
+
+// ripgrepData holds either UTF-8 text or, when the value is not valid UTF-8,
+// the base64 encoded bytes.
+type ripgrepData struct {
+	Text  *string `json:"text"`
+	Bytes []byte  `json:"bytes"`
+}
+
+func (d ripgrepData) value() []byte {
+	if d.Text != nil {
+		return []byte(*d.Text)
+	}
+	return d.Bytes
+}
+
+// executeGrepMulti runs one command that reports the lines matching any of
+// searches and evaluates each search against those lines, so that the files
+// are read only once regardless of the number of searches.
+func executeGrepMulti(ctx context.Context, gen CommandGenerator, index *Index, searches []string, jobNames sets.String, fn GrepFunc) error {
+	res := make([]*regexp.Regexp, 0, len(searches))
+	for _, search := range searches {
+		re, err := compileSearch(search)
+		if err != nil {
+			return fmt.Errorf("search is an invalid regular expression: %v", err)
+		}
+		res = append(res, re)
+	}
+	commandPath, commandArgs, commandPaths, err := gen.SearchCommand(index, searches, jobNames)
+	if err != nil {
+		return err
+	}
+	maxArgs := maxArgumentLength(commandArgs)
+
+	bytesRead := make([]int64, len(searches))
+	for len(commandPaths) > 0 {
+		var args []string
+		args, commandPaths = splitStringSliceByLength(commandPaths, maxArgs)
+		if len(args) == 0 {
+			return fmt.Errorf("argument longer than maximum shell length")
+		}
+		cmdArgs := append(append([]string{}, commandArgs...), args...)
+		if err := runJSONCommand(ctx, gen.PathPrefix(), commandPath, cmdArgs, index, searches, res, bytesRead, fn); err != nil {
+			if strings.Contains(err.Error(), "argument list too long") {
+				return fmt.Errorf("arguments too long: %d bytes", estimateLength(cmdArgs))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// runJSONCommand executes a single ripgrep command with --json output and
+// passes the lines of each file to a grepState for every search. The matches
+// for a file are sent to fn once ripgrep finishes with it.
+func runJSONCommand(ctx context.Context, pathPrefix string, commandPath string, commandArgs []string, index *Index, searches []string, res []*regexp.Regexp, bytesRead []int64, fn GrepFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errOut := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, commandPath)
+	cmd.Args = commandArgs
+	cmd.Stderr = errOut
+	pr, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	finished := false
+	defer func() {
+		if !finished {
+			// stop the command rather than reading output that will be discarded
+			cancel()
+		}
+		if _, err := io.Copy(ioutil.Discard, pr); err != nil && finished {
+			klog.Errorf("Unread input: %v", err)
+		}
+		if err := cmd.Wait(); err != nil && finished {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 1 {
+					return
+				}
+			}
+			klog.Errorf("Failed to wait for command: %v: %s", err, errOut.String())
+		}
+	}()
+
+	var name string
+	var states []*grepState
+	lastLine := 0
+
+	br := bufio.NewReaderSize(pr, 512*1024)
+	for {
+		data, readErr := br.ReadBytes('\n')
+		if len(data) > 0 {
+			var message ripgrepMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				return fmt.Errorf("unable to parse search output: %v", err)
+			}
+			switch message.Type {
+			case "begin":
+				relPath, err := filepath.Rel(pathPrefix, string(message.Data.Path.value()))
+				if err != nil {
+					return err
+				}
+				name = filepath.ToSlash(relPath)
+				states = make([]*grepState, 0, len(res))
+				for _, re := range res {
+					states = append(states, newGrepState(re, index))
+				}
+				lastLine = 0
+
+			case "match", "context":
+				if states == nil {
+					continue
+				}
+				lineNumber := message.Data.LineNumber
+				if lastLine > 0 && lineNumber != lastLine+1 {
+					for _, state := range states {
+						state.skip()
+					}
+				}
+				lastLine = lineNumber
+				line := bytes.TrimSuffix(message.Data.Lines.value(), []byte("\n"))
+				line = bytes.TrimSuffix(line, []byte("\r"))
+				if len(line) > maxLineLength {
+					line = line[:maxLineLength]
+				}
+				for _, state := range states {
+					if !state.done {
+						state.next(lineNumber, line)
+					}
+				}
+
+			case "end":
+				if states == nil {
+					continue
+				}
+				matches := make([][]grepMatch, len(states))
+				sizes := make([]int64, len(states))
+				for i, state := range states {
+					matches[i] = state.matches
+					sizes[i] = state.bytes
+				}
+				states = nil
+				if err := sendMatches(name, searches, matches, sizes, bytesRead, index, fn); err != nil {
+					return err
+				}
+			}
+		}
+		if readErr == io.EOF {
+			finished = ctx.Err() == nil
+			return ctx.Err()
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+type staticArguments []string
+
+func (a staticArguments) RipgrepSourceArguments(*Index, sets.String) ([]string, []string, error) {
+	return nil, a, nil
+}
+
+func Test_commandSearcher_singlePass(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// ripgrep ignores case for every search, so lines that match only when
+	// case is ignored and lines outside of any match are reported and must be
+	// assigned to the right search here
+	output := strings.Join([]string{
+		`{"type":"begin","data":{"path":{"text":"/base/a.log"}}}`,
+		`{"type":"match","data":{"path":{"text":"/base/a.log"},"lines":{"text":"error one\n"},"line_number":1}}`,
+		`{"type":"context","data":{"path":{"text":"/base/a.log"},"lines":{"text":"between\n"},"line_number":2}}`,
+		`{"type":"match","data":{"path":{"text":"/base/a.log"},"lines":{"text":"timeout lower\n"},"line_number":3}}`,
+		`{"type":"context","data":{"path":{"text":"/base/a.log"},"lines":{"text":"after\n"},"line_number":4}}`,
+		`{"type":"context","data":{"path":{"text":"/base/a.log"},"lines":{"text":"before\n"},"line_number":9}}`,
+		`{"type":"match","data":{"path":{"text":"/base/a.log"},"lines":{"text":"Timeout upper\n"},"line_number":10}}`,
+		`{"type":"end","data":{"path":{"text":"/base/a.log"}}}`,
+		`{"type":"begin","data":{"path":{"text":"/base/b.log"}}}`,
+		`{"type":"match","data":{"path":{"text":"/base/b.log"},"lines":{"bytes":"RVJST1IgdHdvCg=="},"line_number":7}}`,
+		`{"type":"end","data":{"path":{"text":"/base/b.log"}}}`,
+		`{"type":"summary","data":{}}`,
+	}, "\n") + "\n"
+	outputPath := filepath.Join(dir, "output")
+	if err := ioutil.WriteFile(outputPath, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+	countPath := filepath.Join(dir, "count")
+	rgPath := filepath.Join(dir, "rg")
+	script := fmt.Sprintf("#!/bin/sh\necho run >> %q\ncat %q\n", countPath, outputPath)
+	if err := ioutil.WriteFile(rgPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	searcher := commandSearcher{ripgrepGenerator{
+		execPath:   rgPath,
+		searchPath: "/base",
+		arguments:  staticArguments{"/base/a.log", "/base/b.log"},
+	}}
+	index := &Index{Search: []string{"error", "Timeout", "never"}, MaxMatches: 5, Context: 1, MaxBytes: 1024}
+	var got []string
+	if err := executeGrep(context.Background(), searcher, index, nil, func(name string, search string, lines []bytes.Buffer, moreLines int) error {
+		var text []string
+		for _, line := range lines {
+			text = append(text, line.String())
+		}
+		got = append(got, search+" "+name+": "+strings.Join(text, "|"))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"error a.log: error one|between",
+		"Timeout a.log: before|Timeout upper",
+		"error b.log: ERROR two",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	runs, err := ioutil.ReadFile(countPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "run"); n != 1 {
+		t.Errorf("expected the command to run once for all searches, ran %d times", n)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"k8s.io/klog"
 
 	"github.com/openshift/ci-search/bugzilla"
+	"github.com/openshift/ci-search/github"
 	"github.com/openshift/ci-search/metricdb/httpgraph"
 	"github.com/openshift/ci-search/pkg/httpwriter"
 )
@@ -41,6 +42,9 @@ type Match struct {
 	URL          string                `json:"url,omitempty"`
 	Bug          *bugzilla.BugInfo     `json:"bugInfo,omitempty"`
 	Issue        *jiraBaseClient.Issue `json:"issues,omitempty"`
+	GitHubIssue  *github.IssueInfo     `json:"githubIssue,omitempty"`
+	// KnownIssues are the bugs and issues that reference the job run.
+	KnownIssues []KnownIssue `json:"knownIssues,omitempty"`
 }
 
 type SearchResponseResult struct {
@@ -49,6 +53,9 @@ type SearchResponseResult struct {
 type SearchResponse struct {
 	// SearchResults is a map of searchstring to search results that matched that search string
 	Results map[string]SearchResponseResult `json:"results"`
+	// NextPageToken is set when a page of results was requested and more
+	// results follow it.
+	NextPageToken string `json:"nextPageToken,omitempty"`
 }
 
 func (o *options) handleConfig(w http.ResponseWriter, req *http.Request) {
@@ -84,7 +91,7 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 	}
 
 	var err error
-	index, err = parseRequest(req, "text", o.MaxAge)
+	index, err = parseRequest(req, "text", o.MaxAge, o.artifacts)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
@@ -118,8 +125,13 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 		contextOptions = append(contextOptions, fmt.Sprintf(`<option value="%s" selected>%s</option>`, context, context))
 	}
 
+	searchTypes := append([]string{"bug+issue+junit", "bug+junit", "bug+issue"}, trackerSearchTypes()...)
+	searchTypes = append(searchTypes, "junit")
+	for _, rule := range o.artifacts {
+		searchTypes = append(searchTypes, rule.Name)
+	}
 	var searchTypeOptions []string
-	for _, searchType := range []string{"bug+issue+junit", "bug+junit", "bug+issue", "issue", "bug", "junit", "build-log", "all"} {
+	for _, searchType := range append(searchTypes, "all") {
 		var selected string
 		if searchType == index.SearchType {
 			selected = "selected"
@@ -154,6 +166,34 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 		maxAgeOptions = append(maxAgeOptions, fmt.Sprintf(`<option value="%s" selected>%s</option>`, maxAge, maxAge))
 	}
 
+	// consult the cache before the page is started so the cache headers can be set
+	var cacheKey string
+	var cached interface{}
+	var hit bool
+	if len(index.Search[0]) > 0 {
+		if index.GroupByJob {
+			cacheKey = o.cacheKey("ordered", index)
+		} else {
+			cacheKey = o.cacheKey("matches", index)
+		}
+		var created time.Time
+		cached, created, hit = o.results.Lookup(cacheKey)
+		o.results.SetHeaders(w, hit, created)
+	}
+
+	// wait for the search to be admitted before the page is started so that
+	// rejected searches can be retried
+	ctx := req.Context()
+	if len(cacheKey) > 0 && !hit {
+		var done func()
+		ctx, done, err = o.scheduler.Admit(req.Context())
+		if err != nil {
+			searchFailed(w, err, http.StatusInternalServerError)
+			return
+		}
+		defer done()
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	writer := httpwriter.ForRequest(w, req)
 	defer writer.Close()
@@ -166,7 +206,12 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 	}
 
 	fmt.Fprintf(writer, htmlPageStart, "Search OpenShift CI", nowrapClass)
+	searchName := "search"
+	if index.Expression != nil {
+		searchName = "query"
+	}
 	fmt.Fprintf(writer, htmlIndexForm,
+		searchName,
 		template.HTMLEscapeString(index.Search[0]),
 		strings.Join(maxAgeOptions, ""),
 
@@ -176,6 +221,8 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 		template.HTMLEscapeString(index.ExcludeName),
 		strconv.Itoa(index.MaxMatches),
 		strconv.FormatInt(index.MaxBytes, 10),
+		template.HTMLEscapeString(formatTime(index.From)),
+		template.HTMLEscapeString(formatTime(index.To)),
 		groupByOptions,
 		wrapValue,
 	)
@@ -184,7 +231,7 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 	if len(index.Search[0]) == 0 {
 		stats := o.Stats()
 
-		fmt.Fprintf(writer, htmlEmptyPage, o.DeckURI, units.HumanSize(float64(stats.Size)), stats.Entries, stats.FailedJobs, stats.Jobs, stats.Bugs, stats.Issues)
+		fmt.Fprintf(writer, htmlEmptyPage, o.DeckURI, units.HumanSize(float64(stats.Size)), stats.Entries, template.HTMLEscapeString(indexSummary(stats)), quotaSummary(stats.Quotas))
 		flusher.Flush()
 
 		gw := &httpgraph.GraphDataWriter{}
@@ -230,45 +277,34 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 
 	switch {
 	case index.GroupByJob:
-		result, err := o.orderedSearchResults(req.Context(), index)
+		if !hit {
+			cached, _, _, err = o.results.Get(ctx, cacheKey, func() (interface{}, error) {
+				return o.orderedSearchResults(ctx, index)
+			})
+			err = o.scheduler.deadlineError(ctx, err)
+		}
 		if err != nil {
 			klog.Errorf("Search %q failed with %d results: command failed: %v", index.Search[0], 0, err)
 			fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
 			fmt.Fprint(writer, htmlPageEnd)
 			return
 		}
+		result := cached.(*SearchResult)
 		bw := bufio.NewWriterSize(writer, 2048)
 		var numRuns int
 		if result.Matches > 0 {
 			fmt.Fprintln(bw, `<div class="table-responsive"><table class="table table-job-compact"><tbody>`)
-			for _, bug := range result.Bugs {
-				age, _ := formatAge(bug.Matches[0].LastModified.Time, start, index.MaxAge)
-				name := bug.Name
-				if i := strings.Index(name, ": "); i != -1 {
-					name = name[i+2:]
-				}
-				fmt.Fprintf(bw, "<tr><td><a target=\"_blank\" href=\"%s\">#%d</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\">%s</td></tr>\n", template.HTMLEscapeString(bug.URI.String()), bug.Number, template.HTMLEscapeString(bug.Matches[0].FileType), template.HTMLEscapeString(age), template.HTMLEscapeString(name))
-				if index.Context >= 0 {
-					fmt.Fprintf(bw, "<tr class=\"row-match\"><td class=\"\" colspan=\"4\"><pre class=\"small\">")
-					for _, match := range bug.Matches {
-						if err := renderLinesString(bw, match.Context, match.MoreLines); err != nil {
-							bw.Flush()
-							klog.Errorf("Search %q failed with %d matches: command failed: %v", index.Search[0], numRuns, err)
-							fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
-							fmt.Fprint(writer, htmlPageEnd)
-							return
-						}
-					}
-					fmt.Fprintln(bw, "</pre></td></tr>")
-				}
-			}
 			for _, issue := range result.Issues {
-				age, _ := formatAge(issue.Matches[0].LastModified.Time, start, index.MaxAge)
+				age, _ := formatAge(issue.Matches[0].LastModified.Time, start, index)
 				name := issue.Name
 				if i := strings.Index(name, ": "); i != -1 {
 					name = name[i+2:]
 				}
-				fmt.Fprintf(bw, "<tr><td><a class=\"text-nowrap\" target=\"_blank\" href=\"%s\">#%s</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\">%s</td></tr>\n", template.HTMLEscapeString(issue.URI.String()), template.HTMLEscapeString(issue.Key), template.HTMLEscapeString(issue.Matches[0].FileType), template.HTMLEscapeString(age), template.HTMLEscapeString(name))
+				key := issue.Key
+				if !strings.Contains(key, "#") {
+					key = "#" + key
+				}
+				fmt.Fprintf(bw, "<tr><td><a class=\"text-nowrap\" target=\"_blank\" href=\"%s\">%s</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\">%s</td></tr>\n", template.HTMLEscapeString(issue.URI.String()), template.HTMLEscapeString(key), template.HTMLEscapeString(issue.Matches[0].FileType), template.HTMLEscapeString(age), template.HTMLEscapeString(name))
 				if index.Context >= 0 {
 					fmt.Fprintf(bw, "<tr class=\"row-match\"><td class=\"\" colspan=\"4\"><pre class=\"small\">")
 					for _, match := range issue.Matches {
@@ -284,7 +320,11 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 				}
 			}
 			for _, job := range result.Jobs {
-				stats := o.jobAccessor.JobStats(job.Name, nil, start.Add(-index.MaxAge), start.Add(time.Hour))
+				from, to := index.Window(start)
+				if index.To.IsZero() {
+					to = to.Add(time.Hour)
+				}
+				stats := o.jobAccessor.JobStats(job.Name, nil, from, to)
 				var contents string
 				if stats.Count > 0 {
 					percentFail := math.Round(float64(stats.Failures) / float64(stats.Count) * 100)
@@ -308,14 +348,19 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 				}
 				copied := *index
 				copied.MaxAge = o.MaxAge
+				copied.From, copied.To = time.Time{}, time.Time{}
 				copied.ExcludeName = ""
 				copied.IncludeName = fmt.Sprintf("^%s$", regexp.QuoteMeta(job.Name))
 				uriAll := url.URL{Path: "/", RawQuery: copied.Query().Encode()}
 				fmt.Fprintf(bw, "<tr><td colspan=\"4\"><a target=\"_blank\" href=\"%s\">%s</a> <a href=\"%s\">(all)</a>%s</td></tr>\n", template.HTMLEscapeString(uri.String()), template.HTMLEscapeString(job.Name), template.HTMLEscapeString(uriAll.String()), contents)
 				for _, instance := range job.Instances {
-					for _, match := range instance.Matches {
-						age, _ := formatAge(match.LastModified.Time, start, index.MaxAge)
-						fmt.Fprintf(bw, "<tr class=\"row-match\"><td><a target=\"_blank\" href=\"%s\">#%d</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\"></td></tr>\n", template.HTMLEscapeString(instance.URI.String()), instance.Number, template.HTMLEscapeString(match.FileType), template.HTMLEscapeString(age))
+					for i, match := range instance.Matches {
+						age, _ := formatAge(match.LastModified.Time, start, index)
+						var known string
+						if i == 0 {
+							known = knownIssueLinks(instance.KnownIssues)
+						}
+						fmt.Fprintf(bw, "<tr class=\"row-match\"><td><a target=\"_blank\" href=\"%s\">#%d</a></td><td>%s</td><td class=\"text-nowrap\">%s</td><td class=\"col-12\">%s</td></tr>\n", template.HTMLEscapeString(instance.URI.String()), instance.Number, template.HTMLEscapeString(match.FileType), template.HTMLEscapeString(age), known)
 						if index.Context >= 0 {
 							fmt.Fprintf(bw, "<tr class=\"row-match\"><td class=\"\" colspan=\"4\"><pre class=\"small\">")
 							if err := renderLinesString(bw, match.Context, match.MoreLines); err != nil {
@@ -334,7 +379,8 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 		}
 		bw.Flush()
 
-		stats := o.jobAccessor.JobStats("", result.JobNames, start.Add(-index.MaxAge), start)
+		from, to := index.Window(start)
+		stats := o.jobAccessor.JobStats("", result.JobNames, from, to)
 
 		title := fmt.Sprintf("%d runs, %d failing runs, %d matched runs, %d jobs, %d matched jobs", stats.Count, stats.Failures, numRuns, stats.Jobs, len(result.Jobs))
 		fmt.Fprintf(writer, `<p style="position:absolute; top: -2rem;" class="small"><em title="%s">`, template.HTMLEscapeString(title))
@@ -348,12 +394,24 @@ func (o *options) handleIndex(w http.ResponseWriter, req *http.Request) {
 		}
 		fmt.Fprintf(writer, `</em> - <a href="/">clear search</a> | <a href="/chart?%s">chart view</a> - source code located <a target="_blank" href="https://github.com/openshift/ci-search">on github</a></p>`, template.HTMLEscapeString(req.URL.RawQuery))
 
-		if numRuns == 0 && len(result.Bugs) == 0 && len(result.Issues) == 0 {
+		if numRuns == 0 && len(result.Issues) == 0 {
 			fmt.Fprintf(writer, `<p style="padding-top: 1em;"><em>No results found.</em></p><p><em>Search uses <a target="_blank" href="https://docs.rs/regex/0.2.5/regex/#syntax">ripgrep regular-expression patterns</a> to find results. Try simplifying your search or using case-insensitive options.</em></p>`)
 		}
 
 	default:
-		count, err := renderMatches(req.Context(), writer, index, o.generator, start, o)
+		var count int
+		if hit {
+			rendered := cached.(renderedMatches)
+			_, err = writer.Write(rendered.data)
+			count = rendered.count
+		} else {
+			buf := &cappedBuffer{limit: maxCachedPageSize}
+			count, err = renderMatches(ctx, io.MultiWriter(writer, buf), index, o.searcher, start, o)
+			err = o.scheduler.deadlineError(ctx, err)
+			if err == nil && !buf.overflow {
+				o.results.Add(cacheKey, renderedMatches{data: buf.Bytes(), count: count}, start)
+			}
+		}
 		if err != nil {
 			klog.Errorf("Search %q failed with %d results: command failed: %v", index.Search[0], count, err)
 			fmt.Fprintf(writer, `<p class="alert alert-danger">error: %s</p>`, template.HTMLEscapeString(err.Error()))
@@ -464,14 +522,14 @@ func (w *sortableWriter) Write(buf []byte) (int, error) {
 	return w.bw.Write(buf)
 }
 
-func renderMatches(ctx context.Context, w io.Writer, index *Index, generator CommandGenerator, start time.Time, resolver PathResolver) (int, error) {
+func renderMatches(ctx context.Context, w io.Writer, index *Index, searcher Searcher, start time.Time, resolver PathResolver) (int, error) {
 	count, lineCount, matchCount := 0, 0, 0
 	lines := make([][]byte, 0, 64)
 
 	bw := &sortableWriter{sizeLimit: 2 * 1024 * 1024, bw: bufio.NewWriterSize(w, 256*1024)}
 	var lastName string
 	drop := true
-	err := executeGrep(ctx, generator, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
+	err := executeGrep(ctx, searcher, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
 		if lastName == name {
 			// continue accumulating matches
 			if drop {
@@ -511,7 +569,7 @@ func renderMatches(ctx context.Context, w io.Writer, index *Index, generator Com
 				return nil
 			}
 
-			age, recent := formatAge(metadata.LastModified, start, index.MaxAge)
+			age, recent := formatAge(metadata.LastModified, start, index)
 			if !metadata.IgnoreAge && !recent {
 				klog.V(7).Infof("Filtered %s, older than query limit", name)
 				drop = true
@@ -527,10 +585,9 @@ func renderMatches(ctx context.Context, w io.Writer, index *Index, generator Com
 				}
 			}
 			bw.SetIndex(-metadata.LastModified.Unix())
-			switch metadata.FileType {
-			case "bug":
+			if isTrackerFileType(metadata.FileType) {
 				fmt.Fprintf(bw, `<tr><td>%s</td><td><a target="_blank" href="%s">%s</a></td><td class="text-nowrap">%s</td>`, template.HTMLEscapeString(metadata.FileType), template.HTMLEscapeString(metadata.URI.String()), template.HTMLEscapeString(metadata.Name), template.HTMLEscapeString(age))
-			default:
+			} else {
 				fmt.Fprintf(bw, `<tr><td>%s</td><td><a target="_blank" href="%s">%s #%d</a></td><td class="text-nowrap">%s</td>`, template.HTMLEscapeString(metadata.FileType), template.HTMLEscapeString(metadata.URI.String()), template.HTMLEscapeString(metadata.Name), metadata.Number, template.HTMLEscapeString(age))
 			}
 
@@ -569,12 +626,21 @@ func renderMatches(ctx context.Context, w io.Writer, index *Index, generator Com
 	return count, err
 }
 
-func formatAge(t time.Time, from time.Time, maxAge time.Duration) (string, bool) {
+// formatAge returns how long before now t was and whether t is within the
+// window of index.
+func formatAge(t time.Time, now time.Time, index *Index) (string, bool) {
 	if t.IsZero() {
 		return "", true
 	}
-	duration := from.Sub(t)
-	return units.HumanDuration(duration) + " ago", duration <= maxAge
+	return units.HumanDuration(now.Sub(t)) + " ago", index.Includes(t, now)
+}
+
+// formatTime returns t as an RFC3339 time or an empty string if t is not set.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
 }
 
 func trimMatches(matches []bytes.Buffer, lines [][]byte) [][]byte {
@@ -665,7 +731,7 @@ const htmlPageEnd = `
 const htmlIndexForm = `
 <form class="form mt-4 mb-4" method="GET">
 	<div class="input-group input-group-lg mb-2">
-		<input title="A regular expression over the contents of test logs and junit output - uses ripgrep regular expressions" autocomplete="off" autofocus name="search" class="form-control col-auto" value="%s" placeholder="Search OpenShift CI failures by entering a regex search ...">
+		<input title="A regular expression over the contents of test logs and junit output - uses ripgrep regular expressions" autocomplete="off" autofocus name="%s" class="form-control col-auto" value="%s" placeholder="Search OpenShift CI failures by entering a regex search ...">
 		<select title="How far back to search for jobs" name="maxAge" class="form-control custom-select col-1" onchange="this.form.submit();">%s</select>
 		<select title="Number of lines before and after the match to show" name="context" class="form-control custom-select col-1" onchange="this.form.submit();">%s</select>
 		<select title="Type of results to return" name="type" class="form-control custom-select col-1" onchange="this.form.submit();">%s</select>
@@ -677,6 +743,8 @@ const htmlIndexForm = `
 		<input title="A regular expression that matches the name of a job or the title of a bug" class="form-control col-auto" name="excludeName" value="%s" placeholder="Skip job or bug names by regex ...">
 		<input title="The number of matches per job / file to show" autocomplete="off" class="form-control col-1" name="maxMatches" value="%s" placeholder="Max matches per job or bug">
 		<input title="The maximum number of bytes for the response" autocomplete="off" class="form-control col-1" name="maxBytes" value="%s" placeholder="Max bytes to return">
+		<input title="Only include jobs that failed after this RFC3339 time or duration ago, instead of the max age" autocomplete="off" class="form-control col-1" name="from" value="%s" placeholder="From">
+		<input title="Only include jobs that failed before this RFC3339 time or duration ago" autocomplete="off" class="form-control col-1" name="to" value="%s" placeholder="To">
 		<select title="Group results by job (with stats) or no grouping" name="groupBy" class="form-control custom-select col-1" onchange="this.form.submit();">%s</select>
 		<div class="input-group-append"><span class="input-group-text">
 			<input id="wrap" type="checkbox" name="wrap" %s onchange="document.getElementById('results').classList.toggle('nowrap')">
@@ -704,10 +772,17 @@ const htmlEmptyPage = `
 <li><code>^release-</code> - all jobs that start with 'release-'</li>
 <li><code>UpgradeBlocker</code> - bugs that have 'UpgradeBlocker' in their title</li>
 </ul>
+<p>To combine searches across the files of a job run, use a <a href="/?query=junit:timeout+NOT+build-log:%%22image+pull%%22">query</a> instead:
+<ul>
+<li><code>junit:timeout NOT build-log:"image pull"</code> - runs whose JUnit failures mention 'timeout' and whose build log does not mention 'image pull'</li>
+<li><code>etcd AND (apiserver OR "kube-apiserver")</code> - runs that match 'etcd' and either other term in any file</li>
+</ul>
+<p>Terms may be limited to <code>junit:</code>, <code>build-log:</code>, <code>bug:</code>, <code>issue:</code>, or <code>github-issue:</code> results and must be quoted if they contain spaces or parentheses.</p>
+<p>Bugs and issues may be filtered by their fields with the <code>bugStatus</code>, <code>component</code>, <code>targetRelease</code>, <code>assignee</code> and <code>updatedSince</code> parameters, each a comma separated list of accepted values, such as <a href="/?type=bug&amp;bugStatus=NEW,ASSIGNED&amp;component=Etcd&amp;search=timed+out">open Etcd bugs that mention 'timed out'</a>.</p>
 <div id="width"></div>
 <p id="graph">
-<p>Currently indexing %s across %d results, %d failed jobs of %d, %d bugs and %d issues</p>
-</div>
+<p>Currently indexing %s across %d results, %s</p>
+%s</div>
 `
 const htmlEmptyPageGraph = `
 <style>
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"image/color"
@@ -51,7 +52,7 @@ func (o *options) handleChart(w http.ResponseWriter, req *http.Request) {
 	}()
 
 	var err error
-	index, err = parseRequest(req, "chart", o.MaxAge)
+	index, err = parseRequest(req, "chart", o.MaxAge, o.artifacts)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
@@ -59,29 +60,21 @@ func (o *options) handleChart(w http.ResponseWriter, req *http.Request) {
 
 	index.MaxMatches = 1
 
-	counts := make(map[string]int, len(index.Search))
-	var lastJob string
-	err = executeGrep(req.Context(), o.generator, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
-		metadata, err := o.MetadataFor(name)
-		if err != nil {
-			klog.Errorf("unable to resolve metadata for: %s: %v", name, err)
-			return nil
-		}
-		if metadata.URI == nil {
-			return nil
-		}
-
-		uri := metadata.URI.String()
-		if uri != lastJob {
-			lastJob = uri
-			counts[search] += 1
-		}
-		return nil
+	value, created, hit, err := o.results.Get(req.Context(), o.cacheKey("chart", index), func() (interface{}, error) {
+		var counts map[string]int
+		err := o.scheduler.Run(req.Context(), func(ctx context.Context) error {
+			var err error
+			counts, err = o.chartCounts(ctx, index)
+			return err
+		})
+		return counts, err
 	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusBadRequest)
+		searchFailed(w, err, http.StatusBadRequest)
 		return
 	}
+	counts := value.(map[string]int)
+	o.results.SetHeaders(w, hit, created)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	writer := httpwriter.ForRequest(w, req)
@@ -97,6 +90,8 @@ func (o *options) handleChart(w http.ResponseWriter, req *http.Request) {
 
 	err = htmlChart.Execute(writer, map[string]interface{}{
 		"index":          index,
+		"from":           formatTime(index.From),
+		"to":             formatTime(index.To),
 		"colors":         colors,
 		"counts":         counts,
 		"openGraphImage": openGraphImage.String(),
@@ -110,6 +105,34 @@ func (o *options) handleChart(w http.ResponseWriter, req *http.Request) {
 	success = true
 }
 
+// chartCounts returns the number of jobs that match each search in index.
+func (o *options) chartCounts(ctx context.Context, index *Index) (map[string]int, error) {
+	counts := make(map[string]int, len(index.Search))
+	// results for different searches are interleaved, so track the last job for each
+	lastJob := make(map[string]string, len(index.Search))
+	err := executeGrep(ctx, o.searcher, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
+		metadata, err := o.MetadataFor(name)
+		if err != nil {
+			klog.Errorf("unable to resolve metadata for: %s: %v", name, err)
+			return nil
+		}
+		if metadata.URI == nil {
+			return nil
+		}
+
+		uri := metadata.URI.String()
+		if uri != lastJob[search] {
+			lastJob[search] = uri
+			counts[search] += 1
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
 func hexColor(color color.Color) string {
 	r, g, b, _ := color.RGBA()
 	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
@@ -173,6 +196,8 @@ var htmlChart = template.Must(template.New("chart").Funcs(map[string]interface{}
 
       var filter = '{{.index.IncludeName}}';
       var dateRange = {{.index.MaxAge.Seconds}};  // in seconds
+      var fromDate = {{.from}};  // RFC3339, overrides dateRange if set
+      var toDate = {{.to}};  // RFC3339, open ended if not set
       var searchType = '{{.index.SearchType}}';
 
       // {
@@ -294,8 +319,9 @@ var htmlChart = template.Must(template.New("chart").Funcs(map[string]interface{}
       function redraw(interval) {
         var height = window.innerHeight;
         var width = window.innerWidth;
-        var minDate = new Date(Date.now() - dateRange * 1000);
-        var data = jobs.filter(job => color(job) && job.started >= minDate);
+        var minDate = fromDate ? isoParse(fromDate) : new Date(Date.now() - dateRange * 1000);
+        var maxDate = toDate ? isoParse(toDate) : null;
+        var data = jobs.filter(job => color(job) && job.started >= minDate && (!maxDate || job.started <= maxDate));
 
         xScale.domain(d3.extent(data, job => job.started));
         yScale.domain([0, d3.max(data, job => job.duration)]);
@@ -478,6 +504,12 @@ var htmlChart = template.Must(template.New("chart").Funcs(map[string]interface{}
         var searchParams = new URLSearchParams();
         searchParams.append('name', filter);
         searchParams.append('maxAge', dateRange + 's');  // chart is by start, but maxAge is by finish, so no need to expand this to handle drifting relative times.
+        if (fromDate) {
+          searchParams.append('from', fromDate);
+        }
+        if (toDate) {
+          searchParams.append('to', toDate);
+        }
         searchParams.append('context', 0);
         searchParams.append('type', searchType);
         regexps.forEach((_, regexp) => {
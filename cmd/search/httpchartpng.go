@@ -52,7 +52,7 @@ func (o *options) handleChartPNG(w http.ResponseWriter, req *http.Request) {
 	}()
 
 	var err error
-	index, err = parseRequest(req, "chart", o.MaxAge)
+	index, err = parseRequest(req, "chart", o.MaxAge, o.artifacts)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
@@ -72,12 +72,14 @@ func (o *options) handleChartPNG(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	maxTime := time.Now()
-	minTime := maxTime.Add(-index.MaxAge)
-	xScale := float64(width) / index.MaxAge.Seconds()
-	result, err := o.searchResult(req.Context(), index)
+	minTime, maxTime := index.Window(time.Now())
+	if minTime.IsZero() {
+		minTime = maxTime.Add(-o.MaxAge)
+	}
+	xScale := float64(width) / maxTime.Sub(minTime).Seconds()
+	result, err := o.cachedSearchResult(w, req, index)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		searchFailed(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -85,7 +87,7 @@ func (o *options) handleChartPNG(w http.ResponseWriter, req *http.Request) {
 	scatters := make([]*scatter, len(index.Search)+4)
 	for _, job := range jobs {
 		start, stop := job.Status.StartTime.Time, job.Status.CompletionTime.Time
-		if start.Before(minTime) {
+		if start.Before(minTime) || start.After(maxTime) {
 			continue
 		}
 
@@ -25,7 +25,7 @@ func (o *options) handleSearch(w http.ResponseWriter, req *http.Request) {
 	}()
 
 	var err error
-	index, err = parseRequest(req, "text", o.MaxAge)
+	index, err = parseRequest(req, "text", o.MaxAge, o.artifacts)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
@@ -35,10 +35,27 @@ func (o *options) handleSearch(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "The 'search' query parameter is required", http.StatusBadRequest)
 		return
 	}
+	page, err := parsePageRequest(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
 
-	result, err := o.searchResult(req.Context(), index)
+	var result map[string]map[string][]*Match
+	if page.size > 0 {
+		var paged *searchPage
+		paged, err = o.cachedSearchResultPage(w, req, index, page)
+		if err == nil {
+			result = paged.Result()
+			if len(paged.nextPageToken) > 0 {
+				w.Header().Set("X-Next-Page-Token", paged.nextPageToken)
+			}
+		}
+	} else {
+		result, err = o.cachedSearchResult(w, req, index)
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		searchFailed(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -69,7 +86,7 @@ func (o *options) handleSearchV2(w http.ResponseWriter, req *http.Request) {
 	}()
 
 	var err error
-	index, err = parseRequest(req, "text", o.MaxAge)
+	index, err = parseRequest(req, "text", o.MaxAge, o.artifacts)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
@@ -79,20 +96,22 @@ func (o *options) handleSearchV2(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "The 'search' query parameter is required", http.StatusBadRequest)
 		return
 	}
-
-	internalResults, err := o.searchResult(req.Context(), index)
+	page, err := parsePageRequest(req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
 		return
 	}
 
 	result := SearchResponse{
 		Results: make(map[string]SearchResponseResult),
 	}
-	for url, searchResults := range internalResults {
+	add := func(url string, searchResults map[string][]*Match) {
 		for query, matches := range searchResults {
 			for _, match := range matches {
-				match.URL = url
+				// the results may be cached and shared with other requests
+				copied := *match
+				copied.URL = url
+				match := &copied
 				if response, found := result.Results[query]; !found {
 					result.Results[query] = SearchResponseResult{Matches: []*Match{match}}
 				} else {
@@ -102,6 +121,27 @@ func (o *options) handleSearchV2(w http.ResponseWriter, req *http.Request) {
 			}
 		}
 	}
+	if page.size > 0 {
+		paged, err := o.cachedSearchResultPage(w, req, index, page)
+		if err != nil {
+			searchFailed(w, err, http.StatusInternalServerError)
+			return
+		}
+		// pages keep the order of the files
+		for _, file := range paged.files {
+			add(file.key.URI, file.matches)
+		}
+		result.NextPageToken = paged.nextPageToken
+	} else {
+		internalResults, err := o.cachedSearchResult(w, req, index)
+		if err != nil {
+			searchFailed(w, err, http.StatusInternalServerError)
+			return
+		}
+		for url, searchResults := range internalResults {
+			add(url, searchResults)
+		}
+	}
 	data, err := json.Marshal(result)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Unable to serialize result: %v", err), http.StatusInternalServerError)
@@ -128,21 +168,12 @@ func (o *options) searchResult(ctx context.Context, index *Index) (map[string]ma
 		index.MaxMatches = 1
 	}
 
-	err := executeGrep(ctx, o.generator, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
-		metadata, err := o.MetadataFor(name)
-		if err != nil {
-			klog.Errorf("unable to resolve metadata for: %s: %v", name, err)
-			return nil
-		}
-		if metadata.URI == nil {
-			klog.Errorf("Failed to compute job URI for %q", name)
-			return nil
-		}
-		if metadata.FileType != "bug" && metadata.FileType != "issue" && index.JobFilter != nil && !index.JobFilter(metadata.Name) {
+	err := executeGrep(ctx, o.searcher, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
+		uri, match, ok := o.newMatch(index, name, matches, moreLines)
+		if !ok {
 			return nil
 		}
-		uri := metadata.URI.String()
-		_, ok := result[uri]
+		_, ok = result[uri]
 		if !ok {
 			result[uri] = make(map[string][]*Match, 1)
 		}
@@ -152,18 +183,6 @@ func (o *options) searchResult(ctx context.Context, index *Index) (map[string]ma
 			result[uri][search] = make([]*Match, 0, 1)
 		}
 
-		match := &Match{
-			FileType:  metadata.FileType,
-			MoreLines: moreLines,
-			Name:      metadata.Name,
-			Bug:       metadata.Bug,
-			Issue:     metadata.Issue,
-		}
-
-		for _, m := range matches {
-			line := bytes.TrimRightFunc(m.Bytes(), func(r rune) bool { return r == ' ' })
-			match.Context = append(match.Context, string(line))
-		}
 		result[uri][search] = append(result[uri][search], match)
 		return nil
 	})
@@ -171,10 +190,46 @@ func (o *options) searchResult(ctx context.Context, index *Index) (map[string]ma
 	return result, err
 }
 
+// newMatch returns the URI of the result for the file name and a match holding
+// the matched lines, or false if the file should not be reported.
+func (o *options) newMatch(index *Index, name string, matches []bytes.Buffer, moreLines int) (string, *Match, bool) {
+	metadata, err := o.MetadataFor(name)
+	if err != nil {
+		klog.Errorf("unable to resolve metadata for: %s: %v", name, err)
+		return "", nil, false
+	}
+	if metadata.URI == nil {
+		klog.Errorf("Failed to compute job URI for %q", name)
+		return "", nil, false
+	}
+	if !isTrackerFileType(metadata.FileType) && index.JobFilter != nil && !index.JobFilter(metadata.Name) {
+		return "", nil, false
+	}
+
+	match := &Match{
+		FileType:     metadata.FileType,
+		LastModified: metav1.Time{Time: metadata.LastModified},
+		MoreLines:    moreLines,
+		Name:         metadata.Name,
+		Bug:          metadata.Bug,
+		Issue:        metadata.Issue,
+		GitHubIssue:  metadata.GitHubIssue,
+	}
+
+	for _, m := range matches {
+		line := bytes.TrimRightFunc(m.Bytes(), func(r rune) bool { return r == ' ' })
+		match.Context = append(match.Context, string(line))
+	}
+	match.KnownIssues = o.knownIssuesFor(&metadata, match.Context)
+	return metadata.URI.String(), match, true
+}
+
 type SearchJobInstanceResult struct {
 	Number  int
 	URI     *url.URL
 	Matches []Match
+	// KnownIssues are the bugs and issues that reference the run.
+	KnownIssues []KnownIssue
 }
 
 type SearchJobsResult struct {
@@ -183,14 +238,7 @@ type SearchJobsResult struct {
 	Instances []SearchJobInstanceResult
 }
 
-type SearchBugResult struct {
-	Name    string
-	Number  int
-	URI     *url.URL
-	Matches []Match
-}
-
-//jira
+// SearchIssuesResult is a bug or issue of a tracker that matched a search.
 type SearchIssuesResult struct {
 	Name    string
 	Number  int
@@ -202,44 +250,27 @@ type SearchIssuesResult struct {
 type SearchResult struct {
 	Matches int
 
-	Bugs        []SearchBugResult
-	bugByNumber map[int]int
-
-	//jira
-	Issues        []SearchIssuesResult
-	issueByNumber map[int]int
+	Issues     []SearchIssuesResult
+	issueByKey map[string]int
 
 	Jobs      []SearchJobsResult
 	JobNames  sets.String
 	jobByName map[string]int
 }
 
-func (s *SearchResult) BugByNumber(num int) *SearchBugResult {
-	i, ok := s.bugByNumber[num]
-	if ok {
-		return &s.Bugs[i]
-	}
-	if s.bugByNumber == nil {
-		s.bugByNumber = make(map[int]int)
-	}
-	i = len(s.Bugs)
-	s.Bugs = append(s.Bugs, SearchBugResult{Number: num})
-	s.bugByNumber[num] = i
-	return &s.Bugs[i]
-}
-
-//jira
-func (s *SearchResult) IssueByNumber(num int) *SearchIssuesResult {
-	i, ok := s.issueByNumber[num]
+// IssueByKey returns the result for the bug or issue with key, which is unique
+// across trackers.
+func (s *SearchResult) IssueByKey(key string, num int) *SearchIssuesResult {
+	i, ok := s.issueByKey[key]
 	if ok {
 		return &s.Issues[i]
 	}
-	if s.issueByNumber == nil {
-		s.issueByNumber = make(map[int]int)
+	if s.issueByKey == nil {
+		s.issueByKey = make(map[string]int)
 	}
 	i = len(s.Issues)
-	s.Issues = append(s.Issues, SearchIssuesResult{Number: num})
-	s.issueByNumber[num] = i
+	s.Issues = append(s.Issues, SearchIssuesResult{Number: num, Key: key})
+	s.issueByKey[key] = i
 	return &s.Issues[i]
 }
 
@@ -267,7 +298,7 @@ func (o *options) orderedSearchResults(ctx context.Context, index *Index) (*Sear
 	}
 
 	count := 0
-	err := executeGrep(ctx, o.generator, index, result.JobNames, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
+	err := executeGrep(ctx, o.searcher, index, result.JobNames, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
 		metadata, err := o.MetadataFor(name)
 		if err != nil {
 			klog.Errorf("unable to resolve metadata for: %s: %v", name, err)
@@ -277,30 +308,15 @@ func (o *options) orderedSearchResults(ctx context.Context, index *Index) (*Sear
 			klog.Errorf("Failed to compute job URI for %q", name)
 			return nil
 		}
-		if metadata.FileType != "bug" && metadata.FileType != "issue" && index.JobFilter != nil && !index.JobFilter(metadata.Name) {
+		if !isTrackerFileType(metadata.FileType) && index.JobFilter != nil && !index.JobFilter(metadata.Name) {
 			return nil
 		}
-		switch metadata.FileType {
-		case "bug":
-			bug := result.BugByNumber(metadata.Number)
-			if len(bug.Name) == 0 {
-				bug.Name = metadata.Name
-				bug.URI = metadata.URI
-			}
-			bug.Matches = append(bug.Matches, Match{
-				LastModified: metav1.Time{Time: metadata.LastModified},
-				FileType:     metadata.FileType,
-				MoreLines:    moreLines,
-				Context:      trimMatchStrings(matches, make([]string, 0, len(matches))),
-			})
-			count++
-			return nil
-		case "issue":
-			issue := result.IssueByNumber(metadata.Number)
+		switch {
+		case isTrackerFileType(metadata.FileType):
+			issue := result.IssueByKey(metadata.Key, metadata.Number)
 			if len(issue.Name) == 0 {
 				issue.Name = metadata.Name
 				issue.URI = metadata.URI
-				issue.Key = metadata.Key
 			}
 			issue.Matches = append(issue.Matches, Match{
 				LastModified: metav1.Time{Time: metadata.LastModified},
@@ -333,5 +349,18 @@ func (o *options) orderedSearchResults(ctx context.Context, index *Index) (*Sear
 		}
 	})
 	result.Matches = count
+	if o.knownIssues != nil {
+		for i := range result.Jobs {
+			job := &result.Jobs[i]
+			for j := range job.Instances {
+				instance := &job.Instances[j]
+				var lines []string
+				for _, match := range instance.Matches {
+					lines = append(lines, match.Context...)
+				}
+				instance.KnownIssues = o.knownIssues.For(job.Name, instance.Number, o.testFailures.Failures(job.Name, instance.Number), lines)
+			}
+		}
+	}
 	return &result, err
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+// StreamRecord is a single record of a streamed search response. Each match is
+// sent as it is found and the response ends with a summary.
+type StreamRecord struct {
+	// Type is "match" or "summary".
+	Type string `json:"type"`
+	// Search is the search that found the match.
+	Search  string         `json:"search,omitempty"`
+	Match   *Match         `json:"match,omitempty"`
+	Summary *StreamSummary `json:"summary,omitempty"`
+}
+
+// StreamSummary describes all of the matches sent in a streamed search response.
+type StreamSummary struct {
+	// Matches is the number of matches sent.
+	Matches int `json:"matches"`
+	// Results is the number of distinct URLs that matched.
+	Results int `json:"results"`
+	// Bytes is the size of the matched lines that were sent.
+	Bytes int64 `json:"bytes"`
+	// Searches summarizes the matches of each search.
+	Searches map[string]StreamSearchSummary `json:"searches"`
+	// Truncated is true if the search stopped early because it reached the
+	// maximum search length.
+	Truncated bool `json:"truncated"`
+	// Error is set if the search did not complete.
+	Error string `json:"error,omitempty"`
+	// DurationMillis is how long the search took.
+	DurationMillis int64 `json:"durationMillis"`
+}
+
+type StreamSearchSummary struct {
+	Matches int   `json:"matches"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// streamEncoder writes records as newline delimited JSON or as server-sent
+// events, flushing each record to the client.
+type streamEncoder struct {
+	w       *bufio.Writer
+	flusher http.Flusher
+	events  bool
+}
+
+func (e *streamEncoder) Encode(record *StreamRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if e.events {
+		fmt.Fprintf(e.w, "event: %s\ndata: ", record.Type)
+	}
+	e.w.Write(data)
+	if e.events {
+		e.w.WriteString("\n\n")
+	} else {
+		e.w.WriteString("\n")
+	}
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
+
+// acceptsEventStream returns true if the client asked for server-sent events.
+func acceptsEventStream(req *http.Request) bool {
+	for _, header := range req.Header["Accept"] {
+		for _, mediaType := range strings.Split(header, ",") {
+			if i := strings.Index(mediaType, ";"); i != -1 {
+				mediaType = mediaType[:i]
+			}
+			if strings.TrimSpace(mediaType) == "text/event-stream" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o *options) handleSearchStream(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		klog.Infof("Render search stream %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	var err error
+	index, err = parseRequest(req, "text", o.MaxAge, o.artifacts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(index.Search) == 0 {
+		http.Error(w, "The 'search' query parameter is required", http.StatusBadRequest)
+		return
+	}
+	if index.MaxMatches == 0 {
+		index.MaxMatches = 1
+	}
+
+	ctx, done, err := o.scheduler.Admit(req.Context())
+	if err != nil {
+		searchFailed(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer done()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		flusher = nopFlusher{}
+	}
+	encoder := &streamEncoder{w: bufio.NewWriterSize(w, 4096), flusher: flusher, events: acceptsEventStream(req)}
+	if encoder.events {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+
+	summary := &StreamSummary{Searches: make(map[string]StreamSearchSummary, len(index.Search))}
+	uris := sets.NewString()
+	err = executeGrep(ctx, o.searcher, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
+		uri, match, ok := o.newMatch(index, name, matches, moreLines)
+		if !ok {
+			return nil
+		}
+		match.URL = uri
+
+		var size int64
+		for _, line := range match.Context {
+			size += int64(len(line))
+		}
+		searchSummary := summary.Searches[search]
+		searchSummary.Matches++
+		searchSummary.Bytes += size
+		summary.Searches[search] = searchSummary
+		summary.Matches++
+		summary.Bytes += size
+		uris.Insert(uri)
+
+		return encoder.Encode(&StreamRecord{Type: "match", Search: search, Match: match})
+	})
+	err = o.scheduler.deadlineError(ctx, err)
+	if err == ErrMaxBytes {
+		summary.Truncated = true
+		err = nil
+	}
+	if err != nil {
+		klog.Errorf("Search %q failed with %d results: %v", index.Search, summary.Matches, err)
+		summary.Error = err.Error()
+	}
+	summary.Results = uris.Len()
+	summary.DurationMillis = time.Since(start).Milliseconds()
+
+	if err := encoder.Encode(&StreamRecord{Type: "summary", Summary: summary}); err != nil {
+		klog.Errorf("Failed to write response: %v", err)
+		return
+	}
+
+	success = summary.Error == ""
+}
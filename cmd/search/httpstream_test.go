@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_handleSearchStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	for _, job := range []string{"1", "2"} {
+		jobDir := filepath.Join(dir, "jobs", "origin-ci-test", "logs", "job-a", job)
+		if err := os.MkdirAll(jobDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(jobDir, "junit.failures")
+		if err := ioutil.WriteFile(path, []byte("# test\nfailed: timeout waiting\nerror: image pull\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.ci.openshift.org/view/gs/")
+	o := &options{
+		MaxAge:       time.Hour,
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		searcher:     NewInProcessSearcher(dir, staticPaths(paths), nil, 1),
+	}
+
+	tests := []struct {
+		name   string
+		accept string
+		query  string
+		want   StreamSummary
+	}{
+		{
+			name:  "ndjson",
+			query: "search=timeout&search=image",
+			want:  StreamSummary{Matches: 4, Results: 2, Bytes: 172},
+		},
+		{
+			name:   "events",
+			accept: "text/event-stream",
+			query:  "search=timeout",
+			want:   StreamSummary{Matches: 2, Results: 2, Bytes: 92},
+		},
+		{
+			name:  "truncated",
+			query: "search=timeout&maxBytes=10",
+			want:  StreamSummary{Matches: 1, Results: 1, Bytes: 46, Truncated: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v3/search/stream?"+tt.query, nil)
+			if len(tt.accept) > 0 {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			o.handleSearchStream(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+			}
+
+			var records []StreamRecord
+			scanner := bufio.NewScanner(w.Body)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if len(tt.accept) > 0 {
+					if !strings.HasPrefix(line, "data: ") {
+						continue
+					}
+					line = strings.TrimPrefix(line, "data: ")
+				}
+				var record StreamRecord
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("invalid record %q: %v", line, err)
+				}
+				records = append(records, record)
+			}
+
+			if len(records) != tt.want.Matches+1 {
+				t.Fatalf("unexpected records: %#v", records)
+			}
+			for _, record := range records[:len(records)-1] {
+				if record.Type != "match" || record.Match == nil || !strings.HasPrefix(record.Match.URL, "https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/job-a/") {
+					t.Errorf("unexpected match record: %#v", record)
+				}
+			}
+			summary := records[len(records)-1]
+			if summary.Type != "summary" || summary.Summary == nil {
+				t.Fatalf("expected a summary record, got %#v", summary)
+			}
+			got := *summary.Summary
+			if got.Matches != tt.want.Matches || got.Results != tt.want.Results || got.Bytes != tt.want.Bytes || got.Truncated != tt.want.Truncated || len(got.Error) > 0 {
+				t.Errorf("unexpected summary: %#v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+// maxIngestBytes limits the size of a run pushed to /ingest.
+const maxIngestBytes = 256 * 1024 * 1024
+
+// parseIngestTime accepts RFC3339 or seconds since the epoch.
+func parseIngestTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func readFormFile(header *multipart.FileHeader) ([]byte, error) {
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func parseIngestRequest(req *http.Request) (*prow.IngestRun, error) {
+	if err := req.ParseMultipartForm(32 * 1024 * 1024); err != nil {
+		return nil, fmt.Errorf("unable to read multipart form: %v", err)
+	}
+	form := req.MultipartForm
+	defer form.RemoveAll()
+
+	run := &prow.IngestRun{
+		Job:     req.FormValue("job"),
+		BuildID: req.FormValue("build"),
+		State:   req.FormValue("state"),
+		URL:     req.FormValue("url"),
+	}
+	var err error
+	if run.Started, err = parseIngestTime(req.FormValue("started")); err != nil {
+		return nil, fmt.Errorf("started must be RFC3339 or seconds since the epoch: %v", err)
+	}
+	if run.Finished, err = parseIngestTime(req.FormValue("finished")); err != nil {
+		return nil, fmt.Errorf("finished must be RFC3339 or seconds since the epoch: %v", err)
+	}
+	for _, header := range form.File["junit"] {
+		data, err := readFormFile(header)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read junit file %s: %v", header.Filename, err)
+		}
+		run.JUnit = append(run.JUnit, data)
+	}
+	if headers := form.File["build-log"]; len(headers) > 0 {
+		if run.BuildLog, err = readFormFile(headers[0]); err != nil {
+			return nil, fmt.Errorf("unable to read build log: %v", err)
+		}
+	}
+	if err := run.Validate(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// bearerToken returns the token of the Authorization header of req, or false if
+// the header does not use the Bearer scheme.
+func bearerToken(req *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
+}
+
+func (o *options) handleIngest(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var success bool
+	defer func() {
+		klog.Infof("Render ingest duration=%s success=%t", time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	if o.ingest == nil {
+		http.Error(w, "Ingestion is not enabled.", http.StatusNotFound)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Runs must be sent with POST.", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := bearerToken(req)
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(o.ingestToken)) != 1 {
+		http.Error(w, "A valid bearer token is required.", http.StatusUnauthorized)
+		return
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, maxIngestBytes)
+	run, err := parseIngestRequest(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), time.Minute)
+	defer cancel()
+	job, written, err := o.ingest.Ingest(ctx, run)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to save run: %v", err), http.StatusInternalServerError)
+		return
+	}
+	o.jobsIndex.Notify(written)
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to write job: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if _, err := w.Write(data); err != nil {
+		klog.Errorf("Failed to write response: %v", err)
+		return
+	}
+	success = true
+}
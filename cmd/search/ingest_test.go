@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_handleIngest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jobURIPrefix, _ := url.Parse("https://prow.ci.openshift.org/view/gs/")
+	o := &options{
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{},
+		ingestToken:  "secret",
+		ingest:       prow.NewIngestStore(filepath.Join(dir, "jobs"), 0, prow.DefaultArtifactRules),
+	}
+	o.links = &runLinks{ingest: o.ingest}
+
+	body := func(fields map[string]string) (*bytes.Buffer, string) {
+		buf := &bytes.Buffer{}
+		w := multipart.NewWriter(buf)
+		for k, v := range fields {
+			w.WriteField(k, v)
+		}
+		f, _ := w.CreateFormFile("junit", "junit.xml")
+		f.Write([]byte(`<testsuite name="e2e"><testcase name="fails"><failure>boom</failure></testcase></testsuite>`))
+		w.Close()
+		return buf, w.FormDataContentType()
+	}
+	fields := map[string]string{
+		"job":      "actions-e2e",
+		"build":    "7",
+		"state":    "failure",
+		"url":      "https://github.com/org/repo/actions/runs/7",
+		"started":  "1600000000",
+		"finished": time.Unix(1600000600, 0).UTC().Format(time.RFC3339),
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		fields        map[string]string
+		want          int
+	}{
+		{name: "unauthorized", authorization: "Bearer wrong", fields: fields, want: http.StatusUnauthorized},
+		{name: "no scheme", authorization: "secret", fields: fields, want: http.StatusUnauthorized},
+		{name: "other scheme", authorization: "Basic secret", fields: fields, want: http.StatusUnauthorized},
+		{name: "invalid", authorization: "Bearer secret", fields: map[string]string{"job": "actions-e2e"}, want: http.StatusBadRequest},
+		{name: "saved", authorization: "Bearer secret", fields: fields, want: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, contentType := body(tt.fields)
+			req := httptest.NewRequest("POST", "/ingest", buf)
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+			o.handleIngest(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	result, err := o.MetadataFor("jobs/ingest/logs/actions-e2e/7/junit.failures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.URI.String() != "https://github.com/org/repo/actions/runs/7" || result.Name != "actions-e2e" || result.Number != 7 {
+		t.Errorf("unexpected result: %#v", result)
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"sort"
 	"time"
 
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
 
 	"github.com/openshift/ci-search/pkg/httpwriter"
@@ -62,3 +66,51 @@ func (o *options) handleJobs(w http.ResponseWriter, req *http.Request) {
 
 	success = true
 }
+
+// jobSnapshotInterval is how often the known jobs are saved under --path.
+const jobSnapshotInterval = 5 * time.Minute
+
+// readJobSnapshot returns the jobs saved under --path before the process
+// restarted that have not expired.
+func (o *options) readJobSnapshot() []*prow.Job {
+	path := filepath.Join(o.Path, prow.JobSnapshotFile)
+	jobs, err := prow.ReadJobSnapshot(path, o.MaxAge)
+	if err != nil {
+		klog.Errorf("Unable to restore jobs from %s: %v", path, err)
+		return nil
+	}
+	klog.Infof("Restored %d jobs from %s", len(jobs), path)
+	return jobs
+}
+
+// restoreJobs adds jobs to the cache of informer before it starts so they are
+// counted while it first lists jobs, and saves the jobs it lists under --path
+// once it has synced.
+func (o *options) restoreJobs(ctx context.Context, informer cache.SharedIndexInformer, lister *prow.Lister, jobs []*prow.Job) {
+	for _, job := range jobs {
+		if err := informer.GetIndexer().Add(job); err != nil {
+			klog.Errorf("Unable to restore job %s: %v", job.Name, err)
+		}
+	}
+	if o.NoIndex {
+		return
+	}
+	path := filepath.Join(o.Path, prow.JobSnapshotFile)
+	go func() {
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			return
+		}
+		wait.Until(func() {
+			jobs, err := lister.List(labels.Everything())
+			if err != nil {
+				klog.Errorf("Unable to list jobs to save: %v", err)
+				return
+			}
+			if err := prow.WriteJobSnapshot(path, jobs); err != nil {
+				klog.Errorf("Unable to save jobs to %s: %v", path, err)
+				return
+			}
+			klog.V(4).Infof("Saved %d jobs to %s", len(jobs), path)
+		}, jobSnapshotInterval, ctx.Done())
+	}()
+}
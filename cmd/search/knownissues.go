@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/pkg/signature"
+	"github.com/openshift/ci-search/prow"
+)
+
+// KnownIssue is a bug or issue of a tracker that references a job run, one of the
+// tests that failed in it, or one of its failure messages.
+type KnownIssue struct {
+	// Type is the file type of the item, such as "bug" or "issue".
+	Type string `json:"type"`
+	// Key is the bug number or the issue key.
+	Key string `json:"key"`
+	// Name identifies the item to users, such as "Bug 123".
+	Name   string `json:"name"`
+	Title  string `json:"title"`
+	Status string `json:"status,omitempty"`
+	URL    string `json:"url"`
+	// Reasons lists how the issue references the run: "run" if it links to
+	// the run, "test" if it names a test that failed in the run and "failure"
+	// if it quotes a line of a failure or of the matched text.
+	Reasons []string `json:"reasons"`
+}
+
+const (
+	// knownIssueMinLine is the length a quoted line must have to be matched,
+	// so that short and common lines do not link unrelated issues.
+	knownIssueMinLine = 16
+	// knownIssueMaxShared is the number of issues a line or word may appear
+	// in before it is considered boilerplate and ignored.
+	knownIssueMaxShared = 10
+	// knownIssueMinTest is the length a test name must have to be matched
+	// within the text of an issue.
+	knownIssueMinTest = 6
+)
+
+// knownIssueRunPattern matches the job name and build number in the links to
+// job runs in Prow, GCS and the artifact browser.
+var knownIssueRunPattern = regexp.MustCompile(`/(?:logs|pr-logs/pull/(?:[^/\s]+/)?\d+)/([^/\s?#"'<>\]|]+)/(\d+)\b`)
+
+// knownIssueIndex maps the runs, test names and failure lines referenced by the
+// description and comments of bugs and issues to those items.
+type knownIssueIndex struct {
+	lock   sync.Mutex
+	issues []KnownIssue
+	// runs maps a run key to the position of the issues that link it
+	runs map[string][]int
+	// lines maps a normalized line to the position of the issues that
+	// contain it
+	lines map[string][]int
+	// words maps each word of the text of the issues to the position of the
+	// issues that contain it, so that test names are found within sentences.
+	// common are the words left out because too many issues contain them.
+	words  map[string][]int
+	common map[string]struct{}
+	// generation changes each time the index is rebuilt
+	generation uint64
+
+	// trackerGenerations are the generations of the trackers the index was
+	// built from
+	trackerGenerations []uint64
+}
+
+// knownIssueBuilder accumulates the references of each issue.
+type knownIssueBuilder struct {
+	issues []KnownIssue
+	runs   map[string][]int
+	lines  map[string][]int
+	words  map[string][]int
+}
+
+func (b *knownIssueBuilder) add(issue KnownIssue, texts ...string) {
+	i := len(b.issues)
+	b.issues = append(b.issues, issue)
+	runs := make(map[string]struct{})
+	lines := make(map[string]struct{})
+	words := make(map[string]struct{})
+	for _, text := range texts {
+		for _, m := range knownIssueRunPattern.FindAllStringSubmatch(text, -1) {
+			if number, err := strconv.Atoi(m[2]); err == nil {
+				runs[runKey(m[1], number)] = struct{}{}
+			}
+		}
+		for _, line := range strings.Split(text, "\n") {
+			if line := knownIssueLine(line); len(line) > 0 {
+				lines[line] = struct{}{}
+			}
+		}
+		for _, word := range knownIssueWords(text) {
+			words[word] = struct{}{}
+		}
+	}
+	for key := range runs {
+		b.runs[key] = append(b.runs[key], i)
+	}
+	for line := range lines {
+		b.lines[line] = append(b.lines[line], i)
+	}
+	for word := range words {
+		b.words[word] = append(b.words[word], i)
+	}
+}
+
+// knownIssueWords splits text into words, removing the punctuation and quotes
+// around them.
+func knownIssueWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(text, unicode.IsSpace) {
+		if word = strings.Trim(word, ".,:;!?()[]{}<>\"'`*"); len(word) > 0 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// testIssues returns the position of the issues that contain every word of
+// name that is not common, or nil if every word is common.
+func (k *knownIssueIndex) testIssues(name string) []int {
+	if len(strings.TrimSpace(name)) < knownIssueMinTest {
+		return nil
+	}
+	var matched map[int]struct{}
+	for _, word := range knownIssueWords(name) {
+		if _, ok := k.common[word]; ok {
+			continue
+		}
+		positions := k.words[word]
+		next := make(map[int]struct{}, len(positions))
+		for _, i := range positions {
+			if _, ok := matched[i]; matched == nil || ok {
+				next[i] = struct{}{}
+			}
+		}
+		if matched = next; len(matched) == 0 {
+			return nil
+		}
+	}
+	if matched == nil {
+		return nil
+	}
+	positions := make([]int, 0, len(matched))
+	for i := range matched {
+		positions = append(positions, i)
+	}
+	return positions
+}
+
+// knownIssueLine returns the normalized form of a line quoted in an issue or
+// found in a run, or an empty string if the line is too short to match.
+func knownIssueLine(line string) string {
+	line = strings.TrimSpace(line)
+	// remove the markup used to quote text in Bugzilla, Markdown and Jira
+	line = strings.TrimLeft(line, "> ")
+	for _, markup := range []string{"```", "{code}", "{noformat}", "`", "\"", "'"} {
+		line = strings.TrimPrefix(strings.TrimSuffix(line, markup), markup)
+	}
+	if len(line) < knownIssueMinLine {
+		return ""
+	}
+	return signature.Normalize(line)
+}
+
+// Sync rebuilds the index if the bugs or issues of trackers changed since the
+// last call.
+func (k *knownIssueIndex) Sync(trackers []trackerSource) {
+	generations := make([]uint64, 0, len(trackers))
+	for _, tracker := range trackers {
+		generations = append(generations, tracker.Generation())
+	}
+	k.lock.Lock()
+	unchanged := k.generation > 0 && reflect.DeepEqual(k.trackerGenerations, generations)
+	k.lock.Unlock()
+	if unchanged {
+		return
+	}
+
+	start := time.Now()
+	b := &knownIssueBuilder{runs: make(map[string][]int), lines: make(map[string][]int), words: make(map[string][]int)}
+	for _, tracker := range trackers {
+		if tracker.Enabled() {
+			tracker.KnownIssues(b.add)
+		}
+	}
+	for line, positions := range b.lines {
+		if len(positions) > knownIssueMaxShared {
+			delete(b.lines, line)
+		}
+	}
+	common := make(map[string]struct{})
+	for word, positions := range b.words {
+		if len(positions) > knownIssueMaxShared {
+			common[word] = struct{}{}
+			delete(b.words, word)
+		}
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.issues, k.runs, k.lines, k.words, k.common = b.issues, b.runs, b.lines, b.words, common
+	k.trackerGenerations = generations
+	k.generation++
+	klog.Infof("Refreshed known issue index in %s, %d issues reference %d runs, %d lines and %d words", time.Now().Sub(start).Truncate(time.Millisecond), len(b.issues), len(b.runs), len(b.lines), len(b.words))
+}
+
+// Generation returns a counter that changes whenever the index is rebuilt.
+func (k *knownIssueIndex) Generation() uint64 {
+	if k == nil {
+		return 0
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.generation
+}
+
+// For returns the issues that reference the run of job with the given number,
+// the tests in failures, or one of lines, ordered by the number of references.
+func (k *knownIssueIndex) For(job string, number int, failures []prow.TestFailure, lines []string) []KnownIssue {
+	if k == nil {
+		return nil
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if len(k.issues) == 0 {
+		return nil
+	}
+
+	reasons := make(map[int][]string)
+	add := func(positions []int, reason string) {
+		for _, i := range positions {
+			if !contains(reasons[i], reason) {
+				reasons[i] = append(reasons[i], reason)
+			}
+		}
+	}
+	add(k.runs[runKey(job, number)], "run")
+	for _, failure := range failures {
+		add(k.lines[knownIssueLine(failure.Name)], "test")
+		add(k.testIssues(failure.Name), "test")
+		if len(failure.Signature) >= knownIssueMinLine {
+			add(k.lines[failure.Signature], "failure")
+		}
+	}
+	for _, line := range lines {
+		if line := knownIssueLine(line); len(line) > 0 {
+			add(k.lines[line], "failure")
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	known := make([]KnownIssue, 0, len(reasons))
+	for i, r := range reasons {
+		issue := k.issues[i]
+		issue.Reasons = r
+		known = append(known, issue)
+	}
+	sort.Slice(known, func(i, j int) bool {
+		if len(known[i].Reasons) != len(known[j].Reasons) {
+			return len(known[i].Reasons) > len(known[j].Reasons)
+		}
+		return known[i].URL < known[j].URL
+	})
+	return known
+}
+
+// knownIssuesFor returns the issues that reference the job run in metadata or
+// one of the matched lines.
+func (o *options) knownIssuesFor(metadata *Result, lines []string) []KnownIssue {
+	if o.knownIssues == nil || isTrackerFileType(metadata.FileType) {
+		return nil
+	}
+	return o.knownIssues.For(metadata.Name, metadata.Number, o.testFailures.Failures(metadata.Name, metadata.Number), lines)
+}
+
+// knownIssueLinks renders links to issues for the search results page.
+func knownIssueLinks(issues []KnownIssue) string {
+	var links []string
+	for _, issue := range issues {
+		title := fmt.Sprintf("%s %s (references the %s)", issue.Title, issue.Status, strings.Join(issue.Reasons, ", "))
+		links = append(links, fmt.Sprintf(`<a target="_blank" class="badge badge-info" title="%s" href="%s">%s</a>`, template.HTMLEscapeString(title), template.HTMLEscapeString(issue.URL), template.HTMLEscapeString(issue.Name)))
+	}
+	return strings.Join(links, " ")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/ci-search/bugzilla"
+	"github.com/openshift/ci-search/pkg/tracker"
+	"github.com/openshift/ci-search/prow"
+)
+
+type fakeBugStore []*bugzilla.BugComments
+
+func (s fakeBugStore) Sync(keys []string) ([]tracker.Item, error) {
+	items := make([]tracker.Item, 0, len(s))
+	for _, bug := range s {
+		items = append(items, bug)
+	}
+	return items, nil
+}
+func (s fakeBugStore) NotifyChanged(name string)     {}
+func (s fakeBugStore) Close(item tracker.Item) error { return nil }
+
+func Test_knownIssueIndex(t *testing.T) {
+	bug := func(id int, summary string, comments ...string) *bugzilla.BugComments {
+		b := &bugzilla.BugComments{
+			ObjectMeta: metav1.ObjectMeta{Name: strconv.Itoa(id)},
+			Info:       bugzilla.BugInfo{ID: id, Summary: summary, Status: "NEW"},
+		}
+		for _, text := range comments {
+			b.Comments = append(b.Comments, bugzilla.BugComment{Text: text})
+		}
+		return b
+	}
+	bugs := bugzilla.NewCommentStore(nil, 0, false, fakeBugStore{
+		bug(1, "e2e-aws fails", "Seen in https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/periodic-e2e-aws/1234 again"),
+		bug(2, "[sig-network] services should serve endpoints"),
+		bug(3, "etcd is slow", "The log shows:\n\n> etcdserver: request timed out after 5s\n\nok"),
+		bug(4, "TestFoo fails on aws"),
+		bug(5, "flaky tests", "TestFooBar times out, see \"[sig-storage] CSI volumes should mount (ephemeral)\"."),
+	})
+	if err := bugs.Load(); err != nil {
+		t.Fatal(err)
+	}
+	bugURIPrefix, _ := url.Parse("https://bugzilla.redhat.com/show_bug.cgi")
+
+	index := &knownIssueIndex{}
+	index.Sync([]trackerSource{&bugzillaSource{uriPrefix: bugURIPrefix, store: bugs}})
+	if index.Generation() == 0 {
+		t.Fatal("expected the index to be built")
+	}
+
+	tests := []struct {
+		name     string
+		number   int
+		failures []prow.TestFailure
+		lines    []string
+		want     map[string][]string
+	}{
+		{name: "unrelated", number: 1, lines: []string{"error: image pull failed"}},
+		{name: "linked run", number: 1234, want: map[string][]string{"1": {"run"}}},
+		{name: "failed test", number: 1, failures: []prow.TestFailure{{Name: "[sig-network] services should serve endpoints"}}, want: map[string][]string{"2": {"test"}}},
+		{name: "test named in text", number: 1, failures: []prow.TestFailure{{Name: "TestFoo"}}, want: map[string][]string{"4": {"test"}}},
+		{name: "test quoted in a sentence", number: 1, failures: []prow.TestFailure{{Name: "[sig-storage] CSI volumes should mount (ephemeral)"}}, want: map[string][]string{"5": {"test"}}},
+		{name: "quoted line", number: 1, lines: []string{"  etcdserver: request timed out after 12s"}, want: map[string][]string{"3": {"failure"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string][]string
+			for _, issue := range index.For("periodic-e2e-aws", tt.number, tt.failures, tt.lines) {
+				if got == nil {
+					got = make(map[string][]string)
+				}
+				got[issue.Key] = issue.Reasons
+				if issue.URL != "https://bugzilla.redhat.com/show_bug.cgi?id="+issue.Key {
+					t.Errorf("unexpected url %s", issue.URL)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"flag"
 	"fmt"
@@ -12,8 +11,8 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -22,22 +21,19 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	gcpoption "google.golang.org/api/option"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
-	jiraClient "k8s.io/test-infra/prow/jira"
 
-	"github.com/openshift/ci-search/bugzilla"
-	"github.com/openshift/ci-search/jira"
 	"github.com/openshift/ci-search/metricdb"
 	"github.com/openshift/ci-search/metricdb/httpgraph"
 	"github.com/openshift/ci-search/pkg/proc"
 	"github.com/openshift/ci-search/prow"
 	"github.com/openshift/ci-search/static"
+	"github.com/openshift/ci-search/walk"
 )
 
 func main() {
@@ -55,6 +51,16 @@ func main() {
 		JobURIPrefix:      "https://prow.ci.openshift.org/view/gs/",
 		ArtifactURIPrefix: "https://storage.googleapis.com/",
 		IndexBucket:       "origin-ci-test",
+		SearchCacheSize:   64,
+
+		artifacts: prow.DefaultArtifactRules,
+
+		MaxConcurrentSearches: 8,
+		MaxQueuedSearches:     32,
+		SearchQueueTimeout:    30 * time.Second,
+		SearchTimeout:         2 * time.Minute,
+
+		Backfill: backfillOptions{Workers: 10},
 	}
 	cmd := &cobra.Command{
 		Run: func(cmd *cobra.Command, arguments []string) {
@@ -65,32 +71,87 @@ func main() {
 	}
 	flag := cmd.Flags()
 
-	flag.StringVar(&opt.Path, "path", opt.Path, "The directory to save index results to.")
+	cmd.PersistentFlags().StringVar(&opt.Path, "path", opt.Path, "The directory to save index results to.")
 	flag.StringVar(&opt.ListenAddr, "listen", opt.ListenAddr, "The address to serve search results on")
 	flag.StringVar(&opt.DebugAddr, "debug-listen", opt.DebugAddr, "The address to serve debug handlers on")
-	flag.AddGoFlag(original.Lookup("v"))
+	cmd.PersistentFlags().AddGoFlag(original.Lookup("v"))
 
 	flag.DurationVar(&opt.MaxAge, "max-age", opt.MaxAge, "The maximum age of entries to keep cached. Set to 0 to keep all. Defaults to 14 days.")
 	flag.DurationVar(&opt.Interval, "interval", opt.Interval, "(Disabled) The interval to index jobs.")
 	flag.StringVar(&opt.ConfigPath, "config", opt.ConfigPath, "(Disabled) Path on disk to a testgrid config for indexing.")
 	flag.StringVar(&opt.GCPServiceAccount, "gcp-service-account", opt.GCPServiceAccount, "(Disabled) Path to a GCP service account file.")
-	flag.StringVar(&opt.JobURIPrefix, "job-uri-prefix", opt.JobURIPrefix, "URI prefix for converting job-detail pages to index names.  For example, https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/release-openshift-origin-installer-e2e-aws-4.1/309 has an index name of origin-ci-test/logs/release-openshift-origin-installer-e2e-aws-4.1/309 with the default job-URI prefix.")
+	cmd.PersistentFlags().StringVar(&opt.JobURIPrefix, "job-uri-prefix", opt.JobURIPrefix, "URI prefix for converting job-detail pages to index names.  For example, https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/release-openshift-origin-installer-e2e-aws-4.1/309 has an index name of origin-ci-test/logs/release-openshift-origin-installer-e2e-aws-4.1/309 with the default job-URI prefix.")
 	flag.StringVar(&opt.ArtifactURIPrefix, "artifact-uri-prefix", opt.ArtifactURIPrefix, "URI prefix for artifacts.  For example, origin-ci-test/logs/release-openshift-origin-installer-e2e-aws-4.1/309 has build logs at https://storage.googleapis.com/origin-ci-test/logs/release-openshift-origin-installer-e2e-aws-4.1/309/build-log.txt with the default artifact-URI prefix.")
+	cmd.PersistentFlags().StringVar(&opt.ArtifactConfigPath, "artifact-config", opt.ArtifactConfigPath, "A YAML file listing the artifacts of failed jobs to download and search in addition to the build log.")
 	flag.StringVar(&opt.DeckURI, "deck-uri", opt.DeckURI, "URL to the Deck server to index prow job failures into search.")
 	flag.StringVar(&opt.IndexBucket, "index-bucket", opt.IndexBucket, "A GCS bucket to look for job indices in.")
+	flag.StringVar(&opt.IngestTokenPath, "ingest-token-file", opt.IngestTokenPath, "A file with the bearer token that authorizes runs pushed to /ingest. If empty, ingestion is disabled.")
 	flag.StringVar(&opt.MetricDBPath, "metric-db", opt.MetricDBPath, "Path where metrics should be recorded as a SQLite database. If empty, no metrics will be stored.")
 	flag.DurationVar(&opt.MetricMaxAge, "metric-max-age", opt.MetricMaxAge, "The maximum age to retain metrics. If negative, metrics are retained forever. If zero, no metrics are gathered.")
 
-	flag.StringVar(&opt.BugzillaURL, "bugzilla-url", opt.BugzillaURL, "The URL of a bugzilla server to index bugs from.")
+	cmd.PersistentFlags().StringVar(&opt.BugzillaURL, "bugzilla-url", opt.BugzillaURL, "The URL of a bugzilla server to index bugs from.")
 	flag.StringVar(&opt.BugzillaTokenPath, "bugzilla-token-file", opt.BugzillaTokenPath, "A file to read a bugzilla token from.")
 	flag.StringVar(&opt.BugzillaSearch, "bugzilla-search", opt.BugzillaSearch, "A quicksearch query to search for bugs to index.")
 
 	// jira
-	flag.StringVar(&opt.JiraURL, "jira-url", opt.JiraURL, "The URL of a Jira server to index issues from.")
+	cmd.PersistentFlags().StringVar(&opt.JiraURL, "jira-url", opt.JiraURL, "The URL of a Jira server to index issues from.")
 	flag.StringVar(&opt.JiraTokenPath, "jira-token-file", opt.JiraTokenPath, "A file to read a Jira token from.")
 	flag.StringVar(&opt.JiraSearch, "jira-search", opt.JiraSearch, "A JQL query to search for issues to index.")
 
+	cmd.PersistentFlags().StringSliceVar(&opt.GitHubRepos, "github-repos", opt.GitHubRepos, "A comma-separated list of GitHub repositories in the form org/repo to index issues from.")
+	flag.StringVar(&opt.GitHubSearch, "github-search", opt.GitHubSearch, "An issue search added to the repositories in --github-repos to select the issues to index, for example 'label:ci-failure'.")
+	flag.StringVar(&opt.GitHubTokenPath, "github-token-file", opt.GitHubTokenPath, "A file to read a GitHub token from. If empty, the much lower rate limit of anonymous requests applies.")
+
 	flag.BoolVar(&opt.NoIndex, "disable-indexing", opt.NoIndex, "Disable all indexing to disk.")
+	flag.StringToStringVar(&opt.DiskQuotas, "disk-quota", opt.DiskQuotas, "The maximum size on disk of each source, for example jobs=50GB,bugs=1GB,issues=1GB,github-issues=1GB. When a source is larger, the artifacts of passing runs are removed first, then the oldest build logs and other artifacts, then the oldest JUnit results.")
+
+	cmd.PersistentFlags().StringVar(&opt.SearchBackend, "search-backend", opt.SearchBackend, "The implementation used to search indexed files: 'rg' to invoke ripgrep or 'go' to search in-process. Defaults to ripgrep if it is on the path.")
+	cmd.PersistentFlags().IntVar(&opt.SearchWorkers, "search-workers", opt.SearchWorkers, "The number of files the in-process search backend reads in parallel. Defaults to the number of CPUs.")
+	flag.BoolVar(&opt.NoTrigramIndex, "disable-trigram-index", opt.NoTrigramIndex, "Search every file instead of using the trigram index to skip files that cannot match.")
+	flag.IntVar(&opt.SearchCacheSize, "search-cache-size", opt.SearchCacheSize, "The number of recent search results to keep in memory. Set to 0 to disable caching.")
+	flag.IntVar(&opt.MaxConcurrentSearches, "max-concurrent-searches", opt.MaxConcurrentSearches, "The number of searches that may run at once. Set to 0 to allow any number.")
+	flag.IntVar(&opt.MaxQueuedSearches, "max-queued-searches", opt.MaxQueuedSearches, "The number of searches that may wait for a running search to complete. Additional searches are rejected.")
+	flag.DurationVar(&opt.SearchQueueTimeout, "search-queue-timeout", opt.SearchQueueTimeout, "How long a search waits to start before it is rejected.")
+	flag.DurationVar(&opt.SearchTimeout, "search-timeout", opt.SearchTimeout, "The maximum time a single search may run. Set to 0 for no limit.")
+
+	queryCmd := &cobra.Command{
+		Use:   "query [SEARCH...]",
+		Short: "Search the results previously saved under --path and print them without starting the server",
+		RunE: func(cmd *cobra.Command, arguments []string) error {
+			return opt.RunQuery(os.Stdout, arguments)
+		},
+	}
+	flag = queryCmd.Flags()
+	flag.StringVar(&opt.Offline.Query, "query", opt.Offline.Query, "A query combining several terms with AND, OR and NOT instead of search arguments.")
+	flag.StringVar(&opt.Offline.SearchType, "type", opt.Offline.SearchType, "The type of results to search: 'bug', 'issue', 'github-issue', 'junit', 'build-log', 'all' or a combination such as 'bug+junit'.")
+	flag.StringVar(&opt.Offline.IncludeName, "name", opt.Offline.IncludeName, "A regular expression that job names must match.")
+	flag.StringVar(&opt.Offline.ExcludeName, "exclude-name", opt.Offline.ExcludeName, "A regular expression that job names must not match.")
+	flag.DurationVar(&opt.Offline.MaxAge, "max-age", opt.Offline.MaxAge, "How far back to search for jobs. Set to 0 to search everything saved.")
+	flag.StringVar(&opt.Offline.From, "from", opt.Offline.From, "Only include jobs that failed after this RFC3339 time or duration ago.")
+	flag.StringVar(&opt.Offline.To, "to", opt.Offline.To, "Only include jobs that failed before this RFC3339 time or duration ago.")
+	flag.IntVar(&opt.Offline.Context, "context", opt.Offline.Context, "The number of lines before and after each match to print.")
+	flag.IntVar(&opt.Offline.MaxMatches, "max-matches", opt.Offline.MaxMatches, "The number of matches to print per file.")
+	flag.StringVar(&opt.Offline.BugStatus, "bug-status", opt.Offline.BugStatus, "Only include bugs and issues with one of these comma separated statuses.")
+	flag.StringVar(&opt.Offline.Component, "component", opt.Offline.Component, "Only include bugs and issues in one of these comma separated components.")
+	flag.StringVar(&opt.Offline.TargetRelease, "target-release", opt.Offline.TargetRelease, "Only include bugs and issues targeting one of these comma separated releases.")
+	flag.StringVar(&opt.Offline.Assignee, "assignee", opt.Offline.Assignee, "Only include bugs and issues assigned to one of these comma separated users.")
+	flag.StringVar(&opt.Offline.UpdatedSince, "updated-since", opt.Offline.UpdatedSince, "Only include bugs and issues updated after this RFC3339 time or duration ago.")
+	cmd.AddCommand(queryCmd)
+
+	backfillCmd := &cobra.Command{
+		Use:   "backfill --from TIME",
+		Short: "Download the runs in the job index that finished within a time range into --path",
+		RunE: func(cmd *cobra.Command, arguments []string) error {
+			return opt.RunBackfill(os.Stdout)
+		},
+	}
+	flag = backfillCmd.Flags()
+	flag.StringVar(&opt.Backfill.From, "from", opt.Backfill.From, "Download runs that finished after this RFC3339 time or duration ago.")
+	flag.StringVar(&opt.Backfill.To, "to", opt.Backfill.To, "Download runs that finished before this RFC3339 time or duration ago. Defaults to now.")
+	flag.StringVar(&opt.Backfill.JobRegex, "job-regex", opt.Backfill.JobRegex, "A regular expression that job names must match.")
+	flag.IntVar(&opt.Backfill.Workers, "workers", opt.Backfill.Workers, "The number of runs to download at once.")
+	flag.StringVar(&opt.IndexBucket, "index-bucket", opt.IndexBucket, "A GCS bucket to look for job indices in.")
+	cmd.AddCommand(backfillCmd)
 
 	if err := cmd.Execute(); err != nil {
 		klog.Exitf("error: %v", err)
@@ -112,6 +173,15 @@ type options struct {
 	DeckURI           string
 	IndexBucket       string
 
+	ArtifactConfigPath string
+	artifactSources    []prow.ArtifactSourceConfig
+	artifacts          artifactRules
+	links              *runLinks
+
+	IngestTokenPath string
+	ingestToken     string
+	ingest          *prow.IngestStore
+
 	MetricDBPath string
 	MetricMaxAge time.Duration
 
@@ -120,42 +190,68 @@ type options struct {
 	BugzillaTokenPath string
 
 	// jira
-	JiraURL        string
-	JiraSearch     string
-	JiraTokenPath  string
-	issuesPath     string
-	issues         *jira.CommentStore
-	issueURIPrefix *url.URL
+	JiraURL       string
+	JiraSearch    string
+	JiraTokenPath string
+
+	GitHubRepos     []string
+	GitHubSearch    string
+	GitHubTokenPath string
 
 	NoIndex bool
 
-	generator CommandGenerator
+	DiskQuotas map[string]string
+	quotas     []*diskQuota
+
+	SearchBackend   string
+	SearchWorkers   int
+	NoTrigramIndex  bool
+	SearchCacheSize int
+
+	MaxConcurrentSearches int
+	MaxQueuedSearches     int
+	SearchQueueTimeout    time.Duration
+	SearchTimeout         time.Duration
+
+	searcher  Searcher
+	results   *resultCache
+	scheduler *searchScheduler
 
 	jobsIndex    *pathIndex
+	testFailures *testFailureIndex
 	jobAccessor  prow.JobAccessor
 	jobsPath     string
 	jobURIPrefix *url.URL
 
-	bugs         *bugzilla.CommentStore
-	bugsPath     string
-	bugURIPrefix *url.URL
+	// trackers are the sources of bugs and issues, whether enabled or not
+	trackers []trackerSource
+
+	knownIssues *knownIssueIndex
 
 	metrics *metricdb.DB
+
+	Offline  offlineOptions
+	Backfill backfillOptions
 }
 
 type IndexStats struct {
-	Size int64
-	Bugs int
-
-	// jira
-	Issues int
-
+	Size    int64
 	Entries int
 
 	Jobs       int
 	FailedJobs int
 
 	Buckets []JobCountBucket
+
+	// Trackers counts the items indexed from each enabled tracker.
+	Trackers []TrackerStats
+
+	Quotas []QuotaStats
+}
+
+type TrackerStats struct {
+	Name  string
+	Count int
 }
 
 type JobCountBucket struct {
@@ -167,10 +263,6 @@ type JobCountBucket struct {
 // Stats returns aggregate statistics for the indexed paths.
 func (o *options) Stats() IndexStats {
 	j := o.jobsIndex.Stats()
-	b := o.bugs.Stats()
-
-	// jira
-	is := o.issues.Stats()
 
 	var totalJobs, failedJobs int
 	jobs, _ := o.jobAccessor.List(labels.Everything())
@@ -225,370 +317,212 @@ func (o *options) Stats() IndexStats {
 			}
 		}
 	}
+	var quotas []QuotaStats
+	for _, quota := range o.quotas {
+		quotas = append(quotas, quota.Stats())
+	}
+	var trackers []TrackerStats
+	for _, tracker := range o.trackers {
+		if tracker.Enabled() {
+			trackers = append(trackers, TrackerStats{Name: tracker.DisplayName(), Count: tracker.Count()})
+		}
+	}
 	return IndexStats{
 		Entries:    j.Entries,
 		Size:       j.Size,
-		Bugs:       b.Bugs,
-		Issues:     is.Issues,
 		Jobs:       totalJobs,
 		FailedJobs: failedJobs,
 		Buckets:    buckets,
+		Trackers:   trackers,
+		Quotas:     quotas,
 	}
 }
 
+// indexSummary describes the failed jobs and the items of each tracker in stats.
+func indexSummary(stats IndexStats) string {
+	parts := []string{fmt.Sprintf("%d failed jobs of %d", stats.FailedJobs, stats.Jobs)}
+	for _, tracker := range stats.Trackers {
+		parts = append(parts, fmt.Sprintf("%d %s", tracker.Count, tracker.Name))
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
 func (o *options) RipgrepSourceArguments(index *Index, jobNames sets.String) ([]string, []string, error) {
-	var args []string
-	var additionalPaths []string
-	switch index.SearchType {
-	case "bug":
-		if o.bugURIPrefix == nil {
-			return nil, nil, fmt.Errorf("searching on bugs is not enabled")
-		}
-		return []string{"--glob", "bug-*"}, []string{o.bugsPath}, nil
-	//jira
-	case "issue":
-		if o.issueURIPrefix == nil {
-			return nil, nil, fmt.Errorf("searching on issues is not enabled")
-		}
-		return []string{"--glob", "issue__*"}, []string{o.issuesPath}, nil
-	case "bug+issue":
-		if o.bugURIPrefix != nil {
-			args = []string{"--glob", "bug-*"}
-			additionalPaths = []string{o.bugsPath}
-		}
-		if o.issueURIPrefix != nil {
-			args = append(args, []string{"--glob", "issue__*"}...)
-			additionalPaths = append(additionalPaths, []string{o.issuesPath}...)
-		}
-		return args, additionalPaths, nil
-	case "bug+junit":
-		if o.bugURIPrefix != nil {
-			args = []string{"--glob", "bug-*"}
-			additionalPaths = []string{o.bugsPath}
-		}
-		if o.jobURIPrefix == nil {
-			return nil, nil, fmt.Errorf("searching on jobs is not enabled")
-		}
-		paths, err := o.jobsIndex.SearchPaths(index, jobNames)
-		if err != nil {
-			return nil, nil, err
-		}
-		if paths == nil {
-			if names := o.jobsIndex.FilenamesForSearchType(index.SearchType); len(names) > 0 {
-				for _, name := range names {
-					args = append(args, "--glob", name+"*")
-				}
-				args = append(args, o.jobsPath)
-			}
-		}
-		return args, append(paths, additionalPaths...), nil
-	case "all", "bug+issue+junit":
-		if o.bugURIPrefix != nil {
-			args = []string{"--glob", "bug-*"}
-			additionalPaths = []string{o.bugsPath}
-		}
-		if o.issueURIPrefix != nil {
-			args = append(args, []string{"--glob", "issue__*"}...)
-			additionalPaths = append(additionalPaths, []string{o.issuesPath}...)
-		}
-		fallthrough
-	default:
-		if o.jobURIPrefix == nil {
-			return nil, nil, fmt.Errorf("searching on jobs is not enabled")
+	sources, err := o.searchedSources(index.SearchType)
+	if err != nil {
+		return nil, nil, err
+	}
+	var args, paths []string
+	for _, source := range sources {
+		if tracker, ok := source.(trackerSource); ok && index.Fields != nil {
+			paths = append(paths, o.fieldPaths(tracker, index.Fields)...)
+			continue
 		}
-		paths, err := o.jobsIndex.SearchPaths(index, jobNames)
+		sourceArgs, sourcePaths, err := source.RipgrepArguments(index, jobNames)
 		if err != nil {
 			return nil, nil, err
 		}
-		if paths == nil {
-			if names := o.jobsIndex.FilenamesForSearchType(index.SearchType); len(names) > 0 {
-				for _, name := range names {
-					args = append(args, "--glob", name+"*")
-				}
-				args = append(args, o.jobsPath)
-			}
-		}
-		return args, append(paths, additionalPaths...), nil
+		args = append(args, sourceArgs...)
+		paths = append(paths, sourcePaths...)
 	}
+	return args, paths, nil
 }
 
-func (o *options) MetadataFor(path string) (Result, error) {
-	var result Result
-	switch {
-	case strings.HasPrefix(path, "bugs/"):
-		if o.bugURIPrefix == nil {
-			return result, fmt.Errorf("searching on bugs is not enabled")
-		}
-		path = strings.TrimPrefix(path, "bugs/")
-
-		result.FileType = "bug"
-		name := path
-		if !strings.HasPrefix(name, "bug-") {
-			return result, fmt.Errorf("expected path bugs/bug-NUMBER: %s", path)
+// SearchPaths returns the filesystem paths of every file that should be searched
+// for index. It selects the same files as RipgrepSourceArguments for searchers
+// that do not accept ripgrep arguments.
+func (o *options) SearchPaths(index *Index, jobNames sets.String) ([]string, error) {
+	sources, err := o.searchedSources(index.SearchType)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, source := range sources {
+		if tracker, ok := source.(trackerSource); ok && index.Fields != nil {
+			paths = append(paths, o.fieldPaths(tracker, index.Fields)...)
+			continue
 		}
-		name = name[4:]
-		id, err := strconv.Atoi(name)
+		sourcePaths, err := source.SearchPaths(index, jobNames)
 		if err != nil {
-			return result, fmt.Errorf("expected path bugs/bug-NUMBER: %s", path)
+			return nil, err
 		}
-		result.Name = fmt.Sprintf("Bug %d", id)
-		result.Number = id
-
-		copied := *o.bugURIPrefix
-		copied.RawQuery = url.Values{"id": []string{strconv.Itoa(id)}}.Encode()
-		result.URI = &copied
+		paths = append(paths, sourcePaths...)
+	}
+	return paths, nil
+}
 
-		if comments, ok := o.bugs.Get(id); ok {
-			// take the time of last bug update or comment, whichever is newer
-			if l := len(comments.Comments); l > 0 {
-				result.LastModified = comments.Comments[l-1].CreationTime.Time
-			}
-			if comments.Info.LastChangeTime.After(result.LastModified) {
-				result.LastModified = comments.Info.LastChangeTime.Time
-			}
-			if len(comments.Info.Summary) > 0 {
-				if len(comments.Info.Status) > 0 {
-					result.Name = fmt.Sprintf("Bug %d: %s %s", id, comments.Info.Summary, comments.Info.Status)
-				} else {
-					result.Name = fmt.Sprintf("Bug %d: %s", id, comments.Info.Summary)
-				}
+// findFilesWithPrefix returns all files under base whose name begins with one of
+// prefixes.
+func findFilesWithPrefix(base string, prefixes []string) ([]string, error) {
+	if len(prefixes) == 0 {
+		return nil, nil
+	}
+	var paths []string
+	err := walk.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
 			}
-			result.Bug = &comments.Info
-		}
-
-		result.IgnoreAge = true
-
-		return result, nil
-
-	// jira
-	case strings.HasPrefix(path, "issues/"):
-		if o.issueURIPrefix == nil {
-			return result, fmt.Errorf("searching on issues is not enabled")
-		}
-		path = strings.TrimPrefix(path, "issues/")
-
-		result.FileType = "issue"
-		name := path
-		if !strings.HasPrefix(name, "issue__") {
-			return result, fmt.Errorf("expected issue issues/issue__KEY_ID: %s", path)
+			return err
 		}
-		nameParts := strings.Split(name, "__")
-		name = nameParts[2]
-		id, err := strconv.Atoi(name)
-		if err != nil {
-			return result, fmt.Errorf("expected path issues/issue__KEY_ID: %s", path)
+		if info.IsDir() {
+			return nil
 		}
-		result.Name = fmt.Sprintf("Issue %d", id)
-		result.Number = id
-		result.Key = nameParts[1]
-
-		copied := *o.issueURIPrefix
-		copied.Path = fmt.Sprintf("%s/%s", "browse", nameParts[1])
-		result.URI = &copied
-
-		if comments, ok := o.issues.Get(id); ok {
-			// take the time of last issue update or comment, whichever is newer
-			if l := len(comments.Comments); l > 0 {
-				result.LastModified = jira.StringToTime(comments.Comments[l-1].Created)
-			}
-			if time.Time(comments.Info.Fields.Updated).After(result.LastModified) {
-				result.LastModified = time.Time(comments.Info.Fields.Updated)
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(info.Name(), prefix) {
+				paths = append(paths, path)
+				break
 			}
-			if len(comments.Info.Fields.Summary) > 0 {
-				if len(comments.Info.Fields.Status.Name) > 0 {
-					result.Name = fmt.Sprintf("Issue %s: %s %s", nameParts[1], comments.Info.Fields.Summary, comments.Info.Fields.Status.Name)
-				} else {
-					result.Name = fmt.Sprintf("Issue %s: %s", nameParts[1], comments.Info.Fields.Summary)
-				}
-			}
-			result.Issue = &comments.Info
 		}
+		return nil
+	})
+	return paths, err
+}
 
-		result.IgnoreAge = true
-
-		return result, nil
-
-	case strings.HasPrefix(path, "jobs/"):
-		if o.jobURIPrefix == nil {
-			return result, fmt.Errorf("searching on jobs is not enabled")
-		}
-		path = strings.TrimPrefix(path, "jobs/")
-
-		parts := strings.SplitN(path, "/", 8)
-		last := len(parts) - 1
-
-		var result Result
-		result.URI = o.jobURIPrefix.ResolveReference(&url.URL{Path: strings.Join(parts[:last], "/")})
-
-		switch parts[last] {
-		case "build-log.txt":
-			result.FileType = "build-log"
-		case "junit.failures":
-			result.FileType = "junit"
-		default:
-			result.FileType = parts[last]
+// MetadataFor describes the result for the file at path, relative to --path.
+func (o *options) MetadataFor(path string) (Result, error) {
+	for _, source := range o.sources() {
+		name := strings.TrimPrefix(path, source.Dir()+"/")
+		if name == path {
+			continue
 		}
-
-		switch parts[1] {
-		case "logs":
-			result.Trigger = "build"
-		case "pr-logs":
-			result.Trigger = "pull"
-		default:
-			result.Trigger = parts[1]
+		if !source.Enabled() {
+			return Result{}, fmt.Errorf("searching on %s is not enabled", source.DisplayName())
 		}
+		return source.MetadataFor(name)
+	}
+	return Result{}, fmt.Errorf("unrecognized result path: %s", path)
+}
 
-		var err error
-		result.Number, err = strconv.Atoi(parts[last-1])
+// setupPaths resolves the directories under --path, the URI prefixes that
+// results link to and the artifacts saved for each job.
+func (o *options) setupPaths() error {
+	if len(o.ArtifactConfigPath) > 0 {
+		config, err := prow.LoadArtifactConfig(o.ArtifactConfigPath, trackerSearchTypes())
 		if err != nil {
-			return result, err
+			return fmt.Errorf("unable to load --artifact-config: %v", err)
 		}
-
-		if last < 3 {
-			return result, fmt.Errorf("not enough parts (%d < 3)", last)
-		}
-		result.Name = parts[last-2]
-
-		result.LastModified = o.jobsIndex.LastModified(path)
-
-		return result, nil
-	default:
-		return result, fmt.Errorf("unrecognized result path: %s", path)
+		o.artifacts = config.Artifacts
+		o.artifactSources = config.Sources
 	}
-}
+	links, err := newRunLinks(o.artifactSources)
+	if err != nil {
+		return fmt.Errorf("unable to load --artifact-config: %v", err)
+	}
+	o.links = links
 
-func (o *options) Run() error {
 	jobURIPrefix, err := url.Parse(o.JobURIPrefix)
 	if err != nil {
-		klog.Exitf("Unable to parse --job-uri-prefix: %v", err)
+		return fmt.Errorf("unable to parse --job-uri-prefix: %v", err)
 	}
 	o.jobURIPrefix = jobURIPrefix
 	o.jobsPath = filepath.Join(o.Path, "jobs")
-	o.bugsPath = filepath.Join(o.Path, "bugs")
+	return o.setupTrackers()
+}
 
-	// jira
-	o.issuesPath = filepath.Join(o.Path, "issues")
+func (o *options) Run() error {
+	if err := o.setupPaths(); err != nil {
+		klog.Exitf("%v", err)
+	}
+
+	quotas, err := o.parseDiskQuotas(o.DiskQuotas)
+	if err != nil {
+		klog.Exitf("%v", err)
+	}
+	o.quotas = quotas
 
 	indexedPaths := &pathIndex{
 		base:    o.jobsPath,
-		baseURI: jobURIPrefix,
+		baseURI: o.jobURIPrefix,
 		maxAge:  o.MaxAge,
+
+		artifacts: o.artifacts,
+		links:     o.links,
 	}
 
 	o.jobsIndex = indexedPaths
 
-	if len(o.BugzillaURL) > 0 {
-		url, err := url.Parse(o.BugzillaURL)
-		if err != nil {
-			klog.Exitf("Unable to parse --bugzilla-url: %v", err)
-		}
-
-		u := *url
-		u.Path = "show_bug.cgi"
-		o.bugURIPrefix = &u
+	var trigrams *trigramIndex
+	if !o.NoTrigramIndex {
+		trigrams = newTrigramIndex(o.NoIndex)
+		indexedPaths.observer = trigrams
+	}
 
-		if len(o.BugzillaSearch) == 0 {
-			klog.Exitf("--bugzilla-search is required")
+	var trackersEnabled bool
+	for _, tracker := range o.trackers {
+		if !tracker.Enabled() {
+			continue
 		}
-		tokenData, err := ioutil.ReadFile(o.BugzillaTokenPath)
-		if err != nil {
-			klog.Exitf("Failed to load --bugzilla-token-file: %v", err)
-		}
-		token := string(bytes.TrimSpace(tokenData))
-		c := bugzilla.NewClient(*url)
-		c.APIKey = token
-		rt, err := rest.TransportFor(&rest.Config{})
-		if err != nil {
-			klog.Exitf("Unable to build bugzilla client: %v", err)
-		}
-		c.Client = &http.Client{Transport: rt}
-		informer := bugzilla.NewInformer(
-			c,
-			10*time.Minute,
-			8*time.Hour,
-			30*time.Minute,
-			func(metav1.ListOptions) bugzilla.SearchBugsArgs {
-				return bugzilla.SearchBugsArgs{
-					Quicksearch: o.BugzillaSearch,
-				}
-			},
-			func(info *bugzilla.BugInfo) bool {
-				return !contains(info.Keywords, "Security")
-			},
-		)
-		lister := bugzilla.NewBugLister(informer.GetIndexer())
-		if err := os.MkdirAll(o.bugsPath, 0777); err != nil {
-			return fmt.Errorf("unable to create directory for artifact: %w", err)
+		trackersEnabled = true
+		if err := tracker.Start(context.Background(), o); err != nil {
+			return err
 		}
-		diskStore := bugzilla.NewCommentDiskStore(o.bugsPath, o.MaxAge)
-		store := bugzilla.NewCommentStore(c, 2*time.Minute, false, diskStore)
-
-		o.bugs = store
-
-		ctx := context.Background()
-		go informer.Run(ctx.Done())
-		go store.Run(ctx, informer)
-		go diskStore.Run(ctx, lister, store, o.NoIndex)
-		klog.Infof("Started indexing bugzilla %s with query %q", o.BugzillaURL, o.BugzillaSearch)
-	} else {
-		o.bugs = bugzilla.NewCommentStore(nil, 0, false, nil)
 	}
 
-	// jira
-	if len(o.JiraURL) > 0 {
-		jiraURL, err := url.Parse(o.JiraURL)
-		if err != nil {
-			klog.Exitf("Unable to parse --jira-url: %v", err)
-		}
-		u := *jiraURL
-		u.Path = "issues/"
-		o.issueURIPrefix = &u
+	if trackersEnabled {
+		o.knownIssues = &knownIssueIndex{}
+		go wait.Forever(func() {
+			o.knownIssues.Sync(o.trackers)
+		}, time.Minute)
+	}
 
-		if len(o.JiraSearch) == 0 {
-			klog.Exitf("--jira-search is required")
-		}
-		tokenData, err := ioutil.ReadFile(o.JiraTokenPath)
+	if len(o.IngestTokenPath) > 0 {
+		tokenData, err := ioutil.ReadFile(o.IngestTokenPath)
 		if err != nil {
-			klog.Exitf("Failed to load --jira-token-file: %v", err)
+			klog.Exitf("Failed to load --ingest-token-file: %v", err)
 		}
-		options := func(options *jiraClient.Options) {
-			options.BearerAuth = func() (token string) {
-				return string(bytes.TrimSpace(tokenData))
-			}
+		o.ingestToken = strings.TrimSpace(string(tokenData))
+		if len(o.ingestToken) == 0 {
+			klog.Exitf("--ingest-token-file must not be empty")
 		}
-		jc, _ := jiraClient.NewClient(o.JiraURL, options)
-		c := &jira.Client{
-			Client: jc,
+		o.ingest = prow.NewIngestStore(o.jobsPath, o.MaxAge, o.artifacts)
+		if err := o.ingest.Load(); err != nil {
+			klog.Exitf("Unable to load ingested jobs: %v", err)
 		}
-
-		jiraInformer := jira.NewInformer(
-			c,
-			10*time.Minute,
-			8*time.Hour,
-			30*time.Minute,
-			func(metav1.ListOptions) jira.SearchIssuesArgs {
-				return jira.SearchIssuesArgs{
-					Jql: o.JiraSearch,
-				}
-			},
-			jira.FilterPrivateIssues,
-		)
-		jiraLister := jira.NewIssueLister(jiraInformer.GetIndexer())
-		if err := os.MkdirAll(o.issuesPath, 0777); err != nil {
-			return fmt.Errorf("unable to create directory for artifact: %w", err)
-		}
-		jiraDiskStore := jira.NewCommentDiskStore(o.issuesPath, o.MaxAge)
-		jiraStore := jira.NewCommentStore(c, 2*time.Minute, jiraDiskStore)
-
-		o.issues = jiraStore
-
-		ctx := context.Background()
-		go jiraInformer.Run(ctx.Done())
-		go jiraStore.Run(ctx, jiraInformer)
-		go jiraDiskStore.Run(ctx, jiraLister, jiraStore, o.NoIndex)
-		klog.Infof("Started indexing jira %s with query %q", o.JiraURL, o.JiraSearch)
-	} else {
-		o.issues = jira.NewCommentStore(nil, 0, nil)
+		o.links.ingest = o.ingest
 	}
 
 	if len(o.DeckURI) > 0 {
@@ -615,16 +549,30 @@ func (o *options) Run() error {
 			klog.Exitf("Unable to build gcs client: %v", err)
 		}
 
-		var initialJobLister prow.JobLister
-		if len(o.IndexBucket) > 0 {
-			initialJobLister = prow.ListerFunc(func(ctx context.Context) ([]*prow.Job, error) {
-				return prow.ReadFromIndex(ctx, gcsClient, o.IndexBucket, "job-state", o.MaxAge, *u)
-			})
+		snapshot := o.readJobSnapshot()
+		initialJobLister := prow.ListerFunc(func(ctx context.Context) ([]*prow.Job, error) {
+			if len(o.IndexBucket) == 0 {
+				return snapshot, nil
+			}
+			jobs, err := prow.ReadFromIndex(ctx, gcsClient, o.IndexBucket, "job-state", o.MaxAge, *u)
+			if err != nil {
+				return nil, err
+			}
+			return append(append([]*prow.Job{}, snapshot...), jobs...), nil
+		})
+		listers := []prow.JobLister{c}
+		if o.ingest != nil {
+			listers = append(listers, o.ingest)
 		}
-		informer := prow.NewInformer(2*time.Minute, 30*time.Minute, o.MaxAge, initialJobLister, c)
+		informer := prow.NewInformer(2*time.Minute, 30*time.Minute, o.MaxAge, initialJobLister, listers...)
 		lister := prow.NewLister(informer.GetIndexer())
 		o.jobAccessor = lister
-		store := prow.NewDiskStore(gcsClient, o.jobsPath, o.MaxAge)
+		o.restoreJobs(context.Background(), informer, lister, snapshot)
+		sources, err := prow.NewArtifactSources(gcsClient, o.artifactSources)
+		if err != nil {
+			klog.Exitf("Unable to build artifact sources: %v", err)
+		}
+		store := prow.NewDiskStore(sources, o.jobsPath, o.MaxAge, o.artifacts)
 
 		if err := os.MkdirAll(o.jobsPath, 0777); err != nil {
 			return fmt.Errorf("unable to create directory for artifact: %w", err)
@@ -641,12 +589,23 @@ func (o *options) Run() error {
 		}()
 
 		klog.Infof("Started indexing prow jobs %s", o.DeckURI)
+	} else if o.ingest != nil {
+		snapshot := o.readJobSnapshot()
+		initialJobLister := prow.ListerFunc(func(ctx context.Context) ([]*prow.Job, error) {
+			return snapshot, nil
+		})
+		informer := prow.NewInformer(2*time.Minute, 30*time.Minute, o.MaxAge, initialJobLister, o.ingest)
+		lister := prow.NewLister(informer.GetIndexer())
+		o.jobAccessor = lister
+		o.restoreJobs(context.Background(), informer, lister, snapshot)
+		go informer.Run(context.Background().Done())
 	} else {
 		o.jobAccessor = prow.Empty
 	}
 
 	// enable metrics
 	if len(o.MetricDBPath) > 0 {
+		var err error
 		o.metrics, err = metricdb.New(o.MetricDBPath, url.URL{}, o.MetricMaxAge)
 		if err != nil {
 			return err
@@ -659,16 +618,53 @@ func (o *options) Run() error {
 	}
 	g := &httpgraph.Server{DB: o.metrics}
 
+	o.testFailures = newTestFailureIndex(o.Path, o)
+	pathsLoaded := make(chan struct{})
+	var loadOnce sync.Once
 	go wait.Forever(func() {
-		if err := indexedPaths.Load(); err != nil {
+		for _, quota := range o.quotas {
+			evicted, err := quota.Enforce()
+			if err != nil {
+				klog.Errorf("Unable to enforce the disk quota of %s: %v", quota.source, err)
+			}
+			if quota.base == o.jobsPath {
+				indexedPaths.Forget(evicted)
+			}
+		}
+		// runs are added as they are downloaded, so the files are only walked
+		// periodically to catch anything that was missed
+		if err := indexedPaths.Refresh(); err != nil {
 			klog.Fatalf("Unable to index: %v", err)
 		}
+		loadOnce.Do(func() { close(pathsLoaded) })
+		o.testFailures.Sync(indexedPaths.PathsNamed(prow.TestFailuresFile))
 	}, 3*time.Minute)
 
-	o.generator, err = NewCommandGenerator(o.Path, o)
+	var filter CandidateFilter
+	if trigrams != nil {
+		filter = trigrams
+		// job files follow the path index, so every file is only listed once
+		// it has loaded and then rarely, to repair anything that was missed
+		go func() {
+			<-pathsLoaded
+			wait.Forever(func() {
+				paths, err := o.SearchPaths(&Index{SearchType: "all"}, nil)
+				if err != nil {
+					klog.Errorf("Unable to list paths for the trigram index: %v", err)
+					return
+				}
+				trigrams.Sync(paths)
+			}, trigramSweepInterval)
+		}()
+	}
+
+	searcher, err := NewSearcher(o.SearchBackend, o.Path, o, o, filter, o.SearchWorkers)
 	if err != nil {
 		return err
 	}
+	o.searcher = newQuerySearcher(searcher, o)
+	o.results = newResultCache(o.SearchCacheSize)
+	o.scheduler = newSearchScheduler(o.MaxConcurrentSearches, o.MaxQueuedSearches, o.SearchQueueTimeout, o.SearchTimeout)
 
 	if len(o.DebugAddr) > 0 {
 		go func() {
@@ -684,7 +680,7 @@ func (o *options) Run() error {
 			Name:    "http_duration",
 			Buckets: []float64{0.01, 0.1, 1, 10, 100},
 		}, []string{"path", "code", "method"})
-		prometheus.MustRegister(h)
+		prometheus.MustRegister(h, metricSearchesRejected, metricSearchesTimedOut, metricDiskQuotaBytes, metricDiskUsageBytes, metricDiskEvictedFiles, metricDiskEvictedBytes)
 		handle := func(path string, handler http.Handler) {
 			handler = promhttp.InstrumentHandlerDuration(h.MustCurryWith(prometheus.Labels{"path": path}), handler)
 			mux.Handle(path, handler)
@@ -697,8 +693,15 @@ func (o *options) Run() error {
 		handle("/chart.png", http.HandlerFunc(o.handleChartPNG))
 		handle("/config", http.HandlerFunc(o.handleConfig))
 		handle("/jobs", http.HandlerFunc(o.handleJobs))
+		handle("/ingest", http.HandlerFunc(o.handleIngest))
 		handle("/search", http.HandlerFunc(o.handleSearch))
 		handle("/v2/search", http.HandlerFunc(o.handleSearchV2))
+		handle("/v3/search/stream", http.HandlerFunc(o.handleSearchStream))
+		handle("/v2/tests/failing", http.HandlerFunc(o.handleFailingTests))
+		handle("/v2/clusters", http.HandlerFunc(o.handleClusters))
+		handle("/v2/tests/stats", http.HandlerFunc(o.handleTestStats))
+		handle("/tests", http.HandlerFunc(o.handleFailingTestsPage))
+		handle("/tests/stats", http.HandlerFunc(o.handleTestStatsPage))
 		handle("/metrics", promhttp.Handler())
 		handle("/", http.HandlerFunc(o.handleIndex))
 
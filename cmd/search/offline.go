@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	units "github.com/docker/go-units"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+// offlineOptions are the parameters of a search run by the query command,
+// named after the flags of the command.
+type offlineOptions struct {
+	Query       string
+	SearchType  string
+	IncludeName string
+	ExcludeName string
+	MaxAge      time.Duration
+	From        string
+	To          string
+	Context     int
+	MaxMatches  int
+
+	BugStatus     string
+	Component     string
+	TargetRelease string
+	Assignee      string
+	UpdatedSince  string
+}
+
+// Values returns the request parameters for a search of searches.
+func (o *offlineOptions) Values(searches []string) url.Values {
+	v := url.Values{"search": searches}
+	if len(o.Query) > 0 {
+		v.Set("query", o.Query)
+	}
+	if len(o.SearchType) > 0 {
+		v.Set("type", o.SearchType)
+	}
+	if len(o.IncludeName) > 0 {
+		v.Set("name", o.IncludeName)
+	}
+	if len(o.ExcludeName) > 0 {
+		v.Set("excludeName", o.ExcludeName)
+	}
+	if o.MaxAge > 0 {
+		v.Set("maxAge", o.MaxAge.String())
+	}
+	if len(o.From) > 0 {
+		v.Set("from", o.From)
+	}
+	if len(o.To) > 0 {
+		v.Set("to", o.To)
+	}
+	v.Set("context", strconv.Itoa(o.Context))
+	if o.MaxMatches > 0 {
+		v.Set("maxMatches", strconv.Itoa(o.MaxMatches))
+	}
+	for name, value := range map[string]string{"bugStatus": o.BugStatus, "component": o.Component, "targetRelease": o.TargetRelease, "assignee": o.Assignee, "updatedSince": o.UpdatedSince} {
+		if len(value) > 0 {
+			v.Set(name, value)
+		}
+	}
+	return v
+}
+
+// loadOffline loads the jobs, bugs and issues previously saved under --path
+// without starting any informers or clients, and without removing any file.
+func (o *options) loadOffline() error {
+	if err := o.setupPaths(); err != nil {
+		return err
+	}
+
+	o.jobsIndex = &pathIndex{
+		base:    o.jobsPath,
+		baseURI: o.jobURIPrefix,
+
+		artifacts: o.artifacts,
+		links:     o.links,
+	}
+	if err := o.jobsIndex.Load(); err != nil {
+		return fmt.Errorf("unable to index %s: %v", o.jobsPath, err)
+	}
+	o.jobAccessor = prow.Empty
+
+	for _, tracker := range o.trackers {
+		if err := tracker.Load(); err != nil {
+			return err
+		}
+	}
+
+	searcher, err := NewSearcher(o.SearchBackend, o.Path, o, o, nil, o.SearchWorkers)
+	if err != nil {
+		return err
+	}
+	o.searcher = newQuerySearcher(searcher, o)
+	return nil
+}
+
+// RunQuery searches the results saved under --path for searches and prints
+// them grouped by bug, issue and job to w.
+func (o *options) RunQuery(w io.Writer, searches []string) error {
+	values := o.Offline.Values(searches)
+	req, err := http.NewRequest("GET", (&url.URL{Path: "/", RawQuery: values.Encode()}).String(), nil)
+	if err != nil {
+		return err
+	}
+	// unlike the server nothing is expired, so only limit the age if asked
+	index, err := parseRequest(req, "text", o.Offline.MaxAge, o.artifacts)
+	if err != nil {
+		return err
+	}
+	if len(index.Search) == 0 {
+		return fmt.Errorf("at least one search or --query is required")
+	}
+
+	if err := o.loadOffline(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	result, err := o.orderedSearchResults(context.Background(), index)
+	if err != nil && err != ErrMaxBytes {
+		return err
+	}
+	printSearchResult(w, result, start)
+	if err == ErrMaxBytes {
+		return fmt.Errorf("%v, use --query with more specific terms or limit the jobs searched", err)
+	}
+	return nil
+}
+
+// printSearchResult writes result as text, one line per bug, issue or job
+// run followed by the matched lines.
+func printSearchResult(w io.Writer, result *SearchResult, now time.Time) {
+	printMatches := func(matches []Match) {
+		for _, match := range matches {
+			for _, line := range match.Context {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+			if match.MoreLines > 0 {
+				fmt.Fprintf(w, "    ... %d lines not shown\n", match.MoreLines)
+			}
+		}
+	}
+	age := func(matches []Match) string {
+		if len(matches) == 0 || matches[0].LastModified.IsZero() {
+			return ""
+		}
+		return " " + units.HumanDuration(now.Sub(matches[0].LastModified.Time)) + " ago"
+	}
+
+	for _, issue := range result.Issues {
+		fmt.Fprintf(w, "%s %s%s\n", issue.Name, issue.URI, age(issue.Matches))
+		printMatches(issue.Matches)
+	}
+	var runs int
+	for _, job := range result.Jobs {
+		fmt.Fprintf(w, "%s (%d matching runs)\n", job.Name, len(job.Instances))
+		for _, instance := range job.Instances {
+			var fileType string
+			if len(instance.Matches) > 0 {
+				fileType = " " + instance.Matches[0].FileType
+			}
+			fmt.Fprintf(w, "  #%d %s%s%s\n", instance.Number, instance.URI, fileType, age(instance.Matches))
+			printMatches(instance.Matches)
+		}
+		runs += len(job.Instances)
+	}
+	fmt.Fprintf(w, "%d matches, %d bugs and issues, %d runs of %d jobs\n", result.Matches, len(result.Issues), runs, len(result.Jobs))
+}
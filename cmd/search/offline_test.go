@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_options_RunQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for _, run := range []struct {
+		job, number, content string
+		age                  time.Duration
+	}{
+		{"job-a", "1", "failed: timeout waiting\n", time.Hour},
+		{"job-a", "2", "failed: timeout waiting\n", 30 * 24 * time.Hour},
+		{"job-b", "1", "failed: connection refused\n", time.Hour},
+	} {
+		jobDir := filepath.Join(dir, "jobs", "origin-ci-test", "logs", run.job, run.number)
+		if err := os.MkdirAll(jobDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(jobDir, "junit.failures")
+		if err := ioutil.WriteFile(path, []byte(run.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-run.age), now.Add(-run.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		offline offlineOptions
+		want    []string
+		wantNot []string
+	}{
+		{
+			name: "everything saved",
+			want: []string{
+				"job-a (2 matching runs)",
+				"  #1 https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/job-a/1 junit About an hour ago",
+				"  #2 https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/job-a/2 junit",
+				"    failed: timeout waiting",
+				"2 matches, 0 bugs and issues, 2 runs of 1 jobs",
+			},
+			wantNot: []string{"job-b"},
+		},
+		{
+			name:    "max age",
+			offline: offlineOptions{MaxAge: 24 * time.Hour},
+			want:    []string{"job-a (1 matching runs)", "1 runs of 1 jobs"},
+			wantNot: []string{"job-a/2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &options{
+				Path:          dir,
+				JobURIPrefix:  "https://prow.ci.openshift.org/view/gs/",
+				SearchBackend: "go",
+				SearchWorkers: 1,
+				Offline:       tt.offline,
+			}
+			o.Offline.SearchType = "junit"
+			out := &bytes.Buffer{}
+			if err := o.RunQuery(out, []string{"timeout"}); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output does not contain %q:\n%s", want, out.String())
+				}
+			}
+			for _, want := range tt.wantNot {
+				if strings.Contains(out.String(), want) {
+					t.Errorf("output contains %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+
+	if err := (&options{Path: dir}).RunQuery(ioutil.Discard, nil); err == nil {
+		t.Error("expected an error without a search")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxPageSize is the largest number of files a page of results may hold.
+const maxPageSize = 1000
+
+// pageCursor identifies the last file returned in a page of results. Files
+// are ordered from most to least recently modified, then by URI and name.
+type pageCursor struct {
+	LastModified time.Time `json:"t"`
+	URI          string    `json:"u"`
+	Name         string    `json:"n"`
+}
+
+// Before returns true if c is ordered before other.
+func (c pageCursor) Before(other pageCursor) bool {
+	if !c.LastModified.Equal(other.LastModified) {
+		return c.LastModified.After(other.LastModified)
+	}
+	if c.URI != other.URI {
+		return c.URI < other.URI
+	}
+	return c.Name < other.Name
+}
+
+// Token returns the opaque continuation token for c.
+func (c pageCursor) Token() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parsePageToken(token string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("pageToken is invalid")
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || len(cursor.Name) == 0 {
+		return nil, fmt.Errorf("pageToken is invalid")
+	}
+	return &cursor, nil
+}
+
+// searchPageRequest selects a page of results. A zero size means the results
+// are not paginated.
+type searchPageRequest struct {
+	size   int
+	cursor *pageCursor
+}
+
+// parsePageRequest returns the page requested by the pageSize and pageToken
+// parameters.
+func parsePageRequest(req *http.Request) (searchPageRequest, error) {
+	var page searchPageRequest
+	if value := req.FormValue("pageSize"); len(value) > 0 {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 || size > maxPageSize {
+			return page, fmt.Errorf("pageSize must be a number between 1 and %d", maxPageSize)
+		}
+		page.size = size
+	}
+	if value := req.FormValue("pageToken"); len(value) > 0 {
+		cursor, err := parsePageToken(value)
+		if err != nil {
+			return page, err
+		}
+		page.cursor = cursor
+		if page.size == 0 {
+			page.size = 100
+		}
+	}
+	return page, nil
+}
+
+// pagedFile holds the matches found in a single file.
+type pagedFile struct {
+	key     pageCursor
+	matches map[string][]*Match
+}
+
+// searchPage is a page of results in order along with the token for the next
+// page, which is empty if this is the last page.
+type searchPage struct {
+	files         []*pagedFile
+	nextPageToken string
+}
+
+// Result returns the page as a result[uri][search][]*Match.
+func (p *searchPage) Result() map[string]map[string][]*Match {
+	result := make(map[string]map[string][]*Match, len(p.files))
+	for _, file := range p.files {
+		searches, ok := result[file.key.URI]
+		if !ok {
+			searches = make(map[string][]*Match, len(file.matches))
+			result[file.key.URI] = searches
+		}
+		for search, matches := range file.matches {
+			searches[search] = append(searches[search], matches...)
+		}
+	}
+	return result
+}
+
+// searchResultPage returns the files after the cursor of page that match index,
+// up to the page size. Only the files that could be part of the page are kept,
+// so the size of the page rather than index.MaxBytes bounds the memory used.
+// The scan resumes at the files modified when the previous page stopped.
+func (o *options) searchResultPage(ctx context.Context, index *Index, page searchPageRequest) (*searchPage, error) {
+	copied := *index
+	index = &copied
+	index.MaxBytes = 0
+	if index.MaxMatches == 0 {
+		index.MaxMatches = 1
+	}
+	if page.cursor != nil && (index.To.IsZero() || page.cursor.LastModified.Before(index.To)) {
+		index.To = page.cursor.LastModified
+	}
+
+	files := make(map[string]*pagedFile)
+	// compact drops the files that can no longer be part of the page
+	compact := func() []*pagedFile {
+		ordered := make([]*pagedFile, 0, len(files))
+		for _, file := range files {
+			ordered = append(ordered, file)
+		}
+		sort.Slice(ordered, func(i, j int) bool { return ordered[i].key.Before(ordered[j].key) })
+		if len(ordered) > page.size+1 {
+			for _, file := range ordered[page.size+1:] {
+				delete(files, file.key.Name)
+			}
+			ordered = ordered[:page.size+1]
+		}
+		return ordered
+	}
+
+	err := executeGrep(ctx, o.searcher, index, nil, func(name string, search string, matches []bytes.Buffer, moreLines int) error {
+		uri, match, ok := o.newMatch(index, name, matches, moreLines)
+		if !ok {
+			return nil
+		}
+		file, ok := files[name]
+		if !ok {
+			key := pageCursor{LastModified: match.LastModified.Time, URI: uri, Name: name}
+			if page.cursor != nil && !page.cursor.Before(key) {
+				return nil
+			}
+			file = &pagedFile{key: key, matches: make(map[string][]*Match, 1)}
+			files[name] = file
+			if len(files) > 2*(page.size+1) {
+				compact()
+			}
+		}
+		file.matches[search] = append(file.matches[search], match)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &searchPage{files: compact()}
+	if len(result.files) > page.size {
+		result.files = result.files[:page.size]
+		result.nextPageToken = result.files[page.size-1].key.Token()
+	}
+	return result, nil
+}
+
+// cachedSearchResultPage returns the result of searchResultPage for index from
+// the cache if possible.
+func (o *options) cachedSearchResultPage(w http.ResponseWriter, req *http.Request, index *Index, page searchPageRequest) (*searchPage, error) {
+	kind := fmt.Sprintf("page/%d", page.size)
+	if page.cursor != nil {
+		kind += "/" + page.cursor.Token()
+	}
+	value, created, hit, err := o.results.Get(req.Context(), o.cacheKey(kind, index), func() (interface{}, error) {
+		var result *searchPage
+		err := o.scheduler.Run(req.Context(), func(ctx context.Context) error {
+			var err error
+			result, err = o.searchResultPage(ctx, index, page)
+			return err
+		})
+		return result, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	o.results.SetHeaders(w, hit, created)
+	return value.(*searchPage), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_handleSearchV2_pages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	var want []string
+	// runs 3 and 4 finish at the same time and are ordered by URI
+	for i, age := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour, 3 * time.Hour, 4 * time.Hour} {
+		run := string(rune('1' + i))
+		jobDir := filepath.Join(dir, "jobs", "origin-ci-test", "logs", "job-a", run)
+		if err := os.MkdirAll(jobDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(jobDir, "junit.failures")
+		if err := ioutil.WriteFile(path, []byte("failed: timeout waiting\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, "https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/job-a/"+run)
+	}
+	jobURIPrefix, _ := url.Parse("https://prow.ci.openshift.org/view/gs/")
+	o := &options{
+		Path:         dir,
+		MaxAge:       24 * time.Hour,
+		jobURIPrefix: jobURIPrefix,
+		jobsPath:     filepath.Join(dir, "jobs"),
+		jobsIndex:    &pathIndex{base: filepath.Join(dir, "jobs"), baseURI: jobURIPrefix},
+	}
+	if err := o.jobsIndex.Load(); err != nil {
+		t.Fatal(err)
+	}
+	// a fake ripgrep prints every line of the files it is given, since every
+	// line matches the search
+	rgPath := filepath.Join(dir, "rg")
+	script := "#!/bin/sh\nfor arg; do\n  if [ -f \"$arg\" ]; then\n    while IFS= read -r line; do printf '%s\\0%s\\n' \"$arg\" \"$line\"; done < \"$arg\"\n  fi\ndone\n"
+	if err := ioutil.WriteFile(rgPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, searcher := range []struct {
+		name     string
+		searcher Searcher
+	}{
+		{name: "in-process", searcher: NewInProcessSearcher(dir, o, nil, 1)},
+		{name: "ripgrep", searcher: commandSearcher{ripgrepGenerator{execPath: rgPath, searchPath: dir, arguments: o}}},
+	} {
+		t.Run(searcher.name, func(t *testing.T) {
+			o.searcher = searcher.searcher
+
+			var got []string
+			var pages int
+			query := url.Values{"search": {"timeout"}, "type": {"junit"}, "pageSize": {"2"}}
+			for {
+				req := httptest.NewRequest("GET", "/v2/search?"+query.Encode(), nil)
+				w := httptest.NewRecorder()
+				o.handleSearchV2(w, req)
+				if w.Code != http.StatusOK {
+					t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+				}
+				var response SearchResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				for _, match := range response.Results["timeout"].Matches {
+					got = append(got, match.URL)
+				}
+				pages++
+				if len(response.NextPageToken) == 0 {
+					break
+				}
+				if pages > 5 {
+					t.Fatalf("too many pages: %v", got)
+				}
+				query.Set("pageToken", response.NextPageToken)
+			}
+			if pages != 3 || !reflect.DeepEqual(got, want) {
+				t.Errorf("got %d pages %v, want %v", pages, got, want)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/v2/search?search=timeout&pageToken=invalid", nil)
+	w := httptest.NewRecorder()
+	o.handleSearchV2(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status for an invalid token: %d", w.Code)
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog"
 
+	"github.com/openshift/ci-search/pkg/trigram"
+	"github.com/openshift/ci-search/prow"
 	"github.com/openshift/ci-search/walk"
 )
 
@@ -26,6 +28,13 @@ type PathAccessor interface {
 	LastModified(path string) time.Time
 }
 
+// PathObserver is told about the files added to or removed from the path index
+// between walks, as filesystem paths.
+type PathObserver interface {
+	Added(paths []string)
+	Removed(paths []string)
+}
+
 type PathIndexStats struct {
 	Entries int
 	Size    int64
@@ -37,21 +46,157 @@ type PathResolver interface {
 	MetadataFor(path string) (Result, error)
 }
 
+// artifactRules are the artifacts the indexer downloads besides the JUnit
+// failures, from --artifact-config.
+type artifactRules []prow.ArtifactRule
+
+// named returns the rule with the given search type or nil.
+func (rules artifactRules) named(name string) *prow.ArtifactRule {
+	for i := range rules {
+		if rules[i].Name == name {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// fileTypeFor returns the search type of a file saved in a job run directory.
+func (rules artifactRules) fileTypeFor(name string) string {
+	base := strings.TrimSuffix(name, ".gz")
+	if base == "junit.failures" {
+		return "junit"
+	}
+	for _, rule := range rules {
+		if base == rule.Filename {
+			return rule.Name
+		}
+	}
+	return name
+}
+
+// indexNameFor returns the name a saved file is indexed under or false if the
+// file is not searched.
+func (rules artifactRules) indexNameFor(name string) (string, bool) {
+	switch {
+	case strings.HasPrefix(name, "junit.failures"):
+		return "junit.failures", true
+	case name == prow.TestFailuresFile:
+		return prow.TestFailuresFile, true
+	}
+	for _, rule := range rules {
+		if strings.HasPrefix(name, rule.Filename) {
+			return rule.Filename, true
+		}
+	}
+	return "", false
+}
+
+// runLinks resolves the status URLs of runs that were read from a configured
+// artifact source or pushed to /ingest.
+type runLinks struct {
+	// sources maps the local directory of each configured artifact source to
+	// the prefix of the status URLs of its runs.
+	sources map[string]*url.URL
+	// ingest lists the runs pushed to /ingest, if ingestion is enabled.
+	ingest *prow.IngestStore
+}
+
+// newRunLinks links the runs read from sources to their status URLs.
+func newRunLinks(sources []prow.ArtifactSourceConfig) (*runLinks, error) {
+	links := &runLinks{sources: make(map[string]*url.URL, len(sources))}
+	for _, source := range sources {
+		u, err := url.Parse(source.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		links.sources[source.Bucket] = u
+	}
+	return links, nil
+}
+
+// jobURI returns the status URL of the run in the slash-separated directory
+// relative to the jobs path, which starts with the bucket name. Runs that were
+// not read from a configured source or pushed to /ingest are resolved against
+// prefix.
+func (l *runLinks) jobURI(prefix *url.URL, dir string) *url.URL {
+	if l == nil {
+		return prefix.ResolveReference(&url.URL{Path: dir})
+	}
+	if l.ingest != nil && strings.HasPrefix(dir, prow.IngestBucket+"/") {
+		if job, ok := l.ingest.JobForRun(dir); ok {
+			if u, err := url.Parse(job.Status.URL); err == nil {
+				return u
+			}
+		}
+	}
+	if i := strings.Index(dir, "/"); i != -1 {
+		if link, ok := l.sources[dir[:i]]; ok {
+			return link.ResolveReference(&url.URL{Path: dir[i+1:]})
+		}
+	}
+	return prefix.ResolveReference(&url.URL{Path: dir})
+}
+
+// pathIndexWalkInterval is how often the path index is rebuilt from the files
+// on disk to pick up changes it was not notified of. Between walks expired
+// paths are removed by Expire.
+const pathIndexWalkInterval = time.Hour
+
+// pathNotifyDelay is how long notified paths are batched before they are
+// merged into the index.
+const pathNotifyDelay = 5 * time.Second
+
+// maxPathChanges is the number of changes kept to decide whether a search is
+// affected by them. Searches that began before the oldest kept change are
+// treated as affected.
+const maxPathChanges = 1024
+
 type pathIndex struct {
 	base    string
 	baseURI *url.URL
 	maxAge  time.Duration
-
-	lock      sync.Mutex
-	ordered   []pathAge
-	stats     PathIndexStats
-	pathIndex map[string]int
+	// artifacts are the artifacts indexed besides the JUnit failures
+	artifacts artifactRules
+	// links, if set, resolves the status URLs of runs that are not under
+	// baseURI
+	links *runLinks
+	// observer, if set, is called after paths are added or removed
+	observer PathObserver
+
+	lock    sync.Mutex
+	ordered []pathAge
+	stats   PathIndexStats
+	ages    map[string]time.Time
+	// generation is incremented each time a new ordered list is published
+	generation uint64
+	// resetGeneration is the last generation that may have changed the
+	// results of any search, such as a walk. changes are the paths added or
+	// removed by each later generation.
+	resetGeneration uint64
+	changes         []pathChange
+	// lastLoad is when the last full walk started
+	lastLoad time.Time
+
+	// pending are the notified paths that have not been merged yet
+	pending        []pathAge
+	flushScheduled bool
+	// notified are the paths merged while a walk is in progress, which are
+	// merged again into its result in case the walk missed them
+	loading  bool
+	notified []pathAge
 }
 
 type pathAge struct {
 	path  string
 	index string
 	age   time.Time
+	size  int64
+}
+
+// pathChange is the paths added or removed by a generation of the index.
+type pathChange struct {
+	generation uint64
+	paths      []pathAge
 }
 
 func (index *pathIndex) parseJobPath(path string) (*Result, error) {
@@ -60,16 +205,9 @@ func (index *pathIndex) parseJobPath(path string) (*Result, error) {
 	parts := strings.SplitN(path, "/", 8)
 	last := len(parts) - 1
 
-	result.URI = index.baseURI.ResolveReference(&url.URL{Path: strings.Join(parts[:last], "/")})
+	result.URI = index.links.jobURI(index.baseURI, strings.Join(parts[:last], "/"))
 
-	switch parts[last] {
-	case "build-log.txt":
-		result.FileType = "build-log"
-	case "junit.failures":
-		result.FileType = "junit"
-	default:
-		result.FileType = parts[last]
-	}
+	result.FileType = index.artifacts.fileTypeFor(parts[last])
 
 	var err error
 	result.Number, err = strconv.Atoi(parts[last-1])
@@ -97,15 +235,243 @@ func (index *pathIndex) parseJobPath(path string) (*Result, error) {
 func (index *pathIndex) LastModified(path string) time.Time {
 	index.lock.Lock()
 	defer index.lock.Unlock()
-	if position, ok := index.pathIndex[path]; ok {
-		return index.ordered[position].age
+	return index.ages[path]
+}
+
+// pathStats returns the aggregate statistics of ordered.
+func pathStats(ordered []pathAge) PathIndexStats {
+	var stats PathIndexStats
+	for _, item := range ordered {
+		if item.index != prow.TestFailuresFile {
+			stats.Entries++
+			stats.Size += item.size
+		}
+	}
+	return stats
+}
+
+// mergePaths returns the paths in ordered and added newest first, replacing
+// the entries of ordered with those in added that have the same path. Neither
+// slice is modified so that readers of ordered are not affected.
+func mergePaths(ordered, added []pathAge) []pathAge {
+	latest := make(map[string]int, len(added))
+	unique := make([]pathAge, 0, len(added))
+	for _, item := range added {
+		if i, ok := latest[item.path]; ok {
+			unique[i] = item
+			continue
+		}
+		latest[item.path] = len(unique)
+		unique = append(unique, item)
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		return !unique[i].age.Before(unique[j].age)
+	})
+
+	merged := make([]pathAge, 0, len(ordered)+len(unique))
+	i := 0
+	for _, item := range ordered {
+		if _, ok := latest[item.path]; ok {
+			continue
+		}
+		for ; i < len(unique) && !unique[i].age.Before(item.age); i++ {
+			merged = append(merged, unique[i])
+		}
+		merged = append(merged, item)
 	}
-	return time.Time{}
+	return append(merged, unique[i:]...)
 }
 
+// publish replaces the indexed paths with ordered, which differs from the
+// previous paths by changed. If changed is nil any path may have changed. The
+// caller must hold the lock.
+func (index *pathIndex) publish(ordered []pathAge, changed []pathAge) {
+	index.ordered = ordered
+	index.stats = pathStats(ordered)
+	index.generation++
+	if changed == nil {
+		index.resetGeneration = index.generation
+		index.changes = nil
+		return
+	}
+	if len(index.changes) >= maxPathChanges {
+		index.resetGeneration = index.changes[0].generation
+		index.changes = index.changes[1:]
+	}
+	index.changes = append(index.changes, pathChange{generation: index.generation, paths: changed})
+}
+
+// Notify adds the files at paths, which were just saved under the index base,
+// to the index after a short delay so that they are searchable without waiting
+// for the next walk.
 func (index *pathIndex) Notify(paths []string) {
+	var added []pathAge
+	for _, path := range paths {
+		indexName, ok := index.artifacts.indexNameFor(filepath.Base(path))
+		if !ok {
+			continue
+		}
+		relPath, err := filepath.Rel(index.base, path)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		added = append(added, pathAge{path: filepath.ToSlash(relPath), index: indexName, age: info.ModTime(), size: info.Size()})
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	index.pending = append(index.pending, added...)
+	if !index.flushScheduled {
+		index.flushScheduled = true
+		time.AfterFunc(pathNotifyDelay, index.flush)
+	}
+}
+
+// flush merges the notified paths into the index.
+func (index *pathIndex) flush() {
+	index.lock.Lock()
+	pending := index.pending
+	index.pending = nil
+	index.flushScheduled = false
+	if len(pending) == 0 {
+		index.lock.Unlock()
+		return
+	}
+	if index.ages == nil {
+		index.ages = make(map[string]time.Time, len(pending))
+	}
+	for _, item := range pending {
+		index.ages[item.path] = item.age
+	}
+	if index.loading {
+		index.notified = append(index.notified, pending...)
+	}
+	index.publish(mergePaths(index.ordered, pending), pending)
+	index.lock.Unlock()
+	klog.V(4).Infof("Added %d notified paths to the path index", len(pending))
+
+	if index.observer != nil {
+		index.observer.Added(index.filesystemPaths(pending))
+	}
 }
 
+// filesystemPaths returns the location on disk of each of items.
+func (index *pathIndex) filesystemPaths(items []pathAge) []string {
+	paths := make([]string, 0, len(items))
+	for _, item := range items {
+		paths = append(paths, filepath.Join(index.base, filepath.FromSlash(item.path)))
+	}
+	return paths
+}
+
+// Forget removes the files at paths, which were deleted from under the index
+// base, from the index.
+func (index *pathIndex) Forget(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	removed := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		if relPath, err := filepath.Rel(index.base, path); err == nil {
+			removed[filepath.ToSlash(relPath)] = struct{}{}
+		}
+	}
+
+	index.lock.Lock()
+	ordered := make([]pathAge, 0, len(index.ordered))
+	var forgotten []pathAge
+	for _, item := range index.ordered {
+		if _, ok := removed[item.path]; ok {
+			delete(index.ages, item.path)
+			forgotten = append(forgotten, item)
+			continue
+		}
+		ordered = append(ordered, item)
+	}
+	if len(forgotten) == 0 {
+		index.lock.Unlock()
+		return
+	}
+	index.publish(ordered, forgotten)
+	index.lock.Unlock()
+
+	if index.observer != nil {
+		index.observer.Removed(index.filesystemPaths(forgotten))
+	}
+}
+
+// Refresh walks the files on disk if the last walk was more than
+// pathIndexWalkInterval ago, and otherwise removes the expired paths.
+func (index *pathIndex) Refresh() error {
+	index.lock.Lock()
+	lastLoad := index.lastLoad
+	index.lock.Unlock()
+	if time.Now().Sub(lastLoad) >= pathIndexWalkInterval {
+		return index.Load()
+	}
+	index.Expire()
+	return nil
+}
+
+// Expire deletes the runs whose indexed files are older than the maximum age
+// and removes them from the index. Since paths are ordered newest first only
+// the expired paths are visited.
+func (index *pathIndex) Expire() {
+	if index.maxAge == 0 {
+		return
+	}
+	start := time.Now()
+	expiredAt := start.Add(-index.maxAge)
+
+	index.lock.Lock()
+	ordered := index.ordered
+	i := sort.Search(len(ordered), func(i int) bool {
+		return ordered[i].age.Before(expiredAt)
+	})
+	expired := ordered[i:]
+	if len(expired) == 0 {
+		index.lock.Unlock()
+		return
+	}
+	for _, item := range expired {
+		delete(index.ages, item.path)
+	}
+	// limit the capacity so that later merges cannot overwrite the expired entries
+	index.publish(ordered[:i:i], expired)
+	index.lock.Unlock()
+
+	if index.observer != nil {
+		index.observer.Removed(index.filesystemPaths(expired))
+	}
+
+	dirs := make(map[string][]string)
+	for _, item := range expired {
+		path := filepath.Join(index.base, filepath.FromSlash(item.path))
+		dirs[filepath.Dir(path)] = append(dirs[filepath.Dir(path)], path)
+	}
+	for dir, paths := range dirs {
+		// runs are removed whole once their directory expires, like a walk would
+		if info, err := os.Stat(dir); err == nil && expiredAt.After(info.ModTime()) {
+			os.RemoveAll(dir)
+			continue
+		}
+		for _, path := range paths {
+			os.Remove(path)
+			os.Remove(trigram.Path(path))
+		}
+	}
+	klog.Infof("Expired %d paths from the path index in %s", len(expired), time.Now().Sub(start).Truncate(time.Millisecond))
+}
+
+// Load rebuilds the index from the files on disk, deleting the files and
+// directories that expired.
 func (index *pathIndex) Load() error {
 	ordered := make([]pathAge, 0, 1024)
 
@@ -115,11 +481,21 @@ func (index *pathIndex) Load() error {
 		klog.Infof("Refreshed path index in %s, loaded %d: %v", time.Now().Sub(start).Truncate(time.Millisecond), len(ordered), err)
 	}()
 
+	index.lock.Lock()
+	index.loading = true
+	index.notified = nil
+	index.lastLoad = start
+	index.lock.Unlock()
+	defer func() {
+		index.lock.Lock()
+		defer index.lock.Unlock()
+		index.loading = false
+		index.notified = nil
+	}()
+
 	mustExpire := index.maxAge != 0
 	expiredAt := start.Add(-index.maxAge)
 
-	stats := PathIndexStats{}
-
 	err = walk.Walk(index.base, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -135,24 +511,16 @@ func (index *pathIndex) Load() error {
 			return nil
 		}
 
-		var indexName string
-		switch name := info.Name(); {
-		case strings.HasPrefix(name, "build-log.txt"):
-			indexName = "build-log.txt"
-		case strings.HasPrefix(name, "junit.failures"):
-			indexName = "junit.failures"
-		default:
+		indexName, ok := index.artifacts.indexNameFor(info.Name())
+		if !ok {
 			return nil
 		}
-
-		stats.Entries++
-		stats.Size += info.Size()
 		relPath, err := filepath.Rel(index.base, path)
 		if err != nil {
 			return err
 		}
 		relPath = filepath.ToSlash(relPath)
-		ordered = append(ordered, pathAge{index: indexName, path: relPath, age: info.ModTime()})
+		ordered = append(ordered, pathAge{index: indexName, path: relPath, age: info.ModTime(), size: info.Size()})
 
 		return nil
 	})
@@ -163,17 +531,19 @@ func (index *pathIndex) Load() error {
 	sort.Slice(ordered, func(i, j int) bool {
 		return !ordered[i].age.Before(ordered[j].age)
 	})
-	pathIndex := make(map[string]int, len(ordered))
-	for i, item := range ordered {
-		path := strings.TrimPrefix(item.path, index.base)
-		pathIndex[path] = i
-	}
 
 	index.lock.Lock()
 	defer index.lock.Unlock()
-	index.ordered = ordered
-	index.pathIndex = pathIndex
-	index.stats = stats
+	// paths notified during the walk may have been written after it passed them
+	if len(index.notified) > 0 {
+		ordered = mergePaths(ordered, index.notified)
+	}
+	ages := make(map[string]time.Time, len(ordered))
+	for _, item := range ordered {
+		ages[item.path] = item.age
+	}
+	index.ages = ages
+	index.publish(ordered, nil)
 
 	return nil
 }
@@ -182,15 +552,93 @@ func (i *pathIndex) FilenamesForSearchType(searchType string) []string {
 	switch searchType {
 	case "", "bug+junit", "junit", "bug+issue+junit":
 		return []string{"junit.failures"}
-	case "build-log":
-		return []string{"build-log.txt"}
 	case "all":
-		return []string{"junit.failures", "build-log.txt"}
+		names := []string{"junit.failures"}
+		for _, rule := range i.artifacts {
+			names = append(names, rule.Filename)
+		}
+		return names
 	default:
+		if rule := i.artifacts.named(searchType); rule != nil {
+			return []string{rule.Filename}
+		}
 		return nil
 	}
 }
 
+// PathsNamed returns the paths of the indexed files with the given name,
+// newest first.
+func (i *pathIndex) PathsNamed(name string) []string {
+	i.lock.Lock()
+	paths := i.ordered
+	i.lock.Unlock()
+
+	var named []string
+	for _, path := range paths {
+		if path.index == name {
+			named = append(named, filepath.Join(i.base, filepath.FromSlash(path.path)))
+		}
+	}
+	return named
+}
+
+// Generation returns a counter that changes whenever the indexed paths are
+// reloaded.
+func (i *pathIndex) Generation() uint64 {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.generation
+}
+
+// GenerationFor returns the last generation that added or removed a path that
+// index searches, so that it only changes when the results of index may.
+func (i *pathIndex) GenerationFor(index *Index) uint64 {
+	names := i.FilenamesForSearchType(index.SearchType)
+	oldest, _ := index.Window(time.Now())
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if len(names) > 0 {
+		for c := len(i.changes) - 1; c >= 0; c-- {
+			for _, path := range i.changes[c].paths {
+				if searchesPath(index, names, oldest, path) {
+					return i.changes[c].generation
+				}
+			}
+		}
+	}
+	return i.resetGeneration
+}
+
+// searchesPath returns true if index searches path, which is one of names and
+// is no older than oldest.
+func searchesPath(index *Index, names []string, oldest time.Time, path pathAge) bool {
+	if path.age.Before(oldest) || (!index.To.IsZero() && path.age.After(index.To)) {
+		return false
+	}
+	if !contains(names, path.index) {
+		return false
+	}
+	if index.JobFilter != nil {
+		if jobName, ok := pathJobName(path.path); ok && !index.JobFilter(jobName) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathJobName returns the job of a path of the form .../job/build/file.
+func pathJobName(path string) (string, bool) {
+	if i := strings.LastIndex(path, "/"); i != -1 {
+		if j := strings.LastIndex(path[:i], "/"); j != -1 {
+			if k := strings.LastIndex(path[:j], "/"); k != -1 {
+				return path[k+1 : j], true
+			}
+		}
+	}
+	return "", false
+}
+
 func (i *pathIndex) Stats() PathIndexStats {
 	i.lock.Lock()
 	defer i.lock.Unlock()
@@ -217,29 +665,25 @@ func (i *pathIndex) SearchPaths(index *Index, jobNames sets.String) ([]string, e
 	// grow the map to the desired size up front
 	copied := make([]string, 0, len(paths))
 
-	var oldest time.Time
-	if index.MaxAge > 0 {
-		oldest = time.Now().Add(-index.MaxAge)
-	}
+	oldest, _ := index.Window(time.Now())
 
 	for _, path := range paths {
 		if path.age.Before(oldest) {
 			klog.V(2).Infof("Stopped path index at %s because it is before %s", path.path, oldest)
 			break
 		}
+		// paths are ordered newest first
+		if !index.To.IsZero() && path.age.After(index.To) {
+			continue
+		}
 		if index.JobFilter != nil {
-			// Paths should be .../job/build/file - isolate the job and verify it matches the job regex
-			if i := strings.LastIndex(path.path, string(filepath.Separator)); i != -1 {
-				if j := strings.LastIndex(path.path[:i], string(filepath.Separator)); j != -1 {
-					if k := strings.LastIndex(path.path[:j], string(filepath.Separator)); k != -1 {
-						jobName := path.path[k+1 : j]
-						if !index.JobFilter(jobName) {
-							continue
-						}
-						if jobNames != nil {
-							jobNames.Insert(jobName)
-						}
-					}
+			// isolate the job and verify it matches the job regex
+			if jobName, ok := pathJobName(path.path); ok {
+				if !index.JobFilter(jobName) {
+					continue
+				}
+				if jobNames != nil {
+					jobNames.Insert(jobName)
 				}
 			}
 		}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/pkg/query"
+)
+
+// querySearcher evaluates the query expression of an index across all of the
+// files of a job run. Every term is searched for at once and the matches are
+// grouped by the URI of the run (or bug or issue) they were found in. Only the
+// matches of runs that satisfy the expression are reported, as matches of the
+// single search holding the query. Searches without an expression are passed
+// through unchanged.
+type querySearcher struct {
+	Searcher
+	resolver PathResolver
+}
+
+func newQuerySearcher(searcher Searcher, resolver PathResolver) Searcher {
+	return querySearcher{Searcher: searcher, resolver: resolver}
+}
+
+// queryRun holds the matches found in the files of a single run.
+type queryRun struct {
+	// matched records the file types each pattern matched in
+	matched map[string]sets.String
+	matches []queryMatch
+}
+
+type queryMatch struct {
+	name      string
+	pattern   string
+	fileType  string
+	lines     []bytes.Buffer
+	moreLines int
+}
+
+func (s querySearcher) Search(ctx context.Context, index *Index, searches []string, jobNames sets.String, fn GrepFunc) error {
+	if index.Fields != nil {
+		fn = s.filterFields(index.Fields, fn)
+	}
+	if index.Expression == nil {
+		return s.Searcher.Search(ctx, index, searches, jobNames, fn)
+	}
+	if len(searches) != 1 {
+		return fmt.Errorf("a query must be evaluated as a single search")
+	}
+	expr := index.Expression
+
+	runs := make(map[string]*queryRun)
+	var order []string
+	err := s.Searcher.Search(ctx, index, expr.Patterns(), jobNames, func(name string, search string, lines []bytes.Buffer, moreLines int) error {
+		metadata, err := s.resolver.MetadataFor(name)
+		if err != nil || metadata.URI == nil {
+			klog.V(4).Infof("Ignoring query match in %s without a result: %v", name, err)
+			return nil
+		}
+		key := metadata.URI.String()
+		run, ok := runs[key]
+		if !ok {
+			run = &queryRun{matched: make(map[string]sets.String)}
+			runs[key] = run
+			order = append(order, key)
+		}
+		if run.matched[search] == nil {
+			run.matched[search] = sets.NewString()
+		}
+		run.matched[search].Insert(metadata.FileType)
+
+		// the caller may reuse the buffers once we return
+		copied := make([]bytes.Buffer, len(lines))
+		for i := range lines {
+			copied[i].Write(lines[i].Bytes())
+		}
+		run.matches = append(run.matches, queryMatch{name: name, pattern: search, fileType: metadata.FileType, lines: copied, moreLines: moreLines})
+		return nil
+	})
+	if err != nil {
+		// a partial result cannot show that a negated term is absent
+		return err
+	}
+
+	positive := expr.PositiveTerms()
+	for _, key := range order {
+		run := runs[key]
+		if !expr.Eval(func(term *query.Expr) bool {
+			for fileType := range run.matched[term.Pattern] {
+				if term.Matches(fileType) {
+					return true
+				}
+			}
+			return false
+		}) {
+			continue
+		}
+		// report the lines each file matched for any of the terms together
+		var names []string
+		files := make(map[string]*queryMatch)
+		for i := range run.matches {
+			match := &run.matches[i]
+			if !matchesAnyTerm(positive, match.pattern, match.fileType) {
+				continue
+			}
+			file, ok := files[match.name]
+			if !ok {
+				files[match.name] = match
+				names = append(names, match.name)
+				continue
+			}
+			file.lines = append(file.lines, match.lines...)
+			file.moreLines += match.moreLines
+		}
+		for _, name := range names {
+			file := files[name]
+			if err := fn(file.name, searches[0], file.lines, file.moreLines); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func matchesAnyTerm(terms []*query.Expr, pattern, fileType string) bool {
+	for _, term := range terms {
+		if term.Pattern == pattern && term.Matches(fileType) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterFields drops the matches in bugs and issues whose fields no longer match
+// filter. The files searched were selected by their fields, but the items may
+// have changed since.
+func (s querySearcher) filterFields(filter *FieldFilter, fn GrepFunc) GrepFunc {
+	return func(name string, search string, lines []bytes.Buffer, moreLines int) error {
+		metadata, err := s.resolver.MetadataFor(name)
+		if err == nil && isTrackerFileType(metadata.FileType) && !filter.Matches(metadata.Fields) {
+			return nil
+		}
+		return fn(name, search, lines, moreLines)
+	}
+}
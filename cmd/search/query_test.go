@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_querySearcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	write := func(run, name, content string) {
+		jobDir := filepath.Join(dir, "jobs", "origin-ci-test", "logs", "job-a", run)
+		if err := os.MkdirAll(jobDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(jobDir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	write("1", "junit.failures", "failed: timeout waiting\n")
+	write("1", "build-log.txt", "image pull failed\n")
+	write("2", "junit.failures", "failed: timeout waiting\n")
+	write("2", "build-log.txt", "etcd leader changed\n")
+	write("3", "build-log.txt", "timeout waiting for etcd\n")
+
+	jobURIPrefix, _ := url.Parse("https://prow.ci.openshift.org/view/gs/")
+	o := &options{
+		MaxAge:       time.Hour,
+		jobURIPrefix: jobURIPrefix,
+		jobsIndex:    &pathIndex{artifacts: prow.DefaultArtifactRules},
+		artifacts:    prow.DefaultArtifactRules,
+	}
+	o.searcher = newQuerySearcher(NewInProcessSearcher(dir, staticPaths(paths), nil, 1), o)
+
+	tests := []struct {
+		query      string
+		searchType string
+		want       []string
+	}{
+		{
+			query: `junit:timeout NOT build-log:"image pull"`,
+			want:  []string{"jobs/origin-ci-test/logs/job-a/2/junit.failures"},
+		},
+		{
+			query:      `timeout etcd`,
+			searchType: "all",
+			want: []string{
+				"jobs/origin-ci-test/logs/job-a/2/build-log.txt",
+				"jobs/origin-ci-test/logs/job-a/2/junit.failures",
+				"jobs/origin-ci-test/logs/job-a/3/build-log.txt",
+			},
+		},
+		{
+			query: `build-log:"image pull" OR build-log:leader`,
+			want: []string{
+				"jobs/origin-ci-test/logs/job-a/1/build-log.txt",
+				"jobs/origin-ci-test/logs/job-a/2/build-log.txt",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			values := url.Values{"query": []string{tt.query}}
+			if len(tt.searchType) > 0 {
+				values.Set("type", tt.searchType)
+			}
+			index, err := parseRequest(httptest.NewRequest("GET", "/?"+values.Encode(), nil), "text", o.MaxAge, o.artifacts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if index.SearchType != "all" {
+				t.Fatalf("expected queries on build logs to search all files, got %s", index.SearchType)
+			}
+			var got []string
+			if err := executeGrep(context.Background(), o.searcher, index, nil, func(name string, search string, lines []bytes.Buffer, moreLines int) error {
+				if search != tt.query {
+					t.Errorf("unexpected search %q", search)
+				}
+				got = append(got, name)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"search=a&query=b", "query=NOT+a"} {
+		if _, err := parseRequest(httptest.NewRequest("GET", "/?"+invalid, nil), "text", o.MaxAge, o.artifacts); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
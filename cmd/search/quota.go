@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/pkg/trigram"
+	"github.com/openshift/ci-search/prow"
+	"github.com/openshift/ci-search/walk"
+)
+
+var (
+	metricDiskQuotaBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "disk_quota_bytes",
+		Help: "The number of bytes each source may use on disk.",
+	}, []string{"source"})
+	metricDiskUsageBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "disk_usage_bytes",
+		Help: "The number of bytes each source used on disk after the last eviction.",
+	}, []string{"source"})
+	metricDiskEvictedFiles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "disk_evicted_files_total",
+		Help: "The number of files removed to keep a source within its disk quota.",
+	}, []string{"source", "tier"})
+	metricDiskEvictedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "disk_evicted_bytes_total",
+		Help: "The number of bytes removed to keep a source within its disk quota.",
+	}, []string{"source", "tier"})
+)
+
+// quotaLowWatermark is the fraction of the quota that eviction frees space
+// down to, so that a source that is just over its quota is not evicted on
+// every pass.
+const quotaLowWatermark = 0.9
+
+// The tiers of job files, evicted in order.
+const (
+	tierPassingArtifacts = iota
+	tierArtifacts
+	tierJUnit
+)
+
+var jobTierNames = []string{"passing-artifacts", "artifacts", "junit"}
+
+// QuotaStats describes the disk usage of a source and what was removed to keep
+// it within its quota.
+type QuotaStats struct {
+	Source       string
+	Quota        int64
+	Size         int64
+	EvictedFiles int
+	EvictedBytes int64
+	LastEviction time.Time
+}
+
+// diskQuota keeps the files saved for a source under base within a number of
+// bytes by removing the least valuable files first.
+type diskQuota struct {
+	source string
+	base   string
+	quota  int64
+	// tiers names the tiers returned by classify, in eviction order
+	tiers []string
+	// classify returns the tier of the file at path or false if the file is
+	// never evicted. passed reports whether the run in a directory passed.
+	classify func(path string, passed func(dir string) bool) (int, bool)
+
+	lock  sync.Mutex
+	stats QuotaStats
+}
+
+// quotaFile is a file that may be evicted along with its trigram file.
+type quotaFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	tier    int
+}
+
+// newJobsQuota evicts the artifacts saved by rules for passing runs, then the
+// build logs and other artifacts of failing runs, then their JUnit results,
+// oldest first.
+func newJobsQuota(base string, rules artifactRules, quota int64) *diskQuota {
+	return &diskQuota{
+		source: "jobs",
+		base:   base,
+		quota:  quota,
+		tiers:  jobTierNames,
+		classify: func(path string, passed func(dir string) bool) (int, bool) {
+			name := strings.TrimSuffix(filepath.Base(path), ".gz")
+			switch name {
+			case "junit.failures", prow.TestFailuresFile, prow.TestResultsFile:
+				return tierJUnit, true
+			}
+			for _, rule := range rules {
+				if name == rule.Filename {
+					if passed(filepath.Dir(path)) {
+						return tierPassingArtifacts, true
+					}
+					return tierArtifacts, true
+				}
+			}
+			return 0, false
+		},
+		stats: QuotaStats{Source: "jobs", Quota: quota},
+	}
+}
+
+// newCommentsQuota evicts the saved comments of the bugs or issues under base
+// that were updated least recently.
+func newCommentsQuota(source, base string, quota int64) *diskQuota {
+	return &diskQuota{
+		source: source,
+		base:   base,
+		quota:  quota,
+		tiers:  []string{"comments"},
+		classify: func(path string, _ func(dir string) bool) (int, bool) {
+			// temporary files are removed when they expire
+			return 0, !strings.HasPrefix(filepath.Base(path), "z-")
+		},
+		stats: QuotaStats{Source: source, Quota: quota},
+	}
+}
+
+// newDiskQuota returns the quota of size for the source whose directory is dir.
+func (o *options) newDiskQuota(dir string, size int64) (*diskQuota, error) {
+	var dirs []string
+	for _, source := range o.sources() {
+		if source.Dir() != dir {
+			dirs = append(dirs, source.Dir())
+			continue
+		}
+		if _, ok := source.(jobSource); ok {
+			return newJobsQuota(o.jobsPath, o.artifacts, size), nil
+		}
+		return newCommentsQuota(dir, filepath.Join(o.Path, dir), size), nil
+	}
+	return nil, fmt.Errorf("--disk-quota source %q must be one of %s", dir, strings.Join(dirs, ", "))
+}
+
+// parseDiskQuotas returns a quota for each source in quotas, which maps the
+// directory of a source such as jobs or bugs to a size such as 50GB.
+func (o *options) parseDiskQuotas(quotas map[string]string) ([]*diskQuota, error) {
+	sources := make([]string, 0, len(quotas))
+	for source := range quotas {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var result []*diskQuota
+	for _, source := range sources {
+		size, err := units.FromHumanSize(quotas[source])
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("--disk-quota %s must be a positive size such as 50GB", source)
+		}
+		quota, err := o.newDiskQuota(source, size)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, quota)
+		metricDiskQuotaBytes.WithLabelValues(source).Set(float64(size))
+	}
+	return result, nil
+}
+
+// Stats returns the usage of the source as of the last call to Enforce.
+func (q *diskQuota) Stats() QuotaStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.stats
+}
+
+// Enforce removes files from the source until it uses less than its quota and
+// returns the paths of the removed files. The modification times of the directories files are removed from are preserved
+// so that removed files do not delay when runs expire or cause them to be
+// downloaded again.
+func (q *diskQuota) Enforce() ([]string, error) {
+	start := time.Now()
+	files := make(map[string]*quotaFile)
+	var size int64
+	err := walk.Walk(q.base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		size += info.Size()
+		name := info.Name()
+		if strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".trigrams") {
+			// trigrams are removed with the file they index
+			owner := filepath.Join(filepath.Dir(path), strings.TrimSuffix(name[1:], ".trigrams"))
+			if file, ok := files[owner]; ok {
+				file.size += info.Size()
+			} else {
+				files[owner] = &quotaFile{path: owner, size: info.Size(), tier: -1}
+			}
+			return nil
+		}
+		if file, ok := files[path]; ok {
+			file.size += info.Size()
+			file.modTime = info.ModTime()
+			file.tier = 0
+		} else {
+			files[path] = &quotaFile{path: path, size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var evicted []*quotaFile
+	if size > q.quota {
+		passed := make(map[string]bool)
+		passedFn := func(dir string) bool {
+			ok, checked := passed[dir]
+			if !checked {
+				results, err := prow.ReadTestResults(filepath.Join(dir, prow.TestResultsFile))
+				ok = err == nil && results.Succeeded
+				passed[dir] = ok
+			}
+			return ok
+		}
+		candidates := make([]*quotaFile, 0, len(files))
+		for _, file := range files {
+			// trigrams of files that no longer exist are removed when they expire
+			if file.tier == -1 {
+				continue
+			}
+			tier, ok := q.classify(file.path, passedFn)
+			if !ok {
+				continue
+			}
+			file.tier = tier
+			candidates = append(candidates, file)
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if candidates[i].tier != candidates[j].tier {
+				return candidates[i].tier < candidates[j].tier
+			}
+			return candidates[i].modTime.Before(candidates[j].modTime)
+		})
+
+		target := int64(float64(q.quota) * quotaLowWatermark)
+		dirs := make(map[string]time.Time)
+		for _, file := range candidates {
+			if size <= target {
+				break
+			}
+			dir := filepath.Dir(file.path)
+			if _, ok := dirs[dir]; !ok {
+				info, err := os.Stat(dir)
+				if err != nil {
+					continue
+				}
+				dirs[dir] = info.ModTime()
+			}
+			if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+				klog.Errorf("Unable to evict %s: %v", file.path, err)
+				continue
+			}
+			os.Remove(trigram.Path(file.path))
+			size -= file.size
+			evicted = append(evicted, file)
+		}
+		for dir, modTime := range dirs {
+			if err := os.Chtimes(dir, modTime, modTime); err != nil && !os.IsNotExist(err) {
+				klog.Errorf("Unable to restore modification time of %s: %v", dir, err)
+			}
+		}
+	}
+
+	var evictedBytes int64
+	paths := make([]string, 0, len(evicted))
+	for _, file := range evicted {
+		paths = append(paths, file.path)
+		evictedBytes += file.size
+		tier := q.tiers[file.tier]
+		metricDiskEvictedFiles.WithLabelValues(q.source, tier).Inc()
+		metricDiskEvictedBytes.WithLabelValues(q.source, tier).Add(float64(file.size))
+	}
+	metricDiskUsageBytes.WithLabelValues(q.source).Set(float64(size))
+	if len(evicted) > 0 {
+		klog.Infof("Evicted %d files (%s) from %s in %s to stay within the disk quota of %s", len(evicted), units.HumanSize(float64(evictedBytes)), q.source, time.Now().Sub(start).Truncate(time.Millisecond), units.HumanSize(float64(q.quota)))
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.stats.Size = size
+	if len(evicted) > 0 {
+		q.stats.EvictedFiles += len(evicted)
+		q.stats.EvictedBytes += evictedBytes
+		q.stats.LastEviction = start
+	}
+	return paths, nil
+}
+
+// quotaSummary describes the disk usage of each source with a quota as HTML
+// for the stats page.
+func quotaSummary(quotas []QuotaStats) string {
+	if len(quotas) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, quota := range quotas {
+		part := fmt.Sprintf("%s uses %s of %s", quota.Source, units.HumanSize(float64(quota.Size)), units.HumanSize(float64(quota.Quota)))
+		if quota.EvictedFiles > 0 {
+			part += fmt.Sprintf(" (%d files and %s evicted, last %s ago)", quota.EvictedFiles, units.HumanSize(float64(quota.EvictedBytes)), units.HumanDuration(time.Since(quota.LastEviction)))
+		}
+		parts = append(parts, part)
+	}
+	return fmt.Sprintf("<p>Disk quota: %s</p>\n", template.HTMLEscapeString(strings.Join(parts, ", ")))
+}
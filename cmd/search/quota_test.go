@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/pkg/trigram"
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_diskQuota_Enforce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	data := strings.Repeat("x", 1000)
+	runs := []struct {
+		path     string
+		finished time.Time
+		results  string
+		files    []string
+	}{
+		{path: "bucket/logs/job/1", finished: now.Add(-3 * time.Hour), results: `{}`, files: []string{"build-log.txt", "junit.failures"}},
+		{path: "bucket/logs/job/2", finished: now.Add(-2 * time.Hour), results: `{}`, files: []string{"build-log.txt", "junit.failures"}},
+		{path: "bucket/logs/job/3", finished: now.Add(-time.Hour), results: `{"succeeded":true}`, files: []string{"build-log.txt"}},
+	}
+	for _, run := range runs {
+		runPath := filepath.Join(dir, filepath.FromSlash(run.path))
+		if err := os.MkdirAll(runPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(runPath, prow.TestResultsFile), []byte(run.results), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range run.files {
+			if err := ioutil.WriteFile(filepath.Join(runPath, name), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(trigram.Path(filepath.Join(runPath, name)), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, name := range append(run.files, prow.TestResultsFile, "") {
+			if err := os.Chtimes(filepath.Join(runPath, name), run.finished, run.finished); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+		return err == nil
+	}
+
+	// the artifacts of the passing run are evicted before those of failing runs
+	quota := newJobsQuota(dir, prow.DefaultArtifactRules, 9000)
+	if _, err := quota.Enforce(); err != nil {
+		t.Fatal(err)
+	}
+	if exists("bucket/logs/job/3/build-log.txt") || exists("bucket/logs/job/3/.build-log.txt.trigrams") || !exists("bucket/logs/job/1/build-log.txt") {
+		t.Fatalf("expected only the passing build log to be evicted")
+	}
+	if stats := quota.Stats(); stats.EvictedFiles != 1 || stats.EvictedBytes != 2000 || stats.Size > 9000 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "bucket/logs/job/3")); err != nil || !info.ModTime().Equal(runs[2].finished) {
+		t.Errorf("expected the run directory to keep its modification time: %v", err)
+	}
+
+	// then the oldest build logs, and the oldest junit once no logs remain
+	quota = newJobsQuota(dir, prow.DefaultArtifactRules, 3000)
+	if _, err := quota.Enforce(); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{
+		"bucket/logs/job/1/build-log.txt":  false,
+		"bucket/logs/job/2/build-log.txt":  false,
+		"bucket/logs/job/1/junit.failures": false,
+		"bucket/logs/job/2/junit.failures": true,
+	} {
+		if exists(path) != want {
+			t.Errorf("expected %s to exist: %t", path, want)
+		}
+	}
+}
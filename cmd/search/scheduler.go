@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricSearchesRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "search_rejected_total",
+		Help: "The number of searches rejected because too many searches were in progress.",
+	})
+	metricSearchesTimedOut = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "search_timeout_total",
+		Help: "The number of searches that did not complete before the search deadline.",
+	})
+)
+
+// searchRejectedError is returned when a search could not be started because
+// too many searches are in progress.
+type searchRejectedError struct {
+	retryAfter time.Duration
+}
+
+func (e *searchRejectedError) Error() string {
+	return "too many searches are in progress, try again later"
+}
+
+// searchTimeoutError is returned when a search did not complete before the
+// search deadline.
+type searchTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *searchTimeoutError) Error() string {
+	return fmt.Sprintf("search did not complete within %s, try a more specific search", e.timeout)
+}
+
+// searchScheduler limits the number of searches that run at once, queues a
+// bounded number of additional searches for a limited time, and bounds how long
+// each search may run. A nil scheduler admits every search without a deadline.
+type searchScheduler struct {
+	// slots holds a token for each running search, or is nil if searches are
+	// not limited
+	slots chan struct{}
+	// queued holds a token for each search waiting for a slot
+	queued chan struct{}
+	// maxWait is how long a queued search waits for a slot
+	maxWait time.Duration
+	// timeout is the deadline of each search, or zero for none
+	timeout time.Duration
+}
+
+// newSearchScheduler runs up to concurrency searches at once and queues up to
+// queue more for at most maxWait. If concurrency is not positive searches are
+// not limited. Each search is cancelled after timeout unless it is zero.
+func newSearchScheduler(concurrency, queue int, maxWait, timeout time.Duration) *searchScheduler {
+	s := &searchScheduler{
+		maxWait: maxWait,
+		timeout: timeout,
+	}
+	if concurrency > 0 {
+		s.slots = make(chan struct{}, concurrency)
+		if queue > 0 {
+			s.queued = make(chan struct{}, queue)
+		}
+	}
+	return s
+}
+
+// Admit waits until the search may run and returns a context bounded by the
+// search deadline. The caller must invoke done when the search completes. If
+// the search cannot run a searchRejectedError is returned.
+func (s *searchScheduler) Admit(ctx context.Context) (searchCtx context.Context, done func(), err error) {
+	if s == nil {
+		return ctx, func() {}, nil
+	}
+	if s.slots != nil {
+		if err := s.acquire(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	searchCtx, cancel := ctx, context.CancelFunc(func() {})
+	if s.timeout > 0 {
+		searchCtx, cancel = context.WithTimeout(ctx, s.timeout)
+	}
+	return searchCtx, func() {
+		if searchCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			metricSearchesTimedOut.Inc()
+		}
+		cancel()
+		if s.slots != nil {
+			<-s.slots
+		}
+	}, nil
+}
+
+func (s *searchScheduler) acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	// wait in the queue if there is room
+	select {
+	case s.queued <- struct{}{}:
+	default:
+		metricSearchesRejected.Inc()
+		return &searchRejectedError{retryAfter: s.maxWait}
+	}
+	defer func() { <-s.queued }()
+
+	timer := time.NewTimer(s.maxWait)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		metricSearchesRejected.Inc()
+		return &searchRejectedError{retryAfter: s.maxWait}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run invokes fn once the search is admitted with a context bounded by the
+// search deadline.
+func (s *searchScheduler) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	searchCtx, done, err := s.Admit(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return s.deadlineError(searchCtx, fn(searchCtx))
+}
+
+// deadlineError returns a searchTimeoutError if err was caused by ctx reaching
+// the search deadline, and err otherwise.
+func (s *searchScheduler) deadlineError(ctx context.Context, err error) error {
+	if err == nil || s == nil || s.timeout == 0 || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	return &searchTimeoutError{timeout: s.timeout}
+}
+
+// searchFailed responds to a search that could not be completed, asking the
+// client to retry later if the search was rejected.
+func searchFailed(w http.ResponseWriter, err error, code int) {
+	var rejected *searchRejectedError
+	if errors.As(err, &rejected) {
+		seconds := int((rejected.retryAfter + time.Second - 1) / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		http.Error(w, fmt.Sprintf("Failed search: %v", err), http.StatusTooManyRequests)
+		return
+	}
+	var timedOut *searchTimeoutError
+	if errors.As(err, &timedOut) {
+		code = http.StatusServiceUnavailable
+	}
+	http.Error(w, fmt.Sprintf("Failed search: %v", err), code)
+}
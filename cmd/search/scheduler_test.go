@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_searchScheduler(t *testing.T) {
+	s := newSearchScheduler(1, 1, 50*time.Millisecond, 0)
+
+	_, done, err := s.Admit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a queued search is admitted when the running search completes
+	admitted := make(chan error, 1)
+	go func() {
+		_, queuedDone, err := s.Admit(context.Background())
+		if err == nil {
+			queuedDone()
+		}
+		admitted <- err
+	}()
+	for len(s.queued) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queue is full
+	var rejected *searchRejectedError
+	if _, _, err := s.Admit(context.Background()); !errors.As(err, &rejected) {
+		t.Fatalf("expected search to be rejected, got %v", err)
+	}
+
+	done()
+	if err := <-admitted; err != nil {
+		t.Fatalf("expected queued search to be admitted, got %v", err)
+	}
+
+	// a queued search that waits too long is rejected
+	_, done, err = s.Admit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+	if _, _, err := s.Admit(context.Background()); !errors.As(err, &rejected) {
+		t.Fatalf("expected search to be rejected after waiting, got %v", err)
+	}
+}
+
+func Test_searchScheduler_timeout(t *testing.T) {
+	s := newSearchScheduler(0, 0, 0, 10*time.Millisecond)
+	err := s.Run(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	var timedOut *searchTimeoutError
+	if !errors.As(err, &timedOut) {
+		t.Fatalf("expected search to time out, got %v", err)
+	}
+
+	var unlimited *searchScheduler
+	if err := unlimited.Run(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_searchFailed(t *testing.T) {
+	w := httptest.NewRecorder()
+	searchFailed(w, &searchRejectedError{retryAfter: 1500 * time.Millisecond}, http.StatusInternalServerError)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("unexpected response %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	w = httptest.NewRecorder()
+	searchFailed(w, errors.New("failed"), http.StatusBadRequest)
+	if w.Code != http.StatusBadRequest || len(w.Header().Get("Retry-After")) > 0 {
+		t.Errorf("unexpected response %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/bugzilla"
+	"github.com/openshift/ci-search/pkg/tracker"
+)
+
+// bugzillaSource indexes the bugs matching --bugzilla-search.
+type bugzillaSource struct {
+	trackerDir
+	uriPrefix *url.URL
+	store     *tracker.CommentStore
+}
+
+func newBugzillaSource(o *options) (trackerSource, error) {
+	s := &bugzillaSource{
+		trackerDir: newTrackerDir(o, "bug", "bugs", "bug-"),
+		store:      bugzilla.NewCommentStore(nil, 0, false, nil),
+	}
+	if len(o.BugzillaURL) > 0 {
+		bugzillaURL, err := url.Parse(o.BugzillaURL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse --bugzilla-url: %v", err)
+		}
+		u := *bugzillaURL
+		u.Path = "show_bug.cgi"
+		s.uriPrefix = &u
+	}
+	return s, nil
+}
+
+func (s *bugzillaSource) DisplayName() string { return "bugs" }
+
+func (s *bugzillaSource) Enabled() bool { return s.uriPrefix != nil }
+
+// Searched also includes bugs in searches of bugs and junit files.
+func (s *bugzillaSource) Searched(searchType string) bool {
+	return searchType == "bug+junit" || s.trackerDir.Searched(searchType)
+}
+
+func (s *bugzillaSource) Count() int { return s.store.Len() }
+
+func (s *bugzillaSource) Generation() uint64 { return s.store.Generation() }
+
+func (s *bugzillaSource) Start(ctx context.Context, o *options) error {
+	if len(o.BugzillaSearch) == 0 {
+		klog.Exitf("--bugzilla-search is required")
+	}
+	tokenData, err := ioutil.ReadFile(o.BugzillaTokenPath)
+	if err != nil {
+		klog.Exitf("Failed to load --bugzilla-token-file: %v", err)
+	}
+	u, _ := url.Parse(o.BugzillaURL)
+	c := bugzilla.NewClient(*u)
+	c.APIKey = string(bytes.TrimSpace(tokenData))
+	rt, err := rest.TransportFor(&rest.Config{})
+	if err != nil {
+		klog.Exitf("Unable to build bugzilla client: %v", err)
+	}
+	c.Client = &http.Client{Transport: rt}
+	informer := bugzilla.NewInformer(
+		c,
+		10*time.Minute,
+		8*time.Hour,
+		30*time.Minute,
+		func(metav1.ListOptions) bugzilla.SearchBugsArgs {
+			return bugzilla.SearchBugsArgs{
+				Quicksearch: o.BugzillaSearch,
+			}
+		},
+		func(info *bugzilla.BugInfo) bool {
+			return !contains(info.Keywords, "Security")
+		},
+	)
+	if err := os.MkdirAll(s.path, 0777); err != nil {
+		return fmt.Errorf("unable to create directory for artifact: %w", err)
+	}
+	diskStore := bugzilla.NewCommentDiskStore(s.path, o.MaxAge)
+	s.store = bugzilla.NewCommentStore(c, 2*time.Minute, false, diskStore)
+
+	go informer.Run(ctx.Done())
+	go s.store.Run(ctx, informer)
+	go diskStore.Run(ctx, s.store, o.NoIndex)
+	klog.Infof("Started indexing bugzilla %s with query %q", o.BugzillaURL, o.BugzillaSearch)
+	return nil
+}
+
+func (s *bugzillaSource) Load() error {
+	s.store = bugzilla.NewCommentStore(nil, 0, false, bugzilla.NewCommentDiskStoreReader(s.path))
+	if !s.Enabled() {
+		return nil
+	}
+	if err := s.store.Load(); err != nil {
+		return fmt.Errorf("unable to load bugs from %s: %v", s.path, err)
+	}
+	return nil
+}
+
+func (s *bugzillaSource) MetadataFor(path string) (Result, error) {
+	var result Result
+	result.FileType = "bug"
+	name, err := s.name(path, "NUMBER")
+	if err != nil {
+		return result, err
+	}
+	id, err := strconv.Atoi(name)
+	if err != nil {
+		return result, fmt.Errorf("expected path bugs/bug-NUMBER: %s", path)
+	}
+	result.Name = fmt.Sprintf("Bug %d", id)
+	result.Number = id
+	result.Key = name
+
+	copied := *s.uriPrefix
+	copied.RawQuery = url.Values{"id": []string{strconv.Itoa(id)}}.Encode()
+	result.URI = &copied
+
+	if item, ok := s.store.Get(name); ok {
+		comments := item.(*bugzilla.BugComments)
+		// take the time of last bug update or comment, whichever is newer
+		if l := len(comments.Comments); l > 0 {
+			result.LastModified = comments.Comments[l-1].CreationTime.Time
+		}
+		if comments.Info.LastChangeTime.After(result.LastModified) {
+			result.LastModified = comments.Info.LastChangeTime.Time
+		}
+		if len(comments.Info.Summary) > 0 {
+			if len(comments.Info.Status) > 0 {
+				result.Name = fmt.Sprintf("Bug %d: %s %s", id, comments.Info.Summary, comments.Info.Status)
+			} else {
+				result.Name = fmt.Sprintf("Bug %d: %s", id, comments.Info.Summary)
+			}
+		}
+		result.Bug = &comments.Info
+		result.Fields = bugFields(&comments.Info)
+	}
+
+	result.IgnoreAge = true
+
+	return result, nil
+}
+
+func (s *bugzillaSource) KnownIssues(add func(issue KnownIssue, texts ...string)) {
+	if s.uriPrefix == nil {
+		return
+	}
+	for _, item := range s.store.List() {
+		bug := item.(*bugzilla.BugComments)
+		u := *s.uriPrefix
+		u.RawQuery = url.Values{"id": []string{strconv.Itoa(bug.Info.ID)}}.Encode()
+		texts := []string{bug.Info.Summary}
+		for _, comment := range bug.Comments {
+			texts = append(texts, comment.Text)
+		}
+		add(KnownIssue{Type: "bug", Key: strconv.Itoa(bug.Info.ID), Name: fmt.Sprintf("Bug %d", bug.Info.ID), Title: bug.Info.Summary, Status: bug.Info.Status, URL: u.String()}, texts...)
+	}
+}
+
+func (s *bugzillaSource) Fields(fn func(name string, fields *TrackerFields)) {
+	for _, item := range s.store.List() {
+		bug := item.(*bugzilla.BugComments)
+		fn(fmt.Sprintf("bug-%d", bug.Info.ID), bugFields(&bug.Info))
+	}
+}
+
+func bugFields(info *bugzilla.BugInfo) *TrackerFields {
+	fields := &TrackerFields{
+		Status:        info.Status,
+		Components:    info.Component,
+		TargetRelease: info.TargetRelease,
+		Updated:       info.LastChangeTime.Time,
+	}
+	if len(info.AssignedTo) > 0 {
+		fields.Assignees = []string{info.AssignedTo}
+	}
+	return fields
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/github"
+	"github.com/openshift/ci-search/pkg/tracker"
+)
+
+// gitHubSource indexes the issues of --github-repos matching --github-search.
+type gitHubSource struct {
+	trackerDir
+	uriPrefix *url.URL
+	store     *tracker.CommentStore
+}
+
+func newGitHubSource(o *options) (trackerSource, error) {
+	s := &gitHubSource{
+		trackerDir: newTrackerDir(o, "github-issue", "github-issues", github.FilePrefix),
+		store:      github.NewCommentStore(nil, 0, nil),
+	}
+	if len(o.GitHubRepos) > 0 {
+		for _, repo := range o.GitHubRepos {
+			if parts := strings.Split(repo, "/"); len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 || strings.Contains(parts[0], "_") {
+				return nil, fmt.Errorf("--github-repos must be a list of org/repo: %s", repo)
+			}
+		}
+		s.uriPrefix = &url.URL{Scheme: "https", Host: "github.com", Path: "/"}
+	}
+	return s, nil
+}
+
+func (s *gitHubSource) DisplayName() string { return "GitHub issues" }
+
+func (s *gitHubSource) Enabled() bool { return s.uriPrefix != nil }
+
+func (s *gitHubSource) Count() int { return s.store.Len() }
+
+func (s *gitHubSource) Generation() uint64 { return s.store.Generation() }
+
+func (s *gitHubSource) Start(ctx context.Context, o *options) error {
+	c := github.NewClient(url.URL{Scheme: "https", Host: "api.github.com"})
+	c.Retries = 2
+	if len(o.GitHubTokenPath) > 0 {
+		tokenData, err := ioutil.ReadFile(o.GitHubTokenPath)
+		if err != nil {
+			klog.Exitf("Failed to load --github-token-file: %v", err)
+		}
+		c.Token = string(bytes.TrimSpace(tokenData))
+	}
+	informer := github.NewInformer(
+		c,
+		10*time.Minute,
+		8*time.Hour,
+		30*time.Minute,
+		func(metav1.ListOptions) github.SearchIssuesArgs {
+			return github.SearchIssuesArgs{
+				Repos: o.GitHubRepos,
+				Query: o.GitHubSearch,
+			}
+		},
+		nil,
+	)
+	if err := os.MkdirAll(s.path, 0777); err != nil {
+		return fmt.Errorf("unable to create directory for artifact: %w", err)
+	}
+	diskStore := github.NewCommentDiskStore(s.path, o.MaxAge)
+	s.store = github.NewCommentStore(c, 30*time.Minute, diskStore)
+
+	go informer.Run(ctx.Done())
+	go s.store.Run(ctx, informer)
+	go diskStore.Run(ctx, s.store, o.NoIndex)
+	klog.Infof("Started indexing GitHub issues of %s with query %q", strings.Join(o.GitHubRepos, ", "), o.GitHubSearch)
+	return nil
+}
+
+func (s *gitHubSource) Load() error {
+	s.store = github.NewCommentStore(nil, 0, github.NewCommentDiskStoreReader(s.path))
+	if !s.Enabled() {
+		return nil
+	}
+	if err := s.store.Load(); err != nil {
+		return fmt.Errorf("unable to load GitHub issues from %s: %v", s.path, err)
+	}
+	return nil
+}
+
+// issueURL returns the link to the issue number of repo.
+func (s *gitHubSource) issueURL(repo string, number int) *url.URL {
+	copied := *s.uriPrefix
+	copied.Path = fmt.Sprintf("/%s/issues/%d", repo, number)
+	return &copied
+}
+
+func (s *gitHubSource) MetadataFor(path string) (Result, error) {
+	var result Result
+	result.FileType = "github-issue"
+	key, err := s.name(path, "ORG_REPO_NUMBER")
+	if err != nil {
+		return result, err
+	}
+	repo, number, err := github.ParseIssueKey(key)
+	if err != nil {
+		return result, fmt.Errorf("expected path github-issues/%sORG_REPO_NUMBER: %s", github.FilePrefix, path)
+	}
+	result.Name = fmt.Sprintf("%s#%d", repo, number)
+	result.Number = number
+	result.Key = fmt.Sprintf("%s#%d", repo, number)
+	result.URI = s.issueURL(repo, number)
+
+	if item, ok := s.store.Get(key); ok {
+		comments := item.(*github.IssueComments)
+		// take the time of last issue update or comment, whichever is newer
+		if l := len(comments.Comments); l > 0 {
+			result.LastModified = comments.Comments[l-1].CreatedAt
+		}
+		if comments.Info.UpdatedAt.After(result.LastModified) {
+			result.LastModified = comments.Info.UpdatedAt
+		}
+		if len(comments.Info.Title) > 0 {
+			result.Name = fmt.Sprintf("%s#%d: %s %s", repo, number, comments.Info.Title, comments.Info.State)
+		}
+		result.GitHubIssue = &comments.Info
+		result.Fields = gitHubIssueFields(&comments.Info)
+	}
+
+	result.IgnoreAge = true
+
+	return result, nil
+}
+
+func (s *gitHubSource) KnownIssues(add func(issue KnownIssue, texts ...string)) {
+	if s.uriPrefix == nil {
+		return
+	}
+	for _, item := range s.store.List() {
+		issue := item.(*github.IssueComments)
+		repo, number, err := github.ParseIssueKey(issue.Name)
+		if err != nil {
+			continue
+		}
+		texts := []string{issue.Info.Title, issue.Info.Body}
+		for _, comment := range issue.Comments {
+			texts = append(texts, comment.Body)
+		}
+		key := fmt.Sprintf("%s#%d", repo, number)
+		add(KnownIssue{Type: "github-issue", Key: key, Name: key, Title: issue.Info.Title, Status: issue.Info.State, URL: s.issueURL(repo, number).String()}, texts...)
+	}
+}
+
+func (s *gitHubSource) Fields(fn func(name string, fields *TrackerFields)) {
+	for _, item := range s.store.List() {
+		issue := item.(*github.IssueComments)
+		fn(github.FilePrefix+issue.Name, gitHubIssueFields(&issue.Info))
+	}
+}
+
+// gitHubIssueFields returns the fields of an issue. GitHub issues have no
+// component and use their milestone as the target release.
+func gitHubIssueFields(info *github.IssueInfo) *TrackerFields {
+	fields := &TrackerFields{
+		Status:    info.State,
+		Assignees: info.AssigneeLogins(),
+		Updated:   info.UpdatedAt,
+	}
+	if info.Milestone != nil {
+		fields.TargetRelease = []string{info.Milestone.Title}
+	}
+	return fields
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	jiraBaseClient "github.com/andygrunwald/go-jira"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	jiraClient "k8s.io/test-infra/prow/jira"
+
+	"github.com/openshift/ci-search/jira"
+	"github.com/openshift/ci-search/pkg/tracker"
+)
+
+// jiraSource indexes the Jira issues matching --jira-search.
+type jiraSource struct {
+	trackerDir
+	uriPrefix *url.URL
+	store     *tracker.CommentStore
+}
+
+func newJiraSource(o *options) (trackerSource, error) {
+	s := &jiraSource{
+		trackerDir: newTrackerDir(o, "issue", "issues", "issue__"),
+		store:      jira.NewCommentStore(nil, 0, nil),
+	}
+	if len(o.JiraURL) > 0 {
+		jiraURL, err := url.Parse(o.JiraURL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse --jira-url: %v", err)
+		}
+		u := *jiraURL
+		u.Path = "issues/"
+		s.uriPrefix = &u
+	}
+	return s, nil
+}
+
+func (s *jiraSource) DisplayName() string { return "issues" }
+
+func (s *jiraSource) Enabled() bool { return s.uriPrefix != nil }
+
+func (s *jiraSource) Count() int { return s.store.Len() }
+
+func (s *jiraSource) Generation() uint64 { return s.store.Generation() }
+
+func (s *jiraSource) Start(ctx context.Context, o *options) error {
+	if len(o.JiraSearch) == 0 {
+		klog.Exitf("--jira-search is required")
+	}
+	tokenData, err := ioutil.ReadFile(o.JiraTokenPath)
+	if err != nil {
+		klog.Exitf("Failed to load --jira-token-file: %v", err)
+	}
+	options := func(options *jiraClient.Options) {
+		options.BearerAuth = func() (token string) {
+			return string(bytes.TrimSpace(tokenData))
+		}
+	}
+	jc, _ := jiraClient.NewClient(o.JiraURL, options)
+	c := &jira.Client{
+		Client: jc,
+	}
+
+	informer := jira.NewInformer(
+		c,
+		10*time.Minute,
+		8*time.Hour,
+		30*time.Minute,
+		func(metav1.ListOptions) jira.SearchIssuesArgs {
+			return jira.SearchIssuesArgs{
+				Jql: o.JiraSearch,
+			}
+		},
+		jira.FilterPrivateIssues,
+	)
+	if err := os.MkdirAll(s.path, 0777); err != nil {
+		return fmt.Errorf("unable to create directory for artifact: %w", err)
+	}
+	diskStore := jira.NewCommentDiskStore(s.path, o.MaxAge)
+	s.store = jira.NewCommentStore(c, 2*time.Minute, diskStore)
+
+	go informer.Run(ctx.Done())
+	go s.store.Run(ctx, informer)
+	go diskStore.Run(ctx, s.store, o.NoIndex)
+	klog.Infof("Started indexing jira %s with query %q", o.JiraURL, o.JiraSearch)
+	return nil
+}
+
+func (s *jiraSource) Load() error {
+	s.store = jira.NewCommentStore(nil, 0, jira.NewCommentDiskStoreReader(s.path))
+	if !s.Enabled() {
+		return nil
+	}
+	if err := s.store.Load(); err != nil {
+		return fmt.Errorf("unable to load issues from %s: %v", s.path, err)
+	}
+	return nil
+}
+
+func (s *jiraSource) MetadataFor(path string) (Result, error) {
+	var result Result
+	result.FileType = "issue"
+	name, err := s.name(path, "KEY__ID")
+	if err != nil {
+		return result, err
+	}
+	nameParts := strings.Split(name, "__")
+	if len(nameParts) != 2 {
+		return result, fmt.Errorf("expected path issues/issue__KEY__ID: %s", path)
+	}
+	key := nameParts[0]
+	id, err := strconv.Atoi(nameParts[1])
+	if err != nil {
+		return result, fmt.Errorf("expected path issues/issue__KEY__ID: %s", path)
+	}
+	result.Name = fmt.Sprintf("Issue %d", id)
+	result.Number = id
+	result.Key = key
+
+	copied := *s.uriPrefix
+	copied.Path = fmt.Sprintf("%s/%s", "browse", key)
+	result.URI = &copied
+
+	if item, ok := s.store.Get(nameParts[1]); ok {
+		comments := item.(*jira.IssueComments)
+		// take the time of last issue update or comment, whichever is newer
+		if l := len(comments.Comments); l > 0 {
+			result.LastModified = jira.StringToTime(comments.Comments[l-1].Created)
+		}
+		if time.Time(comments.Info.Fields.Updated).After(result.LastModified) {
+			result.LastModified = time.Time(comments.Info.Fields.Updated)
+		}
+		if len(comments.Info.Fields.Summary) > 0 {
+			if len(comments.Info.Fields.Status.Name) > 0 {
+				result.Name = fmt.Sprintf("Issue %s: %s %s", key, comments.Info.Fields.Summary, comments.Info.Fields.Status.Name)
+			} else {
+				result.Name = fmt.Sprintf("Issue %s: %s", key, comments.Info.Fields.Summary)
+			}
+		}
+		result.Issue = &comments.Info
+		result.Fields = issueFields(&comments.Info)
+	}
+
+	result.IgnoreAge = true
+
+	return result, nil
+}
+
+func (s *jiraSource) KnownIssues(add func(issue KnownIssue, texts ...string)) {
+	if s.uriPrefix == nil {
+		return
+	}
+	for _, item := range s.store.List() {
+		issue := item.(*jira.IssueComments)
+		if issue.Info.Fields == nil {
+			continue
+		}
+		u := *s.uriPrefix
+		u.Path = fmt.Sprintf("%s/%s", "browse", issue.Info.Key)
+		var status string
+		if issue.Info.Fields.Status != nil {
+			status = issue.Info.Fields.Status.Name
+		}
+		texts := []string{issue.Info.Fields.Summary, issue.Info.Fields.Description}
+		for _, comment := range issue.Comments {
+			texts = append(texts, comment.Body)
+		}
+		add(KnownIssue{Type: "issue", Key: issue.Info.Key, Name: issue.Info.Key, Title: issue.Info.Fields.Summary, Status: status, URL: u.String()}, texts...)
+	}
+}
+
+func (s *jiraSource) Fields(fn func(name string, fields *TrackerFields)) {
+	for _, item := range s.store.List() {
+		issue := item.(*jira.IssueComments)
+		if issue.Info.Fields == nil {
+			continue
+		}
+		fn(fmt.Sprintf("issue__%s__%s", issue.Info.Key, issue.Info.ID), issueFields(&issue.Info))
+	}
+}
+
+func issueFields(issue *jiraBaseClient.Issue) *TrackerFields {
+	if issue.Fields == nil {
+		return nil
+	}
+	fields := &TrackerFields{
+		TargetRelease: jira.IssueTargetVersionNames(*issue),
+		Updated:       time.Time(issue.Fields.Updated),
+	}
+	if issue.Fields.Status != nil {
+		fields.Status = issue.Fields.Status.Name
+	}
+	for _, component := range issue.Fields.Components {
+		if component != nil {
+			fields.Components = append(fields.Components, component.Name)
+		}
+	}
+	for _, version := range issue.Fields.FixVersions {
+		if version != nil {
+			fields.TargetRelease = append(fields.TargetRelease, version.Name)
+		}
+	}
+	if assignee := issue.Fields.Assignee; assignee != nil {
+		for _, identity := range []string{assignee.Name, assignee.EmailAddress, assignee.DisplayName} {
+			if len(identity) > 0 {
+				fields.Assignees = append(fields.Assignees, identity)
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// jobSource is the artifacts of the job runs saved under jobs/. Unlike the
+// trackers it is started by Run, since the jobs are shared with ingestion and
+// the test statistics.
+type jobSource struct {
+	o *options
+}
+
+func (s jobSource) Dir() string { return "jobs" }
+
+func (s jobSource) DisplayName() string { return "jobs" }
+
+func (s jobSource) Enabled() bool { return s.o.jobURIPrefix != nil }
+
+// Searched returns true for every search type except those limited to
+// trackers.
+func (s jobSource) Searched(searchType string) bool {
+	return searchType != "bug+issue" && !isTrackerFileType(searchType)
+}
+
+func (s jobSource) Count() int { return s.o.jobsIndex.Stats().Entries }
+
+func (s jobSource) Generation() uint64 { return s.o.jobsIndex.Generation() }
+
+// GenerationFor changes only when runs that index searches are added or
+// removed.
+func (s jobSource) GenerationFor(index *Index) uint64 { return s.o.jobsIndex.GenerationFor(index) }
+
+func (s jobSource) RipgrepArguments(index *Index, jobNames sets.String) ([]string, []string, error) {
+	paths, err := s.o.jobsIndex.SearchPaths(index, jobNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	var args []string
+	if paths == nil {
+		if names := s.o.jobsIndex.FilenamesForSearchType(index.SearchType); len(names) > 0 {
+			for _, name := range names {
+				args = append(args, "--glob", name+"*")
+			}
+			args = append(args, s.o.jobsPath)
+		}
+	}
+	return args, paths, nil
+}
+
+func (s jobSource) SearchPaths(index *Index, jobNames sets.String) ([]string, error) {
+	paths, err := s.o.jobsIndex.SearchPaths(index, jobNames)
+	if err != nil {
+		return nil, err
+	}
+	if paths == nil {
+		// the index has not been loaded yet, search everything on disk
+		return findFilesWithPrefix(s.o.jobsPath, s.o.jobsIndex.FilenamesForSearchType(index.SearchType))
+	}
+	return paths, nil
+}
+
+func (s jobSource) MetadataFor(path string) (Result, error) {
+	parts := strings.SplitN(path, "/", 8)
+	last := len(parts) - 1
+
+	var result Result
+	result.URI = s.o.links.jobURI(s.o.jobURIPrefix, strings.Join(parts[:last], "/"))
+
+	result.FileType = s.o.artifacts.fileTypeFor(parts[last])
+
+	switch parts[1] {
+	case "logs":
+		result.Trigger = "build"
+	case "pr-logs":
+		result.Trigger = "pull"
+	default:
+		result.Trigger = parts[1]
+	}
+
+	var err error
+	result.Number, err = strconv.Atoi(parts[last-1])
+	if err != nil {
+		return result, err
+	}
+
+	if last < 3 {
+		return result, fmt.Errorf("not enough parts (%d < 3)", last)
+	}
+	result.Name = parts[last-2]
+
+	result.LastModified = s.o.jobsIndex.LastModified(path)
+
+	return result, nil
+}
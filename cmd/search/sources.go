@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Source is a set of files saved under --path that can be searched, such as the
+// artifacts of job runs or the bugs of a tracker.
+type Source interface {
+	// Dir is the directory under --path the files of the source are saved to.
+	// It also names the source in --disk-quota.
+	Dir() string
+	// DisplayName describes the items of the source to users.
+	DisplayName() string
+	// Enabled returns false if the source has not been configured.
+	Enabled() bool
+	// Searched returns true if searches of searchType include the source.
+	Searched(searchType string) bool
+	// RipgrepArguments returns the arguments and paths that restrict ripgrep to
+	// the files of the source that index searches.
+	RipgrepArguments(index *Index, jobNames sets.String) ([]string, []string, error)
+	// SearchPaths returns the paths of the files of the source that index
+	// searches.
+	SearchPaths(index *Index, jobNames sets.String) ([]string, error)
+	// MetadataFor describes the result for the file at path, relative to Dir.
+	MetadataFor(path string) (Result, error)
+	// Count returns the number of items indexed.
+	Count() int
+	// Generation changes whenever the files of the source are reloaded.
+	Generation() uint64
+}
+
+// trackerSource is a source of the bugs or issues of a tracker, saved one file
+// per item.
+type trackerSource interface {
+	Source
+	// Type is the search type that selects only this source, and the file type
+	// of its results.
+	Type() string
+	// Start lists and watches the items of the tracker and saves them to disk.
+	Start(ctx context.Context, o *options) error
+	// Load reads the items previously saved to disk without contacting the
+	// tracker.
+	Load() error
+	// KnownIssues calls add with each item and the texts that may reference
+	// job runs.
+	KnownIssues(add func(issue KnownIssue, texts ...string))
+	// Fields calls fn with the name of the file of each item held in memory
+	// and the fields searches may filter it by.
+	Fields(fn func(name string, fields *TrackerFields))
+}
+
+// trackers are the trackers that can be indexed, in the order they are searched
+// and listed. Adding a tracker only requires a source registered here.
+var trackers = []struct {
+	searchType string
+	new        func(o *options) (trackerSource, error)
+}{
+	{"bug", newBugzillaSource},
+	{"issue", newJiraSource},
+	{"github-issue", newGitHubSource},
+}
+
+// trackerSearchTypes returns the search types of each tracker.
+func trackerSearchTypes() []string {
+	types := make([]string, 0, len(trackers))
+	for _, tracker := range trackers {
+		types = append(types, tracker.searchType)
+	}
+	return types
+}
+
+// isTrackerFileType returns true if fileType is a bug or issue rather than a
+// file of a job run.
+func isTrackerFileType(fileType string) bool {
+	for _, tracker := range trackers {
+		if tracker.searchType == fileType {
+			return true
+		}
+	}
+	return false
+}
+
+// setupTrackers creates the source of each tracker. Trackers that are not
+// configured are disabled.
+func (o *options) setupTrackers() error {
+	o.trackers = nil
+	for _, tracker := range trackers {
+		source, err := tracker.new(o)
+		if err != nil {
+			return err
+		}
+		o.trackers = append(o.trackers, source)
+	}
+	return nil
+}
+
+// sources returns the job source followed by the source of each tracker.
+func (o *options) sources() []Source {
+	sources := make([]Source, 0, len(o.trackers)+1)
+	sources = append(sources, jobSource{o})
+	for _, tracker := range o.trackers {
+		sources = append(sources, tracker)
+	}
+	return sources
+}
+
+// searchedSources returns the enabled sources searched for searchType. Searches
+// that combine several trackers skip the trackers that are not enabled.
+func (o *options) searchedSources(searchType string) ([]Source, error) {
+	var sources []Source
+	for _, source := range o.sources() {
+		if !source.Searched(searchType) {
+			continue
+		}
+		if !source.Enabled() {
+			if tracker, ok := source.(trackerSource); ok && tracker.Type() != searchType {
+				continue
+			}
+			return nil, fmt.Errorf("searching on %s is not enabled", source.DisplayName())
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// trackerDir is the directory of a tracker source, which holds a file named
+// with prefix for each item.
+type trackerDir struct {
+	searchType string
+	dir        string
+	path       string
+	prefix     string
+}
+
+func newTrackerDir(o *options, searchType, dir, prefix string) trackerDir {
+	return trackerDir{searchType: searchType, dir: dir, path: filepath.Join(o.Path, dir), prefix: prefix}
+}
+
+func (d trackerDir) Type() string { return d.searchType }
+
+func (d trackerDir) Dir() string { return d.dir }
+
+// Searched returns true for the search type of the tracker and for the search
+// types that include every tracker.
+func (d trackerDir) Searched(searchType string) bool {
+	switch searchType {
+	case d.searchType, "bug+issue", "bug+issue+junit", "all":
+		return true
+	}
+	return false
+}
+
+func (d trackerDir) RipgrepArguments(*Index, sets.String) ([]string, []string, error) {
+	return []string{"--glob", d.prefix + "*"}, []string{d.path}, nil
+}
+
+func (d trackerDir) SearchPaths(*Index, sets.String) ([]string, error) {
+	return filepath.Glob(filepath.Join(d.path, d.prefix+"*"))
+}
+
+// name returns the name of the file at path relative to the directory, or an
+// error if it is not an item of the tracker.
+func (d trackerDir) name(path, format string) (string, error) {
+	if !strings.HasPrefix(path, d.prefix) {
+		return "", fmt.Errorf("expected path %s/%s%s: %s", d.dir, d.prefix, format, path)
+	}
+	return strings.TrimPrefix(path, d.prefix), nil
+}
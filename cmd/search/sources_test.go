@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_options_searchedSources(t *testing.T) {
+	o := &options{Path: "/tmp/search", BugzillaURL: "https://bugzilla.redhat.com"}
+	if err := o.setupPaths(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		searchType string
+		want       []string
+		wantErr    string
+	}{
+		{searchType: "bug", want: []string{"bugs"}},
+		{searchType: "issue", wantErr: "searching on issues is not enabled"},
+		{searchType: "github-issue", wantErr: "searching on GitHub issues is not enabled"},
+		{searchType: "bug+issue", want: []string{"bugs"}},
+		{searchType: "bug+junit", want: []string{"jobs", "bugs"}},
+		{searchType: "all", want: []string{"jobs", "bugs"}},
+		{searchType: "build-log", want: []string{"jobs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.searchType, func(t *testing.T) {
+			sources, err := o.searchedSources(tt.searchType)
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var dirs []string
+			for _, source := range sources {
+				dirs = append(dirs, source.Dir())
+			}
+			if !reflect.DeepEqual(dirs, tt.want) {
+				t.Errorf("got %v, want %v", dirs, tt.want)
+			}
+		})
+	}
+
+	o.jobURIPrefix = nil
+	if _, err := o.searchedSources("bug+junit"); err == nil || err.Error() != "searching on jobs is not enabled" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/pkg/httpwriter"
+	"github.com/openshift/ci-search/prow"
+)
+
+// testFailureIndex holds the failed tests recorded for each job run so that
+// tests can be ranked without searching the junit files.
+type testFailureIndex struct {
+	// base is the directory paths are resolved relative to
+	base     string
+	resolver PathResolver
+
+	lock sync.Mutex
+	runs map[string]*testFailureRun
+	// byRun holds the runs by job name and number
+	byRun map[string]*testFailureRun
+	// tests holds the name of each test that passed or was skipped once, so
+	// that runs refer to them by their position
+	tests     []failingTestKey
+	testIndex map[failingTestKey]int32
+}
+
+// testFailureRun is the set of tests that failed in a single job run.
+type testFailureRun struct {
+	job    string
+	number int
+	uri    string
+	// pull identifies the pull request the run tested, if any
+	pull string
+	// at is the time the run finished
+	at       time.Time
+	size     int64
+	failures []prow.TestFailure
+	// hasResults is set if the tests that passed or were skipped were
+	// recorded
+	hasResults bool
+	passed     []int32
+	skipped    []int32
+}
+
+func newTestFailureIndex(base string, resolver PathResolver) *testFailureIndex {
+	return &testFailureIndex{
+		base:     base,
+		resolver: resolver,
+		runs:     make(map[string]*testFailureRun),
+
+		testIndex: make(map[failingTestKey]int32),
+	}
+}
+
+// intern returns the position of the named tests in t.tests.
+func (t *testFailureIndex) intern(names map[string][]string) []int32 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var positions []int32
+	for suite, tests := range names {
+		for _, name := range tests {
+			key := failingTestKey{suite: suite, name: name}
+			i, ok := t.testIndex[key]
+			if !ok {
+				i = int32(len(t.tests))
+				t.tests = append(t.tests, key)
+				t.testIndex[key] = i
+			}
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// Sync loads the test failure files in paths that are new or have changed and
+// forgets any run not in paths.
+func (t *testFailureIndex) Sync(paths []string) {
+	start := time.Now()
+	var loaded, failed int
+
+	t.lock.Lock()
+	previous := t.runs
+	t.lock.Unlock()
+
+	runs := make(map[string]*testFailureRun, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if run, ok := previous[path]; ok && run.at.Equal(info.ModTime()) && run.size == info.Size() {
+			runs[path] = run
+			continue
+		}
+		rel, err := filepath.Rel(t.base, path)
+		if err != nil {
+			continue
+		}
+		metadata, err := t.resolver.MetadataFor(filepath.ToSlash(rel))
+		if err != nil || metadata.URI == nil {
+			klog.V(4).Infof("Ignoring test failures in %s without a job run: %v", path, err)
+			continue
+		}
+		failures, err := prow.ReadTestFailures(path)
+		if err != nil {
+			klog.Errorf("Unable to load test failures: %v", err)
+			failed++
+			continue
+		}
+		run := &testFailureRun{
+			job:      metadata.Name,
+			number:   metadata.Number,
+			uri:      metadata.URI.String(),
+			pull:     pullForPath(rel, metadata.Trigger),
+			at:       info.ModTime(),
+			size:     info.Size(),
+			failures: failures,
+		}
+		// runs indexed before passing tests were recorded have no results
+		results, err := prow.ReadTestResults(filepath.Join(filepath.Dir(path), prow.TestResultsFile))
+		switch {
+		case err == nil:
+			run.hasResults = true
+			run.passed = t.intern(results.Passed)
+			run.skipped = t.intern(results.Skipped)
+		case !os.IsNotExist(err):
+			klog.Errorf("Unable to load test results: %v", err)
+		}
+		runs[path] = run
+		loaded++
+	}
+
+	byRun := make(map[string]*testFailureRun, len(runs))
+	for _, run := range runs {
+		byRun[runKey(run.job, run.number)] = run
+	}
+
+	t.lock.Lock()
+	t.runs = runs
+	t.byRun = byRun
+	t.lock.Unlock()
+	klog.Infof("Refreshed test failure index in %s, %d runs loaded, %d could not be read, %d runs", time.Now().Sub(start).Truncate(time.Millisecond), loaded, failed, len(runs))
+}
+
+// runKey identifies the run of job with the given number.
+func runKey(job string, number int) string {
+	return job + "/" + strconv.Itoa(number)
+}
+
+// Failures returns the tests that failed in the run of job with the given
+// number, or nil if the run is not indexed.
+func (t *testFailureIndex) Failures(job string, number int) []prow.TestFailure {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if run, ok := t.byRun[runKey(job, number)]; ok {
+		return run.failures
+	}
+	return nil
+}
+
+// pullForPath returns the directory of the pull request that the run with
+// the given test file tested, or an empty string if the run did not test a
+// single pull request.
+func pullForPath(rel, trigger string) string {
+	if trigger != "pull" {
+		return ""
+	}
+	// .../pr-logs/pull/<org_repo>/<number>/<job>/<build>/<file>
+	pull := filepath.Dir(filepath.Dir(filepath.Dir(rel)))
+	if filepath.Base(pull) == "batch" {
+		return ""
+	}
+	return filepath.ToSlash(pull)
+}
+
+// FailingTest summarizes the failures of a single test across job runs.
+type FailingTest struct {
+	Suite string `json:"suite,omitempty"`
+	Name  string `json:"name"`
+	// Failures is the number of runs the test failed in.
+	Failures int `json:"failures"`
+	// Jobs is the number of distinct jobs the test failed in.
+	Jobs int `json:"jobs"`
+	// Messages is the number of distinct failure messages.
+	Messages int `json:"messages"`
+	// AverageDuration is the mean duration of the failed test in seconds.
+	AverageDuration float64 `json:"averageDuration"`
+	// LastFailure is when the most recent failing run finished.
+	LastFailure metav1.Time `json:"lastFailure"`
+	// LastURL is the most recent failing run.
+	LastURL string `json:"lastURL"`
+}
+
+// FailingTestsResponse ranks the tests that failed most often.
+type FailingTestsResponse struct {
+	// Runs is the number of job runs with recorded test results that were
+	// considered.
+	Runs  int           `json:"runs"`
+	Tests []FailingTest `json:"tests"`
+}
+
+type failingTestKey struct {
+	suite, name string
+}
+
+type failingTestCounts struct {
+	FailingTest
+	jobs     sets.String
+	messages sets.String
+	duration float64
+}
+
+// Runs returns the runs that finished between from and to and whose job
+// matches jobFilter.
+func (t *testFailureIndex) Runs(from, to time.Time, jobFilter func(string) bool) []*testFailureRun {
+	t.lock.Lock()
+	all := t.runs
+	t.lock.Unlock()
+
+	var runs []*testFailureRun
+	for _, run := range all {
+		if run.at.Before(from) || run.at.After(to) {
+			continue
+		}
+		if jobFilter != nil && !jobFilter(run.job) {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// TopFailing returns up to limit tests that failed in the most runs that
+// finished between from and to and whose job matches jobFilter.
+func (t *testFailureIndex) TopFailing(from, to time.Time, jobFilter func(string) bool, limit int) FailingTestsResponse {
+	runs := t.Runs(from, to, jobFilter)
+
+	var response FailingTestsResponse
+	response.Runs = len(runs)
+	tests := make(map[failingTestKey]*failingTestCounts)
+	for _, run := range runs {
+
+		// a test that is retried within a run counts as a single failure
+		seen := make(map[failingTestKey]struct{}, len(run.failures))
+		for _, failure := range run.failures {
+			key := failingTestKey{suite: failure.Suite, name: failure.Name}
+			counts, ok := tests[key]
+			if !ok {
+				counts = &failingTestCounts{
+					FailingTest: FailingTest{Suite: failure.Suite, Name: failure.Name},
+					jobs:        sets.NewString(),
+					messages:    sets.NewString(),
+				}
+				tests[key] = counts
+			}
+			counts.jobs.Insert(run.job)
+			if len(failure.MessageHash) > 0 {
+				counts.messages.Insert(failure.MessageHash)
+			}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			counts.Failures++
+			counts.duration += failure.Duration
+			if run.at.After(counts.LastFailure.Time) {
+				counts.LastFailure = metav1.Time{Time: run.at}
+				counts.LastURL = run.uri
+			}
+		}
+	}
+
+	response.Tests = make([]FailingTest, 0, len(tests))
+	for _, counts := range tests {
+		test := counts.FailingTest
+		test.Jobs = counts.jobs.Len()
+		test.Messages = counts.messages.Len()
+		test.AverageDuration = counts.duration / float64(test.Failures)
+		response.Tests = append(response.Tests, test)
+	}
+	sort.Slice(response.Tests, func(i, j int) bool {
+		a, b := response.Tests[i], response.Tests[j]
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		if a.Jobs != b.Jobs {
+			return a.Jobs > b.Jobs
+		}
+		if a.Suite != b.Suite {
+			return a.Suite < b.Suite
+		}
+		return a.Name < b.Name
+	})
+	if limit > 0 && len(response.Tests) > limit {
+		response.Tests = response.Tests[:limit]
+	}
+	return response
+}
+
+// parseFailingTestsRequest returns the index and limit of a request for the
+// top failing tests.
+func parseFailingTestsRequest(req *http.Request, maxAge time.Duration, rules artifactRules) (*Index, int, error) {
+	index, err := parseRequest(req, "tests", maxAge, rules)
+	if err != nil {
+		return nil, 0, err
+	}
+	limit, err := parseLimit(req, 50)
+	if err != nil {
+		return nil, 0, err
+	}
+	return index, limit, nil
+}
+
+// parseLimit returns the limit parameter of req or defaultLimit if it is not
+// set.
+func parseLimit(req *http.Request, defaultLimit int) (int, error) {
+	value := req.FormValue("limit")
+	if len(value) == 0 {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > 1000 {
+		return 0, fmt.Errorf("limit must be a number between 1 and 1000")
+	}
+	return limit, nil
+}
+
+func (o *options) handleFailingTests(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		klog.Infof("Render failing tests %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	var err error
+	var limit int
+	index, limit, err = parseFailingTestsRequest(req, o.MaxAge, o.artifacts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	from, to := index.Window(start)
+	result := o.testFailures.TopFailing(from, to, index.JobFilter, limit)
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to serialize result: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	if _, err = writer.Write(data); err != nil {
+		klog.Errorf("Failed to write response: %v", err)
+		return
+	}
+
+	success = true
+}
+
+func (o *options) handleFailingTestsPage(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		klog.Infof("Render failing tests page %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	var err error
+	var limit int
+	index, limit, err = parseFailingTestsRequest(req, o.MaxAge, o.artifacts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	from, to := index.Window(start)
+	result := o.testFailures.TopFailing(from, to, index.JobFilter, limit)
+
+	type row struct {
+		FailingTest
+		Title     string
+		SearchURL string
+		Age       string
+	}
+	rows := make([]row, 0, len(result.Tests))
+	for _, test := range result.Tests {
+		title := test.Name
+		if len(test.Suite) > 0 {
+			title = test.Suite + "." + test.Name
+		}
+		search := &Index{
+			Search:      []string{regexp.QuoteMeta(title)},
+			SearchType:  "junit",
+			MaxAge:      index.MaxAge,
+			From:        index.From,
+			To:          index.To,
+			IncludeName: index.IncludeName,
+			ExcludeName: index.ExcludeName,
+			MaxMatches:  1,
+			Context:     -1,
+			GroupByJob:  true,
+		}
+		age, _ := formatAge(test.LastFailure.Time, start, index)
+		rows = append(rows, row{
+			FailingTest: test,
+			Title:       title,
+			SearchURL:   (&url.URL{Path: "/", RawQuery: search.Query().Encode()}).String(),
+			Age:         age,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	fmt.Fprintf(writer, htmlPageStart, "Top failing tests", "")
+	err = htmlFailingTests.Execute(writer, map[string]interface{}{
+		"index": index,
+		"from":  formatTime(index.From),
+		"to":    formatTime(index.To),
+		"runs":  result.Runs,
+		"rows":  rows,
+	})
+	if err != nil {
+		klog.Errorf("Failed to execute failing tests template: %v", err)
+		return
+	}
+	fmt.Fprint(writer, htmlPageEnd)
+
+	success = true
+}
+
+var htmlFailingTests = template.Must(template.New("tests").Parse(`
+<h4 class="mt-4">Top failing tests</h4>
+<p class="small"><em>{{ len .rows }} tests failed in {{ .runs }} runs {{ if .index.From.IsZero }}in the last {{ .index.MaxAge }}{{ else }}since {{ .from }}{{ end }}{{ if not .index.To.IsZero }} until {{ .to }}{{ end }}</em> - <a href="/tests/stats">pass and flake rates</a> - <a href="/">search</a></p>
+<form class="form mb-3" method="GET">
+	<div class="input-group input-group-sm">
+		<div class="input-group-prepend"><span class="input-group-text">Job:</span></div>
+		<input title="A regular expression that matches the name of a job" class="form-control col-auto" name="name" value="{{ .index.IncludeName }}" placeholder="Focus job names by regex ...">
+		<input title="A regular expression that matches the name of a job" class="form-control col-auto" name="excludeName" value="{{ .index.ExcludeName }}" placeholder="Skip job names by regex ...">
+		<input title="How far back to look for failures" class="form-control col-1" name="maxAge" value="{{ .index.MaxAge }}">
+		<input title="Only include runs that failed after this RFC3339 time or duration ago, instead of maxAge" class="form-control col-1" name="from" value="{{ .from }}" placeholder="From">
+		<input title="Only include runs that failed before this RFC3339 time or duration ago" class="form-control col-1" name="to" value="{{ .to }}" placeholder="To">
+		<div class="input-group-append"><input class="btn btn-outline-primary" type="submit" value="Filter"></div>
+	</div>
+</form>
+<div class="table-responsive"><table class="table table-sm">
+<thead><tr><th>Test</th><th class="text-right">Failed runs</th><th class="text-right">Jobs</th><th class="text-right">Messages</th><th class="text-right">Duration</th><th>Last failure</th></tr></thead>
+<tbody>
+{{ range .rows }}<tr><td><a href="{{ .SearchURL }}">{{ .Title }}</a></td><td class="text-right">{{ .Failures }}</td><td class="text-right">{{ .Jobs }}</td><td class="text-right">{{ .Messages }}</td><td class="text-right">{{ printf "%.1fs" .AverageDuration }}</td><td class="text-nowrap"><a target="_blank" href="{{ .LastURL }}">{{ .Age }}</a></td></tr>
+{{ else }}<tr><td colspan="6"><em>No test failures were recorded.</em></td></tr>
+{{ end }}</tbody>
+</table></div>
+`))
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_testFailureIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	var paths []string
+	write := func(job, run string, at time.Time, failures ...prow.TestFailure) string {
+		runDir := filepath.Join(dir, "jobs", "origin-ci-test", "logs", job, run)
+		if err := os.MkdirAll(runDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(runDir, prow.TestFailuresFile)
+		if err := prow.WriteTestFailures(path, failures); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+		return path
+	}
+	a := prow.TestFailure{Suite: "e2e", Name: "a", Duration: 2, MessageHash: "1"}
+	b := prow.TestFailure{Suite: "e2e", Name: "b", Duration: 1, MessageHash: "1"}
+	retried := a
+	retried.MessageHash = "2"
+	write("job-1", "1", now.Add(-time.Hour), a, retried, b)
+	write("job-1", "2", now.Add(-2*time.Hour), a)
+	write("job-2", "1", now.Add(-3*time.Hour), a)
+	write("job-2", "2", now.Add(-4*time.Hour))
+	old := write("job-2", "3", now.Add(-48*time.Hour), b)
+
+	jobURIPrefix, _ := url.Parse("https://prow.ci.openshift.org/view/gs/")
+	o := &options{jobURIPrefix: jobURIPrefix, jobsIndex: &pathIndex{}}
+	index := newTestFailureIndex(dir, o)
+	index.Sync(paths)
+
+	result := index.TopFailing(now.Add(-24*time.Hour), now, nil, 10)
+	if result.Runs != 4 || len(result.Tests) != 2 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+	top := result.Tests[0]
+	if top.Name != "a" || top.Failures != 3 || top.Jobs != 2 || top.Messages != 2 || top.AverageDuration != 2 || !top.LastFailure.Time.Equal(now.Add(-time.Hour)) || top.LastURL != "https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/job-1/1" {
+		t.Errorf("unexpected top test: %#v", top)
+	}
+	if second := result.Tests[1]; second.Name != "b" || second.Failures != 1 {
+		t.Errorf("unexpected second test: %#v", second)
+	}
+
+	if result := index.TopFailing(now.Add(-24*time.Hour), now, func(job string) bool { return job == "job-2" }, 10); result.Runs != 2 || len(result.Tests) != 1 || result.Tests[0].Failures != 1 {
+		t.Errorf("unexpected filtered result: %#v", result)
+	}
+	if result := index.TopFailing(now.Add(-72*time.Hour), now, nil, 1); len(result.Tests) != 1 || result.Tests[0].Name != "a" {
+		t.Errorf("unexpected limited result: %#v", result)
+	}
+
+	// removed runs are forgotten
+	index.Sync([]string{old})
+	if result := index.TopFailing(now.Add(-72*time.Hour), now, nil, 10); result.Runs != 1 || result.Tests[0].Name != "b" {
+		t.Errorf("unexpected result after sync: %#v", result)
+	}
+}
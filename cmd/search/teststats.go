@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/pkg/httpwriter"
+)
+
+// TestStats summarizes the results of a single test across the job runs that
+// recorded which tests passed.
+type TestStats struct {
+	Suite string `json:"suite,omitempty"`
+	Name  string `json:"name"`
+	// Runs is the number of runs the test passed or failed in.
+	Runs int `json:"runs"`
+	// Passes is the number of runs the test passed in, including those where
+	// it passed when retried.
+	Passes int `json:"passes"`
+	// Failures is the number of runs the test failed in.
+	Failures int `json:"failures"`
+	// Flakes is the number of failures followed by a pass, either when the
+	// test was retried in the same run or in a later run of the same job on
+	// the same pull request.
+	Flakes int `json:"flakes"`
+	// Skips is the number of runs the test was skipped in.
+	Skips int `json:"skips"`
+	// PassRate is the fraction of runs the test passed in.
+	PassRate float64 `json:"passRate"`
+	// FlakeRate is the fraction of runs the test flaked in.
+	FlakeRate float64 `json:"flakeRate"`
+	// FirstFailure is when the earliest failing run finished.
+	FirstFailure metav1.Time `json:"firstFailure"`
+	// LastFailure is when the most recent failing run finished.
+	LastFailure metav1.Time `json:"lastFailure"`
+	// LastURL is the most recent failing run.
+	LastURL string `json:"lastURL,omitempty"`
+}
+
+// TestStatsResponse lists the pass and flake rates of tests.
+type TestStatsResponse struct {
+	// Runs is the number of job runs with recorded test results that were
+	// considered.
+	Runs  int         `json:"runs"`
+	Tests []TestStats `json:"tests"`
+}
+
+// testStatsSorts orders the tests by the given column, worst first.
+var testStatsSorts = map[string]func(a, b *TestStats) bool{
+	"flakes": func(a, b *TestStats) bool {
+		if a.FlakeRate != b.FlakeRate {
+			return a.FlakeRate > b.FlakeRate
+		}
+		return a.Flakes > b.Flakes
+	},
+	"failures": func(a, b *TestStats) bool {
+		return a.Failures > b.Failures
+	},
+	"passRate": func(a, b *TestStats) bool {
+		if a.PassRate != b.PassRate {
+			return a.PassRate < b.PassRate
+		}
+		return a.Runs > b.Runs
+	},
+}
+
+// testRunKey identifies a test in the runs of a job on a pull request.
+type testRunKey struct {
+	pull, job string
+	test      failingTestKey
+}
+
+// TestStats returns up to limit tests ordered by sortBy from the runs that
+// finished between from and to, whose job matches jobFilter and that recorded
+// which tests passed. Only tests that failed are returned unless testFilter is
+// set, in which case every test whose name matches is.
+func (t *testFailureIndex) TestStats(from, to time.Time, jobFilter, testFilter func(string) bool, sortBy string, limit int) TestStatsResponse {
+	var runs []*testFailureRun
+	for _, run := range t.Runs(from, to, jobFilter) {
+		if run.hasResults {
+			runs = append(runs, run)
+		}
+	}
+	// flakes across runs are found in the order the runs finished
+	sort.Slice(runs, func(i, j int) bool { return runs[i].at.Before(runs[j].at) })
+
+	t.lock.Lock()
+	names := t.tests
+	t.lock.Unlock()
+
+	tests := make(map[failingTestKey]*TestStats)
+	stats := func(key failingTestKey) *TestStats {
+		s, ok := tests[key]
+		if !ok {
+			s = &TestStats{Suite: key.suite, Name: key.name}
+			tests[key] = s
+		}
+		return s
+	}
+	// failures on a pull request that have not yet been followed by a pass
+	pending := make(map[testRunKey]int)
+
+	for _, run := range runs {
+		failed := make(map[failingTestKey]struct{}, len(run.failures))
+		for _, failure := range run.failures {
+			failed[failingTestKey{suite: failure.Suite, name: failure.Name}] = struct{}{}
+		}
+		passed := make(map[failingTestKey]struct{}, len(run.passed))
+		for _, i := range run.passed {
+			passed[names[i]] = struct{}{}
+		}
+
+		for key := range failed {
+			s := stats(key)
+			s.Runs++
+			s.Failures++
+			if s.FirstFailure.IsZero() {
+				s.FirstFailure = metav1.Time{Time: run.at}
+			}
+			s.LastFailure = metav1.Time{Time: run.at}
+			s.LastURL = run.uri
+			if _, ok := passed[key]; ok {
+				s.Passes++
+				s.Flakes++
+				continue
+			}
+			if len(run.pull) > 0 {
+				pending[testRunKey{pull: run.pull, job: run.job, test: key}]++
+			}
+		}
+		for key := range passed {
+			if _, ok := failed[key]; ok {
+				continue
+			}
+			s := stats(key)
+			s.Runs++
+			s.Passes++
+			if len(run.pull) > 0 {
+				pullKey := testRunKey{pull: run.pull, job: run.job, test: key}
+				if count, ok := pending[pullKey]; ok {
+					s.Flakes += count
+					delete(pending, pullKey)
+				}
+			}
+		}
+		for _, i := range run.skipped {
+			stats(names[i]).Skips++
+		}
+	}
+
+	response := TestStatsResponse{Runs: len(runs), Tests: make([]TestStats, 0, len(tests))}
+	for _, s := range tests {
+		if testFilter != nil {
+			if !testFilter(testTitle(s.Suite, s.Name)) {
+				continue
+			}
+		} else if s.Failures == 0 {
+			continue
+		}
+		if s.Runs > 0 {
+			s.PassRate = float64(s.Passes) / float64(s.Runs)
+			s.FlakeRate = float64(s.Flakes) / float64(s.Runs)
+		}
+		response.Tests = append(response.Tests, *s)
+	}
+	less, ok := testStatsSorts[sortBy]
+	if !ok {
+		less = testStatsSorts["flakes"]
+	}
+	sort.Slice(response.Tests, func(i, j int) bool {
+		a, b := &response.Tests[i], &response.Tests[j]
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		if a.Suite != b.Suite {
+			return a.Suite < b.Suite
+		}
+		return a.Name < b.Name
+	})
+	if limit > 0 && len(response.Tests) > limit {
+		response.Tests = response.Tests[:limit]
+	}
+	return response
+}
+
+// testTitle returns the name of a test as it appears in junit.failures.
+func testTitle(suite, name string) string {
+	if len(suite) > 0 {
+		return suite + "." + name
+	}
+	return name
+}
+
+// testStatsRequest is a request for the pass and flake rates of tests.
+type testStatsRequest struct {
+	index      *Index
+	limit      int
+	test       string
+	testFilter func(string) bool
+	sortBy     string
+}
+
+func parseTestStatsRequest(req *http.Request, maxAge time.Duration, rules artifactRules) (*testStatsRequest, error) {
+	index, err := parseRequest(req, "tests", maxAge, rules)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := parseLimit(req, 50)
+	if err != nil {
+		return nil, err
+	}
+	r := &testStatsRequest{index: index, limit: limit, sortBy: "flakes"}
+	if value := req.FormValue("sort"); len(value) > 0 {
+		if _, ok := testStatsSorts[value]; !ok {
+			return nil, fmt.Errorf("sort must be 'flakes', 'failures' or 'passRate'")
+		}
+		r.sortBy = value
+	}
+	if value := req.FormValue("test"); len(value) > 0 {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("test is an invalid regular expression: %v", err)
+		}
+		r.test = value
+		r.testFilter = re.MatchString
+	}
+	return r, nil
+}
+
+func (o *options) handleTestStats(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		klog.Infof("Render test stats %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	r, err := parseTestStatsRequest(req, o.MaxAge, o.artifacts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+	index = r.index
+
+	from, to := index.Window(start)
+	result := o.testFailures.TestStats(from, to, index.JobFilter, r.testFilter, r.sortBy, r.limit)
+	data, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to serialize result: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	if _, err = writer.Write(data); err != nil {
+		klog.Errorf("Failed to write response: %v", err)
+		return
+	}
+
+	success = true
+}
+
+func (o *options) handleTestStatsPage(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var index *Index
+	var success bool
+	defer func() {
+		klog.Infof("Render test stats page %s duration=%s success=%t", index.String(), time.Since(start).Truncate(time.Millisecond), success)
+	}()
+
+	r, err := parseTestStatsRequest(req, o.MaxAge, o.artifacts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad input: %v", err), http.StatusBadRequest)
+		return
+	}
+	index = r.index
+
+	from, to := index.Window(start)
+	result := o.testFailures.TestStats(from, to, index.JobFilter, r.testFilter, r.sortBy, r.limit)
+
+	type row struct {
+		TestStats
+		Title     string
+		SearchURL string
+		First     string
+		Last      string
+	}
+	rows := make([]row, 0, len(result.Tests))
+	for _, test := range result.Tests {
+		title := testTitle(test.Suite, test.Name)
+		search := &Index{
+			Search:      []string{regexp.QuoteMeta(title)},
+			SearchType:  "junit",
+			MaxAge:      index.MaxAge,
+			From:        index.From,
+			To:          index.To,
+			IncludeName: index.IncludeName,
+			ExcludeName: index.ExcludeName,
+			MaxMatches:  1,
+			Context:     -1,
+			GroupByJob:  true,
+		}
+		first, _ := formatAge(test.FirstFailure.Time, start, index)
+		last, _ := formatAge(test.LastFailure.Time, start, index)
+		rows = append(rows, row{
+			TestStats: test,
+			Title:     title,
+			SearchURL: (&url.URL{Path: "/", RawQuery: search.Query().Encode()}).String(),
+			First:     first,
+			Last:      last,
+		})
+	}
+
+	var sortOptions []string
+	for _, opt := range []string{"flakes", "failures", "passRate"} {
+		var selected string
+		if opt == r.sortBy {
+			selected = "selected"
+		}
+		sortOptions = append(sortOptions, fmt.Sprintf(`<option value="%s" %s>%s</option>`, template.HTMLEscapeString(opt), selected, template.HTMLEscapeString(opt)))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer := httpwriter.ForRequest(w, req)
+	defer writer.Close()
+
+	fmt.Fprintf(writer, htmlPageStart, "Test pass and flake rates", "")
+	err = htmlTestStats.Execute(writer, map[string]interface{}{
+		"index":       index,
+		"from":        formatTime(index.From),
+		"to":          formatTime(index.To),
+		"test":        r.test,
+		"sortOptions": template.HTML(strings.Join(sortOptions, "")),
+		"runs":        result.Runs,
+		"rows":        rows,
+	})
+	if err != nil {
+		klog.Errorf("Failed to execute test stats template: %v", err)
+		return
+	}
+	fmt.Fprint(writer, htmlPageEnd)
+
+	success = true
+}
+
+var htmlTestStats = template.Must(template.New("stats").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+}).Parse(`
+<h4 class="mt-4">Test pass and flake rates</h4>
+<p class="small"><em>{{ len .rows }} tests from {{ .runs }} runs {{ if .index.From.IsZero }}in the last {{ .index.MaxAge }}{{ else }}since {{ .from }}{{ end }}{{ if not .index.To.IsZero }} until {{ .to }}{{ end }}</em> - <a href="/tests">top failing tests</a> - <a href="/">search</a></p>
+<form class="form mb-3" method="GET">
+	<div class="input-group input-group-sm">
+		<div class="input-group-prepend"><span class="input-group-text">Test:</span></div>
+		<input title="A regular expression that matches the name of a test, to include tests that did not fail" class="form-control col-auto" name="test" value="{{ .test }}" placeholder="Focus test names by regex ...">
+		<div class="input-group-prepend"><span class="input-group-text">Job:</span></div>
+		<input title="A regular expression that matches the name of a job" class="form-control col-auto" name="name" value="{{ .index.IncludeName }}" placeholder="Focus job names by regex ...">
+		<input title="A regular expression that matches the name of a job" class="form-control col-auto" name="excludeName" value="{{ .index.ExcludeName }}" placeholder="Skip job names by regex ...">
+		<input title="How far back to look for results" class="form-control col-1" name="maxAge" value="{{ .index.MaxAge }}">
+		<input title="Only include runs that finished after this RFC3339 time or duration ago, instead of maxAge" class="form-control col-1" name="from" value="{{ .from }}" placeholder="From">
+		<input title="Only include runs that finished before this RFC3339 time or duration ago" class="form-control col-1" name="to" value="{{ .to }}" placeholder="To">
+		<select title="How to order the tests" class="form-control col-1" name="sort" onchange="this.form.submit();">{{ .sortOptions }}</select>
+		<div class="input-group-append"><input class="btn btn-outline-primary" type="submit" value="Filter"></div>
+	</div>
+</form>
+<div class="table-responsive"><table class="table table-sm">
+<thead><tr><th>Test</th><th class="text-right">Runs</th><th class="text-right">Pass rate</th><th class="text-right">Flake rate</th><th class="text-right">Failures</th><th class="text-right">Flakes</th><th class="text-right">Skips</th><th>First failure</th><th>Last failure</th></tr></thead>
+<tbody>
+{{ range .rows }}<tr><td><a href="{{ .SearchURL }}">{{ .Title }}</a></td><td class="text-right">{{ .Runs }}</td><td class="text-right">{{ percent .PassRate }}</td><td class="text-right">{{ percent .FlakeRate }}</td><td class="text-right">{{ .Failures }}</td><td class="text-right">{{ .Flakes }}</td><td class="text-right">{{ .Skips }}</td><td class="text-nowrap">{{ .First }}</td><td class="text-nowrap">{{ if .LastURL }}<a target="_blank" href="{{ .LastURL }}">{{ .Last }}</a>{{ end }}</td></tr>
+{{ else }}<tr><td colspan="9"><em>No test results were recorded.</em></td></tr>
+{{ end }}</tbody>
+</table></div>
+`))
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_testFailureIndex_TestStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	var paths []string
+	write := func(runPath string, at time.Time, results *prow.TestResults, failures ...prow.TestFailure) {
+		runDir := filepath.Join(dir, "jobs", "origin-ci-test", filepath.FromSlash(runPath))
+		if err := os.MkdirAll(runDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if results != nil {
+			if err := prow.WriteTestResults(filepath.Join(runDir, prow.TestResultsFile), results); err != nil {
+				t.Fatal(err)
+			}
+		}
+		path := filepath.Join(runDir, prow.TestFailuresFile)
+		if err := prow.WriteTestFailures(path, failures); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	passed := func(names ...string) *prow.TestResults {
+		return &prow.TestResults{Passed: map[string][]string{"e2e": names}, Skipped: map[string][]string{"e2e": {"skipped"}}}
+	}
+	broken := prow.TestFailure{Suite: "e2e", Name: "broken"}
+	flaky := prow.TestFailure{Suite: "e2e", Name: "flaky"}
+	retried := prow.TestFailure{Suite: "e2e", Name: "retried"}
+
+	// flaky fails on a pull request and passes when the job is retested
+	write("pr-logs/pull/org_repo/1/job-1/1", now.Add(-4*time.Hour), passed("retried", "stable"), broken, flaky, retried)
+	write("pr-logs/pull/org_repo/1/job-1/2", now.Add(-3*time.Hour), passed("flaky", "stable"), broken)
+	// a failure on another pull request is not a flake
+	write("pr-logs/pull/org_repo/2/job-1/3", now.Add(-2*time.Hour), passed("stable"), flaky)
+	write("logs/job-2/1", now.Add(-time.Hour), passed("flaky", "stable"), broken)
+	// runs without recorded results are ignored
+	write("logs/job-2/2", now.Add(-time.Hour), nil, broken)
+
+	jobURIPrefix, _ := url.Parse("https://prow.ci.openshift.org/view/gs/")
+	o := &options{jobURIPrefix: jobURIPrefix, jobsIndex: &pathIndex{}}
+	index := newTestFailureIndex(dir, o)
+	index.Sync(paths)
+
+	result := index.TestStats(now.Add(-24*time.Hour), now, nil, nil, "flakes", 10)
+	if result.Runs != 4 || len(result.Tests) != 3 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+	stats := make(map[string]TestStats)
+	for _, test := range result.Tests {
+		stats[test.Name] = test
+	}
+	if s := stats["retried"]; s.Runs != 1 || s.Passes != 1 || s.Failures != 1 || s.Flakes != 1 || s.FlakeRate != 1 {
+		t.Errorf("unexpected retried test: %#v", s)
+	}
+	if s := stats["flaky"]; s.Runs != 4 || s.Passes != 2 || s.Failures != 2 || s.Flakes != 1 || s.PassRate != 0.5 || s.FlakeRate != 0.25 || s.LastURL != "https://prow.ci.openshift.org/view/gs/origin-ci-test/pr-logs/pull/org_repo/2/job-1/3" {
+		t.Errorf("unexpected flaky test: %#v", s)
+	}
+	if s := stats["broken"]; s.Runs != 3 || s.Passes != 0 || s.Flakes != 0 || !s.FirstFailure.Time.Equal(now.Add(-4*time.Hour)) || !s.LastFailure.Time.Equal(now.Add(-time.Hour)) {
+		t.Errorf("unexpected broken test: %#v", s)
+	}
+	if result.Tests[0].Name != "retried" || result.Tests[2].Name != "broken" {
+		t.Errorf("unexpected order: %#v", result.Tests)
+	}
+
+	if result := index.TestStats(now.Add(-24*time.Hour), now, nil, nil, "passRate", 1); len(result.Tests) != 1 || result.Tests[0].Name != "broken" {
+		t.Errorf("unexpected tests by pass rate: %#v", result.Tests)
+	}
+	result = index.TestStats(now.Add(-24*time.Hour), now, nil, func(name string) bool { return name == "e2e.stable" || name == "e2e.skipped" }, "flakes", 10)
+	if len(result.Tests) != 2 || result.Tests[0].Name != "skipped" || result.Tests[0].Skips != 4 || result.Tests[1].Name != "stable" || result.Tests[1].PassRate != 1 {
+		t.Errorf("unexpected filtered tests: %#v", result.Tests)
+	}
+}
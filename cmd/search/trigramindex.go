@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/pkg/trigram"
+)
+
+// trigramSweepInterval is how often every searchable file is checked against
+// the trigram index. Job files are added and removed as the path index
+// changes, so the sweep picks up the files of trackers and anything missed.
+const trigramSweepInterval = time.Hour
+
+// trigramIndex keeps an in-memory trigram index in sync with the trigram files
+// written next to each searchable file and uses it to discard files that cannot
+// match a search.
+type trigramIndex struct {
+	index *trigram.Index
+	// readOnly prevents missing trigram files from being written
+	readOnly bool
+
+	lock   sync.Mutex
+	loaded map[string]trigramEntry
+	// sweep is incremented by each call to Sync
+	sweep uint64
+}
+
+type trigramEntry struct {
+	// modTime is the modification time of the indexed file
+	modTime time.Time
+	// info describes the trigram file that was loaded, or is nil if the file
+	// could not be indexed
+	info os.FileInfo
+	// sweep is the sweep during or after which the entry was last updated
+	sweep uint64
+}
+
+func newTrigramIndex(readOnly bool) *trigramIndex {
+	return &trigramIndex{
+		index:    trigram.NewIndex(),
+		readOnly: readOnly,
+		loaded:   make(map[string]trigramEntry),
+	}
+}
+
+// Candidates returns the subset of paths that may contain a match for search.
+func (t *trigramIndex) Candidates(search string, paths []string) []string {
+	q, err := trigram.RegexpQuery(search)
+	if err != nil {
+		return paths
+	}
+	filtered := t.index.Filter(q, paths)
+	klog.V(4).Infof("Trigram index selected %d of %d paths for %q", len(filtered), len(paths), search)
+	return filtered
+}
+
+// Added loads the trigram files of paths, which were just added to the path
+// index.
+func (t *trigramIndex) Added(paths []string) {
+	var updated, failed int
+	for _, path := range paths {
+		switch t.update(path) {
+		case trigramUpdated:
+			updated++
+		case trigramFailed:
+			failed++
+		}
+	}
+	klog.V(4).Infof("Added %d paths to the trigram index, %d could not be indexed", updated, failed)
+}
+
+// Removed forgets paths, which were removed from the path index.
+func (t *trigramIndex) Removed(paths []string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, path := range paths {
+		delete(t.loaded, path)
+		t.index.Remove(path)
+	}
+}
+
+// Sync loads the trigram files of paths that are new or have changed since they
+// were last loaded and forgets any file not in paths that was not added during
+// the call. Files that do not have an up to date trigram file are indexed
+// unless the index is read only.
+func (t *trigramIndex) Sync(paths []string) {
+	start := time.Now()
+	t.lock.Lock()
+	t.sweep++
+	sweep := t.sweep
+	t.lock.Unlock()
+
+	var updated, failed int
+	for _, path := range paths {
+		switch t.update(path) {
+		case trigramUpdated:
+			updated++
+		case trigramFailed:
+			failed++
+		}
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for path, entry := range t.loaded {
+		if entry.sweep < sweep {
+			delete(t.loaded, path)
+			t.index.Remove(path)
+		}
+	}
+	klog.Infof("Refreshed trigram index in %s, %d files updated, %d could not be indexed, %d indexed", time.Now().Sub(start).Truncate(time.Millisecond), updated, failed, t.index.Len())
+}
+
+type trigramUpdate int
+
+const (
+	trigramUnchanged trigramUpdate = iota
+	trigramUpdated
+	trigramFailed
+)
+
+// update loads the trigram file of path if it is new or has changed, writing
+// it first if it is missing or out of date.
+func (t *trigramIndex) update(path string) trigramUpdate {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Removed([]string{path})
+		return trigramUnchanged
+	}
+
+	t.lock.Lock()
+	previous, ok := t.loaded[path]
+	sweep := t.sweep
+	t.lock.Unlock()
+
+	entry := trigramEntry{modTime: info.ModTime(), sweep: sweep}
+	// store records entry and updates the index under the lock so that
+	// concurrent updates of the same path leave both consistent
+	store := func(entry trigramEntry, trigrams []trigram.Trigram, indexed bool) {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		if indexed {
+			t.index.Add(path, trigrams)
+		} else {
+			t.index.Remove(path)
+		}
+		t.loaded[path] = entry
+	}
+
+	indexInfo, err := os.Stat(trigram.Path(path))
+	if err != nil || !indexInfo.ModTime().Equal(info.ModTime()) {
+		// the trigram file is missing or describes an older version of the file
+		if t.readOnly || (ok && previous.info == nil && previous.modTime.Equal(entry.modTime)) {
+			store(entry, nil, false)
+			return trigramUnchanged
+		}
+		if err := trigram.WriteFile(path); err != nil {
+			if !os.IsNotExist(err) {
+				klog.Errorf("Unable to index trigrams of %s: %v", path, err)
+			}
+			store(entry, nil, false)
+			return trigramFailed
+		}
+		if indexInfo, err = os.Stat(trigram.Path(path)); err != nil {
+			store(entry, nil, false)
+			return trigramFailed
+		}
+	}
+	if ok && previous.info != nil && os.SameFile(previous.info, indexInfo) && previous.info.ModTime().Equal(indexInfo.ModTime()) && previous.info.Size() == indexInfo.Size() {
+		previous.sweep = sweep
+		t.lock.Lock()
+		t.loaded[path] = previous
+		t.lock.Unlock()
+		return trigramUnchanged
+	}
+
+	trigrams, indexed, err := trigram.ReadFile(path)
+	if err != nil {
+		klog.Errorf("Unable to load trigrams of %s: %v", path, err)
+		store(entry, nil, false)
+		return trigramFailed
+	}
+	entry.info = indexInfo
+	store(entry, trigrams, indexed)
+	return trigramUpdated
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_trigramIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trigrams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string, at time.Time) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	at := time.Unix(1600000000, 0)
+	a := write("bug-1", "Bug 1: cluster upgrade timeout", at)
+	b := write("bug-2", "Bug 2: image pull failed", at)
+	missing := filepath.Join(dir, "bug-3")
+	paths := []string{a, b, missing}
+
+	index := newTrigramIndex(false)
+	index.Sync(paths)
+	if got, want := index.Candidates("upgrade timeout", paths), []string{a, missing}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := index.Candidates("(", paths); !reflect.DeepEqual(got, paths) {
+		t.Errorf("invalid expressions should not filter paths, got %q", got)
+	}
+
+	// rewriting a file without updating its trigram file reindexes it
+	write("bug-2", "Bug 2: upgrade timeout in image pull", at.Add(time.Minute))
+	index.Sync(paths)
+	if got, want := index.Candidates("upgrade timeout", paths), []string{a, b, missing}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// files that are no longer present are forgotten
+	index.Sync([]string{b})
+	if index.index.Len() != 1 {
+		t.Errorf("expected one indexed file, got %d", index.index.Len())
+	}
+}
+
+func Test_trigramIndex_pathIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trigrams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jobDir := filepath.Join(dir, "bucket", "logs", "job", "1")
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(jobDir, "junit.failures")
+	if err := ioutil.WriteFile(path, []byte("cluster upgrade timeout\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the trigram index follows the paths added to and removed from the path
+	// index without listing the files on disk
+	trigrams := newTrigramIndex(false)
+	index := &pathIndex{base: dir, baseURI: &url.URL{}, observer: trigrams}
+	index.Notify([]string{path})
+	index.flush()
+	if got := trigrams.Candidates("image pull", []string{path}); len(got) != 0 {
+		t.Errorf("expected the added path to be indexed, got %q", got)
+	}
+	index.Forget([]string{path})
+	if trigrams.index.Len() != 0 {
+		t.Errorf("expected the forgotten path to be removed, got %d", trigrams.index.Len())
+	}
+}
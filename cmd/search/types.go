@@ -12,6 +12,8 @@ import (
 	jiraBaseClient "github.com/andygrunwald/go-jira"
 
 	"github.com/openshift/ci-search/bugzilla"
+	"github.com/openshift/ci-search/github"
+	"github.com/openshift/ci-search/pkg/query"
 )
 
 type Result struct {
@@ -21,7 +23,7 @@ type Result struct {
 	// URI is the job detail page, e.g. https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/release-openshift-origin-installer-e2e-aws-4.1/309
 	URI *url.URL
 
-	// FileType is the type of file where the match was found: "bug", "build-log" or "junit".
+	// FileType is the type of file where the match was found: "bug", "issue", "github-issue", "build-log" or "junit".
 	FileType string
 
 	// Trigger is "pull" or "build".
@@ -42,6 +44,12 @@ type Result struct {
 	Key string
 	// jira
 	Issue *jiraBaseClient.Issue
+
+	GitHubIssue *github.IssueInfo
+
+	// Fields are the fields of a bug or issue held in memory, used to filter
+	// results.
+	Fields *TrackerFields
 }
 
 type Index struct {
@@ -50,9 +58,16 @@ type Index struct {
 	// One or more search strings. Some pages support only a single search
 	Search []string
 
+	// Expression is set when the search is a query combining several terms,
+	// in which case Search holds the text of the query.
+	Expression *query.Expr
+
 	// SearchType excludes jobs whose Result.FileType does not match.
 	SearchType string
 
+	// Fields only includes the bugs and issues whose fields match, if set.
+	Fields *FieldFilter
+
 	// JobFilter only includes jobs that match the filter.
 	JobFilter func(name string) bool
 	// IncludeName is the string value a regular expression to filter job results.
@@ -62,6 +77,15 @@ type Index struct {
 
 	// MaxAge excludes jobs which failed longer than MaxAge ago.
 	MaxAge time.Duration
+	// From excludes jobs which failed before it. MaxAge is ignored when From is
+	// set.
+	From time.Time
+	// To excludes jobs which failed after it, if set.
+	To time.Time
+	// relativeFrom and relativeTo are the from and to parameters that From
+	// and To were resolved from when they are relative to the time of the
+	// request, such as "6h" or "now".
+	relativeFrom, relativeTo string
 
 	// MaxMatches caps the number of individual results within a file
 	// that can be returned.
@@ -84,16 +108,27 @@ type Index struct {
 
 func (i *Index) Query() url.Values {
 	v := make(url.Values)
-	v["search"] = i.Search
+	if i.Expression != nil {
+		v["query"] = i.Search
+	} else {
+		v["search"] = i.Search
+	}
 	v.Set("mode", i.Mode)
 	v.Set("searchType", i.SearchType)
 	v.Set("maxAge", i.MaxAge.String())
+	if !i.From.IsZero() {
+		v.Set("from", i.From.UTC().Format(time.RFC3339))
+	}
+	if !i.To.IsZero() {
+		v.Set("to", i.To.UTC().Format(time.RFC3339))
+	}
 	v.Set("name", i.IncludeName)
 	v.Set("excludeName", i.ExcludeName)
 	v.Set("maxMatches", strconv.Itoa(i.MaxMatches))
 	v.Set("maxBytes", strconv.FormatInt(i.MaxBytes, 10))
 	v.Set("context", strconv.Itoa(i.Context))
 	v.Set("wrapLines", strconv.FormatBool(i.WrapLines))
+	i.Fields.Values(v)
 	if i.GroupByJob {
 		v.Set("groupByJob", "job")
 	} else {
@@ -109,19 +144,89 @@ func (i *Index) String() string {
 	sb := &strings.Builder{}
 	sb.WriteRune('{')
 	fmt.Fprintf(sb, "Mode=%s", i.Mode)
-	fmt.Fprintf(sb, " Search=%v", i.Search)
+	if i.Expression != nil {
+		fmt.Fprintf(sb, " Query=%s", i.Expression)
+	} else {
+		fmt.Fprintf(sb, " Search=%v", i.Search)
+	}
 	fmt.Fprintf(sb, " SearchType=%s", i.SearchType)
+	if !i.From.IsZero() {
+		fmt.Fprintf(sb, " From=%s", i.From.UTC().Format(time.RFC3339))
+	}
+	if !i.To.IsZero() {
+		fmt.Fprintf(sb, " To=%s", i.To.UTC().Format(time.RFC3339))
+	}
 	if len(i.IncludeName) > 0 {
 		fmt.Fprintf(sb, " Include=%s", i.IncludeName)
 	}
 	if len(i.ExcludeName) > 0 {
 		fmt.Fprintf(sb, " Exclude=%s", i.ExcludeName)
 	}
+	if i.Fields != nil {
+		fmt.Fprintf(sb, " Fields=%s", i.Fields)
+	}
 	sb.WriteRune('}')
 	return sb.String()
 }
 
-func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index, error) {
+// Window returns the times between which jobs must have failed to be
+// included, relative to now.
+func (i *Index) Window(now time.Time) (from, to time.Time) {
+	from, to = i.From, i.To
+	if from.IsZero() && i.MaxAge > 0 {
+		from = now.Add(-i.MaxAge)
+	}
+	if to.IsZero() {
+		to = now
+	}
+	return from, to
+}
+
+// Includes returns true if a job that failed at t is within the window of the
+// index. Jobs that fail after now are included unless To is set.
+func (i *Index) Includes(t, now time.Time) bool {
+	from, _ := i.Window(now)
+	if t.Before(from) {
+		return false
+	}
+	return i.To.IsZero() || !t.After(i.To)
+}
+
+// parseTime accepts an RFC3339 time, "now", or a duration before now.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(strings.TrimPrefix(value, "-"))
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("must be an RFC3339 time, 'now', or a duration before now")
+	}
+	return now.Add(-d), nil
+}
+
+// isRelativeTime returns true if value is resolved by parseTime relative to
+// the current time.
+func isRelativeTime(value string) bool {
+	_, err := time.Parse(time.RFC3339, value)
+	return err != nil
+}
+
+// searchScopes returns the file types the terms of a query may be restricted
+// to: JUnit failures, the items of each tracker and the artifacts of rules.
+func searchScopes(rules artifactRules) []string {
+	scopes := append([]string{"junit"}, trackerSearchTypes()...)
+	for _, rule := range rules {
+		scopes = append(scopes, rule.Name)
+	}
+	return scopes
+}
+
+// parseRequest returns the index described by req, which may search the
+// artifacts saved by rules.
+func parseRequest(req *http.Request, mode string, maxAge time.Duration, rules artifactRules) (*Index, error) {
 	if err := req.ParseForm(); err != nil {
 		return nil, err
 	}
@@ -131,6 +236,17 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 	}
 
 	index.Search = req.Form["search"]
+	if value := req.FormValue("query"); len(value) > 0 {
+		if len(index.Search) > 0 {
+			return nil, fmt.Errorf("search and query may not both be specified")
+		}
+		expr, err := query.Parse(value, searchScopes(rules))
+		if err != nil {
+			return nil, fmt.Errorf("query is invalid: %v", err)
+		}
+		index.Expression = expr
+		index.Search = []string{value}
+	}
 	if len(index.Search) == 0 && mode == "chart" {
 
 		// CI-cluster issues
@@ -153,7 +269,7 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 
 	switch req.FormValue("type") {
 	case "":
-		if mode == "chart" {
+		if mode == "chart" || (index.Expression != nil && hasArtifactScope(index.Expression, rules)) {
 			index.SearchType = "all"
 		} else {
 			index.SearchType = "bug+issue+junit"
@@ -164,18 +280,20 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 		index.SearchType = "bug+junit"
 	case "bug+issue":
 		index.SearchType = "bug+issue"
-	case "bug":
-		index.SearchType = "bug"
-	case "issue":
-		index.SearchType = "issue"
 	case "junit":
 		index.SearchType = "junit"
-	case "build-log":
-		index.SearchType = "build-log"
 	case "all":
 		index.SearchType = "all"
 	default:
-		return nil, fmt.Errorf("search type must be 'bug', 'issue, 'junit', 'build-log', or 'all'")
+		if isTrackerFileType(req.FormValue("type")) {
+			index.SearchType = req.FormValue("type")
+			break
+		}
+		rule := rules.named(req.FormValue("type"))
+		if rule == nil {
+			return nil, fmt.Errorf("search type must be '%s', 'junit', 'all', or an artifact type such as 'build-log'", strings.Join(trackerSearchTypes(), "', '"))
+		}
+		index.SearchType = rule.Name
 	}
 
 	var includeRE *regexp.Regexp
@@ -243,6 +361,41 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 		index.MaxAge = maxAge
 	}
 
+	now := time.Now()
+	if value := req.FormValue("from"); len(value) > 0 {
+		from, err := parseTime(value, now)
+		if err != nil {
+			return nil, fmt.Errorf("from is invalid: %v", err)
+		}
+		// nothing older than the server keeps can be searched
+		if maxAge > 0 && from.Before(now.Add(-maxAge)) {
+			from = now.Add(-maxAge)
+		}
+		index.From = from
+		if isRelativeTime(value) {
+			index.relativeFrom = value
+		}
+	}
+	if value := req.FormValue("to"); len(value) > 0 {
+		to, err := parseTime(value, now)
+		if err != nil {
+			return nil, fmt.Errorf("to is invalid: %v", err)
+		}
+		index.To = to
+		if isRelativeTime(value) {
+			index.relativeTo = value
+		}
+	}
+	if !index.From.IsZero() && !index.To.IsZero() && !index.From.Before(index.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	fields, err := parseFieldFilter(req.Form, now)
+	if err != nil {
+		return nil, err
+	}
+	index.Fields = fields
+
 	if value := req.FormValue("wrap"); len(value) > 0 {
 		index.WrapLines = true
 	}
@@ -262,3 +415,14 @@ func parseRequest(req *http.Request, mode string, maxAge time.Duration) (*Index,
 
 	return index, nil
 }
+
+// hasArtifactScope returns true if a term of expr is limited to one of the
+// artifact types of rules, which are not searched by default.
+func hasArtifactScope(expr *query.Expr, rules artifactRules) bool {
+	for _, term := range expr.Terms() {
+		if rules.named(term.Scope) != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openshift/ci-search/prow"
+)
+
+func Test_parseRequest_window(t *testing.T) {
+	now := time.Now()
+	tuesday := now.Add(-3 * 24 * time.Hour).UTC().Truncate(time.Hour)
+	tests := []struct {
+		name     string
+		query    string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{name: "relative max age", query: "maxAge=6h", wantFrom: now.Add(-6 * time.Hour), wantTo: now},
+		{name: "absolute", query: "maxAge=6h&from=" + url.QueryEscape(tuesday.Format(time.RFC3339)) + "&to=" + url.QueryEscape(tuesday.Add(4*time.Hour).Format(time.RFC3339)), wantFrom: tuesday, wantTo: tuesday.Add(4 * time.Hour)},
+		{name: "relative", query: "from=-12h&to=6h", wantFrom: now.Add(-12 * time.Hour), wantTo: now.Add(-6 * time.Hour)},
+		{name: "clamped to the server max age", query: "from=2000h&to=now", wantFrom: now.Add(-14 * 24 * time.Hour), wantTo: now},
+		{name: "empty", query: "from=1h&to=2h", wantErr: true},
+		{name: "invalid", query: "from=tuesday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, err := parseRequest(httptest.NewRequest("GET", "/?"+tt.query, nil), "text", 14*24*time.Hour, prow.DefaultArtifactRules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			from, to := index.Window(now)
+			if d := from.Sub(tt.wantFrom); d < -time.Minute || d > time.Minute {
+				t.Errorf("from is %s, want %s", from, tt.wantFrom)
+			}
+			if d := to.Sub(tt.wantTo); d < -time.Minute || d > time.Minute {
+				t.Errorf("to is %s, want %s", to, tt.wantTo)
+			}
+
+			// links preserve the window
+			copied, err := parseRequest(httptest.NewRequest("GET", "/?"+index.Query().Encode(), nil), "text", 14*24*time.Hour, prow.DefaultArtifactRules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := copied.From.Sub(index.From); d < -time.Second || d > time.Second {
+				t.Errorf("window was not preserved: %s", index.Query().Encode())
+			}
+			if d := copied.To.Sub(index.To); d < -time.Second || d > time.Second {
+				t.Errorf("window was not preserved: %s", index.Query().Encode())
+			}
+		})
+	}
+}
+
+func Test_parseRequest_artifactScopes(t *testing.T) {
+	rules := artifactRules{{Name: "events", Glob: "**/events.json", Filename: "events.json"}}
+	req := httptest.NewRequest("GET", "/?"+url.Values{"query": {`events:"FailedMount" github-issue:mount`}}.Encode(), nil)
+	index, err := parseRequest(req, "text", time.Hour, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scopes []string
+	for _, term := range index.Expression.Terms() {
+		scopes = append(scopes, term.Scope)
+	}
+	if want := []string{"events", "github-issue"}; !reflect.DeepEqual(scopes, want) {
+		t.Errorf("unexpected scopes %q", scopes)
+	}
+	if index.SearchType != "all" {
+		t.Errorf("expected a query on a configured artifact to search all files, got %s", index.SearchType)
+	}
+
+	// artifacts are not scopes unless a rule saves them
+	index, err = parseRequest(req, "text", time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scope := index.Expression.Terms()[0].Scope; len(scope) != 0 {
+		t.Errorf("unconfigured artifact was parsed as scope %q", scope)
+	}
+}
+
+func Test_pathIndex_SearchPaths_window(t *testing.T) {
+	now := time.Now()
+	index := &pathIndex{base: "/", baseURI: &url.URL{}, artifacts: prow.DefaultArtifactRules}
+	for i, age := range []time.Duration{time.Hour, 5 * time.Hour, 10 * time.Hour, 20 * time.Hour} {
+		index.ordered = append(index.ordered, pathAge{
+			path:  "logs/job/" + string(rune('1'+i)) + "/build-log.txt",
+			index: "build-log.txt",
+			age:   now.Add(-age),
+		})
+	}
+
+	paths, err := index.SearchPaths(&Index{SearchType: "build-log", From: now.Add(-12 * time.Hour), To: now.Add(-2 * time.Hour)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/logs/job/2/build-log.txt", "/logs/job/3/build-log.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+
+	if age, recent := formatAge(now.Add(-time.Hour), now, &Index{From: now.Add(-12 * time.Hour), To: now.Add(-2 * time.Hour)}); recent || age != "About an hour ago" {
+		t.Errorf("unexpected age %q %t", age, recent)
+	}
+}
+
+func Test_pathIndex_Notify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pathindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().Truncate(time.Second)
+	write := func(path string, age time.Duration) string {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("error: timed out\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{path, filepath.Dir(path)} {
+			if err := os.Chtimes(p, now.Add(-age), now.Add(-age)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+	write("bucket/logs/job/1/junit.failures", 30*time.Hour)
+	write("bucket/logs/job/2/junit.failures", 2*time.Hour)
+
+	index := &pathIndex{base: dir, baseURI: &url.URL{}, maxAge: 24 * time.Hour}
+	if err := index.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bucket/logs/job/1")); !os.IsNotExist(err) {
+		t.Fatalf("expected the expired run to be removed: %v", err)
+	}
+
+	// notified runs are ordered by age and replace earlier copies of the same file
+	generation := index.Generation()
+	index.Notify([]string{
+		write("bucket/logs/job/3/junit.failures", time.Hour),
+		write("bucket/logs/job/4/junit.failures", 3*time.Hour),
+		write("bucket/logs/job/4/junit.results", 3*time.Hour),
+		write("bucket/logs/job/2/junit.failures", 2*time.Hour),
+	})
+	index.flush()
+	if index.Generation() == generation {
+		t.Errorf("expected the generation to change")
+	}
+	paths, err := index.SearchPaths(&Index{SearchType: "junit", MaxAge: 24 * time.Hour}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, build := range []string{"3", "2", "4"} {
+		want = append(want, filepath.Join(dir, "bucket/logs/job", build, "junit.failures"))
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+	if stats := index.Stats(); stats.Entries != 3 {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+	if !index.LastModified("bucket/logs/job/3/junit.failures").Equal(now.Add(-time.Hour)) {
+		t.Errorf("unexpected last modified time")
+	}
+
+	// expiry only removes the oldest paths
+	index.maxAge = 150 * time.Minute
+	index.Expire()
+	if _, err := os.Stat(filepath.Join(dir, "bucket/logs/job/4")); !os.IsNotExist(err) {
+		t.Errorf("expected the expired run to be removed: %v", err)
+	}
+	if stats := index.Stats(); stats.Entries != 2 || !index.LastModified("bucket/logs/job/4/junit.failures").IsZero() {
+		t.Errorf("unexpected stats: %#v", stats)
+	}
+}
+
+func Test_options_MetadataFor_githubIssue(t *testing.T) {
+	o := &options{Path: "/tmp/search", GitHubRepos: []string{"openshift/my_repo"}}
+	if err := o.setupPaths(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := o.MetadataFor("github-issues/gh-issue__openshift_my_repo_42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FileType != "github-issue" || result.Number != 42 || result.Key != "openshift/my_repo#42" || !result.IgnoreAge {
+		t.Errorf("unexpected result: %#v", result)
+	}
+	if result.URI.String() != "https://github.com/openshift/my_repo/issues/42" {
+		t.Errorf("unexpected link: %s", result.URI)
+	}
+	if _, err := o.MetadataFor("github-issues/gh-issue__42"); err == nil {
+		t.Errorf("expected an invalid name to be rejected")
+	}
+
+	o.GitHubRepos = []string{"openshift_org/repo"}
+	if err := o.setupPaths(); err == nil {
+		t.Errorf("expected an invalid organization to be rejected")
+	}
+}
@@ -0,0 +1,234 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog"
+)
+
+const (
+	// pageSize is the number of items requested per page, the most the API
+	// allows.
+	pageSize = 100
+	// maxSearchResults is the number of results the search API returns for a
+	// single query.
+	maxSearchResults = 1000
+	// maxRateLimitWait is the longest a request waits for the rate limit of
+	// the API to reset before failing.
+	maxRateLimitWait = 15 * time.Minute
+)
+
+type Client struct {
+	Base    url.URL
+	Client  *http.Client
+	Retries int
+
+	Token string
+	// Limiter, if set, is waited on before each request.
+	Limiter *rate.Limiter
+}
+
+func NewClient(base url.URL) *Client {
+	return &Client{
+		Base:   base,
+		Client: http.DefaultClient,
+		// authenticated clients may make 30 searches and 5000 other requests
+		// per hour, stay well below that
+		Limiter: rate.NewLimiter(rate.Every(2*time.Second), 10),
+	}
+}
+
+func (c *Client) addRequestHeaders(req *http.Request) {
+	if req == nil {
+		return
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if len(c.Token) > 0 {
+		req.Header.Set("Authorization", fmt.Sprintf("token %s", c.Token))
+	}
+}
+
+// SearchIssues returns the issues matching args, oldest change first. The
+// search API returns at most 1000 results, so callers should narrow the
+// search with LastChangeTime.
+func (c *Client) SearchIssues(ctx context.Context, args SearchIssuesArgs) ([]IssueInfo, error) {
+	u := c.Base
+	u.Path = path.Join(u.Path, "search", "issues")
+
+	var issues []IssueInfo
+	for page := 1; ; page++ {
+		v := make(url.Values)
+		v.Set("q", args.SearchQuery())
+		v.Set("sort", "updated")
+		v.Set("order", "asc")
+		v.Set("per_page", strconv.Itoa(pageSize))
+		v.Set("page", strconv.Itoa(page))
+		u.RawQuery = v.Encode()
+
+		var list *IssueInfoList
+		err := c.readJSONIntoObject(ctx, func() (interface{}, *http.Request, error) {
+			list = &IssueInfoList{}
+			req, err := http.NewRequest("GET", u.String(), nil)
+			c.addRequestHeaders(req)
+			return list, req, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if list.IncompleteResults {
+			klog.V(4).Infof("GitHub search %q returned incomplete results", args.SearchQuery())
+		}
+		issues = append(issues, list.Items...)
+		if len(list.Items) < pageSize || len(issues) >= list.TotalCount || len(issues) >= maxSearchResults {
+			return issues, nil
+		}
+	}
+}
+
+// IssueComments returns the comments of the issue with number in repo.
+func (c *Client) IssueComments(ctx context.Context, repo string, number int) ([]IssueComment, error) {
+	u := c.Base
+	u.Path = path.Join(u.Path, "repos", repo, "issues", strconv.Itoa(number), "comments")
+
+	var comments []IssueComment
+	for page := 1; ; page++ {
+		v := make(url.Values)
+		v.Set("per_page", strconv.Itoa(pageSize))
+		v.Set("page", strconv.Itoa(page))
+		u.RawQuery = v.Encode()
+
+		var items []IssueComment
+		err := c.readJSONIntoObject(ctx, func() (interface{}, *http.Request, error) {
+			items = nil
+			req, err := http.NewRequest("GET", u.String(), nil)
+			c.addRequestHeaders(req)
+			return &items, req, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, items...)
+		if len(items) < pageSize {
+			return comments, nil
+		}
+	}
+}
+
+type ClientError struct {
+	Err Error
+}
+
+func (e *ClientError) Error() string {
+	if len(e.Err.Message) == 0 {
+		return fmt.Sprintf("unknown client error %d", e.Err.Code)
+	}
+	return fmt.Sprintf("%s (%d)", e.Err.Message, e.Err.Code)
+}
+
+// rateLimitReset returns how long to wait before retrying a request that was
+// rejected because the client exceeded a rate limit, or false if the response
+// was not a rate limit error.
+func rateLimitReset(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if value := resp.Header.Get("Retry-After"); len(value) > 0 {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Minute, true
+	}
+	if d := time.Unix(reset, 0).Sub(now); d > 0 {
+		return d, true
+	}
+	return time.Second, true
+}
+
+func (c *Client) readJSONIntoObject(ctx context.Context, fn func() (interface{}, *http.Request, error)) error {
+	var lastErr error
+	for i := 0; i < (c.Retries + 1); i++ {
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		obj, req, err := fn()
+		if err != nil {
+			return err
+		}
+		resp, err := c.Client.Do(req.WithContext(ctx))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := func() error {
+			defer resp.Body.Close()
+			defer io.Copy(ioutil.Discard, resp.Body)
+			contentType := resp.Header.Get("Content-Type")
+			mediaType, _, err := mime.ParseMediaType(contentType)
+			if err != nil {
+				return fmt.Errorf("unrecognized content type from GitHub API: %s: %v", contentType, err)
+			}
+			if resp.StatusCode != 200 {
+				clientErr := ClientError{Err: Error{Code: resp.StatusCode}}
+				if mediaType == "application/json" {
+					data, err := ioutil.ReadAll(resp.Body)
+					if err != nil {
+						return err
+					}
+					klog.V(8).Infof("Response body: %s", data)
+					if err := json.Unmarshal(data, &clientErr.Err); err != nil {
+						return err
+					}
+				}
+				if wait, ok := rateLimitReset(resp, time.Now()); ok {
+					if wait > maxRateLimitWait {
+						return fmt.Errorf("GitHub rate limit exceeded for %s: %v", wait, &clientErr)
+					}
+					klog.Infof("GitHub rate limit exceeded, waiting %s: %v", wait, &clientErr)
+					select {
+					case <-time.After(wait):
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+				return &clientErr
+			}
+
+			if mediaType != "application/json" {
+				return fmt.Errorf("unrecognized 200 response from GitHub API: %s", contentType)
+			}
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			klog.V(8).Infof("Response body: %s", data)
+			return json.Unmarshal(data, obj)
+		}(); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
@@ -0,0 +1,72 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestClient_SearchIssues(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Path != "/search/issues" {
+			t.Errorf("unexpected path %s", req.URL.Path)
+		}
+		if q := req.URL.Query().Get("q"); q != "is:issue repo:openshift/origin label:ci-failure" {
+			t.Errorf("unexpected query %q", q)
+		}
+		if req.Header.Get("Authorization") != "token abc" {
+			t.Errorf("unexpected authorization %q", req.Header.Get("Authorization"))
+		}
+		// the first request is rate limited
+		if requests == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"You have exceeded a secondary rate limit"}`)
+			return
+		}
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		count := pageSize
+		if page == 2 {
+			count = 2
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprintf(w, `{"total_count":%d,"items":[`, pageSize+2)
+		for i := 0; i < count; i++ {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			number := (page-1)*pageSize + i + 1
+			var pull string
+			if number == 3 {
+				pull = `,"pull_request":{}`
+			}
+			fmt.Fprintf(w, `{"number":%d,"repository_url":"https://api.github.com/repos/openshift/origin"%s}`, number, pull)
+		}
+		fmt.Fprint(w, `]}`)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	c := NewClient(*u)
+	c.Limiter = nil
+	c.Retries = 1
+	c.Token = "abc"
+	issues, err := c.SearchIssues(context.Background(), SearchIssuesArgs{Repos: []string{"openshift/origin"}, Query: "label:ci-failure"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != pageSize+2 || requests != 3 {
+		t.Fatalf("unexpected %d issues in %d requests", len(issues), requests)
+	}
+	list := NewIssueList(issues, nil)
+	if len(list.Items) != pageSize+1 || list.Items[0].Name != "openshift_origin_1" || list.Items[0].Info.Repo != "openshift/origin" {
+		t.Fatalf("unexpected list: %d %#v", len(list.Items), list.Items[0])
+	}
+}
@@ -0,0 +1,63 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/ci-search/pkg/tracker"
+)
+
+// NewCommentStore keeps the comments of the issues of an informer. GitHub
+// returns the comments of a single issue per request, so comments are fetched
+// one issue at a time at the rate allowed by the client's limiter.
+func NewCommentStore(client *Client, refreshInterval time.Duration, persisted tracker.PersistentCommentStore) *tracker.CommentStore {
+	s := tracker.NewCommentStore("comment_store_github", &commentTracker{client: client}, refreshInterval, persisted)
+	// new comments change the time the issue was updated
+	s.RefreshOnUpdate = true
+	return s
+}
+
+type commentTracker struct {
+	client *Client
+}
+
+func (t *commentTracker) WithInfo(existing tracker.Item, obj interface{}) (tracker.Item, bool) {
+	issue, ok := obj.(*Issue)
+	if !ok {
+		return nil, false
+	}
+	if existing == nil {
+		return &IssueComments{
+			ObjectMeta: metav1.ObjectMeta{Name: issue.Name},
+			Info:       issue.Info,
+		}, true
+	}
+	copied := existing.DeepCopyObject().(*IssueComments)
+	copied.Info = issue.Info
+	return copied, true
+}
+
+func (t *commentTracker) Fetch(ctx context.Context, items []tracker.Item) (map[string]interface{}, error) {
+	comments := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		info := item.(*IssueComments).Info
+		issueComments, err := t.client.IssueComments(ctx, info.Repo, info.Number)
+		if err != nil {
+			return comments, fmt.Errorf("unable to retrieve comments of %s#%d: %v", info.Repo, info.Number, err)
+		}
+		comments[item.GetName()] = issueComments
+	}
+	return comments, nil
+}
+
+func (t *commentTracker) WithComments(existing tracker.Item, comments interface{}, now time.Time) (tracker.Item, bool) {
+	issue := existing.(*IssueComments)
+	updated := NewIssueComments(issue.Name, comments.([]IssueComment))
+	updated.Info = issue.Info
+	updated.RefreshTime = now
+	return updated, !reflect.DeepEqual(issue.Comments, updated.Comments)
+}
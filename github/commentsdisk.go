@@ -0,0 +1,247 @@
+package github
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openshift/ci-search/pkg/tracker"
+)
+
+// FilePrefix is the prefix of the name of the file each issue is saved to,
+// followed by the issue key ORG_REPO_NUMBER.
+const FilePrefix = "gh-issue__"
+
+// NewCommentDiskStore saves each issue and its comments to a file named
+// FilePrefix followed by the issue key under path.
+func NewCommentDiskStore(path string, maxAge time.Duration) *tracker.DiskStore {
+	return tracker.NewDiskStore("comment_disk_github", diskFormat{}, path, maxAge)
+}
+
+// NewCommentDiskStoreReader returns a store that reads the comments saved
+// under path without expiring or removing any files.
+func NewCommentDiskStoreReader(path string) *tracker.DiskStore {
+	return tracker.NewDiskStoreReader(diskFormat{}, path)
+}
+
+type diskFormat struct{}
+
+func (diskFormat) Prefix() string { return FilePrefix }
+
+func (diskFormat) FileName(item tracker.Item) string {
+	return FilePrefix + item.GetName()
+}
+
+func (diskFormat) ItemName(fileName string) (string, error) {
+	key := strings.TrimPrefix(fileName, FilePrefix)
+	if _, _, err := ParseIssueKey(key); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (diskFormat) Closed(item tracker.Item) tracker.Item {
+	clone := item.DeepCopyObject().(*IssueComments)
+	clone.Info.State = "closed"
+	return clone
+}
+
+func (diskFormat) Read(path string, modTime time.Time) (tracker.Item, error) {
+	comments, err := readIssueComments(path)
+	if err != nil {
+		return nil, err
+	}
+	comments.RefreshTime = modTime
+	return comments, nil
+}
+
+func commentAuthor(login string) string {
+	if login == "" {
+		return "ghost"
+	}
+	return strings.TrimSpace(login)
+}
+
+func escapeText(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\x00", " "), tracker.CommentDelimiter, " ")
+}
+
+func (diskFormat) Write(w io.Writer, item tracker.Item) error {
+	issue := item.(*IssueComments)
+	var milestone string
+	if issue.Info.Milestone != nil {
+		milestone = tracker.LineSafe(issue.Info.Milestone.Title)
+	}
+	if _, err := fmt.Fprintf(
+		w,
+		"Issue %s#%d: %s\nURL: %s\nState: %s\nAuthor: %s\nAssignees: %s\nLabels: %s\nMilestone: %s\nCreated: %s\nUpdated: %s\n---\n%s\n%s",
+		issue.Info.Repo,
+		issue.Info.Number,
+		tracker.LineSafe(issue.Info.Title),
+		tracker.LineSafe(issue.Info.HTMLURL),
+		tracker.LineSafe(issue.Info.State),
+		commentAuthor(issue.Info.User.Login),
+		tracker.ArrayLineSafe(issue.Info.AssigneeLogins(), ", "),
+		tracker.ArrayLineSafe(issue.Info.LabelNames(), ", "),
+		milestone,
+		issue.Info.CreatedAt.UTC().Format(time.RFC3339),
+		issue.Info.UpdatedAt.UTC().Format(time.RFC3339),
+		escapeText(issue.Info.Body),
+		tracker.CommentDelimiter,
+	); err != nil {
+		return err
+	}
+
+	for _, comment := range issue.Comments {
+		if _, err := fmt.Fprintf(
+			w,
+			"Comment %d by %s at %s\n%s\n%s",
+			comment.ID,
+			commentAuthor(comment.User.Login),
+			comment.CreatedAt.UTC().Format(time.RFC3339),
+			escapeText(comment.Body),
+			tracker.CommentDelimiter,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	reDiskCommentsLineHeader        = regexp.MustCompile(`^Issue ([^/\s]+/[^#\s]+)#(\d+): (.*)$`)
+	reDiskCommentsLineCommentHeader = regexp.MustCompile(`^Comment (\d+) by (.+) at (\S+)$`)
+)
+
+func readIssueComments(path string) (*IssueComments, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var issue IssueComments
+	comments := make([]IssueComment, 0, 4)
+
+	sr := tracker.NewScanner(f)
+
+	// PHASE 0: Header
+	if !sr.Scan() {
+		return nil, fmt.Errorf("%s: first line missing or malformed: %v", path, sr.Err())
+	}
+	m := reDiskCommentsLineHeader.FindStringSubmatch(sr.Text())
+	if m == nil {
+		return nil, fmt.Errorf("%s: first line must be of the form 'Issue ORG/REPO#NUMBER: TITLE'", path)
+	}
+	number, err := strconv.Atoi(m[2])
+	if err != nil {
+		return nil, fmt.Errorf("%s: first line must have an integer number: %v", path, err)
+	}
+	issue.Info.Repo = m[1]
+	issue.Info.Number = number
+	issue.Info.Title = m[3]
+	issue.Name = issue.Info.Key()
+
+	var foundSeparator bool
+ScanHeader:
+	for sr.Scan() {
+		text := sr.Text()
+		if text == "---" {
+			foundSeparator = true
+			break ScanHeader
+		}
+		parts := strings.SplitN(text, ": ", 2)
+		if len(parts) < 2 || len(parts[1]) == 0 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch parts[0] {
+		case "URL":
+			issue.Info.HTMLURL = value
+		case "State":
+			issue.Info.State = value
+		case "Author":
+			issue.Info.User.Login = value
+		case "Assignees":
+			for _, login := range strings.Split(value, ", ") {
+				issue.Info.Assignees = append(issue.Info.Assignees, User{Login: login})
+			}
+		case "Labels":
+			for _, name := range strings.Split(value, ", ") {
+				issue.Info.Labels = append(issue.Info.Labels, Label{Name: name})
+			}
+		case "Milestone":
+			issue.Info.Milestone = &Milestone{Title: value}
+		case "Created":
+			issue.Info.CreatedAt, _ = time.Parse(time.RFC3339, value)
+		case "Updated":
+			issue.Info.UpdatedAt, _ = time.Parse(time.RFC3339, value)
+		}
+	}
+	if err := sr.Err(); err != nil {
+		return nil, fmt.Errorf("%s: unable to read stored issue: %v", path, err)
+	}
+	if !foundSeparator {
+		return nil, fmt.Errorf("%s: unable to read stored issue: no body separator", path)
+	}
+
+	// PHASE 2: the body of the issue
+	sr.ScanComments()
+	if sr.Scan() {
+		issue.Info.Body = strings.TrimSuffix(sr.Text(), "\n")
+	}
+
+	// PHASE 1 and 2: each comment
+	phase := 1
+	sr.ScanLines()
+	var comment IssueComment
+	for sr.Scan() {
+		switch phase {
+		case 1:
+			m := reDiskCommentsLineCommentHeader.FindStringSubmatch(sr.Text())
+			if m == nil {
+				return nil, fmt.Errorf("%s: comment header line %d must be of the form 'Comment ID by AUTHOR at DATE': %q", path, len(comments)+1, sr.Text())
+			}
+			comment.ID, err = strconv.ParseInt(m[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: comment header line must have an integer ID: %v", path, err)
+			}
+			if m[2] != "ghost" {
+				comment.User.Login = m[2]
+			}
+			comment.CreatedAt, err = time.Parse(time.RFC3339, m[3])
+			if err != nil {
+				return nil, fmt.Errorf("%s: comment header line must have an RFC3339 date: %v", path, err)
+			}
+			comment.UpdatedAt = comment.CreatedAt
+
+			phase = 2
+			sr.ScanComments()
+
+		case 2:
+			comment.Body = strings.TrimSuffix(sr.Text(), "\n")
+			comments = append(comments, comment)
+			comment = IssueComment{}
+
+			phase = 1
+			sr.ScanLines()
+
+		default:
+			return nil, fmt.Errorf("%s: programmer error, unexpected phase %d", path, phase)
+		}
+	}
+	if err := sr.Err(); err != nil {
+		return nil, fmt.Errorf("%s: failed to parse comments: %v", path, err)
+	}
+
+	issue.Comments = comments
+	setFieldsFromIssueComments(&issue)
+	if issue.CreationTimestamp.Time.IsZero() || issue.Info.CreatedAt.Before(issue.CreationTimestamp.Time) {
+		issue.CreationTimestamp.Time = issue.Info.CreatedAt
+	}
+	return &issue, nil
+}
@@ -0,0 +1,92 @@
+package github
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/diff"
+)
+
+func TestCommentDiskStore_write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewCommentDiskStore(dir, 0)
+	info := IssueInfo{
+		Repo:      "openshift/my_repo",
+		Number:    42,
+		Title:     "e2e fails\non AWS",
+		State:     "open",
+		Body:      "Seen in\n\n```\nerror: timed out\n```\n",
+		HTMLURL:   "https://github.com/openshift/my_repo/issues/42",
+		User:      User{Login: "alice"},
+		Assignees: []User{{Login: "bob"}, {Login: "carol"}},
+		Labels:    []Label{{Name: "ci-failure"}, {Name: "kind/bug"}},
+		Milestone: &Milestone{Title: "v1.2"},
+		CreatedAt: time.Unix(100, 0).UTC(),
+		UpdatedAt: time.Unix(300, 0).UTC(),
+	}
+	comments := &IssueComments{
+		ObjectMeta: metav1.ObjectMeta{Name: info.Key()},
+		Info:       info,
+		Comments: []IssueComment{
+			{ID: 1, User: User{Login: "bob"}, Body: "Text with newlines\n\nNewline\n", CreatedAt: time.Unix(150, 0).UTC(), UpdatedAt: time.Unix(150, 0).UTC()},
+			{ID: 2, Body: "Fake comment\n---\nWith divider and \x1e record separator", CreatedAt: time.Unix(200, 0).UTC(), UpdatedAt: time.Unix(200, 0).UTC()},
+		},
+		RefreshTime: time.Unix(400, 0),
+	}
+	if err := s.Write(comments); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir + "/gh-issue__openshift_my_repo_42"); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.Sync(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("unexpected issues: %#v", list)
+	}
+	got := list[0].(*IssueComments)
+	if got.Name != "openshift_my_repo_42" || !got.RefreshTime.Equal(comments.RefreshTime) || !got.CreationTimestamp.Time.Equal(info.CreatedAt) {
+		t.Errorf("unexpected metadata: %#v", got.ObjectMeta)
+	}
+	want := info
+	want.Title = "e2e fails on AWS"
+	want.Body = "Seen in\n\n```\nerror: timed out\n```\n"
+	if !reflect.DeepEqual(want, got.Info) {
+		t.Errorf("unexpected info: %s", diff.ObjectReflectDiff(want, got.Info))
+	}
+	wantComments := append([]IssueComment{}, comments.Comments...)
+	wantComments[1].Body = "Fake comment\n---\nWith divider and   record separator"
+	if !reflect.DeepEqual(wantComments, got.Comments) {
+		t.Errorf("unexpected comments: %s", diff.ObjectReflectDiff(wantComments, got.Comments))
+	}
+}
+
+func TestParseIssueKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"openshift_origin_1":         "openshift/origin",
+		"openshift_my_repo_name_123": "openshift/my_repo_name",
+		"kube-org_repo.go_9":         "kube-org/repo.go",
+	} {
+		repo, number, err := ParseIssueKey(key)
+		if err != nil || repo != want || IssueKey(repo, number) != key {
+			t.Errorf("%s: unexpected %s %d %v", key, repo, number, err)
+		}
+	}
+	for _, key := range []string{"openshift_1", "_repo_1", "openshift_origin_x", "openshift_origin_0"} {
+		if _, _, err := ParseIssueKey(key); err == nil {
+			t.Errorf("%s: expected error", key)
+		}
+	}
+}
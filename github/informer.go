@@ -0,0 +1,99 @@
+package github
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/pkg/tracker"
+)
+
+// NewIssueLister lists issues out of a cache.
+func NewIssueLister(indexer cache.Indexer) *IssueLister {
+	return &IssueLister{indexer: indexer, resource: schema.GroupResource{Group: "search.openshift.io", Resource: "githubissues"}}
+}
+
+type IssueLister struct {
+	indexer  cache.Indexer
+	resource schema.GroupResource
+}
+
+func (s *IssueLister) List(selector labels.Selector) (ret []*Issue, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*Issue))
+	})
+	return ret, err
+}
+
+func (s *IssueLister) Get(key string) (*Issue, error) {
+	obj, exists, err := s.indexer.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(s.resource, key)
+	}
+	return obj.(*Issue), nil
+}
+
+func NewInformer(client *Client, interval, maxInterval, resyncInterval time.Duration, argsFn func(metav1.ListOptions) SearchIssuesArgs, includeFn func(*IssueInfo) bool) cache.SharedIndexInformer {
+	lw := &ListWatcher{
+		client:      client,
+		argsFn:      argsFn,
+		includeFn:   includeFn,
+		interval:    interval,
+		maxInterval: maxInterval,
+	}
+	lwPager := &cache.ListWatch{ListFunc: lw.List, WatchFunc: lw.Watch}
+	return cache.NewSharedIndexInformer(lwPager, &Issue{}, resyncInterval, nil)
+}
+
+type ListWatcher struct {
+	client      *Client
+	argsFn      func(metav1.ListOptions) SearchIssuesArgs
+	includeFn   func(*IssueInfo) bool
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+// List returns every issue matching the search. The client reads all pages of
+// the search, so the list is never continued.
+func (lw *ListWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
+	args := lw.argsFn(options)
+	issues, err := lw.client.SearchIssues(context.Background(), args)
+	if err != nil {
+		return nil, err
+	}
+	list := NewIssueList(issues, lw.includeFn)
+	klog.V(6).Infof("Listed GitHub issues total=%d items=%d", len(issues), len(list.Items))
+	return list, nil
+}
+
+func (lw *ListWatcher) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	var rv metav1.Time
+	if err := rv.UnmarshalQueryParameter(options.ResourceVersion); err != nil {
+		return nil, err
+	}
+	args := lw.argsFn(options)
+	return tracker.NewPeriodicWatcher(lw.interval, lw.maxInterval, rv, func(since time.Time) ([]tracker.Change, error) {
+		args.LastChangeTime = since
+		issues, err := lw.client.SearchIssues(context.Background(), args)
+		if err != nil {
+			return nil, err
+		}
+		list := NewIssueList(issues, lw.includeFn)
+		changes := make([]tracker.Change, 0, len(list.Items))
+		for i := range list.Items {
+			changes = append(changes, tracker.Change{Object: &list.Items[i], Created: list.Items[i].CreationTimestamp.Time, Changed: list.Items[i].Info.UpdatedAt})
+		}
+		return changes, nil
+	}), nil
+}
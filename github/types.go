@@ -0,0 +1,256 @@
+package github
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/openshift/ci-search/pkg/tracker"
+)
+
+type IssueList struct {
+	metav1.TypeMeta
+	metav1.ListMeta
+
+	Items []Issue
+}
+
+type Issue struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+
+	Info IssueInfo
+}
+
+type IssueComments struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+
+	Info        IssueInfo
+	RefreshTime time.Time
+	Comments    []IssueComment
+}
+
+type Error struct {
+	Message          string `json:"message"`
+	DocumentationURL string `json:"documentation_url"`
+	Code             int    `json:"-"`
+}
+
+type User struct {
+	Login string `json:"login"`
+}
+
+type Label struct {
+	Name string `json:"name"`
+}
+
+type IssueInfo struct {
+	// Repo is the org/repo the issue belongs to. It is not returned by the
+	// API and is set from RepositoryURL.
+	Repo          string     `json:"repo,omitempty"`
+	RepositoryURL string     `json:"repository_url"`
+	Number        int        `json:"number"`
+	Title         string     `json:"title"`
+	State         string     `json:"state"`
+	Body          string     `json:"body"`
+	HTMLURL       string     `json:"html_url"`
+	User          User       `json:"user"`
+	Assignees     []User     `json:"assignees"`
+	Labels        []Label    `json:"labels"`
+	Milestone     *Milestone `json:"milestone,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ClosedAt      *time.Time `json:"closed_at,omitempty"`
+	// PullRequest is set when the issue is a pull request.
+	PullRequest *struct{} `json:"pull_request,omitempty"`
+}
+
+type Milestone struct {
+	Title string `json:"title"`
+}
+
+// Key returns the name the issue is stored under.
+func (i *IssueInfo) Key() string {
+	return IssueKey(i.Repo, i.Number)
+}
+
+// LabelNames returns the names of the labels on the issue.
+func (i *IssueInfo) LabelNames() []string {
+	names := make([]string, 0, len(i.Labels))
+	for _, label := range i.Labels {
+		names = append(names, label.Name)
+	}
+	return names
+}
+
+// AssigneeLogins returns the logins of the users the issue is assigned to.
+func (i *IssueInfo) AssigneeLogins() []string {
+	logins := make([]string, 0, len(i.Assignees))
+	for _, user := range i.Assignees {
+		logins = append(logins, user.Login)
+	}
+	return logins
+}
+
+type IssueInfoList struct {
+	TotalCount        int         `json:"total_count"`
+	IncompleteResults bool        `json:"incomplete_results"`
+	Items             []IssueInfo `json:"items"`
+}
+
+type IssueComment struct {
+	ID        int64     `json:"id"`
+	User      User      `json:"user"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SearchIssuesArgs struct {
+	LastChangeTime time.Time
+	// Repos are the org/repo repositories to search.
+	Repos []string
+	// Query is added to the search, for example label:ci-failure.
+	Query string
+}
+
+// SearchQuery returns the issue search query for the arguments.
+func (arg SearchIssuesArgs) SearchQuery() string {
+	terms := []string{"is:issue"}
+	for _, repo := range arg.Repos {
+		terms = append(terms, "repo:"+repo)
+	}
+	if len(arg.Query) > 0 {
+		terms = append(terms, arg.Query)
+	}
+	if !arg.LastChangeTime.IsZero() {
+		terms = append(terms, "updated:>="+arg.LastChangeTime.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(terms, " ")
+}
+
+// IssueKey returns the name an issue of repo is stored under, ORG_REPO_NUMBER.
+// Organization names may not contain underscores, so the key can be split
+// unambiguously by ParseIssueKey.
+func IssueKey(repo string, number int) string {
+	return fmt.Sprintf("%s_%d", strings.Replace(repo, "/", "_", 1), number)
+}
+
+// ParseIssueKey returns the org/repo and number of an issue key.
+func ParseIssueKey(key string) (string, int, error) {
+	i, j := strings.Index(key, "_"), strings.LastIndex(key, "_")
+	if i <= 0 || j <= i+1 {
+		return "", 0, fmt.Errorf("expected ORG_REPO_NUMBER: %s", key)
+	}
+	number, err := strconv.Atoi(key[j+1:])
+	if err != nil || number <= 0 {
+		return "", 0, fmt.Errorf("expected ORG_REPO_NUMBER: %s", key)
+	}
+	return key[:i] + "/" + key[i+1:j], number, nil
+}
+
+// repoFromURL returns the org/repo of an API repository URL.
+func repoFromURL(u string) string {
+	parts := strings.Split(strings.TrimSuffix(u, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
+
+func NewIssueComments(key string, comments []IssueComment) *IssueComments {
+	return setFieldsFromIssueComments(&IssueComments{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: key,
+			UID:  types.UID(key),
+		},
+		Comments: comments,
+	})
+}
+
+func setFieldsFromIssueComments(issue *IssueComments) *IssueComments {
+	var oldest, newest time.Time
+	for _, comment := range issue.Comments {
+		if oldest.IsZero() || comment.CreatedAt.Before(oldest) {
+			oldest = comment.CreatedAt
+		}
+		if comment.UpdatedAt.After(newest) {
+			newest = comment.UpdatedAt
+		}
+	}
+	issue.CreationTimestamp.Time = oldest
+	issue.ResourceVersion = tracker.TimeToRV(metav1.Time{Time: newest})
+	return issue
+}
+
+func NewIssueList(issues []IssueInfo, includeFn func(*IssueInfo) bool) *IssueList {
+	var change time.Time
+	items := make([]Issue, 0, len(issues))
+	for _, info := range issues {
+		if info.PullRequest != nil {
+			continue
+		}
+		if len(info.Repo) == 0 {
+			info.Repo = repoFromURL(info.RepositoryURL)
+		}
+		if includeFn != nil && !includeFn(&info) {
+			continue
+		}
+		if change.Before(info.UpdatedAt) {
+			change = info.UpdatedAt
+		}
+		key := info.Key()
+		items = append(items, Issue{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              key,
+				UID:               types.UID(key),
+				CreationTimestamp: metav1.Time{Time: info.CreatedAt},
+				ResourceVersion:   tracker.TimeToRV(metav1.Time{Time: info.UpdatedAt}),
+			},
+			Info: info,
+		})
+	}
+	list := &IssueList{Items: items}
+	if !change.IsZero() {
+		list.ResourceVersion = tracker.TimeToRV(metav1.Time{Time: change})
+	}
+	return list
+}
+
+func (b Issue) DeepCopyObject() runtime.Object {
+	copied := b
+	copied.ObjectMeta = *b.ObjectMeta.DeepCopy()
+	return &copied
+}
+
+func (b IssueComments) DeepCopyObject() runtime.Object {
+	copied := b
+	copied.ObjectMeta = *b.ObjectMeta.DeepCopy()
+	if b.Comments != nil {
+		copied.Comments = make([]IssueComment, len(b.Comments))
+		copy(copied.Comments, b.Comments)
+	}
+	return &copied
+}
+
+// Refreshed returns when the comments of the issue were last fetched.
+func (b *IssueComments) Refreshed() time.Time {
+	return b.RefreshTime
+}
+
+func (b *IssueList) DeepCopyObject() runtime.Object {
+	copied := *b
+	if b.Items != nil {
+		copied.Items = make([]Issue, len(b.Items))
+		for i := range b.Items {
+			copied.Items[i] = *b.Items[i].DeepCopyObject().(*Issue)
+		}
+	}
+	return &copied
+}
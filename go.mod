@@ -21,6 +21,7 @@ require (
 	k8s.io/test-infra v0.0.0-20220613105811-fd89122a68eb
 	k8s.io/utils v0.0.0-20220210201930-3a6ce19ff2f9
 	modernc.org/sqlite v1.10.0
+	sigs.k8s.io/yaml v1.2.0
 	vbom.ml/util v0.0.0-20180919145318-efcd4e0f9787
 )
 
@@ -92,7 +93,6 @@ require (
 	modernc.org/token v1.0.0 // indirect
 	sigs.k8s.io/json v0.0.0-20211208200746-9f7c6b3444d2 // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.2.1 // indirect
-	sigs.k8s.io/yaml v1.2.0 // indirect
 )
 
 replace k8s.io/client-go => k8s.io/client-go v0.24.1
@@ -29,6 +29,21 @@ func IssueTargetVersionIDs(s jiraBaseClient.Issue) []string {
 	return listOfTargetVersions
 }
 
+// IssueTargetVersionNames returns the names of the target versions of an issue.
+func IssueTargetVersionNames(s jiraBaseClient.Issue) []string {
+	targetVersion, err := jiraClient.GetIssueTargetVersion(&s)
+	if err != nil || targetVersion == nil {
+		return nil
+	}
+	var names []string
+	for _, element := range *targetVersion {
+		if element != nil && len(element.Name) > 0 {
+			names = append(names, element.Name)
+		}
+	}
+	return names
+}
+
 func FilterPrivateIssues(issue *jiraBaseClient.Issue) bool {
 	securityField, err := jiraClient.GetIssueSecurityLevel(issue)
 	if err != nil {
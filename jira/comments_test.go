@@ -5,7 +5,6 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
-	"strconv"
 	"testing"
 	"time"
 
@@ -52,7 +51,7 @@ func TestCommentStore(t *testing.T) {
 
 	go informer.Run(ctx.Done())
 	go store.Run(ctx, informer)
-	go diskStore.Run(ctx, lister, store, false)
+	go diskStore.Run(ctx, store, false)
 
 	klog.Infof("waiting for caches to sync")
 	cache.WaitForCacheSync(ctx.Done(), informer.HasSynced)
@@ -70,13 +69,13 @@ func TestCommentStore(t *testing.T) {
 
 		var missing bool
 		for _, bug := range bugs {
-			a, _ := strconv.Atoi(bug.Info.ID)
-			comments, ok := store.Get(a)
-			if !ok || comments.RefreshTime.IsZero() {
+			item, ok := store.Get(bug.Name)
+			if !ok || item.Refreshed().IsZero() {
 				klog.Infof("no comments for %s", bug.Info.ID)
 				missing = true
 				continue
 			}
+			comments := item.(*IssueComments)
 			if len(comments.Comments) == 0 {
 				t.Fatalf("bug %s had zero comments: %#v", bug.Info.ID, comments)
 			}
@@ -1,189 +1,70 @@
 package jira
 
 import (
-	"bufio"
-	"bytes"
-	"context"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	jiraBaseClient "github.com/andygrunwald/go-jira"
-	"k8s.io/apimachinery/pkg/util/sets"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/util/workqueue"
-	"k8s.io/klog"
 	jiraClient "k8s.io/test-infra/prow/jira"
 
-	"github.com/openshift/ci-search/walk"
+	"github.com/openshift/ci-search/pkg/tracker"
 )
 
-type CommentDiskStore struct {
-	base   string
-	maxAge time.Duration
-
-	queue workqueue.Interface
+// NewCommentDiskStore saves each issue and its comments to a file named
+// issue__KEY__ID under path.
+func NewCommentDiskStore(path string, maxAge time.Duration) *tracker.DiskStore {
+	return tracker.NewDiskStore("comment_disk", diskFormat{}, path, maxAge)
 }
 
-type CommentAccessor interface {
-	Get(id int) (*IssueComments, bool)
+// NewCommentDiskStoreReader returns a store that reads the comments saved
+// under path without expiring or removing any files.
+func NewCommentDiskStoreReader(path string) *tracker.DiskStore {
+	return tracker.NewDiskStoreReader(diskFormat{}, path)
 }
 
-func NewCommentDiskStore(path string, maxAge time.Duration) *CommentDiskStore {
-	return &CommentDiskStore{
-		base:   path,
-		maxAge: maxAge,
-		queue:  workqueue.NewNamed("comment_disk"),
-	}
-}
+type diskFormat struct{}
 
-func (s *CommentDiskStore) Run(ctx context.Context, lister *IssueLister, store CommentAccessor, disableWrite bool) {
-	defer klog.V(2).Infof("Comment disk worker exited")
-	wait.UntilWithContext(ctx, func(ctx context.Context) {
-		for {
-			obj, done := s.queue.Get()
-			if done {
-				return
-			}
-			if disableWrite {
-				s.queue.Done(obj)
-				return
-			}
-			id, err := strconv.Atoi(obj.(string))
-			if err != nil {
-				s.queue.Done(obj)
-				klog.Errorf("unexpected id in queue: %v", err)
-				continue
-			}
-			comments, ok := store.Get(id)
-			if !ok {
-				s.queue.Done(obj)
-				klog.V(5).Infof("No comments for %d", id)
-				continue
-			}
-			s.queue.Done(obj)
-			bug, err := lister.Get(id)
-			if err != nil {
-				bug = &Issue{ObjectMeta: comments.ObjectMeta, Info: comments.Info}
-			}
-			if err := s.write(bug, comments); err != nil {
-				klog.Errorf("write bug: %v", err)
-			}
-		}
-	}, time.Second)
-}
+func (diskFormat) Prefix() string { return "issue__" }
 
-func (s *CommentDiskStore) NotifyChanged(id int) {
-	s.queue.Add(strconv.Itoa(id))
+func (diskFormat) FileName(item tracker.Item) string {
+	issue := item.(*IssueComments)
+	return fmt.Sprintf("issue__%s__%s", issue.Info.Key, issue.Info.ID)
 }
 
-func (s *CommentDiskStore) Sync(keys []string) ([]*IssueComments, error) {
-	var known sets.String
-	if keys != nil {
-		known = sets.NewString(keys...)
+func (diskFormat) ItemName(fileName string) (string, error) {
+	nameParts := strings.Split(fileName, "__")
+	if len(nameParts) != 3 {
+		return "", fmt.Errorf("expected issue__KEY__ID")
 	}
-	start := time.Now()
-	mustExpire := s.maxAge != 0
-	expiredAt := start.Add(-s.maxAge)
-	tempExpiredAfter := start.Add(-15 * time.Minute)
-
-	bugs := make([]*IssueComments, 0, 2048)
-
-	err := walk.Walk(s.base, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			if os.IsNotExist(err) {
-				return nil
-			}
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-
-		if mustExpire && expiredAt.After(info.ModTime()) {
-			os.Remove(path)
-			klog.V(5).Infof("File expired: %s", path)
-			return nil
-		}
-		relPath, err := filepath.Rel(s.base, path)
-		if err != nil {
-			return err
-		}
-		relPath = filepath.ToSlash(relPath)
-		if strings.HasPrefix(info.Name(), "z-issue__") {
-			if tempExpiredAfter.After(info.ModTime()) {
-				os.Remove(path)
-				klog.V(5).Infof("Temporary file expired: %s", path)
-				return nil
-			}
-			return nil
-		}
-		if !strings.HasPrefix(info.Name(), "issue__") {
-			return nil
-		}
-		nameParts := strings.Split(info.Name(), "__")
-		idString := nameParts[2]
-		id, err := strconv.ParseInt(idString, 10, 64)
-		if err != nil {
-			os.Remove(path)
-			klog.V(5).Infof("File has invalid name: %s", path)
-			return nil
-		}
-
-		if known != nil && !known.Has(idString) {
-			os.Remove(path)
-			klog.V(5).Infof("JiraIssue is not in the known list: %s", path)
-			return nil
-		}
-
-		comments, err := readBugComments(path)
-		if err != nil {
-			return fmt.Errorf("unable to read %q: %v", path, err)
-		}
-		if len(comments.Comments) == 0 {
-			os.Remove(path)
-			klog.V(5).Infof("Issue has no comments: %s", path)
-			return nil
-		}
-		if comments.Name != idString {
-			return fmt.Errorf("file has path %q but ID is %d", path, id)
-		}
-		comments.CreationTimestamp.Time = StringToTime(comments.Comments[0].Created)
-		comments.RefreshTime = info.ModTime()
-		bugs = append(bugs, comments)
-		return nil
-	})
-	if err != nil {
-		return nil, err
+	idString := nameParts[2]
+	if _, err := strconv.ParseInt(idString, 10, 64); err != nil {
+		return "", err
 	}
-	return bugs, nil
+	return idString, nil
 }
 
-func (s *CommentDiskStore) DeleteIssue(bug *Issue) error {
-	_, path := s.pathForBug(bug)
-	return os.Remove(path)
-}
-
-func (s *CommentDiskStore) CloseIssue(bug *IssueComments) error {
-
-	clone := bug.DeepCopyObject().(*IssueComments)
+func (diskFormat) Closed(item tracker.Item) tracker.Item {
+	clone := item.DeepCopyObject().(*IssueComments)
 	clone.Info.Fields.Status.Name = jiraClient.StatusClosed
-	if err := s.write(&Issue{ObjectMeta: clone.ObjectMeta, Info: clone.Info}, clone); err != nil {
-		return fmt.Errorf("could not mark bug %s closed due to write error: %v", clone.Info.ID, err)
-	}
-	return nil
-}
-func (s *CommentDiskStore) pathForBug(bug *Issue) (string, string) {
-	return filepath.Join(s.base, fmt.Sprintf("z-issue__%s__%s", bug.Info.Key, bug.Info.ID)),
-		filepath.Join(s.base, fmt.Sprintf("issue__%s__%s", bug.Info.Key, bug.Info.ID))
+	return clone
 }
 
-func lineSafe(s string) string {
-	return strings.TrimSpace(strings.Replace(s, "\n", " ", -1))
+func (diskFormat) Read(path string, modTime time.Time) (tracker.Item, error) {
+	comments, err := readBugComments(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments.Comments) == 0 {
+		return nil, nil
+	}
+	comments.CreationTimestamp.Time = StringToTime(comments.Comments[0].Created)
+	comments.RefreshTime = modTime
+	return comments, nil
 }
 
 func resolutionFieldName(s *jiraBaseClient.Resolution) string {
@@ -218,14 +99,6 @@ func userFieldDisplayName(s *jiraBaseClient.User) string {
 	return ""
 }
 
-func arrayLineSafe(arr []string, delim string) string {
-	inputs := make([]string, 0, len(arr))
-	for _, s := range arr {
-		inputs = append(inputs, lineSafe(s))
-	}
-	return strings.Join(inputs, delim)
-}
-
 func commentAuthor(authorDisplayName string) string {
 	if authorDisplayName == "" {
 		return "ANONYMOUS"
@@ -233,70 +106,45 @@ func commentAuthor(authorDisplayName string) string {
 	return strings.TrimSpace(authorDisplayName)
 }
 
-func (s *CommentDiskStore) write(issue *Issue, comments *IssueComments) error {
-	path, finalPath := s.pathForBug(issue)
-
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
-	if err != nil {
-		return err
-	}
-
-	w := bufio.NewWriter(f)
-
+func (diskFormat) Write(w io.Writer, item tracker.Item) error {
+	issue := item.(*IssueComments)
 	if _, err := fmt.Fprintf(
 		w,
 		"Issue %s: %s\nDescription: %s \nStatus: %s\nResolution: %s\nPriority: %s\nCreator: %s\nAssigned To: %s\nLabels: %s\nTarget Version: %s\n---\n",
 		issue.Info.ID,
-		lineSafe(issue.Info.Fields.Summary),
-		lineSafe(issue.Info.Fields.Description),
+		tracker.LineSafe(issue.Info.Fields.Summary),
+		tracker.LineSafe(issue.Info.Fields.Description),
 		statusFieldName(issue.Info.Fields.Status),
 		resolutionFieldName(issue.Info.Fields.Resolution),
 		priorityFieldName(issue.Info.Fields.Priority),
 		userFieldDisplayName(issue.Info.Fields.Creator),
 		userFieldDisplayName(issue.Info.Fields.Assignee),
-		arrayLineSafe(issue.Info.Fields.Labels, ", "),
-		arrayLineSafe(IssueTargetVersionIDs(issue.Info), ", "),
+		tracker.ArrayLineSafe(issue.Info.Fields.Labels, ", "),
+		tracker.ArrayLineSafe(IssueTargetVersionIDs(issue.Info), ", "),
 		//TODO these fields might or might not contain usefully information. Check what makes sense to keep, and what the requirements are
-		//arrayLineSafe(fixVersionJira(issue.Info), ", "),
-		//arrayLineSafe(versionsJira(issue.Info), ", "),
-		//arrayLineSafe(componentsJira(issue.Info), ", "),
-		//lineSafe(strings.ReplaceAll(issue.Info.Environment, "\x0D", "")),
+		//tracker.ArrayLineSafe(fixVersionJira(issue.Info), ", "),
+		//tracker.ArrayLineSafe(versionsJira(issue.Info), ", "),
+		//tracker.ArrayLineSafe(componentsJira(issue.Info), ", "),
+		//tracker.LineSafe(strings.ReplaceAll(issue.Info.Environment, "\x0D", "")),
 	); err != nil {
-		f.Close()
-		os.Remove(path)
 		return err
 	}
 
-	for _, comment := range comments.Comments {
-		escapedText := strings.ReplaceAll(strings.ReplaceAll(comment.Body, "\x00", " "), "\x1e", " ")
+	for _, comment := range issue.Comments {
+		escapedText := strings.ReplaceAll(strings.ReplaceAll(comment.Body, "\x00", " "), tracker.CommentDelimiter, " ")
 		if _, err := fmt.Fprintf(
 			w,
-			"Comment %s by %s at %s\n%s\n\x1e",
+			"Comment %s by %s at %s\n%s\n%s",
 			comment.ID,
 			commentAuthor(comment.Author.DisplayName),
 			comment.Created,
 			escapedText,
+			tracker.CommentDelimiter,
 		); err != nil {
-			f.Close()
-			os.Remove(path)
 			return err
 		}
 	}
-
-	if err := w.Flush(); err != nil {
-		f.Close()
-		os.Remove(path)
-		return err
-	}
-	if err := f.Close(); err != nil {
-		os.Remove(path)
-		return err
-	}
-	if err := os.Chtimes(path, comments.RefreshTime, comments.RefreshTime); err != nil {
-		os.Remove(path)
-		return err
-	}
-	return os.Rename(path, finalPath)
+	return nil
 }
 
 var (
@@ -304,10 +152,6 @@ var (
 	reDiskCommentsLineCommentHeader = regexp.MustCompile(`^Comment (\d+) by (.+) at (\d\d\d\d-\d\d-\d\dT\d\d:\d\d:\d\d\.\d\d\d\+\d\d\d\d)$`)
 )
 
-const (
-	issueCommentDelimiter = "\x1e"
-)
-
 func readBugComments(path string) (*IssueComments, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -324,34 +168,7 @@ func readBugComments(path string) (*IssueComments, error) {
 	var resolution jiraBaseClient.Resolution
 	comments := make([]*jiraBaseClient.Comment, 0, 4)
 
-	// allow lines of up to 4MB
-	delim := []byte(issueCommentDelimiter)
-	br := bufio.NewReader(f)
-	sr := bufio.NewScanner(br)
-	sr.Buffer(make([]byte, 4*1024), 4*1024*1024)
-	phase := 0
-	sr.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		switch phase {
-		case 0, 1:
-			return bufio.ScanLines(data, atEOF)
-		case 2:
-			if atEOF && len(data) == 0 {
-				return 0, nil, nil
-			}
-			if i := bytes.Index(data, delim); i >= 0 {
-				// We have a full comment
-				return i + len(delim), data[0:i], nil
-			}
-			// If we're at EOF, we have a final, non-terminated line. Return it.
-			if atEOF {
-				return len(data), data, nil
-			}
-			// Request more data.
-			return 0, nil, nil
-		default:
-			return 0, nil, fmt.Errorf("unrecognized phase %d", phase)
-		}
-	})
+	sr := tracker.NewScanner(f)
 
 	// PHASE 0: Header
 	if !sr.Scan() {
@@ -434,7 +251,7 @@ ScanHeader:
 		return nil, fmt.Errorf("%s: unable to read stored bug: no body separator", path)
 	}
 
-	phase = 1
+	phase := 1
 	comment := new(jiraBaseClient.Comment)
 	for sr.Scan() {
 		switch phase {
@@ -458,6 +275,7 @@ ScanHeader:
 			comment.Updated = comment.Created
 
 			phase = 2
+			sr.ScanComments()
 
 		case 2:
 			comment.Body = strings.TrimSuffix(sr.Text(), "\n")
@@ -465,6 +283,7 @@ ScanHeader:
 			comment = &jiraBaseClient.Comment{}
 
 			phase = 1
+			sr.ScanLines()
 
 		default:
 			return nil, fmt.Errorf("%s: programmer error, unexpected phase %d", path, phase)
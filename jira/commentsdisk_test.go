@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"k8s.io/utils/diff"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -21,31 +22,7 @@ func TestCommentDiskStore_write(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	s := &CommentDiskStore{
-		base: dir,
-	}
-	issue := &Issue{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: "181",
-		},
-		Info: jiraBaseClient.Issue{
-			ID:  strconv.Itoa(181),
-			Key: "OCP-123",
-			Fields: &jiraBaseClient.IssueFields{
-				Assignee: &jiraBaseClient.User{
-					DisplayName: "John Doe",
-				},
-				Description: "This is the description",
-				Status:      &jiraBaseClient.Status{Name: "In Progress"},
-				Resolution:  &jiraBaseClient.Resolution{Name: "Resolution"},
-				Priority:    &jiraBaseClient.Priority{Name: "Urgent"},
-
-				Summary: "This is a test issue description",
-				Creator: &jiraBaseClient.User{DisplayName: "John Smith"},
-				Labels:  []string{"Openshift"},
-			},
-		},
-	}
+	s := NewCommentDiskStore(dir, 0)
 	comments := &IssueComments{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:              "181",
@@ -122,10 +99,10 @@ func TestCommentDiskStore_write(t *testing.T) {
 		},
 	}
 
-	if err := s.write(issue, comments); err != nil {
+	if err := s.Write(comments); err != nil {
 		t.Fatal(err)
 	}
-	tempPath, path := s.pathForBug(issue)
+	tempPath, path := filepath.Join(dir, "z-issue__OCP-123__181"), s.Path(comments)
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		t.Fatal(err)
@@ -150,7 +127,7 @@ func TestCommentDiskStore_write(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(list) != 1 || len(list[0].Comments) != len(comments.Comments) {
+	if len(list) != 1 || len(list[0].(*IssueComments).Comments) != len(comments.Comments) {
 		t.Fatalf("%#v", list)
 	}
 }
@@ -11,6 +11,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/openshift/ci-search/pkg/tracker"
 )
 
 type IssueList struct {
@@ -103,15 +105,10 @@ func setFieldsFromIssueComments(issue *IssueComments) *IssueComments {
 		}
 	}
 	issue.CreationTimestamp.Time = oldest
-	issue.ResourceVersion = timeToRV(metav1.Time{Time: newest})
+	issue.ResourceVersion = tracker.TimeToRV(metav1.Time{Time: newest})
 	return issue
 }
 
-func timeToRV(t metav1.Time) string {
-	s, _ := t.MarshalQueryParameter()
-	return s
-}
-
 func StringToMetaV1Time(timeString string) metav1.Time {
 	created, err := time.Parse("2006-01-02T15:04:05.999-0700", timeString)
 	if err != nil {
@@ -151,14 +148,14 @@ func NewIssueList(issues []jiraBaseClient.Issue, includeFn func(issue *jiraBaseC
 				Name:              info.ID,
 				UID:               types.UID(info.ID),
 				CreationTimestamp: StringToMetaV1Time(time.Time(info.Fields.Created).Format("2006-01-02T15:04:05.000-0700")),
-				ResourceVersion:   timeToRV(StringToMetaV1Time(time.Time(info.Fields.Updated).Format("2006-01-02T15:04:05.000-0700"))),
+				ResourceVersion:   tracker.TimeToRV(StringToMetaV1Time(time.Time(info.Fields.Updated).Format("2006-01-02T15:04:05.000-0700"))),
 			},
 			Info: info,
 		})
 	}
 	list := &IssueList{Items: items}
 	if !change.IsZero() {
-		list.ResourceVersion = timeToRV(metav1.Time{Time: change})
+		list.ResourceVersion = tracker.TimeToRV(metav1.Time{Time: change})
 	}
 	return list
 }
@@ -179,6 +176,11 @@ func (b IssueComments) DeepCopyObject() runtime.Object {
 	return &copied
 }
 
+// Refreshed returns when the comments of the issue were last fetched.
+func (b *IssueComments) Refreshed() time.Time {
+	return b.RefreshTime
+}
+
 func (b *IssueList) DeepCopyObject() runtime.Object {
 	copied := *b
 	if b.Items != nil {
@@ -0,0 +1,388 @@
+// Package query parses boolean expressions over regular expression terms.
+//
+// A query combines terms with AND, OR and NOT and parentheses. Adjacent terms
+// are joined by AND, and AND binds more tightly than OR. A term is a regular
+// expression, optionally prefixed by the type of file it must match in:
+//
+//	junit:"timeout waiting" AND NOT build-log:"image pull"
+//	(junit:etcd OR junit:apiserver) NOT bug:"known issue"
+//
+// Terms containing spaces or parentheses must be quoted. Within quotes \" and
+// \\ are replaced by " and \, and any other escape is passed through to the
+// regular expression unchanged.
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type Op int
+
+const (
+	OpTerm Op = iota
+	OpAnd
+	OpOr
+	OpNot
+)
+
+// Expr is a node of a parsed query.
+type Expr struct {
+	Op Op
+	// Scope is the file type a term must match in, or empty to match any file.
+	Scope string
+	// Pattern is the regular expression of a term.
+	Pattern string
+	// Args are the operands of AND, OR, and NOT.
+	Args []*Expr
+}
+
+// Parse parses a query whose terms may be restricted to any of scopes, the
+// file types that can be searched. At least one term must match for any result
+// to satisfy the query, so a query cannot consist only of negated terms.
+func Parse(s string, scopes []string) (*Expr, error) {
+	p := &parser{scopes: scopes}
+	if err := p.tokenize(s); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("query is empty")
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	if !e.positive() {
+		return nil, fmt.Errorf("query must require at least one term that is not negated")
+	}
+	return e, nil
+}
+
+// Terms returns the terms of the query in order.
+func (e *Expr) Terms() []*Expr {
+	var terms []*Expr
+	e.walk(false, func(term *Expr, negated bool) { terms = append(terms, term) })
+	return terms
+}
+
+// PositiveTerms returns the terms of the query that are not negated.
+func (e *Expr) PositiveTerms() []*Expr {
+	var terms []*Expr
+	e.walk(false, func(term *Expr, negated bool) {
+		if !negated {
+			terms = append(terms, term)
+		}
+	})
+	return terms
+}
+
+// Patterns returns the distinct regular expressions of the query's terms.
+func (e *Expr) Patterns() []string {
+	var patterns []string
+	seen := make(map[string]struct{})
+	for _, term := range e.Terms() {
+		if _, ok := seen[term.Pattern]; ok {
+			continue
+		}
+		seen[term.Pattern] = struct{}{}
+		patterns = append(patterns, term.Pattern)
+	}
+	return patterns
+}
+
+// Matches returns true if term may be satisfied by a file of fileType.
+func (e *Expr) Matches(fileType string) bool {
+	return len(e.Scope) == 0 || e.Scope == fileType
+}
+
+// Eval returns true if the query is satisfied given which terms matched.
+func (e *Expr) Eval(matched func(term *Expr) bool) bool {
+	switch e.Op {
+	case OpTerm:
+		return matched(e)
+	case OpNot:
+		return !e.Args[0].Eval(matched)
+	case OpAnd:
+		for _, arg := range e.Args {
+			if !arg.Eval(matched) {
+				return false
+			}
+		}
+		return true
+	case OpOr:
+		for _, arg := range e.Args {
+			if arg.Eval(matched) {
+				return true
+			}
+		}
+		return false
+	default:
+		panic(fmt.Sprintf("unrecognized query operator %d", e.Op))
+	}
+}
+
+func (e *Expr) String() string {
+	switch e.Op {
+	case OpTerm:
+		pattern := `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(e.Pattern) + `"`
+		if len(e.Scope) > 0 {
+			return e.Scope + ":" + pattern
+		}
+		return pattern
+	case OpNot:
+		return "NOT " + e.Args[0].String()
+	case OpAnd, OpOr:
+		op := " AND "
+		if e.Op == OpOr {
+			op = " OR "
+		}
+		parts := make([]string, 0, len(e.Args))
+		for _, arg := range e.Args {
+			parts = append(parts, arg.String())
+		}
+		return "(" + strings.Join(parts, op) + ")"
+	default:
+		return fmt.Sprintf("<unknown %d>", e.Op)
+	}
+}
+
+// positive returns true if the expression can only be satisfied when at least
+// one of its terms matches.
+func (e *Expr) positive() bool {
+	switch e.Op {
+	case OpTerm:
+		return true
+	case OpAnd:
+		for _, arg := range e.Args {
+			if arg.positive() {
+				return true
+			}
+		}
+		return false
+	case OpOr:
+		for _, arg := range e.Args {
+			if !arg.positive() {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *Expr) walk(negated bool, fn func(term *Expr, negated bool)) {
+	switch e.Op {
+	case OpTerm:
+		fn(e, negated)
+	case OpNot:
+		e.Args[0].walk(!negated, fn)
+	default:
+		for _, arg := range e.Args {
+			arg.walk(negated, fn)
+		}
+	}
+}
+
+type tokenType int
+
+const (
+	tokenTerm tokenType = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	typ     tokenType
+	scope   string
+	pattern string
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenAnd:
+		return "AND"
+	case tokenOr:
+		return "OR"
+	case tokenNot:
+		return "NOT"
+	case tokenOpen:
+		return "'('"
+	case tokenClose:
+		return "')'"
+	default:
+		return fmt.Sprintf("term %q", t.pattern)
+	}
+}
+
+type parser struct {
+	scopes []string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) tokenize(s string) error {
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			p.tokens = append(p.tokens, token{typ: tokenOpen})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, token{typ: tokenClose})
+			i++
+		default:
+			t := token{typ: tokenTerm}
+			for _, scope := range p.scopes {
+				if strings.HasPrefix(s[i:], scope+":") {
+					t.scope = scope
+					i += len(scope) + 1
+					break
+				}
+			}
+			if i < len(s) && s[i] == '"' {
+				pattern, n, err := readQuoted(s[i:])
+				if err != nil {
+					return err
+				}
+				t.pattern = pattern
+				i += n
+			} else {
+				end := strings.IndexFunc(s[i:], func(r rune) bool { return unicode.IsSpace(r) || r == '(' || r == ')' })
+				if end == -1 {
+					end = len(s) - i
+				}
+				t.pattern = s[i : i+end]
+				i += end
+				if len(t.scope) == 0 {
+					switch t.pattern {
+					case "AND":
+						t.typ = tokenAnd
+					case "OR":
+						t.typ = tokenOr
+					case "NOT":
+						t.typ = tokenNot
+					}
+				}
+			}
+			if t.typ == tokenTerm && len(t.pattern) == 0 {
+				return fmt.Errorf("query contains an empty term")
+			}
+			p.tokens = append(p.tokens, t)
+		}
+	}
+	return nil
+}
+
+// readQuoted returns the contents of the quoted string at the start of s and
+// the number of bytes it occupies.
+func readQuoted(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return "", 0, fmt.Errorf("unterminated quoted term")
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseOr() (*Expr, error) {
+	e, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	args := []*Expr{e}
+	for {
+		t, ok := p.peek()
+		if !ok || t.typ != tokenOr {
+			break
+		}
+		p.pos++
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, e)
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return &Expr{Op: OpOr, Args: args}, nil
+}
+
+func (p *parser) parseAnd() (*Expr, error) {
+	e, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	args := []*Expr{e}
+	for {
+		t, ok := p.peek()
+		if !ok || t.typ == tokenOr || t.typ == tokenClose {
+			break
+		}
+		if t.typ == tokenAnd {
+			p.pos++
+		}
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, e)
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return &Expr{Op: OpAnd, Args: args}, nil
+}
+
+func (p *parser) parseUnary() (*Expr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	p.pos++
+	switch t.typ {
+	case tokenNot:
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Op: OpNot, Args: []*Expr{e}}, nil
+	case tokenOpen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.typ != tokenClose {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return e, nil
+	case tokenTerm:
+		return &Expr{Op: OpTerm, Scope: t.scope, Pattern: t.pattern}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s", t)
+	}
+}
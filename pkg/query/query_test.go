@@ -0,0 +1,101 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testScopes = []string{"junit", "build-log", "bug"}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		err   bool
+	}{
+		{query: "timeout", want: `"timeout"`},
+		{query: "junit:timeout", want: `junit:"timeout"`},
+		{query: `build-log:"image pull (failed)"`, want: `build-log:"image pull (failed)"`},
+		{query: "a b", want: `("a" AND "b")`},
+		{query: "a AND b OR c", want: `(("a" AND "b") OR "c")`},
+		{query: "a (b OR c)", want: `("a" AND ("b" OR "c"))`},
+		{query: "junit:a NOT build-log:b", want: `(junit:"a" AND NOT build-log:"b")`},
+		{query: `"say \"hi\"" "\d+\\"`, want: `("say \"hi\"" AND "\\d+\\")`},
+		{query: `"AND" or`, want: `("AND" AND "or")`},
+		{query: "other:a", want: `"other:a"`},
+
+		{query: "", err: true},
+		{query: "NOT a", err: true},
+		{query: "a OR NOT b", err: true},
+		{query: "(a", err: true},
+		{query: "a)", err: true},
+		{query: "a AND", err: true},
+		{query: `"a`, err: true},
+		{query: "junit: a", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			e, err := Parse(tt.query, testScopes)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got %s", e)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			// the string form parses to the same query
+			reparsed, err := Parse(e.String(), testScopes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reparsed, e) {
+				t.Errorf("reparsed %s as %s", e, reparsed)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	e, err := Parse(`junit:timeout NOT build-log:"image pull" OR bug:"known issue"`, testScopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Patterns(), []string{"timeout", "image pull", "known issue"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected patterns %q", got)
+	}
+	var positive []string
+	for _, term := range e.PositiveTerms() {
+		positive = append(positive, term.Pattern)
+	}
+	if want := []string{"timeout", "known issue"}; !reflect.DeepEqual(positive, want) {
+		t.Errorf("unexpected positive terms %q", positive)
+	}
+
+	tests := []struct {
+		name    string
+		matched map[string]string
+		want    bool
+	}{
+		{name: "junit only", matched: map[string]string{"timeout": "junit"}, want: true},
+		{name: "excluded by build log", matched: map[string]string{"timeout": "junit", "image pull": "build-log"}},
+		{name: "wrong scope", matched: map[string]string{"timeout": "build-log"}},
+		{name: "other branch", matched: map[string]string{"timeout": "junit", "image pull": "build-log", "known issue": "bug"}, want: true},
+		{name: "nothing", matched: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := e.Eval(func(term *Expr) bool {
+				fileType, ok := tt.matched[term.Pattern]
+				return ok && term.Matches(fileType)
+			})
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
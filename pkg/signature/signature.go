@@ -0,0 +1,95 @@
+// Package signature reduces failure messages to stable signatures by masking
+// the parts of a message that change between occurrences of the same failure,
+// such as timestamps, addresses, versions, generated names and durations.
+package signature
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxLength is the longest signature returned by Normalize.
+const MaxLength = 256
+
+type replacement struct {
+	re   *regexp.Regexp
+	with string
+}
+
+// generatedSuffix matches the five characters Kubernetes appends to generated
+// names when at least one of them is a digit.
+var generatedSuffix = func() string {
+	const consonants, digits = "bcdfghjklmnpqrstvwxz", "2456789"
+	var alternatives []string
+	for i := 0; i < 5; i++ {
+		alternatives = append(alternatives, fmt.Sprintf("[%s]{%d}[%s][%s%s]{%d}", consonants, i, digits, consonants, digits, 4-i))
+	}
+	return strings.Join(alternatives, "|")
+}()
+
+// replacements are applied in order, so more specific patterns come before the
+// patterns that would match part of them.
+var replacements = []replacement{
+	// 5f0c3f8e-8b3c-4c1e-9a3e-2b8f0e1c9d7a
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), "<uuid>"},
+	// 2020-01-02T15:04:05.123Z, 2020-01-02 15:04:05 +0000
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|\s?[+-]\d{2}:?\d{2}\b)?`), "<time>"},
+	// Jan  2 15:04:05.123
+	{regexp.MustCompile(`\b(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)\s+\d{1,2},?\s+(\d{4}\s+)?\d{2}:\d{2}:\d{2}(\.\d+)?`), "<time>"},
+	// E0102 15:04:05.123456 (klog) and bare times
+	{regexp.MustCompile(`\b([IWEF])\d{4} \d{2}:\d{2}:\d{2}(\.\d+)?`), "$1<time>"},
+	{regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(\.\d+)?\b`), "<time>"},
+	// 10.0.0.1, 10.0.0.1:6443, 10.128.0.0/14
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+|/\d+)?\b`), "<ip>"},
+	// fd00:1:2:3:4:5:6:7, fd00::1, [::1]:443
+	{regexp.MustCompile(`\b([0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`), "<ip>"},
+	// a "::" must not follow or precede a word, so paths such as std::string
+	// or Foo::add are kept
+	{regexp.MustCompile(`\b[0-9a-fA-F]{1,4}(:[0-9a-fA-F]{1,4})*::([0-9a-fA-F]{1,4}(:[0-9a-fA-F]{1,4})*\b|\B)|\B::[0-9a-fA-F]{1,4}(:[0-9a-fA-F]{1,4})*\b`), "<ip>"},
+	// 4.14.0, v1.27.3, 4.14.0-0.nightly-2023-10-10-123456, 1.2.3+build.5
+	{regexp.MustCompile(`\bv?\d+\.\d+\.\d+(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?\b`), "<version>"},
+	// generated pod names, e.g. etcd-operator-5d8f7b9c4-x2k9p and
+	// node-exporter-x2k9p. A suffix without a hash must contain a digit, so
+	// words such as the "https" of console-https are kept.
+	{regexp.MustCompile(`-[bcdfghjklmnpqrstvwxz2456789]{6,10}-[bcdfghjklmnpqrstvwxz2456789]{5}\b`), "-<id>"},
+	{regexp.MustCompile(`-(` + generatedSuffix + `)\b`), "-<id>"},
+	// sha256:0123..., commit and container ids
+	{regexp.MustCompile(`\b[0-9a-f]{8,}\b`), "<hex>"},
+	// 1.5s, 200ms, 1h2m3.5s
+	{regexp.MustCompile(`\b(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+\b`), "<duration>"},
+	// any other number that is not part of a word
+	{regexp.MustCompile(`\b\d+(\.\d+)?\b`), "<n>"},
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// Normalize returns the signature of a single line of a failure message.
+func Normalize(line string) string {
+	for _, r := range replacements {
+		line = r.re.ReplaceAllString(line, r.with)
+	}
+	line = strings.TrimSpace(whitespace.ReplaceAllString(line, " "))
+	if len(line) > MaxLength {
+		line = line[:MaxLength]
+		// do not split a multi-byte character
+		for len(line) > 0 && line[len(line)-1]&0xc0 == 0x80 {
+			line = line[:len(line)-1]
+		}
+		if len(line) > 0 && line[len(line)-1] >= 0xc0 {
+			line = line[:len(line)-1]
+		}
+	}
+	return line
+}
+
+// FirstLine returns the signature of the first line of message that is not
+// empty once normalized.
+func FirstLine(message string) string {
+	for _, line := range strings.Split(message, "\n") {
+		if signature := Normalize(line); len(signature) > 0 {
+			return signature
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package signature
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{
+			line: `fail [github.com/openshift/origin/test/extended/util.go:123]: Jan  2 15:04:05.123: timed out after 30s waiting for pod etcd-operator-5d8f7b9c4-x2k9p`,
+			want: `fail [github.com/openshift/origin/test/extended/util.go:<n>]: <time>: timed out after <duration> waiting for pod etcd-operator-<id>`,
+		},
+		{
+			line: `level=error time="2020-01-02T15:04:05Z" msg="dial tcp 10.0.12.4:6443: i/o timeout"`,
+			want: `level=error time="<time>" msg="dial tcp <ip>: i/o timeout"`,
+		},
+		{
+			line: `E0102 15:04:05.123456    1234 reflector.go:178] failed to list *v1.Pod: Get "https://[fd00::1]:443/api": context deadline exceeded`,
+			want: `E<time> <n> reflector.go:<n>] failed to list *v1.Pod: Get "https://[<ip>]:<n>/api": context deadline exceeded`,
+		},
+		{
+			line: `namespace e2e-test-5f0c3f8e-8b3c-4c1e-9a3e-2b8f0e1c9d7a pod node-exporter-x2k9p image sha256:0123456789abcdef0123`,
+			want: `namespace e2e-test-<uuid> pod node-exporter-<id> image sha256:<hex>`,
+		},
+		{
+			line: "  took   1h2m3.5s\tand 200ms ",
+			want: "took <duration> and <duration>",
+		},
+		{
+			line: "panic in std::string at ::1 and [fd00:10::2]:53",
+			want: "panic in std::string at <ip> and [<ip>]:<n>",
+		},
+		{
+			line: "x509: certificate signed by unknown authority on e2e node",
+			want: "x509: certificate signed by unknown authority on e2e node",
+		},
+		{
+			line: "cluster upgraded from 4.14.0-0.nightly-2023-10-10-123456 to v4.15.2+build.5 with kubelet v1.27.3",
+			want: "cluster upgraded from <version> to <version> with kubelet <version>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := Normalize(tt.line); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := Normalize(strings.Repeat("é", MaxLength)); len(got) > MaxLength || !strings.HasSuffix(got, "é") {
+		t.Errorf("unexpected truncation: %q", got)
+	}
+}
+
+// TestNormalizeKeeps lists lines that must survive normalization unchanged, so
+// that different failures keep different signatures.
+func TestNormalizeKeeps(t *testing.T) {
+	for _, line := range []string{
+		`route openshift-console/console-https was not admitted`,
+		`Get "https://oauth-openshift.apps.example.com/healthz": dial tcp: lookup oauth-openshift.apps.example.com: no such host`,
+		`service router-internal-default-https has no endpoints`,
+		`Post "https://thanos-querier-https.openshift-monitoring.svc/api/v1/query": EOF`,
+		`API version v1beta1 of kind CronJob is not served`,
+		`thread panicked at std::string::add and Foo::Dead::Code`,
+		`container kube-rbac-proxy-crio-bcdfg terminated`,
+	} {
+		t.Run(line, func(t *testing.T) {
+			if got := Normalize(line); got != line {
+				t.Errorf("got  %q\nwant %q", got, line)
+			}
+		})
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	if got := FirstLine("\n  \nerror 1 at 15:04:05\nmore\n"); got != "error <n> at <time>" {
+		t.Errorf("unexpected signature %q", got)
+	}
+	if got := FirstLine(""); got != "" {
+		t.Errorf("unexpected signature %q", got)
+	}
+}
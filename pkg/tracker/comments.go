@@ -0,0 +1,339 @@
+package tracker
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+)
+
+// Item is a bug or issue of a tracker together with its comments.
+type Item interface {
+	runtime.Object
+	GetName() string
+	// Refreshed returns when the comments were last fetched.
+	Refreshed() time.Time
+}
+
+// Tracker fetches the comments of the items of a tracker and merges them with
+// the items returned by its informer.
+type Tracker interface {
+	// WithInfo returns a copy of existing, or a new item without comments if
+	// existing is nil, with the info of obj, an object of the informer. It
+	// returns false if obj is not an item of the tracker.
+	WithInfo(existing Item, obj interface{}) (Item, bool)
+	// Fetch returns the comments of items by item name. Items whose comments
+	// could not be retrieved are omitted.
+	Fetch(ctx context.Context, items []Item) (map[string]interface{}, error)
+	// WithComments returns a copy of existing with comments refreshed at now
+	// and whether the comments changed.
+	WithComments(existing Item, comments interface{}, now time.Time) (Item, bool)
+}
+
+// PersistentCommentStore saves the items of a CommentStore.
+type PersistentCommentStore interface {
+	Sync(keys []string) ([]Item, error)
+	NotifyChanged(name string)
+	Close(Item) error
+}
+
+// CommentStore keeps the comments of the items of an informer, refetching the
+// comments of each item at least once per refresh interval.
+type CommentStore struct {
+	// generation is incremented whenever an item or its comments change and
+	// must be accessed atomically
+	generation uint64
+
+	// MaxBatch is the largest number of items to fetch comments for at once.
+	MaxBatch int
+	// RateLimit, if set, limits how often comments are fetched.
+	RateLimit *rate.Limiter
+	// RefreshOnUpdate refetches the comments of an item whenever its info
+	// changes, for trackers where a new comment changes the item.
+	RefreshOnUpdate bool
+
+	tracker        Tracker
+	store          cache.Store
+	persistedStore PersistentCommentStore
+
+	queue workqueue.Interface
+
+	refreshInterval time.Duration
+
+	// lock keeps the comment list in sync with the item list
+	lock sync.Mutex
+}
+
+// NewCommentStore returns a store that fetches comments one item at a time
+// through tracker and saves changed items to persisted, if set.
+func NewCommentStore(name string, tracker Tracker, refreshInterval time.Duration, persisted PersistentCommentStore) *CommentStore {
+	return &CommentStore{
+		MaxBatch: 1,
+
+		tracker:         tracker,
+		store:           cache.NewStore(cache.MetaNamespaceKeyFunc),
+		persistedStore:  persisted,
+		queue:           workqueue.NewNamed(name),
+		refreshInterval: refreshInterval,
+	}
+}
+
+// Len returns the number of stored items.
+func (s *CommentStore) Len() int {
+	return len(s.store.ListKeys())
+}
+
+// Generation returns a counter that changes whenever the stored items or their
+// comments change.
+func (s *CommentStore) Generation() uint64 {
+	return atomic.LoadUint64(&s.generation)
+}
+
+// Get returns the item stored under name.
+func (s *CommentStore) Get(name string) (Item, bool) {
+	obj, ok, err := s.store.GetByKey(name)
+	if err != nil || !ok {
+		return nil, false
+	}
+	return obj.(Item), true
+}
+
+// List returns the stored items and their comments.
+func (s *CommentStore) List() []Item {
+	objs := s.store.List()
+	list := make([]Item, 0, len(objs))
+	for _, obj := range objs {
+		list = append(list, obj.(Item))
+	}
+	return list
+}
+
+// Load adds the items saved by the persistent store to the store.
+func (s *CommentStore) Load() error {
+	if s.persistedStore == nil {
+		return nil
+	}
+	// load the full state into the store
+	list, err := s.persistedStore.Sync(nil)
+	for _, item := range list {
+		s.store.Add(item.DeepCopyObject())
+		atomic.AddUint64(&s.generation, 1)
+	}
+	klog.V(4).Infof("Loaded %d items from disk", len(list))
+	return err
+}
+
+func (s *CommentStore) Run(ctx context.Context, informer cache.SharedInformer) error {
+	defer klog.V(2).Infof("Comment worker exited")
+	if s.refreshInterval == 0 {
+		return nil
+	}
+	if err := s.Load(); err != nil {
+		klog.Errorf("Unable to load initial comment state: %v", err)
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    s.itemAdd,
+		DeleteFunc: s.itemDelete,
+		UpdateFunc: func(_, new interface{}) { s.itemUpdate(new) },
+	})
+
+	klog.V(5).Infof("Running comment store")
+
+	// periodically put all items that haven't been refreshed in the last
+	// interval into the queue
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		refreshAfter := time.Now().Add(-s.refreshInterval)
+		var count int
+		for _, item := range s.List() {
+			if item.Refreshed().Before(refreshAfter) {
+				s.queue.Add(item.GetName())
+				count++
+			}
+		}
+		klog.V(5).Infof("Refreshed %d comments older than %s", count, s.refreshInterval.String())
+	}, s.refreshInterval/4)
+
+	go func() {
+		<-ctx.Done()
+		s.queue.ShutDown()
+	}()
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := s.run(ctx); err != nil {
+			klog.Errorf("Error syncing comments: %v", err)
+		}
+	}, time.Second)
+
+	return ctx.Err()
+}
+
+func (s *CommentStore) run(ctx context.Context) error {
+	for {
+		k, done := s.queue.Get()
+		if done {
+			return ctx.Err()
+		}
+		s.queue.Done(k)
+		if s.RateLimit != nil {
+			if err := s.RateLimit.Wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		// fetch the items queued while waiting in the same batch
+		names := []string{k.(string)}
+		for len(names) < s.MaxBatch && s.queue.Len() > 0 {
+			k, done := s.queue.Get()
+			if done {
+				return ctx.Err()
+			}
+			s.queue.Done(k)
+			names = append(names, k.(string))
+		}
+		items := make([]Item, 0, len(names))
+		for _, name := range names {
+			if item, ok := s.Get(name); ok {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		now := time.Now()
+		klog.V(7).Infof("Fetching comments of %d items", len(items))
+		comments, err := s.tracker.Fetch(ctx, items)
+		if err != nil {
+			klog.Warningf("comment store failed to retrieve comments: %v", err)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		s.merge(comments, now)
+	}
+}
+
+func (s *CommentStore) merge(comments map[string]interface{}, now time.Time) {
+	var total int
+	defer func() { klog.V(7).Infof("Updated %d comment records", total) }()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for name, itemComments := range comments {
+		existing, ok := s.Get(name)
+		if !ok {
+			klog.V(5).Infof("Item %s is not in cache", name)
+			continue
+		}
+		if existing.Refreshed().After(now) {
+			klog.V(5).Infof("Item %s refresh time is in the future: %v >= %v", name, existing.Refreshed(), now)
+			continue
+		}
+
+		updated, changed := s.tracker.WithComments(existing, itemComments, now)
+		if err := s.store.Update(updated); err != nil {
+			klog.Errorf("Unable to update comments of %s: %v", name, err)
+			continue
+		}
+		if changed {
+			atomic.AddUint64(&s.generation, 1)
+		}
+		if s.persistedStore != nil {
+			s.persistedStore.NotifyChanged(name)
+		}
+		total++
+	}
+}
+
+func (s *CommentStore) itemAdd(obj interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	name, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	existing, ok := s.Get(name)
+	if !ok {
+		existing = nil
+	}
+	item, ok := s.tracker.WithInfo(existing, obj)
+	if !ok {
+		return
+	}
+	if existing != nil {
+		if err := s.store.Update(item); err != nil {
+			klog.Errorf("Unable to merge added item from informer: %v", err)
+			return
+		}
+	} else {
+		if err := s.store.Add(item); err != nil {
+			klog.Errorf("Unable to add item from informer: %v", err)
+			return
+		}
+	}
+	atomic.AddUint64(&s.generation, 1)
+	s.queue.Add(name)
+}
+
+func (s *CommentStore) itemUpdate(obj interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	name, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	existing, ok := s.Get(name)
+	if !ok {
+		return
+	}
+	item, ok := s.tracker.WithInfo(existing, obj)
+	if !ok || reflect.DeepEqual(existing, item) {
+		return
+	}
+	if err := s.store.Update(item); err != nil {
+		klog.Errorf("Unable to update item from informer: %v", err)
+		return
+	}
+	atomic.AddUint64(&s.generation, 1)
+	switch {
+	case s.RefreshOnUpdate:
+		s.queue.Add(name)
+	case s.persistedStore != nil:
+		s.persistedStore.NotifyChanged(name)
+	}
+}
+
+func (s *CommentStore) itemDelete(obj interface{}) {
+	name, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	existing, ok := s.Get(name)
+	if !ok {
+		klog.Errorf("Item %q not found in store", name)
+		return
+	}
+	if err := s.store.Delete(existing); err != nil {
+		klog.Errorf("Unable to delete item from informer: %v", err)
+		return
+	}
+	atomic.AddUint64(&s.generation, 1)
+	if s.persistedStore == nil {
+		return
+	}
+	if err := s.persistedStore.Close(existing); err != nil {
+		klog.Errorf("Unable to close item in disk store: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+type testObject struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+
+	Status string
+}
+
+func (o testObject) DeepCopyObject() runtime.Object {
+	copied := o
+	copied.ObjectMeta = *o.ObjectMeta.DeepCopy()
+	return &copied
+}
+
+type testItem struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+
+	Status      string
+	RefreshTime time.Time
+	Comments    []string
+}
+
+func (i testItem) DeepCopyObject() runtime.Object {
+	copied := i
+	copied.ObjectMeta = *i.ObjectMeta.DeepCopy()
+	copied.Comments = append([]string(nil), i.Comments...)
+	return &copied
+}
+
+func (i *testItem) Refreshed() time.Time { return i.RefreshTime }
+
+type testTracker map[string][]string
+
+func (t testTracker) WithInfo(existing Item, obj interface{}) (Item, bool) {
+	o, ok := obj.(*testObject)
+	if !ok {
+		return nil, false
+	}
+	if existing == nil {
+		return &testItem{ObjectMeta: metav1.ObjectMeta{Name: o.Name}, Status: o.Status}, true
+	}
+	copied := existing.DeepCopyObject().(*testItem)
+	copied.Status = o.Status
+	return copied, true
+}
+
+func (t testTracker) Fetch(ctx context.Context, items []Item) (map[string]interface{}, error) {
+	comments := make(map[string]interface{})
+	for _, item := range items {
+		if c, ok := t[item.GetName()]; ok {
+			comments[item.GetName()] = c
+		}
+	}
+	return comments, nil
+}
+
+func (t testTracker) WithComments(existing Item, comments interface{}, now time.Time) (Item, bool) {
+	item := existing.DeepCopyObject().(*testItem)
+	item.Comments = comments.([]string)
+	item.RefreshTime = now
+	return item, !reflect.DeepEqual(existing.(*testItem).Comments, item.Comments)
+}
+
+type testPersistedStore struct {
+	changed []string
+	closed  []Item
+}
+
+func (s *testPersistedStore) Sync(keys []string) ([]Item, error) { return nil, nil }
+func (s *testPersistedStore) NotifyChanged(name string)          { s.changed = append(s.changed, name) }
+func (s *testPersistedStore) Close(item Item) error {
+	s.closed = append(s.closed, item)
+	return nil
+}
+
+func TestCommentStore(t *testing.T) {
+	persisted := &testPersistedStore{}
+	s := NewCommentStore("test", testTracker{"1": {"first", "second"}}, time.Minute, persisted)
+
+	s.itemAdd(&testObject{ObjectMeta: metav1.ObjectMeta{Name: "1"}, Status: "NEW"})
+	s.itemAdd(&metav1.Status{})
+	if s.Len() != 1 || s.Generation() != 1 || s.queue.Len() != 1 {
+		t.Fatalf("unexpected store after add: %d items, generation %d, %d queued", s.Len(), s.Generation(), s.queue.Len())
+	}
+
+	now := time.Now()
+	comments, err := s.tracker.Fetch(context.Background(), s.List())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.merge(comments, now)
+	item, ok := s.Get("1")
+	if !ok || !item.Refreshed().Equal(now) || len(item.(*testItem).Comments) != 2 || s.Generation() != 2 {
+		t.Fatalf("unexpected item after fetch: %#v", item)
+	}
+
+	// refetching the same comments only saves the refresh time
+	s.merge(comments, now.Add(time.Second))
+	if s.Generation() != 2 {
+		t.Fatalf("unchanged comments changed the generation: %d", s.Generation())
+	}
+
+	s.itemUpdate(&testObject{ObjectMeta: metav1.ObjectMeta{Name: "1"}, Status: "NEW"})
+	if s.Generation() != 2 {
+		t.Fatalf("unchanged info changed the generation: %d", s.Generation())
+	}
+	s.itemUpdate(&testObject{ObjectMeta: metav1.ObjectMeta{Name: "1"}, Status: "ASSIGNED"})
+	item, _ = s.Get("1")
+	if s.Generation() != 3 || item.(*testItem).Status != "ASSIGNED" || len(item.(*testItem).Comments) != 2 {
+		t.Fatalf("unexpected item after update: %#v", item)
+	}
+	if want := []string{"1", "1", "1"}; !reflect.DeepEqual(persisted.changed, want) {
+		t.Fatalf("unexpected changes saved: %v", persisted.changed)
+	}
+
+	s.itemDelete(cache.DeletedFinalStateUnknown{Key: "1"})
+	if s.Len() != 0 || len(persisted.closed) != 1 || persisted.closed[0].GetName() != "1" {
+		t.Fatalf("unexpected store after delete: %d items, closed %v", s.Len(), persisted.closed)
+	}
+}
+
+type testFormat struct{}
+
+func (testFormat) Prefix() string            { return "item-" }
+func (testFormat) FileName(item Item) string { return "item-" + item.GetName() }
+func (testFormat) ItemName(fileName string) (string, error) {
+	name := strings.TrimPrefix(fileName, "item-")
+	if len(name) == 0 {
+		return "", fmt.Errorf("no name")
+	}
+	return name, nil
+}
+func (testFormat) Closed(item Item) Item {
+	copied := item.DeepCopyObject().(*testItem)
+	copied.Status = "CLOSED"
+	return copied
+}
+func (testFormat) Write(w io.Writer, item Item) error {
+	i := item.(*testItem)
+	if _, err := fmt.Fprintf(w, "%s %s\n", i.Name, i.Status); err != nil {
+		return err
+	}
+	for _, comment := range i.Comments {
+		if _, err := fmt.Fprintf(w, "%s%s", comment, CommentDelimiter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (testFormat) Read(path string, modTime time.Time) (Item, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sr := NewScanner(f)
+	if !sr.Scan() {
+		return nil, fmt.Errorf("no header")
+	}
+	var item testItem
+	fmt.Sscanf(sr.Text(), "%s %s", &item.Name, &item.Status)
+	sr.ScanComments()
+	for sr.Scan() {
+		item.Comments = append(item.Comments, sr.Text())
+	}
+	if len(item.Comments) == 0 {
+		return nil, sr.Err()
+	}
+	item.RefreshTime = modTime
+	return &item, sr.Err()
+}
+
+func TestDiskStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewDiskStore("test", testFormat{}, dir, time.Hour)
+	refreshed := time.Now().Add(-time.Minute).Truncate(time.Second)
+	item := &testItem{
+		ObjectMeta:  metav1.ObjectMeta{Name: "1"},
+		Status:      "NEW",
+		RefreshTime: refreshed,
+		Comments:    []string{"first\nline", "second with \x00 null"},
+	}
+	if err := s.Write(item); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&testItem{ObjectMeta: metav1.ObjectMeta{Name: "2"}, Status: "NEW", RefreshTime: refreshed}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(&testItem{ObjectMeta: metav1.ObjectMeta{Name: "3"}, Status: "NEW", RefreshTime: refreshed.Add(-2 * time.Hour), Comments: []string{"expired"}}); err != nil {
+		t.Fatal(err)
+	}
+	tempPath := filepath.Join(dir, "z-item-4")
+	if err := ioutil.WriteFile(tempPath, nil, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tempPath, refreshed.Add(-time.Hour), refreshed.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.Sync(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || !reflect.DeepEqual(list[0], item) {
+		t.Fatalf("unexpected items: %#v", list)
+	}
+	for _, name := range []string{"item-2", "item-3", "z-item-4"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed: %v", name, err)
+		}
+	}
+
+	if err := s.Close(item); err != nil {
+		t.Fatal(err)
+	}
+	list, err = NewDiskStoreReader(testFormat{}, dir).Sync(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].(*testItem).Status != "CLOSED" {
+		t.Fatalf("unexpected items after close: %#v", list)
+	}
+	if list, err := s.Sync([]string{"2"}); err != nil || len(list) != 0 {
+		t.Fatalf("expected items not in the known list to be removed: %#v %v", list, err)
+	}
+}
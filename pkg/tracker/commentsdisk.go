@@ -0,0 +1,242 @@
+package tracker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/pkg/trigram"
+	"github.com/openshift/ci-search/walk"
+)
+
+// CommentDelimiter separates the comments of an item on disk.
+const CommentDelimiter = "\x1e"
+
+// Format names and serializes the files a DiskStore saves items to.
+type Format interface {
+	// Prefix is the prefix of the names of the files items are saved to.
+	Prefix() string
+	// FileName returns the name of the file item is saved to.
+	FileName(item Item) string
+	// ItemName returns the name of the item saved to the file with name.
+	ItemName(fileName string) (string, error)
+	// Write writes item to w.
+	Write(w io.Writer, item Item) error
+	// Read returns the item saved at path, which was last refreshed at
+	// modTime, or nil if the file holds nothing worth keeping.
+	Read(path string, modTime time.Time) (Item, error)
+	// Closed returns a copy of item marked closed.
+	Closed(item Item) Item
+}
+
+// ItemGetter returns the current version of an item.
+type ItemGetter interface {
+	Get(name string) (Item, bool)
+}
+
+// DiskStore saves the items of a CommentStore to one file per item so they
+// can be searched and loaded on restart.
+type DiskStore struct {
+	format Format
+	base   string
+	maxAge time.Duration
+	// readOnly prevents Sync from removing expired or invalid files
+	readOnly bool
+
+	queue workqueue.Interface
+}
+
+func NewDiskStore(name string, format Format, path string, maxAge time.Duration) *DiskStore {
+	return &DiskStore{
+		format: format,
+		base:   path,
+		maxAge: maxAge,
+		queue:  workqueue.NewNamed(name),
+	}
+}
+
+// NewDiskStoreReader returns a store that reads the items saved under path
+// without expiring or removing any files.
+func NewDiskStoreReader(format Format, path string) *DiskStore {
+	s := NewDiskStore("", format, path, 0)
+	s.readOnly = true
+	return s
+}
+
+func (s *DiskStore) remove(path string) {
+	if s.readOnly {
+		return
+	}
+	os.Remove(path)
+}
+
+// Run writes the items that changed in store until ctx is done.
+func (s *DiskStore) Run(ctx context.Context, store ItemGetter, disableWrite bool) {
+	defer klog.V(2).Infof("Comment disk worker exited")
+	go func() {
+		<-ctx.Done()
+		s.queue.ShutDown()
+	}()
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for {
+			obj, done := s.queue.Get()
+			if done {
+				return
+			}
+			s.queue.Done(obj)
+			if disableWrite {
+				return
+			}
+			name := obj.(string)
+			item, ok := store.Get(name)
+			if !ok {
+				klog.V(5).Infof("No comments for %s", name)
+				continue
+			}
+			if err := s.Write(item); err != nil {
+				klog.Errorf("failed to write %s: %v", name, err)
+			}
+		}
+	}, time.Second)
+}
+
+func (s *DiskStore) NotifyChanged(name string) {
+	s.queue.Add(name)
+}
+
+// Sync returns the items saved to disk, removing expired files and, if keys is
+// not nil, the files of items not in keys.
+func (s *DiskStore) Sync(keys []string) ([]Item, error) {
+	var known sets.String
+	if keys != nil {
+		known = sets.NewString(keys...)
+	}
+	start := time.Now()
+	mustExpire := s.maxAge != 0
+	expiredAt := start.Add(-s.maxAge)
+	tempExpiredAfter := start.Add(-15 * time.Minute)
+	prefix := s.format.Prefix()
+
+	items := make([]Item, 0, 2048)
+
+	err := walk.Walk(s.base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		if mustExpire && expiredAt.After(info.ModTime()) {
+			s.remove(path)
+			klog.V(5).Infof("File expired: %s", path)
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), "z-"+prefix) {
+			if tempExpiredAfter.After(info.ModTime()) {
+				s.remove(path)
+				klog.V(5).Infof("Temporary file expired: %s", path)
+			}
+			return nil
+		}
+		if !strings.HasPrefix(info.Name(), prefix) {
+			return nil
+		}
+		name, err := s.format.ItemName(info.Name())
+		if err != nil {
+			s.remove(path)
+			klog.V(5).Infof("File has invalid name: %s", path)
+			return nil
+		}
+		if known != nil && !known.Has(name) {
+			s.remove(path)
+			klog.V(5).Infof("Item is not in the known list: %s", path)
+			return nil
+		}
+
+		item, err := s.format.Read(path, info.ModTime())
+		if err != nil {
+			return fmt.Errorf("unable to read %q: %v", path, err)
+		}
+		if item == nil {
+			s.remove(path)
+			klog.V(5).Infof("Item has no comments: %s", path)
+			return nil
+		}
+		if item.GetName() != name {
+			return fmt.Errorf("file has path %q but name is %s", path, item.GetName())
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Close saves item marked closed, so that searches still find it once it
+// leaves the tracker query.
+func (s *DiskStore) Close(item Item) error {
+	if err := s.Write(s.format.Closed(item)); err != nil {
+		return fmt.Errorf("could not mark %s closed due to write error: %v", item.GetName(), err)
+	}
+	return nil
+}
+
+// Path returns the path item is saved to.
+func (s *DiskStore) Path(item Item) string {
+	return filepath.Join(s.base, s.format.FileName(item))
+}
+
+// Write saves item to disk and indexes its trigrams.
+func (s *DiskStore) Write(item Item) error {
+	name := s.format.FileName(item)
+	path, finalPath := filepath.Join(s.base, "z-"+name), filepath.Join(s.base, name)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if err := s.format.Write(w, item); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	refreshed := item.Refreshed()
+	if err := os.Chtimes(path, refreshed, refreshed); err != nil {
+		os.Remove(path)
+		return err
+	}
+	if err := os.Rename(path, finalPath); err != nil {
+		return err
+	}
+	if err := trigram.WriteFile(finalPath); err != nil {
+		klog.Errorf("Unable to index trigrams of %s: %v", finalPath, err)
+	}
+	return nil
+}
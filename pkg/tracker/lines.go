@@ -0,0 +1,63 @@
+package tracker
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// LineSafe returns s on a single line, with newlines replaced by spaces.
+func LineSafe(s string) string {
+	return strings.TrimSpace(strings.Replace(s, "\n", " ", -1))
+}
+
+// ArrayLineSafe joins the values of arr made line safe with delim.
+func ArrayLineSafe(arr []string, delim string) string {
+	inputs := make([]string, 0, len(arr))
+	for _, s := range arr {
+		inputs = append(inputs, LineSafe(s))
+	}
+	return strings.Join(inputs, delim)
+}
+
+// Scanner reads the files items are saved to: the header one line at a time,
+// then the comments one at a time.
+type Scanner struct {
+	*bufio.Scanner
+	comments bool
+}
+
+// NewScanner returns a Scanner over r that returns single lines until
+// ScanComments is invoked. Lines and comments may be up to 4MB.
+func NewScanner(r io.Reader) *Scanner {
+	s := &Scanner{Scanner: bufio.NewScanner(bufio.NewReader(r))}
+	s.Buffer(make([]byte, 4*1024), 4*1024*1024)
+	delim := []byte(CommentDelimiter)
+	s.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if !s.comments {
+			return bufio.ScanLines(data, atEOF)
+		}
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.Index(data, delim); i >= 0 {
+			// We have a full comment
+			return i + len(delim), data[0:i], nil
+		}
+		// If we're at EOF, we have a final, non-terminated comment. Return it.
+		if atEOF {
+			return len(data), data, nil
+		}
+		// Request more data.
+		return 0, nil, nil
+	})
+	return s
+}
+
+// ScanLines makes the following scans return single lines.
+func (s *Scanner) ScanLines() { s.comments = false }
+
+// ScanComments makes the following scans return the text up to the next
+// CommentDelimiter.
+func (s *Scanner) ScanComments() { s.comments = true }
@@ -0,0 +1,170 @@
+// Package tracker holds the logic shared by the packages that index the bugs
+// and issues of a tracker: a watch built from periodic searches for changed
+// items, a store that keeps the comments of each item, and the files those
+// items are saved to on disk.
+package tracker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog"
+)
+
+// Change is an item returned by a search for changed items.
+type Change struct {
+	Object runtime.Object
+	// Created is when the item was created.
+	Created time.Time
+	// Changed is when the item last changed.
+	Changed time.Time
+}
+
+// ChangesFunc returns the items that changed at or after since.
+type ChangesFunc func(since time.Time) ([]Change, error)
+
+// TimeToRV returns the resource version for a change time.
+func TimeToRV(t metav1.Time) string {
+	s, _ := t.MarshalQueryParameter()
+	return s
+}
+
+type periodicWatcher struct {
+	changes     ChangesFunc
+	ch          chan watch.Event
+	interval    time.Duration
+	maxInterval time.Duration
+	rv          metav1.Time
+
+	lock   sync.Mutex
+	done   chan struct{}
+	closed bool
+}
+
+// NewPeriodicWatcher returns a watch that searches for the items that changed
+// after rv every interval and sends them as added or modified events, oldest
+// change first. Trackers offer no way to observe deletions, so the watch
+// expires after maxInterval to force a new list.
+func NewPeriodicWatcher(interval, maxInterval time.Duration, rv metav1.Time, changes ChangesFunc) watch.Interface {
+	pw := &periodicWatcher{
+		changes:     changes,
+		interval:    interval,
+		maxInterval: maxInterval,
+		rv:          rv,
+		ch:          make(chan watch.Event, 100),
+		done:        make(chan struct{}),
+	}
+	go pw.run()
+	return pw
+}
+
+func (w *periodicWatcher) run() {
+	defer klog.V(7).Infof("Watcher exited")
+	defer close(w.ch)
+
+	// never watch longer than maxInterval
+	if w.maxInterval > 0 {
+		stop := time.After(w.maxInterval)
+		go func() {
+			select {
+			case <-stop:
+				klog.V(5).Infof("maximum duration reached %s", w.maxInterval)
+				w.ch <- watch.Event{Type: watch.Error, Object: &errors.NewResourceExpired(fmt.Sprintf("watch closed after %s, resync required", w.maxInterval)).ErrStatus}
+				w.stop()
+			case <-w.done:
+			}
+		}()
+	}
+
+	// a watch starts on the next visible change (which is a single second of precision for these queries)
+	rv := metav1.Time{Time: w.rv.Truncate(time.Second).Add(time.Second)}
+
+	var delay time.Duration
+	now := time.Now()
+	if d := rv.Time.Add(w.interval).Sub(now); d > 0 {
+		delay = d
+	} else {
+		delay = w.interval
+	}
+	klog.V(6).Infof("Waiting for minimum interval %s", delay)
+	select {
+	case <-time.After(delay):
+	case <-w.done:
+		return
+	}
+
+	wait.Until(func() {
+		changes, err := w.changes(rv.Time)
+		if err != nil {
+			klog.V(5).Infof("Search query error: %v", err)
+			w.ch <- watch.Event{Type: watch.Error, Object: &errors.NewInternalError(err).ErrStatus}
+			w.stop()
+			return
+		}
+		if len(changes) == 0 {
+			return
+		}
+
+		// like resource versions, the next change time has a precision of seconds
+		var next time.Time
+		for _, change := range changes {
+			if change.Changed.After(next) {
+				next = change.Changed
+			}
+		}
+		next = next.Truncate(time.Second)
+		if !next.After(rv.Time) {
+			klog.Errorf("The resource version for the current query %q is not after %q", TimeToRV(metav1.Time{Time: next}), TimeToRV(rv))
+			return
+		}
+
+		klog.V(5).Infof("Watch observed %d items with a change time since %s", len(changes), TimeToRV(rv))
+
+		// sort the list from oldest change to newest change
+		sort.SliceStable(changes, func(i, j int) bool {
+			return changes[i].Changed.Before(changes[j].Changed)
+		})
+		for _, change := range changes {
+			if change.Changed.Before(rv.Time) {
+				continue
+			}
+			eventType := watch.Modified
+			if !change.Created.Before(rv.Time) {
+				eventType = watch.Added
+			}
+			w.ch <- watch.Event{Type: eventType, Object: change.Object}
+		}
+		rv = metav1.Time{Time: next}
+	}, w.interval, w.done)
+}
+
+func (w *periodicWatcher) Stop() {
+	defer func() {
+		// drain the channel if stop was invoked until the channel is closed
+		for range w.ch {
+		}
+	}()
+	w.stop()
+	klog.V(7).Infof("Stopped watch")
+}
+
+func (w *periodicWatcher) stop() {
+	klog.V(7).Infof("Stopping watch")
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.closed {
+		close(w.done)
+		w.closed = true
+	}
+}
+
+func (w *periodicWatcher) ResultChan() <-chan watch.Event {
+	return w.ch
+}
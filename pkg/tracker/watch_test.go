@@ -0,0 +1,54 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestNewPeriodicWatcher(t *testing.T) {
+	rv := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var calls []time.Time
+	w := NewPeriodicWatcher(10*time.Millisecond, 0, metav1.Time{Time: rv}, func(since time.Time) ([]Change, error) {
+		calls = append(calls, since)
+		if len(calls) > 1 {
+			return nil, nil
+		}
+		return []Change{
+			{Object: &metav1.Status{Message: "created"}, Created: rv.Add(2 * time.Minute), Changed: rv.Add(3 * time.Minute)},
+			{Object: &metav1.Status{Message: "modified"}, Created: rv.Add(-time.Hour), Changed: rv.Add(time.Minute)},
+			{Object: &metav1.Status{Message: "unchanged"}, Created: rv.Add(-time.Hour), Changed: rv.Add(-time.Minute)},
+		}, nil
+	})
+	defer w.Stop()
+
+	want := []struct {
+		eventType watch.EventType
+		message   string
+	}{
+		{watch.Modified, "modified"},
+		{watch.Added, "created"},
+	}
+	for _, expect := range want {
+		select {
+		case event := <-w.ResultChan():
+			if event.Type != expect.eventType || event.Object.(*metav1.Status).Message != expect.message {
+				t.Fatalf("unexpected event: %s %#v", event.Type, event.Object)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", expect.message)
+		}
+	}
+	select {
+	case event := <-w.ResultChan():
+		t.Fatalf("unexpected event: %s %#v", event.Type, event.Object)
+	case <-time.After(50 * time.Millisecond):
+	}
+	w.Stop()
+
+	if len(calls) < 2 || !calls[0].Equal(rv.Add(time.Second)) || !calls[1].Equal(rv.Add(3*time.Minute)) {
+		t.Errorf("unexpected searches: %v", calls)
+	}
+}
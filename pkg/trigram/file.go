@@ -0,0 +1,151 @@
+package trigram
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileHeader begins every trigram file and identifies the format version.
+const fileHeader = "tri1"
+
+// Path returns the location of the trigram file for the file at path. The name
+// begins with a dot so that it is not matched by the prefixes used to select
+// files for searching.
+func Path(path string) string {
+	dir, name := filepath.Split(path)
+	return filepath.Join(dir, "."+name+".trigrams")
+}
+
+// WriteFile extracts the trigrams of the file at path, decompressing it if it
+// has a .gz suffix, and saves them to the trigram file for path. The trigram
+// file has the same modification time as path so that it expires with it, and
+// the modification time of the parent directory is preserved.
+func WriteFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	trigrams, ok, err := extractFile(path)
+	if err != nil {
+		return err
+	}
+
+	dir, name := filepath.Split(path)
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+name+".trigrams-")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := writeTrigrams(w, trigrams, ok); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chtimes(f.Name(), info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), Path(path)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chtimes(dir, dirInfo.ModTime(), dirInfo.ModTime()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func extractFile(path string) ([]Trigram, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err == io.EOF {
+			return nil, true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	return Extract(r)
+}
+
+func writeTrigrams(w io.Writer, trigrams []Trigram, ok bool) error {
+	buf := make([]byte, 0, len(fileHeader)+1+binary.MaxVarintLen64*(len(trigrams)+1))
+	buf = append(buf, fileHeader...)
+	if !ok {
+		_, err := w.Write(append(buf, 0))
+		return err
+	}
+	buf = append(buf, 1)
+	var varint [binary.MaxVarintLen64]byte
+	buf = append(buf, varint[:binary.PutUvarint(varint[:], uint64(len(trigrams)))]...)
+	var last Trigram
+	for _, t := range trigrams {
+		buf = append(buf, varint[:binary.PutUvarint(varint[:], uint64(t-last))]...)
+		last = t
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFile returns the trigrams saved for the file at path. If the file had too
+// many trigrams to be indexed ok is false.
+func ReadFile(path string) (trigrams []Trigram, ok bool, err error) {
+	data, err := ioutil.ReadFile(Path(path))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) < len(fileHeader)+1 || string(data[:len(fileHeader)]) != fileHeader {
+		return nil, false, fmt.Errorf("%s is not a trigram file", Path(path))
+	}
+	data = data[len(fileHeader):]
+	if data[0] == 0 {
+		return nil, false, nil
+	}
+	data = data[1:]
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > MaxTrigrams {
+		return nil, false, fmt.Errorf("%s has an invalid trigram count", Path(path))
+	}
+	data = data[n:]
+	trigrams = make([]Trigram, 0, count)
+	var t Trigram
+	for i := uint64(0); i < count; i++ {
+		delta, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, false, fmt.Errorf("%s is truncated", Path(path))
+		}
+		data = data[n:]
+		t += Trigram(delta)
+		trigrams = append(trigrams, t)
+	}
+	return trigrams, true, nil
+}
@@ -0,0 +1,237 @@
+package trigram
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// Index is an in-memory inverted index from each trigram to the files that
+// contain it. Files that have not been added to the index are assumed to match
+// every query.
+type Index struct {
+	lock sync.RWMutex
+	// paths is the path of each document id, or empty if it was removed
+	paths    []string
+	ids      map[string]uint32
+	postings map[Trigram]*postingList
+	removed  int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		ids:      make(map[string]uint32),
+		postings: make(map[Trigram]*postingList),
+	}
+}
+
+// postingList is an ascending list of document ids encoded as varint deltas.
+type postingList struct {
+	last uint32
+	data []byte
+}
+
+func (l *postingList) add(id uint32) {
+	var buf [binary.MaxVarintLen32]byte
+	n := binary.PutUvarint(buf[:], uint64(id-l.last))
+	l.data = append(l.data, buf[:n]...)
+	l.last = id
+}
+
+func (l *postingList) ids() []uint32 {
+	var ids []uint32
+	var id uint32
+	for data := l.data; len(data) > 0; {
+		delta, n := binary.Uvarint(data)
+		data = data[n:]
+		id += uint32(delta)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Len returns the number of files in the index.
+func (idx *Index) Len() int {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	return len(idx.ids)
+}
+
+// Add records the trigrams of the file at path, replacing any previous entry.
+func (idx *Index) Add(path string, trigrams []Trigram) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	idx.remove(path)
+	id := uint32(len(idx.paths))
+	idx.paths = append(idx.paths, path)
+	idx.ids[path] = id
+	for _, t := range trigrams {
+		l, ok := idx.postings[t]
+		if !ok {
+			l = &postingList{}
+			idx.postings[t] = l
+		}
+		l.add(id)
+	}
+}
+
+// Remove forgets the file at path, which will then match every query.
+func (idx *Index) Remove(path string) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	idx.remove(path)
+}
+
+func (idx *Index) remove(path string) {
+	id, ok := idx.ids[path]
+	if !ok {
+		return
+	}
+	delete(idx.ids, path)
+	idx.paths[id] = ""
+	idx.removed++
+	if idx.removed > 1024 && idx.removed > len(idx.paths)/2 {
+		idx.compact()
+	}
+}
+
+// compact renumbers the documents in the index to drop removed ids from the
+// posting lists.
+func (idx *Index) compact() {
+	renumbered := make([]int64, len(idx.paths))
+	paths := make([]string, 0, len(idx.ids))
+	for id, path := range idx.paths {
+		if len(path) == 0 {
+			renumbered[id] = -1
+			continue
+		}
+		renumbered[id] = int64(len(paths))
+		idx.ids[path] = uint32(len(paths))
+		paths = append(paths, path)
+	}
+	for t, l := range idx.postings {
+		compacted := &postingList{}
+		for _, id := range l.ids() {
+			if newID := renumbered[id]; newID >= 0 {
+				compacted.add(uint32(newID))
+			}
+		}
+		if len(compacted.data) == 0 {
+			delete(idx.postings, t)
+			continue
+		}
+		idx.postings[t] = compacted
+	}
+	idx.paths = paths
+	idx.removed = 0
+}
+
+// Filter returns the paths that may match q, which are those that are not in
+// the index or whose trigrams satisfy q.
+func (idx *Index) Filter(q *Query, paths []string) []string {
+	if q == nil || q.Op == QAll {
+		return paths
+	}
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	matched := make([]uint64, len(idx.paths)/64+1)
+	for _, id := range idx.eval(q) {
+		matched[id>>6] |= 1 << (id & 63)
+	}
+	filtered := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if id, ok := idx.ids[path]; ok && matched[id>>6]&(1<<(id&63)) == 0 {
+			continue
+		}
+		filtered = append(filtered, path)
+	}
+	return filtered
+}
+
+// eval returns the ascending ids of the documents that match q.
+func (idx *Index) eval(q *Query) []uint32 {
+	switch q.Op {
+	case QAnd:
+		var ids []uint32
+		first := true
+		intersect := func(next []uint32) {
+			if first {
+				ids, first = next, false
+				return
+			}
+			ids = intersectIDs(ids, next)
+		}
+		for _, t := range q.Trigrams {
+			l, ok := idx.postings[t]
+			if !ok {
+				return nil
+			}
+			intersect(l.ids())
+			if len(ids) == 0 {
+				return nil
+			}
+		}
+		for _, sub := range q.Sub {
+			intersect(idx.eval(sub))
+			if len(ids) == 0 {
+				return nil
+			}
+		}
+		return ids
+	case QOr:
+		var ids []uint32
+		for _, t := range q.Trigrams {
+			if l, ok := idx.postings[t]; ok {
+				ids = unionIDs(ids, l.ids())
+			}
+		}
+		for _, sub := range q.Sub {
+			ids = unionIDs(ids, idx.eval(sub))
+		}
+		return ids
+	default:
+		ids := make([]uint32, 0, len(idx.paths))
+		for id := range idx.paths {
+			ids = append(ids, uint32(id))
+		}
+		return ids
+	}
+}
+
+func intersectIDs(a, b []uint32) []uint32 {
+	var out []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func unionIDs(a, b []uint32) []uint32 {
+	out := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
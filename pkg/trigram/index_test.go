@@ -0,0 +1,125 @@
+package trigram
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustQuery(t *testing.T, expr string) *Query {
+	q, err := RegexpQuery(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func mustExtract(t *testing.T, s string) []Trigram {
+	trigrams, _, err := Extract(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trigrams
+}
+
+func TestIndex_Filter(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("a", mustExtract(t, "timeout waiting for pod"))
+	idx.Add("b", mustExtract(t, "error: image pull failed"))
+	idx.Add("c", mustExtract(t, "TIMEOUT"))
+	paths := []string{"a", "b", "c", "unindexed"}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "timeout", want: []string{"a", "c", "unindexed"}},
+		{expr: "timeout waiting", want: []string{"a", "unindexed"}},
+		{expr: "pod|image", want: []string{"a", "b", "unindexed"}},
+		{expr: "missing", want: []string{"unindexed"}},
+		{expr: ".*", want: paths},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := idx.Filter(mustQuery(t, tt.expr), paths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	idx.Add("b", mustExtract(t, "timeout"))
+	idx.Remove("c")
+	if got, want := idx.Filter(mustQuery(t, "timeout"), paths), []string{"a", "b", "c", "unindexed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after update got %q, want %q", got, want)
+	}
+	if got, want := idx.Filter(mustQuery(t, "image"), paths), []string{"c", "unindexed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after update got %q, want %q", got, want)
+	}
+}
+
+func TestIndex_compact(t *testing.T) {
+	idx := NewIndex()
+	for i := 0; i < 3000; i++ {
+		idx.Add("a", mustExtract(t, "first"))
+		idx.Add("b", mustExtract(t, "second"))
+	}
+	if l := len(idx.paths); l > 2100 {
+		t.Fatalf("index was not compacted, has %d ids", l)
+	}
+	if got, want := idx.Filter(mustQuery(t, "second"), []string{"a", "b"}), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if idx.Len() != 2 {
+		t.Errorf("unexpected length %d", idx.Len())
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trigram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	at := time.Unix(1600000000, 0)
+	path := filepath.Join(dir, "build-log.txt.gz")
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	gw.Write([]byte("Timeout"))
+	gw.Close()
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(dir, at, at); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	trigrams, ok, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := trigramStrings(trigrams), []string{"eou", "ime", "meo", "out", "tim"}; !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q %t, want %q", got, ok, want)
+	}
+	for _, p := range []string{Path(path), dir} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(at) {
+			t.Errorf("%s has modification time %s, expected %s", p, info.ModTime(), at)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package trigram
+
+import (
+	"regexp/syntax"
+	"strings"
+)
+
+type QueryOp int
+
+const (
+	// QAll matches every file.
+	QAll QueryOp = iota
+	// QAnd matches files that contain all of the trigrams and match all of the
+	// sub queries.
+	QAnd
+	// QOr matches files that contain any of the trigrams or match any of the
+	// sub queries.
+	QOr
+)
+
+// Query describes the trigrams a file must contain to possibly match a regular
+// expression.
+type Query struct {
+	Op       QueryOp
+	Trigrams []Trigram
+	Sub      []*Query
+}
+
+var allQuery = &Query{Op: QAll}
+
+func (q *Query) String() string {
+	if q.Op == QAll {
+		return "+"
+	}
+	var parts []string
+	for _, t := range q.Trigrams {
+		parts = append(parts, t.String())
+	}
+	for _, sub := range q.Sub {
+		if sub.Op == QAnd && q.Op == QOr {
+			parts = append(parts, "("+sub.String()+")")
+			continue
+		}
+		parts = append(parts, sub.String())
+	}
+	if q.Op == QOr {
+		return "(" + strings.Join(parts, "|") + ")"
+	}
+	return strings.Join(parts, " ")
+}
+
+// RegexpQuery returns the query a file must match to possibly contain a match
+// for the Go regular expression expr.
+func RegexpQuery(expr string) (*Query, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	return analyze(re.Simplify()), nil
+}
+
+func analyze(re *syntax.Regexp) *Query {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return literalQuery(re.Rune)
+	case syntax.OpConcat:
+		// adjacent literals may have been split by flag changes, join them so
+		// trigrams that span the boundary are used
+		q := allQuery
+		var literal []rune
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral {
+				literal = append(literal, sub.Rune...)
+				continue
+			}
+			q = and(q, literalQuery(literal))
+			literal = nil
+			q = and(q, analyze(sub))
+		}
+		return and(q, literalQuery(literal))
+	case syntax.OpAlternate:
+		q := analyze(re.Sub[0])
+		for _, sub := range re.Sub[1:] {
+			q = or(q, analyze(sub))
+		}
+		return q
+	case syntax.OpCapture, syntax.OpPlus:
+		return analyze(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return analyze(re.Sub[0])
+		}
+	}
+	return allQuery
+}
+
+// literalQuery requires every trigram of runes. Non-ASCII runes are skipped
+// because case folding may match them against different bytes.
+func literalQuery(runes []rune) *Query {
+	q := allQuery
+	var run []byte
+	flush := func() {
+		if len(run) >= 3 {
+			lit := &Query{Op: QAnd}
+			for i := 0; i+3 <= len(run); i++ {
+				lit.Trigrams = append(lit.Trigrams, Trigram(run[i])<<16|Trigram(run[i+1])<<8|Trigram(run[i+2]))
+			}
+			q = and(q, lit)
+		}
+		run = run[:0]
+	}
+	for _, r := range runes {
+		switch {
+		case r >= 0x80:
+			flush()
+		case 'A' <= r && r <= 'Z':
+			run = append(run, byte(r+'a'-'A'))
+		default:
+			run = append(run, byte(r))
+		}
+	}
+	flush()
+	return q
+}
+
+func and(a, b *Query) *Query {
+	switch {
+	case a.Op == QAll:
+		return b
+	case b.Op == QAll:
+		return a
+	}
+	q := &Query{Op: QAnd}
+	for _, sub := range []*Query{a, b} {
+		if sub.Op == QAnd {
+			q.Trigrams = append(q.Trigrams, sub.Trigrams...)
+			q.Sub = append(q.Sub, sub.Sub...)
+			continue
+		}
+		q.Sub = append(q.Sub, sub)
+	}
+	return q
+}
+
+func or(a, b *Query) *Query {
+	if a.Op == QAll || b.Op == QAll {
+		return allQuery
+	}
+	q := &Query{Op: QOr}
+	for _, sub := range []*Query{a, b} {
+		if sub.Op == QOr {
+			q.Trigrams = append(q.Trigrams, sub.Trigrams...)
+			q.Sub = append(q.Sub, sub.Sub...)
+			continue
+		}
+		if sub.Op == QAnd && len(sub.Trigrams) == 1 && len(sub.Sub) == 0 {
+			q.Trigrams = append(q.Trigrams, sub.Trigrams[0])
+			continue
+		}
+		q.Sub = append(q.Sub, sub)
+	}
+	return q
+}
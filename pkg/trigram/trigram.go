@@ -0,0 +1,101 @@
+// Package trigram records the three byte sequences that occur in a file so that
+// a regular expression search can skip files that cannot contain a match.
+//
+// Content is folded to ASCII lowercase before it is indexed, so the index can
+// answer both case sensitive and case insensitive queries. Queries derived from
+// a regular expression are conservative: a file is only excluded when it is
+// missing a trigram that every match must contain.
+package trigram
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"sync"
+)
+
+// MaxTrigrams is the largest number of distinct trigrams recorded for a single
+// file. Files with more trigrams are not indexed and are always searched, since
+// they contain most of the trigrams in any query and would dominate the size of
+// the index.
+const MaxTrigrams = 50000
+
+// Trigram is three bytes of folded content packed into the low 24 bits.
+type Trigram uint32
+
+func (t Trigram) String() string {
+	return string([]byte{byte(t >> 16), byte(t >> 8), byte(t)})
+}
+
+// seenPool holds bitsets large enough to track every possible trigram.
+var seenPool = sync.Pool{
+	New: func() interface{} {
+		seen := make([]uint64, (1<<24)/64)
+		return &seen
+	},
+}
+
+// Extract returns the sorted, distinct trigrams of the folded content of r. If r
+// contains more than MaxTrigrams distinct trigrams ok is false and no trigrams
+// are returned.
+func Extract(r io.Reader) ([]Trigram, bool, error) {
+	seenp := seenPool.Get().(*[]uint64)
+	seen := *seenp
+	var trigrams []Trigram
+	defer func() {
+		// only the bits that were set need to be cleared before reuse
+		for _, t := range trigrams {
+			seen[t>>6] &^= 1 << (t & 63)
+		}
+		seenPool.Put(seenp)
+	}()
+
+	br := bufio.NewReaderSize(r, 64*1024)
+	var t Trigram
+	for n := 0; ; n++ {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		t = (t<<8 | Trigram(fold(br, c))) & 0xffffff
+		if n < 2 {
+			continue
+		}
+		if seen[t>>6]&(1<<(t&63)) != 0 {
+			continue
+		}
+		seen[t>>6] |= 1 << (t & 63)
+		trigrams = append(trigrams, t)
+		if len(trigrams) > MaxTrigrams {
+			return nil, false, nil
+		}
+	}
+	sort.Slice(trigrams, func(i, j int) bool { return trigrams[i] < trigrams[j] })
+	return trigrams, true, nil
+}
+
+// fold returns the ASCII lowercase form of c. The two non-ASCII runes that Go
+// regular expressions treat as case variants of ASCII letters, the Kelvin sign
+// and the long s, are read from br and replaced by the letter they fold to.
+func fold(br *bufio.Reader, c byte) byte {
+	switch {
+	case 'A' <= c && c <= 'Z':
+		return c + 'a' - 'A'
+	case c == 0xe2:
+		// U+212A KELVIN SIGN
+		if next, err := br.Peek(2); err == nil && next[0] == 0x84 && next[1] == 0xaa {
+			br.Discard(2)
+			return 'k'
+		}
+	case c == 0xc5:
+		// U+017F LATIN SMALL LETTER LONG S
+		if next, err := br.Peek(1); err == nil && next[0] == 0xbf {
+			br.Discard(1)
+			return 's'
+		}
+	}
+	return c
+}
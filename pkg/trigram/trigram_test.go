@@ -0,0 +1,98 @@
+package trigram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func trigramStrings(trigrams []Trigram) []string {
+	var out []string
+	for _, t := range trigrams {
+		out = append(out, t.String())
+	}
+	return out
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		ok    bool
+	}{
+		{name: "short", input: "ab", ok: true},
+		{name: "folds case", input: "AbCab", want: []string{"abc", "bca", "cab"}, ok: true},
+		{name: "folds kelvin sign", input: "oKy", want: []string{"oky"}, ok: true},
+		{name: "folds long s", input: "aſk", want: []string{"ask"}, ok: true},
+		{name: "spans lines", input: "a\nb", want: []string{"a\nb"}, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigrams, ok, err := Extract(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok {
+				t.Fatalf("unexpected ok %t", ok)
+			}
+			if got := trigramStrings(trigrams); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractTooManyTrigrams(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < MaxTrigrams; i++ {
+		b.WriteByte(byte(i))
+		b.WriteByte(byte(i >> 8))
+	}
+	trigrams, ok, err := Extract(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || trigrams != nil {
+		t.Fatalf("expected file to be too large to index, got %d trigrams", len(trigrams))
+	}
+	// the shared bitset must be cleared for the next caller
+	trigrams, _, _ = Extract(strings.NewReader("abc"))
+	if got := trigramStrings(trigrams); !reflect.DeepEqual(got, []string{"abc"}) {
+		t.Errorf("unexpected trigrams after overflow: %q", got)
+	}
+}
+
+func TestRegexpQuery(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "ab", want: "+"},
+		{expr: "Error", want: "err rro ror"},
+		{expr: "(?i)timeout", want: "tim ime meo eou out"},
+		{expr: "foo.*bar", want: "foo bar"},
+		{expr: "a(?i)bcd", want: "abc bcd"},
+		{expr: "error|fail", want: "((err rro ror)|(fai ail))"},
+		{expr: "errors?", want: "err rro ror"},
+		{expr: "(timeout)+waiting", want: "tim ime meo eou out wai ait iti tin ing"},
+		{expr: "error|f", want: "+"},
+		{expr: "x*", want: "+"},
+		{expr: "cafés", want: "caf"},
+		{expr: "oKy", want: "+"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := RegexpQuery(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := RegexpQuery("("); err == nil {
+		t.Errorf("expected invalid expression to return an error")
+	}
+}
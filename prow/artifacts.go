@@ -0,0 +1,169 @@
+package prow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ArtifactRule describes the artifacts of a job run that are downloaded so
+// they can be searched. Every artifact of a run that matches the rule is
+// saved into a single local file.
+type ArtifactRule struct {
+	// Name is the search type that selects the saved files, such as
+	// "build-log".
+	Name string `json:"name"`
+	// Glob matches the path of an artifact relative to the run. A "*" matches
+	// within a single path segment and a "**" segment matches any number of
+	// segments, so "**/pods/*.log" matches the pod logs of every step.
+	Glob string `json:"glob"`
+	// Filename is the name of the local file the artifacts are saved to.
+	Filename string `json:"filename"`
+	// MaxBytes skips artifacts larger than this many bytes. Zero means no
+	// limit.
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+	// TailBytes downloads only the last bytes of each artifact. Zero
+	// downloads the whole artifact.
+	TailBytes int64 `json:"tailBytes,omitempty"`
+	// IncludePassing downloads the artifacts of runs that succeeded as well
+	// as those that failed.
+	IncludePassing bool `json:"includePassing,omitempty"`
+}
+
+// ArtifactConfig is the file format of the artifact rules and sources.
+type ArtifactConfig struct {
+	Artifacts []ArtifactRule         `json:"artifacts"`
+	Sources   []ArtifactSourceConfig `json:"sources,omitempty"`
+}
+
+// DefaultArtifactRules capture the end of the build log of failed runs.
+var DefaultArtifactRules = []ArtifactRule{
+	{Name: "build-log", Glob: "build-log.txt", Filename: "build-log.txt", TailBytes: 20 * 1024 * 1024},
+}
+
+// reservedSearchTypes are the search types of job runs that do not select
+// artifacts. The search types of trackers are passed to LoadArtifactConfig.
+var reservedSearchTypes = []string{"all", "junit"}
+
+var artifactNameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// LoadArtifactConfig reads the YAML or JSON file at path. The configured rules
+// follow the default rules, which a rule with the same name replaces. Rules may
+// not be named after one of the reserved search types, such as those of the
+// indexed trackers.
+func LoadArtifactConfig(path string, reserved []string) (*ArtifactConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config ArtifactConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	var rules []ArtifactRule
+	for _, rule := range DefaultArtifactRules {
+		replaced := false
+		for _, configured := range config.Artifacts {
+			if configured.Name == rule.Name {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			rules = append(rules, rule)
+		}
+	}
+	rules = append(rules, config.Artifacts...)
+	if err := ValidateArtifactRules(rules, reserved); err != nil {
+		return nil, fmt.Errorf("invalid artifact rules in %s: %v", path, err)
+	}
+	config.Artifacts = rules
+	if err := ValidateArtifactSources(config.Sources); err != nil {
+		return nil, fmt.Errorf("invalid artifact sources in %s: %v", path, err)
+	}
+	return &config, nil
+}
+
+// ValidateArtifactRules returns an error if a rule is incomplete, if two rules
+// would save to the same file or search type, or if a rule is named after a
+// search type in reserved.
+func ValidateArtifactRules(rules []ArtifactRule, reserved []string) error {
+	names := make(map[string]struct{})
+	filenames := make(map[string]struct{})
+	for i, rule := range rules {
+		if !artifactNameRE.MatchString(rule.Name) {
+			return fmt.Errorf("rule %d: name must be lowercase letters, numbers and dashes", i)
+		}
+		for _, searchType := range append(reservedSearchTypes, reserved...) {
+			if rule.Name == searchType {
+				return fmt.Errorf("rule %d: name %q is reserved", i, rule.Name)
+			}
+		}
+		if _, ok := names[rule.Name]; ok {
+			return fmt.Errorf("rule %d: name %q is already used", i, rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+
+		switch {
+		case len(rule.Filename) == 0, strings.ContainsAny(rule.Filename, `/\`), strings.HasPrefix(rule.Filename, "."):
+			return fmt.Errorf("rule %d: filename must be a file name", i)
+		case strings.HasPrefix(rule.Filename, "junit."), strings.HasSuffix(rule.Filename, ".gz"):
+			return fmt.Errorf("rule %d: filename %q is reserved", i, rule.Filename)
+		}
+		for other := range filenames {
+			if strings.HasPrefix(rule.Filename, other) || strings.HasPrefix(other, rule.Filename) {
+				return fmt.Errorf("rule %d: filename %q overlaps with %q", i, rule.Filename, other)
+			}
+		}
+		filenames[rule.Filename] = struct{}{}
+
+		if len(rule.Glob) == 0 || strings.HasPrefix(rule.Glob, "/") {
+			return fmt.Errorf("rule %d: glob must be a path relative to the run", i)
+		}
+		for _, segment := range strings.Split(rule.Glob, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("rule %d: glob is invalid: %v", i, err)
+			}
+		}
+		if rule.MaxBytes < 0 || rule.TailBytes < 0 {
+			return fmt.Errorf("rule %d: maxBytes and tailBytes must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the artifact at the slash-separated path relative to
+// the run matches the rule.
+func (r *ArtifactRule) Matches(rel string) bool {
+	return matchSegments(strings.Split(r.Glob, "/"), strings.Split(rel, "/"))
+}
+
+// hasWildcards returns true if the rule may match more than one artifact.
+func (r *ArtifactRule) hasWildcards() bool {
+	return strings.ContainsAny(r.Glob, `*?[`)
+}
+
+func matchSegments(patterns, segments []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(patterns[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(patterns[0], segments[0]); !ok {
+			return false
+		}
+		patterns, segments = patterns[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
@@ -0,0 +1,118 @@
+package prow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArtifactRule_Matches(t *testing.T) {
+	tests := []struct {
+		glob string
+		rel  string
+		want bool
+	}{
+		{glob: "build-log.txt", rel: "build-log.txt", want: true},
+		{glob: "build-log.txt", rel: "artifacts/build-log.txt"},
+		{glob: "artifacts/*/gather-extra/events.json", rel: "artifacts/e2e-aws/gather-extra/events.json", want: true},
+		{glob: "artifacts/*/gather-extra/events.json", rel: "artifacts/e2e-aws/step/gather-extra/events.json"},
+		{glob: "**/pods/*.log", rel: "pods/etcd.log", want: true},
+		{glob: "**/pods/*.log", rel: "artifacts/e2e-aws/gather-extra/pods/etcd.log", want: true},
+		{glob: "**/pods/*.log", rel: "artifacts/e2e-aws/gather-extra/pods/etcd/current.log"},
+		{glob: "artifacts/**", rel: "artifacts/a/b", want: true},
+	}
+	for _, tt := range tests {
+		rule := ArtifactRule{Glob: tt.glob}
+		if got := rule.Matches(tt.rel); got != tt.want {
+			t.Errorf("%q matching %q = %t, want %t", tt.glob, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestLoadArtifactRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		config    string
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			name: "adds to the defaults",
+			config: `artifacts:
+- name: events
+  glob: artifacts/*/gather-extra/events.json
+  filename: events.json
+  maxBytes: 10000000
+- name: pod-logs
+  glob: "**/pods/*.log"
+  filename: pod-logs.txt
+  tailBytes: 1000000
+  includePassing: true
+`,
+			wantNames: []string{"build-log", "events", "pod-logs"},
+		},
+		{
+			name: "replaces a default",
+			config: `artifacts:
+- name: build-log
+  glob: build-log.txt
+  filename: build-log.txt
+  includePassing: true
+`,
+			wantNames: []string{"build-log"},
+		},
+		{
+			name:    "reserved name",
+			config:  "artifacts:\n- name: junit\n  glob: '*.xml'\n  filename: junit.xml\n",
+			wantErr: "reserved",
+		},
+		{
+			name:    "tracker search type",
+			config:  "artifacts:\n- name: github-issue\n  glob: issue.json\n  filename: issue.json\n",
+			wantErr: "reserved",
+		},
+		{
+			name:    "overlapping filename",
+			config:  "artifacts:\n- name: build\n  glob: build.log\n  filename: build-log.txt.1\n",
+			wantErr: "overlaps",
+		},
+		{
+			name:    "unknown field",
+			config:  "artifacts:\n- name: events\n  glob: events.json\n  file: events.json\n",
+			wantErr: "unable to parse",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadArtifactConfig(path, []string{"bug", "issue", "github-issue"})
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, rule := range config.Artifacts {
+				names = append(names, rule.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("unexpected rules: %v", names)
+			}
+		})
+	}
+}
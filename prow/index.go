@@ -3,15 +3,14 @@ package prow
 import (
 	"context"
 	"fmt"
-	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
@@ -43,20 +42,24 @@ func init() {
 }
 
 type DiskStore struct {
-	base   string
-	maxAge time.Duration
-	queue  workqueue.RateLimitingInterface
-	client *storage.Client
+	base    string
+	maxAge  time.Duration
+	rules   []ArtifactRule
+	queue   workqueue.RateLimitingInterface
+	sources *ArtifactSources
 }
 
-func NewDiskStore(client *storage.Client, path string, maxAge time.Duration) *DiskStore {
+// NewDiskStore downloads the artifacts of completed jobs matching rules from
+// sources into path.
+func NewDiskStore(sources *ArtifactSources, path string, maxAge time.Duration, rules []ArtifactRule) *DiskStore {
 	rate := workqueue.NewItemExponentialFailureRateLimiter(time.Minute, 30*time.Minute)
 	queue := workqueue.NewRateLimitingQueue(rate)
 	return &DiskStore{
-		base:   path,
-		maxAge: maxAge,
-		queue:  queue,
-		client: client,
+		base:    path,
+		maxAge:  maxAge,
+		rules:   rules,
+		queue:   queue,
+		sources: sources,
 	}
 }
 
@@ -77,6 +80,10 @@ func (s *DiskStore) Handler() cache.ResourceEventHandler {
 			if !ok {
 				return false
 			}
+			// ingested runs are saved when they are pushed
+			if _, ok := job.Labels[IngestedLabel]; ok {
+				return false
+			}
 			switch job.Status.State {
 			case "aborted", "error", "failure", "success":
 				if len(job.Status.URL) == 0 || job.Status.CompletionTime.IsZero() {
@@ -163,22 +170,22 @@ func (s *DiskStore) Run(ctx context.Context, accessor JobAccessor, notifier Path
 }
 
 func (s *DiskStore) write(ctx context.Context, job *Job, notifier PathNotifier) ([]string, error) {
+	return s.download(ctx, job, job.Status.CompletionTime.Time)
+}
+
+// download saves the run of job unless it was saved after modifiedBefore and
+// returns the paths of the files it saved.
+func (s *DiskStore) download(ctx context.Context, job *Job, modifiedBefore time.Time) ([]string, error) {
 	if job.Status.State == "error" && job.Status.URL == "https://github.com/kubernetes/test-infra/issues" {
 		metricScrapedJobsIgnored.Add(1)
 		return nil, nil
 	}
-	u, err := url.Parse(job.Status.URL)
+	bucket, bucketPath, parts, err := s.sources.ForJob(job.Status.URL)
 	if err != nil {
 		metricScrapedJobsFailed.Add(1)
 		return nil, fmt.Errorf("job %s has no valid status URL: %v", job.Name, err)
 	}
-
-	bucket, _, _, _, parts, err := jobPathToAttributes(u.Path, job.Status.URL)
-	if err != nil {
-		metricScrapedJobsFailed.Add(1)
-		return nil, err
-	}
-	if len(bucket) == 0 {
+	if len(bucketPath) == 0 {
 		// This typically indicates that Prow changed in an unexpected way, perhaps by altering the
 		// URL it reports to jobs.
 		klog.Infof("Job URL cannot be indexed, does not match expected structure: %s", job.Status.URL)
@@ -187,13 +194,13 @@ func (s *DiskStore) write(ctx context.Context, job *Job, notifier PathNotifier)
 	}
 
 	build := Build{
-		Bucket:     s.client.Bucket(bucket),
+		Bucket:     bucket,
 		Context:    ctx,
-		BucketPath: bucket,
+		BucketPath: bucketPath,
 		Prefix:     path.Join(parts...) + "/",
 	}
 	start := time.Now()
-	accumulator, stale := NewAccumulator(s.base, &build, job.Status.CompletionTime.Time)
+	accumulator, stale := NewAccumulator(s.base, &build, modifiedBefore, s.rules)
 	if !stale {
 		klog.V(7).Infof("Job %s is up to date", job.Status.URL)
 		return nil, nil
@@ -209,7 +216,31 @@ func (s *DiskStore) write(ctx context.Context, job *Job, notifier PathNotifier)
 	}
 	klog.V(2).Infof("Download %s succeeded in %s", job.Status.URL, time.Now().Sub(start).Truncate(time.Millisecond))
 	metricScrapedJobs.Add(1)
-	return nil, nil
+	return accumulator.Written(), nil
+}
+
+// Backfill downloads the runs sent on jobs with at most workers at a time and
+// calls fn with the result of each. Runs that were saved before are read again
+// so that artifacts added to the rules since are saved, while files that
+// already exist are kept. It returns once jobs is closed and every run is done.
+func (s *DiskStore) Backfill(ctx context.Context, jobs <-chan *Job, workers int, fn func(job *Job, err error)) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				ctx, cancelFn := context.WithTimeout(ctx, time.Minute)
+				_, err := s.download(ctx, job, time.Time{})
+				cancelFn()
+				lock.Lock()
+				fn(job, err)
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
 }
 
 func (s *DiskStore) pathForJob(job *Job) string {
@@ -255,11 +286,20 @@ func jobPathToAttributes(path, full string) (bucket, trigger, job, buildID strin
 	}
 
 	bucket = parts[2]
-	trigger = parts[3]
+	trigger, job, buildID, parts, err = runPathToAttributes(parts[3:], full)
+	return
+}
+
+// runPathToAttributes parses the path of a run within its bucket, which starts
+// with logs or pr-logs, and returns the path segments that form the run prefix.
+func runPathToAttributes(parts []string, full string) (trigger, job, buildID string, _ []string, err error) {
+	if len(parts) < 2 {
+		err = fmt.Errorf("unrecognized run path %q in %s", strings.Join(parts, "/"), full)
+		return
+	}
+	trigger = parts[0]
 	switch trigger {
 	case "logs":
-		parts = parts[3:]
-
 		switch {
 		case len(parts) == 3:
 		case len(parts) == 4:
@@ -274,11 +314,9 @@ func jobPathToAttributes(path, full string) (bucket, trigger, job, buildID strin
 			err = fmt.Errorf("unrecognized logs path %q in %s", strings.Join(parts, "/"), full)
 			return
 		}
-		return
+		return trigger, job, buildID, parts, nil
 
 	case "pr-logs":
-		parts = parts[3:]
-
 		switch {
 		case len(parts) == 6 && parts[1] == "pull":
 		case len(parts) == 5 && parts[1] == "pull" && parts[2] == "batch":
@@ -298,10 +336,10 @@ func jobPathToAttributes(path, full string) (bucket, trigger, job, buildID strin
 			err = fmt.Errorf("unrecognized logs path %q in %s", strings.Join(parts, "/"), full)
 			return
 		}
-		return
+		return trigger, job, buildID, parts, nil
 
 	default:
-		err = fmt.Errorf("unrecognized job prefix type %q in %s", parts[3], full)
+		err = fmt.Errorf("unrecognized job prefix type %q in %s", trigger, full)
 		return
 	}
 }
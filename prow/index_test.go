@@ -0,0 +1,92 @@
+package prow
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiskStore_Backfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	finished := time.Now().Add(-time.Hour).Truncate(time.Second)
+	files := map[string]string{
+		"logs/job/1/started.json":                  `{"timestamp":1600000000}`,
+		"logs/job/1/finished.json":                 `{"timestamp":1600000600,"result":"FAILURE"}`,
+		"logs/job/1/build-log.txt":                 "error: timed out\n",
+		"logs/job/1/artifacts/e2e/events.json":     `{"reason":"BackOff"}`,
+		"logs/job/1/artifacts/junit/junit_e2e.xml": `<testsuite name="e2e"><testcase name="fails"><failure>boom</failure></testcase></testsuite>`,
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, "artifacts", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configs := []ArtifactSourceConfig{{Prefix: "https://files.example.com/ci/", Type: "local", URL: filepath.Join(dir, "artifacts")}}
+	if err := ValidateArtifactSources(configs); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := NewArtifactSources(nil, configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &Job{
+		Spec: JobSpec{Job: "job"},
+		Status: JobStatus{
+			State:          "failure",
+			URL:            "https://files.example.com/ci/logs/job/1",
+			BuildID:        "1",
+			CompletionTime: metav1.Time{Time: finished},
+		},
+	}
+	runPath := filepath.Join(dir, "jobs", "ci", "logs", "job", "1")
+
+	backfill := func(rules []ArtifactRule) {
+		store := NewDiskStore(sources, filepath.Join(dir, "jobs"), 0, rules)
+		jobs := make(chan *Job, 2)
+		jobs <- job
+		jobs <- &Job{Spec: JobSpec{Job: "job"}, Status: JobStatus{URL: "https://files.example.com/ci/logs/job/latest"}}
+		close(jobs)
+		var failed int
+		store.Backfill(context.Background(), jobs, 2, func(job *Job, err error) {
+			if err != nil {
+				failed++
+			}
+		})
+		if failed != 1 {
+			t.Fatalf("expected only the invalid run to fail, got %d failures", failed)
+		}
+	}
+
+	backfill(DefaultArtifactRules)
+	for _, name := range []string{"junit.failures", TestFailuresFile, "build-log.txt"} {
+		if _, err := os.Stat(filepath.Join(runPath, name)); err != nil {
+			t.Errorf("expected %s to be saved: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(runPath, "events.json")); !os.IsNotExist(err) {
+		t.Fatalf("unexpected events: %v", err)
+	}
+
+	// a run that is up to date is read again when a rule is added
+	rules := append([]ArtifactRule{}, DefaultArtifactRules...)
+	rules = append(rules, ArtifactRule{Name: "events", Glob: "artifacts/*/events.json", Filename: "events.json"})
+	backfill(rules)
+	if data, err := ioutil.ReadFile(filepath.Join(runPath, "events.json")); err != nil || !strings.HasSuffix(string(data), `{"reason":"BackOff"}`) {
+		t.Errorf("unexpected events: %q %v", data, err)
+	}
+}
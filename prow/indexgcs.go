@@ -41,43 +41,10 @@ func (l *CachingLister) ListJobs(ctx context.Context) ([]*Job, error) {
 // them. Jobs older than maxAge are not loaded. statusURL will form the status URL for a given job if the job's link attribute in the
 // index can be parsed.
 func ReadFromIndex(ctx context.Context, client *storage.Client, bucket, indexName string, maxAge time.Duration, statusURL url.URL) ([]*Job, error) {
-	index := &Index{
-		Bucket:    bucket,
-		IndexName: indexName,
-	}
-
 	start := time.Now()
-	index.FromTime(start.Add(-maxAge))
-	index.ToTime(start)
-
 	jobs := make([]*Job, 0, 2048)
-	i := 0
-	if err := index.EachJob(ctx, client, 0, statusURL, func(job Job, attr *storage.ObjectAttrs) error {
-		state, ok := attr.Metadata["state"]
-		if !ok {
-			return nil
-		}
-		completedString, ok := attr.Metadata["completed"]
-		if !ok {
-			return nil
-		}
-		completed, err := strconv.ParseInt(completedString, 10, 64)
-		if err != nil {
-			return nil
-		}
-		switch state {
-		case "success":
-		case "failed":
-			state = "failure"
-		case "error":
-		default:
-			return nil
-		}
-		i++
-		job.Name = fmt.Sprintf("gcs-%d", i)
-		job.Status.State = state
-		job.Status.CompletionTime = metav1.Time{Time: time.Unix(completed, 0)}
-		jobs = append(jobs, &job)
+	if err := EachJobInIndex(ctx, client, bucket, indexName, start.Add(-maxAge), start, statusURL, func(job *Job) error {
+		jobs = append(jobs, job)
 		return nil
 	}); err != nil {
 		if err == ctx.Err() {
@@ -89,6 +56,56 @@ func ReadFromIndex(ctx context.Context, client *storage.Client, bucket, indexNam
 	return jobs, nil
 }
 
+// EachJobInIndex calls fn with each completed job in the named GCS bucket index that finished between from and to. statusURL
+// forms the status URL of each job as in ReadFromIndex.
+func EachJobInIndex(ctx context.Context, client *storage.Client, bucket, indexName string, from, to time.Time, statusURL url.URL, fn func(job *Job) error) error {
+	index := &Index{
+		Bucket:    bucket,
+		IndexName: indexName,
+	}
+	index.FromTime(from)
+	index.ToTime(to)
+
+	return index.EachJob(ctx, client, 0, statusURL, func(job Job, attr *storage.ObjectAttrs) error {
+		indexed, ok := indexedJob(job, attr)
+		if !ok {
+			return nil
+		}
+		return fn(indexed)
+	})
+}
+
+// indexedJob completes job with the state and completion time in the index
+// metadata attr, or returns false if the job has not finished. The job is named
+// after its job name and build ID, so that the same run has the same name in
+// every scan and in the jobs restored from a snapshot.
+func indexedJob(job Job, attr *storage.ObjectAttrs) (*Job, bool) {
+	state, ok := attr.Metadata["state"]
+	if !ok {
+		return nil, false
+	}
+	completedString, ok := attr.Metadata["completed"]
+	if !ok {
+		return nil, false
+	}
+	completed, err := strconv.ParseInt(completedString, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	switch state {
+	case "success":
+	case "failed":
+		state = "failure"
+	case "error":
+	default:
+		return nil, false
+	}
+	job.Name = fmt.Sprintf("gcs-%s-%s", job.Spec.Job, job.Status.BuildID)
+	job.Status.State = state
+	job.Status.CompletionTime = metav1.Time{Time: time.Unix(completed, 0)}
+	return &job, true
+}
+
 var (
 	ErrSkip = fmt.Errorf("skip index data")
 	ErrStop = fmt.Errorf("stop index scan")
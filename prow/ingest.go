@@ -0,0 +1,303 @@
+package prow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/openshift/ci-search/testgrid/metadata"
+	"github.com/openshift/ci-search/testgrid/metadata/junit"
+)
+
+const (
+	// IngestBucket is the directory under the jobs path that runs pushed by
+	// other CI systems are saved in.
+	IngestBucket = "ingest"
+	// IngestedLabel marks the jobs listed by an IngestStore.
+	IngestedLabel = "search.openshift.io/ingested"
+
+	ingestJobFile = "job.json"
+)
+
+// IngestRun is a run of a job in a CI system other than Prow.
+type IngestRun struct {
+	Job      string
+	BuildID  string
+	State    string
+	URL      string
+	Started  time.Time
+	Finished time.Time
+	// JUnit holds the contents of each JUnit XML file of the run.
+	JUnit [][]byte
+	// BuildLog is the optional log of the run.
+	BuildLog []byte
+}
+
+var ingestJobNameRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Validate returns an error if the run cannot be saved.
+func (r *IngestRun) Validate() error {
+	if !ingestJobNameRE.MatchString(r.Job) {
+		return fmt.Errorf("job must be letters, numbers, dots, dashes and underscores")
+	}
+	if _, err := strconv.ParseUint(r.BuildID, 10, 64); err != nil {
+		return fmt.Errorf("build must be a number")
+	}
+	switch r.State {
+	case "aborted", "error", "failure", "success":
+	default:
+		return fmt.Errorf("state must be one of aborted, error, failure, or success")
+	}
+	if len(r.URL) == 0 {
+		return fmt.Errorf("url is required")
+	}
+	if r.Started.IsZero() || r.Finished.IsZero() || r.Finished.Before(r.Started) {
+		return fmt.Errorf("started and finished are required and finished may not be before started")
+	}
+	for i, data := range r.JUnit {
+		if _, err := junit.Parse(data); err != nil {
+			return fmt.Errorf("junit file %d is invalid: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// IngestStore saves pushed runs into the jobs path with the same pipeline as
+// the runs read from Prow, and lists them as jobs so they are counted in job
+// statistics.
+type IngestStore struct {
+	base   string
+	maxAge time.Duration
+	rules  []ArtifactRule
+
+	lock sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewIngestStore saves runs under the ingest bucket of the jobs path base.
+func NewIngestStore(base string, maxAge time.Duration, rules []ArtifactRule) *IngestStore {
+	return &IngestStore{
+		base:   base,
+		maxAge: maxAge,
+		rules:  rules,
+		jobs:   make(map[string]*Job),
+	}
+}
+
+// Load lists the runs that were saved before the process started.
+func (s *IngestStore) Load() error {
+	jobs := make(map[string]*Job)
+	root := filepath.Join(s.base, IngestBucket)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || info.Name() != ingestJobFile {
+			return nil
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			klog.Errorf("Unable to read ingested job %s: %v", p, err)
+			return nil
+		}
+		rel, err := filepath.Rel(s.base, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		jobs[filepath.ToSlash(rel)] = &job
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, job := range jobs {
+		if _, ok := s.jobs[key]; !ok {
+			s.jobs[key] = job
+		}
+	}
+	return nil
+}
+
+// ListJobs returns the ingested jobs that have not expired.
+func (s *IngestStore) ListJobs(ctx context.Context) ([]*Job, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for key, job := range s.jobs {
+		if s.maxAge > 0 && job.Status.CompletionTime.Time.Add(s.maxAge).Before(time.Now()) {
+			delete(s.jobs, key)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs, nil
+}
+
+// JobForRun returns the job saved in the slash-separated run directory
+// relative to the jobs path.
+func (s *IngestStore) JobForRun(dir string) (*Job, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	job, ok := s.jobs[dir]
+	return job, ok
+}
+
+// Ingest replaces any saved copy of the run with its JUnit failures, test
+// results and build log and returns the job it is listed as and the paths of
+// the files that were saved.
+func (s *IngestStore) Ingest(ctx context.Context, run *IngestRun) (*Job, []string, error) {
+	if err := run.Validate(); err != nil {
+		return nil, nil, err
+	}
+	prefix := path.Join("logs", run.Job, run.BuildID) + "/"
+	dir := path.Join(IngestBucket, prefix)
+	if err := os.RemoveAll(filepath.Join(s.base, filepath.FromSlash(dir))); err != nil {
+		return nil, nil, err
+	}
+
+	// the run is read from memory through the same accumulator as a run in
+	// a bucket
+	bucket := memoryBucket{name: IngestBucket, objects: make(map[string][]byte)}
+	finished := run.Finished.Unix()
+	passed := run.State == "success"
+	result := strings.ToUpper(run.State)
+	bucket.putJSON(prefix+"started.json", metadata.Started{Timestamp: run.Started.Unix()})
+	bucket.putJSON(prefix+"finished.json", metadata.Finished{Timestamp: &finished, Passed: &passed, Result: result})
+	for i, data := range run.JUnit {
+		bucket.objects[fmt.Sprintf("%sartifacts/junit_%d.xml", prefix, i)] = data
+	}
+	if run.BuildLog != nil {
+		bucket.objects[prefix+"build-log.txt"] = run.BuildLog
+	}
+
+	build := Build{
+		Bucket:     bucket,
+		Context:    ctx,
+		BucketPath: IngestBucket,
+		Prefix:     prefix,
+	}
+	accumulator, _ := NewAccumulator(s.base, &build, time.Time{}, s.rules)
+	if err := ReadBuild(build, accumulator); err != nil {
+		return nil, nil, err
+	}
+
+	job := &Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   fmt.Sprintf("%s-%s-%s", IngestBucket, run.Job, run.BuildID),
+			Labels: map[string]string{IngestedLabel: "true"},
+		},
+		Spec: JobSpec{Job: run.Job},
+		Status: JobStatus{
+			State:          run.State,
+			StartTime:      metav1.Time{Time: run.Started},
+			CompletionTime: metav1.Time{Time: run.Finished},
+			URL:            run.URL,
+			BuildID:        run.BuildID,
+		},
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobPath := filepath.Join(accumulator.path, ingestJobFile)
+	if err := ioutil.WriteFile(jobPath, data, 0644); err != nil {
+		return nil, nil, err
+	}
+	if err := os.Chtimes(jobPath, run.Finished, run.Finished); err != nil {
+		return nil, nil, err
+	}
+	if err := accumulator.MarkCompleted(run.Finished); err != nil {
+		return nil, nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.jobs[dir] = job
+	return job, accumulator.Written(), nil
+}
+
+// memoryBucket holds the files of a pushed run.
+type memoryBucket struct {
+	name    string
+	objects map[string][]byte
+}
+
+func (b memoryBucket) putJSON(name string, obj interface{}) {
+	data, _ := json.Marshal(obj)
+	b.objects[name] = data
+}
+
+func (b memoryBucket) String() string {
+	return b.name
+}
+
+func (b memoryBucket) Objects(ctx context.Context, prefix string, fn func(*storage.ObjectAttrs) error) error {
+	names := make([]string, 0, len(b.objects))
+	for name := range b.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fn(&storage.ObjectAttrs{Name: name, Size: int64(len(b.objects[name]))}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b memoryBucket) Attrs(ctx context.Context, name string) (*storage.ObjectAttrs, error) {
+	data, ok := b.objects[name]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	return &storage.ObjectAttrs{Name: name, Size: int64(len(data))}, nil
+}
+
+func (b memoryBucket) NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	data, ok := b.objects[name]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	if offset < 0 {
+		offset += int64(len(data))
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
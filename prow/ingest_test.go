@@ -0,0 +1,79 @@
+package prow
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIngestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	finished := time.Now().Add(-time.Hour).Truncate(time.Second)
+	run := &IngestRun{
+		Job:      "jenkins-e2e",
+		BuildID:  "12",
+		State:    "failure",
+		URL:      "https://jenkins.example.com/job/jenkins-e2e/12/",
+		Started:  finished.Add(-time.Hour),
+		Finished: finished,
+		JUnit: [][]byte{[]byte(`<testsuite name="e2e">
+<testcase name="passes"/>
+<testcase name="fails"><failure>timed out waiting for the condition</failure></testcase>
+</testsuite>`)},
+		BuildLog: []byte("error: timed out\n"),
+	}
+	store := NewIngestStore(dir, 0, DefaultArtifactRules)
+	job, written, err := store.Ingest(context.Background(), run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.Job != "jenkins-e2e" || job.Status.BuildID != "12" || job.Labels[IngestedLabel] != "true" {
+		t.Errorf("unexpected job: %#v", job)
+	}
+
+	runPath := filepath.Join(dir, IngestBucket, "logs", "jenkins-e2e", "12")
+	data, err := ioutil.ReadFile(filepath.Join(runPath, "junit.failures"))
+	if err != nil || !strings.Contains(string(data), "# fails\ntimed out waiting for the condition") {
+		t.Errorf("unexpected failures: %q %v", data, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(runPath, "build-log.txt")); err != nil || string(data) != "error: timed out\n" {
+		t.Errorf("unexpected build log: %q %v", data, err)
+	}
+	results, err := ReadTestResults(filepath.Join(runPath, TestResultsFile))
+	if err != nil || len(results.Passed[""]) != 1 {
+		t.Errorf("unexpected results: %#v %v", results, err)
+	}
+	if info, err := os.Stat(filepath.Join(runPath, TestFailuresFile)); err != nil || !info.ModTime().Equal(finished) {
+		t.Errorf("unexpected modification time: %v", err)
+	}
+	if want := []string{filepath.Join(runPath, TestResultsFile), filepath.Join(runPath, TestFailuresFile), filepath.Join(runPath, "junit.failures"), filepath.Join(runPath, "build-log.txt")}; !reflect.DeepEqual(written, want) {
+		t.Errorf("unexpected written files: %v", written)
+	}
+
+	reloaded := NewIngestStore(dir, 0, DefaultArtifactRules)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := reloaded.ListJobs(context.Background())
+	if err != nil || len(jobs) != 1 || jobs[0].Status.URL != run.URL || !jobs[0].Status.CompletionTime.Time.Equal(finished) {
+		t.Fatalf("unexpected jobs: %#v %v", jobs, err)
+	}
+	if job, ok := reloaded.JobForRun("ingest/logs/jenkins-e2e/12"); !ok || job.Name != "ingest-jenkins-e2e-12" {
+		t.Errorf("unexpected job for run: %#v", job)
+	}
+
+	run.BuildID = "latest"
+	if _, _, err := store.Ingest(context.Background(), run); err == nil {
+		t.Errorf("expected an invalid build to be rejected")
+	}
+}
@@ -31,7 +31,7 @@ func init() {
 	prometheus.MustRegister(metricDownloadedBytes)
 }
 
-// Build holds data to builds stored in GCS.
+// Build holds data to builds stored in a bucket.
 type Build = gcs.Build
 
 // Builds holds a slice of builds, which will sort naturally (aka 2 < 10).
@@ -52,7 +52,7 @@ type Accumulator interface {
 	LastUpdate() int64
 }
 
-// ReadBuild asynchronously downloads the files in build from gcs and convert them into a build.
+// ReadBuild asynchronously downloads the files in build from its bucket and convert them into a build.
 func ReadBuild(inputBuild Build, acc Accumulator) error {
 	var wg sync.WaitGroup                                                  // Each subtask does wg.Add(1), then we wg.Wait() for them to finish
 	ctx, cancel := context.WithTimeout(inputBuild.Context, 30*time.Second) // Allows aborting after first error
@@ -202,7 +202,7 @@ func Days(days int) time.Duration {
 	return time.Hour * 24 * time.Duration(days)
 }
 
-func NewAccumulator(base string, build *gcs.Build, modifiedBefore time.Time) (*LogAccumulator, bool) {
+func NewAccumulator(base string, build *gcs.Build, modifiedBefore time.Time, rules []ArtifactRule) (*LogAccumulator, bool) {
 	prefix := filepath.FromSlash(build.Prefix)
 	number := path.Base(build.Prefix)
 	buildPath := filepath.Join(base, build.BucketPath, prefix)
@@ -231,6 +231,7 @@ func NewAccumulator(base string, build *gcs.Build, modifiedBefore time.Time) (*L
 		number: number,
 
 		exists: exists,
+		rules:  rules,
 
 		hasMetadata: make(chan struct{}),
 	}, true
@@ -247,11 +248,17 @@ type LogAccumulator struct {
 	lastUpdate int64
 
 	exists map[string]struct{}
+	rules  []ArtifactRule
 
 	hasMetadata chan struct{}
 
 	lock     sync.Mutex
 	failures int
+	tests    []TestFailure
+	results  TestResults
+
+	// written are the files saved by Finished
+	written []string
 }
 
 func (a *LogAccumulator) MarkCompleted(at time.Time) error {
@@ -290,6 +297,12 @@ func (t *fileTail) Write(path string) error {
 }
 
 func (a *LogAccumulator) AddSuites(ctx context.Context, suites junit.Suites) {
+	tests := TestFailuresFromSuites(suites)
+	a.lock.Lock()
+	a.tests = append(a.tests, tests...)
+	a.results.AddSuites(suites)
+	a.lock.Unlock()
+
 	if _, ok := a.exists["junit.failures"]; ok {
 		return
 	}
@@ -373,21 +386,61 @@ func (a *LogAccumulator) Finished(ctx context.Context) {
 
 	at := time.Unix(a.finished, 0)
 
+	// record the test results before the directory time is set
+	if _, ok := a.exists[TestResultsFile]; !ok {
+		a.lock.Lock()
+		results := a.results
+		a.lock.Unlock()
+		results.Succeeded = a.succeeded
+		if err := WriteTestResults(filepath.Join(a.path, TestResultsFile), &results); err != nil {
+			klog.Errorf("Unable to record test results of %s: %v", a.path, err)
+		} else if err := os.Chtimes(filepath.Join(a.path, TestResultsFile), at, at); err != nil {
+			klog.Errorf("Unable to set modification time of %s to %d: %v", TestResultsFile, a.finished, err)
+		} else {
+			a.written = append(a.written, filepath.Join(a.path, TestResultsFile))
+		}
+	}
+	if _, ok := a.exists[TestFailuresFile]; !ok {
+		a.lock.Lock()
+		tests := a.tests
+		a.lock.Unlock()
+		if err := WriteTestFailures(filepath.Join(a.path, TestFailuresFile), tests); err != nil {
+			klog.Errorf("Unable to record test failures of %s: %v", a.path, err)
+		} else if err := os.Chtimes(filepath.Join(a.path, TestFailuresFile), at, at); err != nil {
+			klog.Errorf("Unable to set modification time of %s to %d: %v", TestFailuresFile, a.finished, err)
+		} else {
+			a.written = append(a.written, filepath.Join(a.path, TestFailuresFile))
+		}
+	}
+
 	// update the timestamps of things we always write
 	if err := os.Chtimes(a.path, at, at); err != nil && !os.IsNotExist(err) {
 		klog.Errorf("Unable to set modification time of %s to %d: %v", a.path, a.finished, err)
 	}
-	for _, file := range []string{"junit.failures", "build-log.txt", "build-log.txt.gz"} {
+	files := []string{"junit.failures"}
+	for _, rule := range a.rules {
+		files = append(files, rule.Filename, rule.Filename+".gz")
+	}
+	for _, file := range files {
 		_, ok := a.exists[file]
 		if ok {
 			continue
 		}
-		if err := os.Chtimes(filepath.Join(a.path, file), at, at); err != nil && !os.IsNotExist(err) {
-			klog.Errorf("Unable to set modification time of %s to %d: %v", file, a.finished, err)
+		if err := os.Chtimes(filepath.Join(a.path, file), at, at); err != nil {
+			if !os.IsNotExist(err) {
+				klog.Errorf("Unable to set modification time of %s to %d: %v", file, a.finished, err)
+			}
+			continue
 		}
+		a.written = append(a.written, filepath.Join(a.path, file))
 	}
 }
 
+// Written returns the paths of the files saved for the run once it finished.
+func (a *LogAccumulator) Written() []string {
+	return a.written
+}
+
 func (a *LogAccumulator) Started() int64 {
 	return a.started
 }
@@ -426,8 +479,7 @@ func (a *LogAccumulator) downloadIfMissing(ctx context.Context, artifact *storag
 		w = gzip.NewWriter(w)
 	}
 
-	h := a.build.Bucket.Object(artifact.Name)
-	r, err := h.NewReader(ctx)
+	r, err := a.build.Bucket.NewRangeReader(ctx, artifact.Name, 0, -1)
 	if err != nil {
 		w.Close()
 		os.Remove(f.Name())
@@ -448,16 +500,47 @@ func (a *LogAccumulator) downloadIfMissing(ctx context.Context, artifact *storag
 	return nil
 }
 
-func (a *LogAccumulator) downloadIfMissingTail(ctx context.Context, artifact *storage.ObjectAttrs, base string, length int64) error {
+// downloadArtifacts saves the artifacts matching rule into a single file
+// unless it already exists. When the rule can match more than one artifact
+// each one is preceded by a line with its path.
+func (a *LogAccumulator) downloadArtifacts(ctx context.Context, rule ArtifactRule, artifacts []*storage.ObjectAttrs) error {
+	base := rule.Filename
 	for _, s := range []string{base, base + ".gz"} {
 		if _, ok := a.exists[s]; ok {
 			return nil
 		}
 	}
+
+	var size int64
+	selected := artifacts[:0]
+	for _, artifact := range artifacts {
+		if artifact.Size < 0 {
+			// some sources only report the size of an artifact on request
+			attrs, err := a.build.Bucket.Attrs(ctx, artifact.Name)
+			if err != nil {
+				return err
+			}
+			artifact = attrs
+		}
+		if rule.MaxBytes > 0 && artifact.Size > rule.MaxBytes {
+			klog.V(4).Infof("Skipped %s because it is larger than %d bytes", artifact.Name, rule.MaxBytes)
+			continue
+		}
+		selected = append(selected, artifact)
+		if rule.TailBytes > 0 && artifact.Size > rule.TailBytes {
+			size += rule.TailBytes
+		} else {
+			size += artifact.Size
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
 	if err := os.MkdirAll(a.path, 0755); err != nil {
 		return err
 	}
-	if artifact.Size > 1*1024*1024 {
+	if size > 1*1024*1024 {
 		base += ".gz"
 	}
 	f, err := os.Create(filepath.Join(a.path, base))
@@ -465,30 +548,38 @@ func (a *LogAccumulator) downloadIfMissingTail(ctx context.Context, artifact *st
 		return err
 	}
 	var w io.WriteCloser = f
-	if artifact.Size > 1*1024*1024 {
+	if size > 1*1024*1024 {
 		w = gzip.NewWriter(w)
 	}
 
-	h := a.build.Bucket.Object(artifact.Name)
-
-	var r *storage.Reader
-	r, err = h.NewRangeReader(ctx, -length, -1)
-	if err != nil {
-		w.Close()
-		os.Remove(f.Name())
-		return err
-	}
-	defer r.Close()
-	if _, err := io.Copy(w, r); err != nil {
-		w.Close()
-		os.Remove(f.Name())
-		return err
+	for _, artifact := range selected {
+		if rule.hasWildcards() {
+			fmt.Fprintf(w, "\n\n# %s\n", strings.TrimPrefix(artifact.Name, a.build.Prefix))
+		}
+		var r io.ReadCloser
+		if rule.TailBytes > 0 && (artifact.Size < 0 || artifact.Size > rule.TailBytes) {
+			r, err = a.build.Bucket.NewRangeReader(ctx, artifact.Name, -rule.TailBytes, -1)
+		} else {
+			r, err = a.build.Bucket.NewRangeReader(ctx, artifact.Name, 0, -1)
+		}
+		if err != nil {
+			w.Close()
+			os.Remove(f.Name())
+			return err
+		}
+		n, err := io.Copy(w, r)
+		r.Close()
+		metricDownloadedBytes.Add(float64(n))
+		if err != nil {
+			w.Close()
+			os.Remove(f.Name())
+			return err
+		}
 	}
 	if err := w.Close(); err != nil {
 		os.Remove(f.Name())
 		return err
 	}
-	metricDownloadedBytes.Add(float64(length))
 	return nil
 }
 
@@ -497,32 +588,42 @@ func (a *LogAccumulator) Artifacts(ctx context.Context, artifacts <-chan *storag
 	ec := make(chan error)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	matched := make([][]*storage.ObjectAttrs, len(a.rules))
 	for art := range artifacts {
 		var rel string
 		if strings.HasPrefix(art.Name, a.build.Prefix) {
 			rel = art.Name[len(a.build.Prefix):]
 		}
-		switch {
-		case rel == "build-log.txt":
-			wg.Add(1)
-			go func(art *storage.ObjectAttrs) {
-				defer wg.Done()
-				// if we can't get metadata, haven't finished, or haven't failed, don't download build log
-				if !a.waitMetadata(ctx) || a.succeeded || a.finished == 0 {
-					return
-				}
-				if err := a.downloadIfMissingTail(ctx, art, "build-log.txt", 20*1024*1024); err != nil {
-					log.Printf("error: Unable to download %s: %v", art.Name, err)
-					select {
-					case <-ctx.Done():
-					case ec <- err:
-					}
-				}
-			}(art)
-		default:
-			unprocessedArtifacts <- art
+		for i := range a.rules {
+			if len(rel) > 0 && a.rules[i].Matches(rel) {
+				matched[i] = append(matched[i], art)
+				break
+			}
+		}
+		// JUnit suites are parsed even when a rule also captures them
+		unprocessedArtifacts <- art
+	}
+
+	for i, arts := range matched {
+		if len(arts) == 0 {
 			continue
 		}
+		wg.Add(1)
+		go func(rule ArtifactRule, arts []*storage.ObjectAttrs) {
+			defer wg.Done()
+			// if we can't get metadata or haven't finished, don't download artifacts, and
+			// only download those of passing runs if the rule asks for them
+			if !a.waitMetadata(ctx) || a.finished == 0 || (a.succeeded && !rule.IncludePassing) {
+				return
+			}
+			if err := a.downloadArtifacts(ctx, rule, arts); err != nil {
+				log.Printf("error: Unable to download %s artifacts of %s: %v", rule.Name, a.build.Prefix, err)
+				select {
+				case <-ctx.Done():
+				case ec <- err:
+				}
+			}
+		}(a.rules[i], arts)
 	}
 
 	go func() {
@@ -0,0 +1,57 @@
+package prow
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// JobSnapshotFile is the name of the file the known jobs are saved to so that
+// they are not lost when the process restarts.
+const JobSnapshotFile = "prowjobs.json.gz"
+
+// WriteJobSnapshot replaces the snapshot at path with jobs.
+func WriteJobSnapshot(path string, jobs []*Job) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		if err := json.NewEncoder(gz).Encode(&JobList{Items: jobs}); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+}
+
+// ReadJobSnapshot returns the jobs in the snapshot at path that completed
+// within maxAge, or no jobs if there is no snapshot. A zero maxAge keeps every
+// job.
+func ReadJobSnapshot(path string, maxAge time.Duration) ([]*Job, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var list JobList
+	if err := json.NewDecoder(gz).Decode(&list); err != nil {
+		return nil, err
+	}
+	if maxAge == 0 {
+		return list.Items, nil
+	}
+	expires := time.Now().Add(-maxAge)
+	jobs := list.Items[:0]
+	for _, job := range list.Items {
+		if !jobExpired(job, expires) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
@@ -0,0 +1,132 @@
+package prow
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestJobSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	newJob := func(name, state string, completed time.Time) *Job {
+		return &Job{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       JobSpec{Job: "job"},
+			Status:     JobStatus{State: state, BuildID: name, CompletionTime: metav1.Time{Time: completed}},
+		}
+	}
+	path := filepath.Join(dir, JobSnapshotFile)
+	if jobs, err := ReadJobSnapshot(path, time.Hour); err != nil || jobs != nil {
+		t.Fatalf("expected no jobs without a snapshot: %v %v", jobs, err)
+	}
+	if err := WriteJobSnapshot(path, []*Job{
+		newJob("1", "failure", now.Add(-30*time.Minute)),
+		newJob("2", "success", now.Add(-2*time.Hour)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := ReadJobSnapshot(path, time.Hour)
+	if err != nil || len(snapshot) != 1 || snapshot[0].Name != "1" {
+		t.Fatalf("unexpected snapshot: %#v %v", snapshot, err)
+	}
+
+	// restored jobs are kept when the informer first lists the live jobs
+	live := ListerFunc(func(ctx context.Context) ([]*Job, error) {
+		return []*Job{newJob("3", "success", now.Add(-time.Minute))}, nil
+	})
+	informer := NewInformer(time.Minute, time.Hour, time.Hour, ListerFunc(func(ctx context.Context) ([]*Job, error) {
+		return snapshot, nil
+	}), live)
+	lister := NewLister(informer.GetIndexer())
+	for _, job := range snapshot {
+		if err := informer.GetIndexer().Add(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := lister.JobStats("job", nil, now.Add(-time.Hour), now); stats.Count != 1 || stats.Failures != 1 {
+		t.Errorf("unexpected stats before the first list: %#v", stats)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		t.Fatal("informer did not sync")
+	}
+	jobs, err := lister.List(labels.Everything())
+	if err != nil || len(jobs) != 2 {
+		t.Errorf("unexpected jobs after the first list: %d %v", len(jobs), err)
+	}
+}
+
+func TestJobSnapshot_rescan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	states := map[string]string{"1": "success", "2": "failed", "3": "success"}
+	scan := func(runs ...string) []*Job {
+		var jobs []*Job
+		for _, run := range runs {
+			job, ok := indexedJob(Job{Spec: JobSpec{Job: "job"}, Status: JobStatus{BuildID: run}}, &storage.ObjectAttrs{Metadata: map[string]string{
+				"state":     states[run],
+				"completed": strconv.FormatInt(now.Add(-time.Minute).Unix(), 10),
+			}})
+			if !ok {
+				t.Fatalf("run %s was not indexed", run)
+			}
+			jobs = append(jobs, job)
+		}
+		return jobs
+	}
+
+	path := filepath.Join(dir, JobSnapshotFile)
+	if err := WriteJobSnapshot(path, scan("1", "2")); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := ReadJobSnapshot(path, time.Hour)
+	if err != nil || len(snapshot) != 2 {
+		t.Fatalf("unexpected snapshot: %#v %v", snapshot, err)
+	}
+
+	// after a restart the index is scanned again and lists the runs in a
+	// different order, which must not replace or duplicate restored runs
+	informer := NewInformer(time.Minute, time.Hour, time.Hour, ListerFunc(func(ctx context.Context) ([]*Job, error) {
+		return append(append([]*Job{}, snapshot...), scan("2", "3")...), nil
+	}), ListerFunc(func(ctx context.Context) ([]*Job, error) {
+		return nil, nil
+	}))
+	lister := NewLister(informer.GetIndexer())
+	for _, job := range snapshot {
+		if err := informer.GetIndexer().Add(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		t.Fatal("informer did not sync")
+	}
+	if stats := lister.JobStats("job", nil, now.Add(-time.Hour), now); stats.Count != 3 || stats.Failures != 1 {
+		t.Errorf("unexpected stats after the rescan: %#v", stats)
+	}
+}
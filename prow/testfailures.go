@@ -0,0 +1,195 @@
+package prow
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/openshift/ci-search/pkg/signature"
+	"github.com/openshift/ci-search/testgrid/metadata/junit"
+)
+
+// TestFailuresFile is the name of the file in each job run directory that
+// records the tests that failed in the run, one JSON TestFailure per line.
+const TestFailuresFile = "junit.tests"
+
+// TestResultsFile is the name of the file in each job run directory that
+// records the tests that passed or were skipped in the run as a JSON
+// TestResults. Together with TestFailuresFile it describes every test the run
+// reported.
+const TestResultsFile = "junit.results"
+
+// TestFailure describes a single failed test in a job run.
+type TestFailure struct {
+	// Suite is the name of the suite the test belongs to. It is empty if the
+	// test name already includes the suite.
+	Suite string `json:"suite,omitempty"`
+	// Name is the name of the test.
+	Name string `json:"name"`
+	// Duration is how long the test ran in seconds.
+	Duration float64 `json:"duration,omitempty"`
+	// MessageHash identifies the failure message so that tests that fail the
+	// same way can be grouped.
+	MessageHash string `json:"messageHash,omitempty"`
+	// Signature is the first line of the failure message with the parts that
+	// vary between occurrences of the same failure masked.
+	Signature string `json:"signature,omitempty"`
+}
+
+// TestFailuresFromSuites returns the tests that failed in suites.
+func TestFailuresFromSuites(suites junit.Suites) []TestFailure {
+	var failures []TestFailure
+	for _, suite := range suites.Suites {
+		for _, test := range suite.Results {
+			var message string
+			switch {
+			case test.Failure != nil:
+				message = *test.Failure
+			case test.Error != nil:
+				message = *test.Error
+			default:
+				continue
+			}
+			failure := TestFailure{
+				Name:        test.Name,
+				Duration:    test.Time,
+				MessageHash: messageHash(message),
+				Signature:   signature.FirstLine(message),
+			}
+			// matches the naming used in junit.failures
+			if !suites.Unwrapped {
+				failure.Suite = suite.Name
+			}
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+func messageHash(message string) string {
+	h := fnv.New64a()
+	h.Write([]byte(message))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// WriteTestFailures atomically writes failures to path.
+func WriteTestFailures(path string, failures []TestFailure) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for i := range failures {
+			if err := enc.Encode(&failures[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeFileAtomic writes the output of fn to a temporary file that replaces
+// path once it is complete.
+func writeFileAtomic(path string, fn func(w io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := fn(w); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// ReadTestFailures reads the failures recorded in path.
+func ReadTestFailures(path string) ([]TestFailure, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var failures []TestFailure
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var failure TestFailure
+		if err := dec.Decode(&failure); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		failures = append(failures, failure)
+	}
+	return failures, nil
+}
+
+// TestResults lists the names of the tests that passed or were skipped in a
+// job run, keyed by suite. The suite is empty if the test name already
+// includes it.
+type TestResults struct {
+	Passed  map[string][]string `json:"passed,omitempty"`
+	Skipped map[string][]string `json:"skipped,omitempty"`
+	// Succeeded is true if the run passed.
+	Succeeded bool `json:"succeeded,omitempty"`
+}
+
+// AddSuites records the tests in suites that passed or were skipped.
+func (r *TestResults) AddSuites(suites junit.Suites) {
+	for _, suite := range suites.Suites {
+		// matches the naming used in junit.failures
+		var name string
+		if !suites.Unwrapped {
+			name = suite.Name
+		}
+		for _, test := range suite.Results {
+			switch {
+			case test.Failure != nil, test.Error != nil:
+			case test.Skipped != nil:
+				if r.Skipped == nil {
+					r.Skipped = make(map[string][]string)
+				}
+				r.Skipped[name] = append(r.Skipped[name], test.Name)
+			default:
+				if r.Passed == nil {
+					r.Passed = make(map[string][]string)
+				}
+				r.Passed[name] = append(r.Passed[name], test.Name)
+			}
+		}
+	}
+}
+
+// WriteTestResults atomically writes results to path.
+func WriteTestResults(path string, results *TestResults) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(results)
+	})
+}
+
+// ReadTestResults reads the results recorded in path.
+func ReadTestResults(path string) (*TestResults, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results TestResults
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &results, nil
+}
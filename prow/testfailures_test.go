@@ -0,0 +1,111 @@
+package prow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/openshift/ci-search/testgrid/metadata/junit"
+)
+
+func TestTestFailures(t *testing.T) {
+	failure, other := "\ntimeout after 30s\nstack", "expected 1"
+	suites := junit.Suites{
+		Suites: []junit.Suite{
+			{
+				Name: "e2e",
+				Results: []junit.Result{
+					{Name: "passes", Time: 1},
+					{Name: "fails", Time: 2.5, Failure: &failure},
+					{Name: "errors", Error: &other},
+				},
+			},
+		},
+	}
+	failures := TestFailuresFromSuites(suites)
+	if len(failures) != 2 || failures[0].Suite != "e2e" || failures[0].Name != "fails" || failures[0].Duration != 2.5 || failures[1].Name != "errors" {
+		t.Fatalf("unexpected failures: %#v", failures)
+	}
+	if failures[0].MessageHash == failures[1].MessageHash || len(failures[0].MessageHash) != 16 {
+		t.Fatalf("unexpected message hashes: %#v", failures)
+	}
+	if failures[0].Signature != "timeout after <duration>" || failures[1].Signature != "expected <n>" {
+		t.Fatalf("unexpected signatures: %#v", failures)
+	}
+
+	suites.Unwrapped = true
+	if unwrapped := TestFailuresFromSuites(suites); unwrapped[0].Suite != "" {
+		t.Fatalf("unwrapped suites should not set the suite: %#v", unwrapped)
+	}
+
+	dir, err := ioutil.TempDir("", "tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, TestFailuresFile)
+	if err := WriteTestFailures(path, failures); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadTestFailures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, failures) {
+		t.Errorf("got %#v, want %#v", read, failures)
+	}
+
+	// a run without failures is recorded as an empty file
+	if err := WriteTestFailures(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := ReadTestFailures(path); err != nil || len(read) != 0 {
+		t.Errorf("unexpected failures %#v: %v", read, err)
+	}
+}
+
+func TestTestResults(t *testing.T) {
+	failure, skipped := "failed", "skipped"
+	suites := junit.Suites{
+		Suites: []junit.Suite{
+			{
+				Name: "e2e",
+				Results: []junit.Result{
+					{Name: "passes"},
+					{Name: "fails", Failure: &failure},
+					{Name: "skips", Skipped: &skipped},
+				},
+			},
+		},
+	}
+	var results TestResults
+	results.AddSuites(suites)
+	suites.Unwrapped = true
+	results.AddSuites(suites)
+	want := TestResults{
+		Passed:  map[string][]string{"e2e": {"passes"}, "": {"passes"}},
+		Skipped: map[string][]string{"e2e": {"skips"}, "": {"skips"}},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Fatalf("got %#v, want %#v", results, want)
+	}
+
+	dir, err := ioutil.TempDir("", "tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, TestResultsFile)
+	if err := WriteTestResults(path, &results); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadTestResults(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*read, want) {
+		t.Errorf("got %#v, want %#v", read, want)
+	}
+}
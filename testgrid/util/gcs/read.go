@@ -20,6 +20,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"regexp"
@@ -49,16 +50,72 @@ type Finished struct {
 	Running bool
 }
 
-// Build points to a build stored under a particular gcs prefix.
+// Bucket lists and reads the objects builds are stored in. Implementations
+// return storage.ErrObjectNotExist for objects that do not exist and report a
+// negative size for objects whose size is not known until they are read.
+type Bucket interface {
+	// String identifies the bucket in messages, such as gs://bucket.
+	String() string
+	// Objects calls fn with the name and size of every object under prefix.
+	Objects(ctx context.Context, prefix string, fn func(*storage.ObjectAttrs) error) error
+	// Attrs returns the name and size of the named object.
+	Attrs(ctx context.Context, name string) (*storage.ObjectAttrs, error)
+	// NewRangeReader reads length bytes of the named object from offset. A
+	// negative offset reads the last -offset bytes and a negative length
+	// reads to the end of the object.
+	NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+}
+
+// NewBucket returns a Bucket that reads the named GCS bucket.
+func NewBucket(bucket *storage.BucketHandle, name string) Bucket {
+	return gcsBucket{bucket: bucket, name: name}
+}
+
+type gcsBucket struct {
+	bucket *storage.BucketHandle
+	name   string
+}
+
+func (b gcsBucket) String() string {
+	return "gs://" + b.name
+}
+
+func (b gcsBucket) Objects(ctx context.Context, prefix string, fn func(*storage.ObjectAttrs) error) error {
+	query := &storage.Query{Prefix: prefix}
+	query.SetAttrSelection([]string{"Name", "Size"})
+	objs := b.bucket.Objects(ctx, query)
+	for {
+		obj, err := objs.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+}
+
+func (b gcsBucket) Attrs(ctx context.Context, name string) (*storage.ObjectAttrs, error) {
+	return b.bucket.Object(name).Attrs(ctx)
+}
+
+func (b gcsBucket) NewRangeReader(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	return b.bucket.Object(name).NewRangeReader(ctx, offset, length)
+}
+
+// Build points to a build stored under a particular prefix of a bucket.
 type Build struct {
-	Bucket     *storage.BucketHandle
+	Bucket     Bucket
 	Context    context.Context
 	Prefix     string
 	BucketPath string
 }
 
 func (build Build) String() string {
-	return "gs://" + build.BucketPath + "/" + build.Prefix
+	return build.Bucket.String() + "/" + build.Prefix
 }
 
 // Builds is a slice of builds.
@@ -80,6 +137,7 @@ func ListBuilds(ctx context.Context, client *storage.Client, path Path) (Builds,
 		p += "/"
 	}
 	bkt := client.Bucket(path.Bucket())
+	bucket := NewBucket(bkt, path.Bucket())
 	it := bkt.Objects(ctx, &storage.Query{
 		Delimiter: "/",
 		Prefix:    p,
@@ -114,7 +172,7 @@ func ListBuilds(ctx context.Context, client *storage.Client, path Path) (Builds,
 				return nil, fmt.Errorf("could not make GCS path for key %s: %v", objAttrs.Name, err)
 			}
 			all = append(all, Build{
-				Bucket:     bkt,
+				Bucket:     bucket,
 				Context:    ctx,
 				Prefix:     linkPath.Object(),
 				BucketPath: path.Bucket(),
@@ -127,7 +185,7 @@ func ListBuilds(ctx context.Context, client *storage.Client, path Path) (Builds,
 		}
 
 		all = append(all, Build{
-			Bucket:     bkt,
+			Bucket:     bucket,
 			Context:    ctx,
 			Prefix:     objAttrs.Prefix,
 			BucketPath: path.Bucket(),
@@ -178,15 +236,16 @@ func parseSuitesMeta(obj *storage.ObjectAttrs) map[string]string {
 	}
 }
 
-// readJSON will decode the json object stored in GCS.
-func readJSON(ctx context.Context, obj *storage.ObjectHandle, i interface{}) error {
-	reader, err := obj.NewReader(ctx)
+// readJSON will decode the json object stored in the bucket.
+func readJSON(ctx context.Context, bucket Bucket, name string, i interface{}) error {
+	reader, err := bucket.NewRangeReader(ctx, name, 0, -1)
 	if err == storage.ErrObjectNotExist {
 		return err
 	}
 	if err != nil {
 		return fmt.Errorf("open: %v", err)
 	}
+	defer reader.Close()
 	if err = json.NewDecoder(reader).Decode(i); err != nil {
 		return fmt.Errorf("decode: %v", err)
 	}
@@ -197,7 +256,7 @@ func readJSON(ctx context.Context, obj *storage.ObjectHandle, i interface{}) err
 func (build Build) Started() (*Started, error) {
 	uri := build.Prefix + "started.json"
 	var started Started
-	err := readJSON(build.Context, build.Bucket.Object(uri), &started)
+	err := readJSON(build.Context, build.Bucket, uri, &started)
 	if err == storage.ErrObjectNotExist {
 		started.Pending = true
 		return &started, nil
@@ -212,7 +271,7 @@ func (build Build) Started() (*Started, error) {
 func (build Build) Finished() (*Finished, error) {
 	uri := build.Prefix + "finished.json"
 	var finished Finished
-	err := readJSON(build.Context, build.Bucket.Object(uri), &finished)
+	err := readJSON(build.Context, build.Bucket, uri, &finished)
 	if err == storage.ErrObjectNotExist {
 		finished.Running = true
 		return &finished, nil
@@ -226,32 +285,23 @@ func (build Build) Finished() (*Finished, error) {
 // Artifacts writes the object name of all paths under the build's artifact dir to the output channel.
 func (build Build) Artifacts(artifacts chan<- *storage.ObjectAttrs) error {
 	pref := build.Prefix
-	query := &storage.Query{Prefix: pref}
-	query.SetAttrSelection([]string{"Name", "Size"})
-	objs := build.Bucket.Objects(build.Context, query)
-	for {
-		obj, err := objs.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("failed to list %s: %v", pref, err)
-		}
+	return build.Bucket.Objects(build.Context, pref, func(obj *storage.ObjectAttrs) error {
 		select {
 		case <-build.Context.Done():
 			return fmt.Errorf("interrupted listing %s", pref)
 		case artifacts <- obj:
+			return nil
 		}
-	}
-	return nil
+	})
 }
 
 // readSuites parses the <testsuite> or <testsuites> object in obj
-func readSuites(ctx context.Context, obj *storage.ObjectHandle) (*junit.Suites, error) {
-	reader, err := obj.NewReader(ctx)
+func readSuites(ctx context.Context, bucket Bucket, name string) (*junit.Suites, error) {
+	reader, err := bucket.NewRangeReader(ctx, name, 0, -1)
 	if err != nil {
 		return nil, fmt.Errorf("open: %v", err)
 	}
+	defer reader.Close()
 
 	buf, err := ioutil.ReadAll(reader)
 	if err != nil {
@@ -290,7 +340,7 @@ func (build Build) Suites(artifacts <-chan *storage.ObjectAttrs, suites chan<- S
 		// each takes a non-trivial amount of time waiting for the network.
 		go func(art string, _ map[string]string) {
 			defer wg.Done()
-			suitesData, err := readSuites(ctx, build.Bucket.Object(art))
+			suitesData, err := readSuites(ctx, build.Bucket, art)
 			if err != nil {
 				select {
 				case <-ctx.Done():
@@ -301,7 +351,7 @@ func (build Build) Suites(artifacts <-chan *storage.ObjectAttrs, suites chan<- S
 			out := SuitesMeta{
 				Suites: *suitesData,
 				//Metadata: meta,
-				Path: "gs://" + build.BucketPath + "/" + art,
+				Path: build.Bucket.String() + "/" + art,
 			}
 			select {
 			case <-ctx.Done():